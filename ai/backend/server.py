@@ -1,9 +1,21 @@
 # Flask server to load and train MLP model and predict maliciousness score
 
 # Required Libraries
+import math
+import os
+
 from flask import Flask, request, jsonify
 from models.MLPRegressor import MaliciousnessPredictor
 
+# Version of the request/response contract shared with the Go backend
+# (models.PredictionSchemaVersion); bump both together
+SCHEMA_VERSION = 1
+MODEL_NAME = 'mlp_regressor'
+MODEL_VERSION = os.environ.get('MODEL_VERSION', 'unversioned')
+# Model inputs in training order; the Go backend checks at startup that they
+# are enabled (services.RemoteModelFeatures)
+FEATURES = ['total_access_count', 'honeytoken_access_count', 'shared_ip_count', 'avg_associated_malicious_score']
+
 # Initialize Flask app
 app = Flask(__name__)
 
@@ -16,15 +28,29 @@ predictor.train_model()
 def predict():
     # Get features from request
     features = request.get_json()
-    print(features)
-    total_access_count = features['total_access_count']
-    honeytoken_access_count = features['honeytoken_access_count']
-    shared_ip_count = features['shared_ip_count']
-    avg_associated_malicious_score = features['avg_associated_malicious_score']
+    if features.get('schema_version') != SCHEMA_VERSION:
+        return jsonify({'error': 'unsupported schema_version, expected %d' % SCHEMA_VERSION}), 400
+    missing = [name for name in FEATURES if name not in features]
+    if missing:
+        return jsonify({'error': 'missing features: %s' % ', '.join(missing), 'missing': missing}), 400
 
     # Predict maliciousness score
-    predicted_maliciousness = predictor.predict_maliciousness([total_access_count, honeytoken_access_count, shared_ip_count, avg_associated_malicious_score])
-    return jsonify({'maliciousness_score': predicted_maliciousness})
+    predicted_maliciousness = float(predictor.predict_maliciousness([features[name] for name in FEATURES]))
+    if math.isnan(predicted_maliciousness):
+        return jsonify({'error': 'model returned NaN'}), 500
+    return jsonify({
+        'schema_version': SCHEMA_VERSION,
+        'maliciousness_score': predicted_maliciousness,
+        'model_name': MODEL_NAME,
+        'model_version': MODEL_VERSION,
+        'score_min': 0.0,
+        'score_max': 1.0,
+    })
+
+# Health check used by the Go backend's readiness probe
+@app.route('/health', methods=['GET'])
+def health():
+    return jsonify({'status': 'ok'})
 
 # Run Flask app
 if __name__ == '__main__':
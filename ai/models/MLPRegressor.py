@@ -7,8 +7,9 @@ from sklearn.preprocessing import MinMaxScaler
 import numpy as np
 
 class MaliciousnessPredictor:
-    def __init__(self, data_file):
+    def __init__(self, data_file, hidden_layer_sizes=(100, 50)):
         self.data_file = data_file
+        self.hidden_layer_sizes = hidden_layer_sizes
         self.model = None 
         self.scaler = None 
         self.target_scaler = None  # New scaler for y
@@ -33,7 +34,7 @@ class MaliciousnessPredictor:
         X_train, X_test, y_train, y_test = train_test_split(X, y, test_size=0.2, random_state=42)
 
         # Train neural network model
-        self.model = MLPRegressor(hidden_layer_sizes=(100, 50), max_iter=1000, random_state=42)
+        self.model = MLPRegressor(hidden_layer_sizes=self.hidden_layer_sizes, max_iter=1000, random_state=42)
         self.model.fit(X_train, y_train)
 
     def predict_maliciousness(self, features):
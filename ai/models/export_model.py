@@ -0,0 +1,85 @@
+# Exports a trained MaliciousnessPredictor as JSON so the Go backend can run
+# inference in process (see backend/services/mlp_scorer.go)
+
+# Required Libraries
+import argparse
+import json
+from datetime import datetime, timezone
+
+import numpy as np
+
+from models.MLPRegressor import MaliciousnessPredictor
+
+FORMAT_VERSION = 1
+FEATURE_NAMES = [
+    'total_access_count',
+    'honeytoken_access_count',
+    'shared_ip_count',
+    'avg_associated_malicious_score',
+]
+
+# Export layer weights, biases, activations and the fitted scalers, plus
+# reference predictions for the Go parity test
+def export_model(predictor, data_file, model_version, reference_count):
+    model = predictor.model
+    layers = [
+        {'weights': coefs.tolist(), 'biases': intercepts.tolist()}
+        for coefs, intercepts in zip(model.coefs_, model.intercepts_)
+    ]
+
+    data = np.loadtxt(data_file, delimiter=',', skiprows=1)
+    reference = [
+        {'features': row[:-1].tolist(), 'prediction': float(predictor.predict_maliciousness(row[:-1].tolist()))}
+        for row in data[:reference_count]
+    ]
+
+    return {
+        'format_version': FORMAT_VERSION,
+        'model_version': model_version,
+        'feature_names': FEATURE_NAMES,
+        'activation': model.activation,
+        'output_activation': model.out_activation_,
+        'input_scaler': {'scale': predictor.scaler.scale_.tolist(), 'min': predictor.scaler.min_.tolist()},
+        'target_scaler': {'scale': predictor.target_scaler.scale_.tolist(), 'min': predictor.target_scaler.min_.tolist()},
+        'layers': layers,
+        'clip': [0.0, 1.0],
+        'reference': reference,
+    }
+
+# Predict rows of the data file, and rows outside its range that exercise
+# clipping, with model.predict for the Go test fixture
+def export_predictions(predictor, data_file, count):
+    data = np.loadtxt(data_file, delimiter=',', skiprows=1)
+    features = data[:count, :-1]
+    features = np.vstack([features, features.min(axis=0) - 10, features.max(axis=0) * 10])
+    scaled = predictor.model.predict(predictor.scaler.transform(features))
+    predictions = predictor.target_scaler.inverse_transform(scaled.reshape(-1, 1)).ravel()
+    return [
+        {'features': row.tolist(), 'prediction': float(prediction)}
+        for row, prediction in zip(features, np.clip(predictions, 0, 1))
+    ]
+
+# Train the model and write the artifact
+if __name__ == '__main__':
+    parser = argparse.ArgumentParser(description='Export the MLP model for the Go backend')
+    parser.add_argument('--data', default='./models/data.csv')
+    parser.add_argument('--output', default='./models/mlp_model.json')
+    parser.add_argument('--version', default='mlp-' + datetime.now(timezone.utc).strftime('%Y%m%d%H%M%S'))
+    parser.add_argument('--reference-count', type=int, default=20)
+    parser.add_argument('--hidden-layers', default='100,50', help='Comma-separated hidden layer sizes')
+    parser.add_argument('--predictions', help='Also write model.predict outputs for the data file to this path')
+    args = parser.parse_args()
+
+    hidden_layers = tuple(int(size) for size in args.hidden_layers.split(','))
+    predictor = MaliciousnessPredictor(args.data, hidden_layers)
+    predictor.train_model()
+
+    artifact = export_model(predictor, args.data, args.version, args.reference_count)
+    with open(args.output, 'w') as output_file:
+        json.dump(artifact, output_file)
+    print('Exported model', args.version, 'to', args.output)
+
+    if args.predictions:
+        with open(args.predictions, 'w') as predictions_file:
+            json.dump(export_predictions(predictor, args.data, 100), predictions_file)
+        print('Wrote predictions to', args.predictions)
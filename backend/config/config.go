@@ -0,0 +1,695 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"backend/models"
+	"backend/utils"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config holds all settings of the backend
+type Config struct {
+	Log         LogConfig         `yaml:"log"`
+	Server      ServerConfig      `yaml:"server"`
+	Store       StoreConfig       `yaml:"store"`
+	Neo4j       Neo4jConfig       `yaml:"neo4j"`
+	AI          AIConfig          `yaml:"ai"`
+	Ingestion   IngestionConfig   `yaml:"ingestion"`
+	Health      HealthConfig      `yaml:"health"`
+	Scoring     ScoringConfig     `yaml:"scoring"`
+	Features    FeaturesConfig    `yaml:"features"`
+	Rescoring   RescoringConfig   `yaml:"rescoring"`
+	Risk        RiskConfig        `yaml:"risk_propagation"`
+	Communities CommunitiesConfig `yaml:"communities"`
+	Inference   InferenceConfig   `yaml:"association_inference"`
+	GeoIP       GeoIPConfig       `yaml:"geoip"`
+	Reputation  ReputationConfig  `yaml:"reputation"`
+}
+
+// LogConfig configures logging
+type LogConfig struct {
+	Level  string `yaml:"level"`  // "debug", "info", "warn" or "error"
+	Format string `yaml:"format"` // "text" or "json"
+}
+
+// ServerConfig configures the HTTP server
+type ServerConfig struct {
+	Port            int           `yaml:"port"`
+	ReadTimeout     time.Duration `yaml:"read_timeout"`     // Maximum time to read a request
+	WriteTimeout    time.Duration `yaml:"write_timeout"`    // Maximum time to write a response
+	IdleTimeout     time.Duration `yaml:"idle_timeout"`     // Maximum keep-alive idle time
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"` // Time allowed to drain requests and flush writes
+}
+
+// StoreConfig selects the graph store backend
+type StoreConfig struct {
+	Backend string `yaml:"backend"` // "neo4j" or "memory"
+}
+
+// Neo4jConfig configures the Neo4j connection
+type Neo4jConfig struct {
+	URI          string `yaml:"uri"`
+	Username     string `yaml:"username"`
+	Password     string `yaml:"password"`
+	PasswordFile string `yaml:"password_file"` // Read into Password when set
+}
+
+// AIConfig configures the AI model server
+type AIConfig struct {
+	ModelURL         string        `yaml:"model_url"`
+	Timeout          time.Duration `yaml:"timeout"`           // Deadline of a single prediction request
+	MaxRetries       int           `yaml:"max_retries"`       // Retries for network errors, 429 and 5xx
+	BaseBackoff      time.Duration `yaml:"base_backoff"`      // Backoff before the first retry
+	MaxBackoff       time.Duration `yaml:"max_backoff"`       // Upper bound of the backoff
+	BreakerThreshold int           `yaml:"breaker_threshold"` // Consecutive failures that open the circuit
+	BreakerCooldown  time.Duration `yaml:"breaker_cooldown"`  // Time the circuit stays open
+	MaxIdleConns     int           `yaml:"max_idle_conns"`    // Keep-alive connections to the model server
+}
+
+// IngestionConfig configures batching and the ingestion queue
+type IngestionConfig struct {
+	BatchSize      int           `yaml:"batch_size"`
+	FlushInterval  time.Duration `yaml:"flush_interval"`
+	QueueSize      int           `yaml:"queue_size"`
+	Workers        int           `yaml:"workers"`
+	MaxRetries     int           `yaml:"max_retries"`
+	BaseBackoff    time.Duration `yaml:"base_backoff"`
+	MaxBackoff     time.Duration `yaml:"max_backoff"`
+	ReplayInterval time.Duration `yaml:"replay_interval"`
+	RetryAfter     time.Duration `yaml:"retry_after"`
+	WALPath        string        `yaml:"wal_path"`
+}
+
+// HealthConfig configures dependency checks for /readyz and /status
+type HealthConfig struct {
+	Interval     time.Duration `yaml:"interval"`      // Time between dependency checks
+	CheckTimeout time.Duration `yaml:"check_timeout"` // Maximum duration of one check
+}
+
+// ScoringConfig configures how users are scored
+type ScoringConfig struct {
+	Model     string          `yaml:"model"`      // "remote" (the AI model server) or "mlp" (in process)
+	ModelPath string          `yaml:"model_path"` // Artifact exported by ai/models/export_model.py, for "mlp"
+	Fallback  bool            `yaml:"fallback"`   // Score with the heuristic when the model fails
+	Heuristic HeuristicConfig `yaml:"heuristic"`
+}
+
+// FeaturesConfig configures feature extraction
+type FeaturesConfig struct {
+	Windows []string `yaml:"windows"` // Lookback windows of the windowed features, e.g. 1h or 7d
+	Enabled []string `yaml:"enabled"` // Features sent to the model; empty enables the built-in features
+}
+
+// FeatureWindows parses Windows, shortest first
+func (c FeaturesConfig) FeatureWindows() ([]models.FeatureWindow, error) {
+	windows := make([]models.FeatureWindow, 0, len(c.Windows))
+	for _, value := range c.Windows {
+		window, err := models.ParseFeatureWindow(value)
+		if err != nil {
+			return nil, err
+		}
+		windows = append(windows, window)
+	}
+	return models.SortFeatureWindows(windows), nil
+}
+
+// RescoringConfig configures the background job re-scoring every user
+type RescoringConfig struct {
+	Interval       time.Duration `yaml:"interval"`        // Time between scheduled runs; 0 disables the schedule
+	Workers        int           `yaml:"workers"`         // Users analyzed concurrently
+	BatchSize      int           `yaml:"batch_size"`      // Users per checkpointed page
+	StaleOnly      bool          `yaml:"stale_only"`      // Scheduled runs skip users without new interactions since their score
+	CheckpointPath string        `yaml:"checkpoint_path"` // File a run's progress is saved to
+}
+
+// RiskConfig configures the risk propagation job
+type RiskConfig struct {
+	Interval      time.Duration `yaml:"interval"`       // Time between runs
+	Damping       float64       `yaml:"damping"`        // Share of a user's risk taken from its associates, in (0, 1)
+	Tolerance     float64       `yaml:"tolerance"`      // Convergence threshold on the largest change of a round
+	MaxIterations int           `yaml:"max_iterations"` // Rounds before giving up on convergence
+	SeedScore     float64       `yaml:"seed_score"`     // malicious_score from which a user is a seed
+}
+
+// CommunitiesConfig configures the community detection job
+type CommunitiesConfig struct {
+	Interval      time.Duration `yaml:"interval"`       // Time between runs
+	MaxIterations int           `yaml:"max_iterations"` // Passes over the users per Louvain level
+	MinSize       int           `yaml:"min_size"`       // Smallest cluster listed by /api/clusters
+}
+
+// InferenceConfig configures the association inference job and its rules
+type InferenceConfig struct {
+	Interval         time.Duration          `yaml:"interval"` // Time between runs
+	Lookback         time.Duration          `yaml:"lookback"` // Interactions older than this are not considered
+	SharedIP         SharedIPConfig         `yaml:"shared_ip"`
+	SharedHoneytoken SharedHoneytokenConfig `yaml:"shared_honeytoken"`
+	SimilarEndpoints SimilarEndpointsConfig `yaml:"similar_endpoints"`
+}
+
+// SharedIPConfig configures the rule associating users on the same IP
+type SharedIPConfig struct {
+	Enabled    bool          `yaml:"enabled"`
+	Window     time.Duration `yaml:"window"`     // Largest gap between the two users' interactions
+	MaxUsers   int           `yaml:"max_users"`  // IPs used by more users are ignored
+	Confidence float64       `yaml:"confidence"` // Confidence of a single shared IP
+}
+
+// SharedHoneytokenConfig configures the rule associating users who triggered the same honeytoken
+type SharedHoneytokenConfig struct {
+	Enabled    bool    `yaml:"enabled"`
+	MaxUsers   int     `yaml:"max_users"`  // Honeytokens triggered by more users are ignored
+	Confidence float64 `yaml:"confidence"` // Confidence of a single shared honeytoken
+}
+
+// SimilarEndpointsConfig configures the rule associating users with near-identical endpoint sequences
+type SimilarEndpointsConfig struct {
+	Enabled    bool    `yaml:"enabled"`
+	MinLength  int     `yaml:"min_length"` // Users with fewer interactions are not compared
+	MaxLength  int     `yaml:"max_length"` // Latest endpoints compared per user
+	MaxUsers   int     `yaml:"max_users"`  // Buckets of more candidate users are ignored
+	Similarity float64 `yaml:"similarity"` // Smallest similarity that counts, in (0, 1]
+	Confidence float64 `yaml:"confidence"` // Confidence of identical sequences
+}
+
+// GeoIPConfig configures offline GeoIP and ASN enrichment of interactions.
+// Enrichment is off unless at least one database is set.
+type GeoIPConfig struct {
+	CityDB         string        `yaml:"city_db"`         // MaxMind City or Country .mmdb file
+	ASNDB          string        `yaml:"asn_db"`          // MaxMind ASN .mmdb file
+	ReloadInterval time.Duration `yaml:"reload_interval"` // How often the files are checked for changes
+	HostingASNs    []int         `yaml:"hosting_asns"`    // ASNs of cloud and hosting providers; empty uses a built-in list
+}
+
+// ReputationConfig configures tagging interactions from the IP reputation
+// lists. Tagging is off unless a list is configured.
+type ReputationConfig struct {
+	ReloadInterval time.Duration          `yaml:"reload_interval"` // How often the lists are checked for changes
+	Lists          []ReputationListConfig `yaml:"lists"`
+}
+
+// ReputationListConfig is one reputation list file
+type ReputationListConfig struct {
+	Path          string   `yaml:"path"`
+	Category      string   `yaml:"category"`       // Tag of interactions from the listed networks, e.g. tor
+	Format        string   `yaml:"format"`         // "text" or "csv"; empty picks csv for .csv files
+	RowCategories []string `yaml:"row_categories"` // Further categories the second column of a CSV list may use
+}
+
+// HeuristicConfig weights the features of the fallback heuristic scorer.
+// Counts are divided by their cap and clamped to 1 before weighting.
+type HeuristicConfig struct {
+	TotalAccess     float64 `yaml:"total_access"`
+	HoneytokenRatio float64 `yaml:"honeytoken_ratio"`
+	SharedIP        float64 `yaml:"shared_ip"`
+	AssociatedScore float64 `yaml:"associated_score"`
+	TotalAccessCap  float64 `yaml:"total_access_cap"`
+	SharedIPCap     float64 `yaml:"shared_ip_cap"`
+}
+
+// Default returns the configuration used when nothing is overridden
+func Default() Config {
+	return Config{
+		Log: LogConfig{Level: "info", Format: "text"},
+		Server: ServerConfig{
+			Port:            8080,
+			ReadTimeout:     15 * time.Second,
+			WriteTimeout:    60 * time.Second,
+			IdleTimeout:     120 * time.Second,
+			ShutdownTimeout: 25 * time.Second,
+		},
+		Store: StoreConfig{Backend: "neo4j"},
+		Neo4j: Neo4jConfig{
+			URI:      "bolt://localhost:7687",
+			Username: "neo4j",
+		},
+		AI: AIConfig{
+			ModelURL:         "http://127.0.0.1:5000",
+			Timeout:          5 * time.Second,
+			MaxRetries:       2,
+			BaseBackoff:      100 * time.Millisecond,
+			MaxBackoff:       2 * time.Second,
+			BreakerThreshold: 5,
+			BreakerCooldown:  30 * time.Second,
+			MaxIdleConns:     32,
+		},
+		Ingestion: IngestionConfig{
+			BatchSize:      500,
+			FlushInterval:  time.Second,
+			QueueSize:      10000,
+			Workers:        4,
+			MaxRetries:     3,
+			BaseBackoff:    100 * time.Millisecond,
+			MaxBackoff:     5 * time.Second,
+			ReplayInterval: 10 * time.Second,
+			RetryAfter:     time.Second,
+			WALPath:        "data/ingestion.wal",
+		},
+		Health: HealthConfig{
+			Interval:     10 * time.Second,
+			CheckTimeout: 2 * time.Second,
+		},
+		Scoring: ScoringConfig{
+			Model:    "remote",
+			Fallback: true,
+			Heuristic: HeuristicConfig{
+				TotalAccess:     0.4,
+				HoneytokenRatio: 0.3,
+				SharedIP:        0.2,
+				AssociatedScore: 0.1,
+				TotalAccessCap:  100,
+				SharedIPCap:     10,
+			},
+		},
+		Features: FeaturesConfig{
+			Windows: []string{"1h", "24h", "7d"},
+		},
+		Rescoring: RescoringConfig{
+			Interval:       time.Hour,
+			Workers:        4,
+			BatchSize:      100,
+			StaleOnly:      true,
+			CheckpointPath: "data/rescoring.checkpoint",
+		},
+		Risk: RiskConfig{
+			Interval:      15 * time.Minute,
+			Damping:       0.85,
+			Tolerance:     1e-6,
+			MaxIterations: 100,
+			SeedScore:     0.8,
+		},
+		Communities: CommunitiesConfig{
+			Interval:      15 * time.Minute,
+			MaxIterations: 50,
+			MinSize:       2,
+		},
+		Inference: InferenceConfig{
+			Interval: 10 * time.Minute,
+			Lookback: 24 * time.Hour,
+			SharedIP: SharedIPConfig{
+				Enabled:    true,
+				Window:     10 * time.Minute,
+				MaxUsers:   20,
+				Confidence: 0.5,
+			},
+			SharedHoneytoken: SharedHoneytokenConfig{
+				Enabled:    true,
+				MaxUsers:   50,
+				Confidence: 0.9,
+			},
+			SimilarEndpoints: SimilarEndpointsConfig{
+				Enabled:    true,
+				MinLength:  10,
+				MaxLength:  50,
+				MaxUsers:   50,
+				Similarity: 0.9,
+				Confidence: 0.7,
+			},
+		},
+		GeoIP: GeoIPConfig{
+			ReloadInterval: time.Minute,
+		},
+		Reputation: ReputationConfig{
+			ReloadInterval: 10 * time.Minute,
+		},
+	}
+}
+
+// setting is a value that can be overridden by an environment variable or a flag
+type setting struct {
+	env   string
+	flag  string
+	usage string
+	apply func(c *Config, value string) error
+}
+
+// settings lists every environment variable and flag override
+var settings = []setting{
+	{"MUDS_LOG_LEVEL", "log-level", "log level: debug, info, warn or error", stringSetter(func(c *Config) *string { return &c.Log.Level })},
+	{"MUDS_LOG_FORMAT", "log-format", "log format: text or json", stringSetter(func(c *Config) *string { return &c.Log.Format })},
+	{"MUDS_PORT", "port", "HTTP server port", intSetter(func(c *Config) *int { return &c.Server.Port })},
+	{"MUDS_SHUTDOWN_TIMEOUT", "shutdown-timeout", "time allowed to drain requests and flush writes on shutdown", durationSetter(func(c *Config) *time.Duration { return &c.Server.ShutdownTimeout })},
+	{"MUDS_STORE", "store", "graph store backend: neo4j or memory", stringSetter(func(c *Config) *string { return &c.Store.Backend })},
+	{"MUDS_NEO4J_URI", "neo4j-uri", "Neo4j bolt URI", stringSetter(func(c *Config) *string { return &c.Neo4j.URI })},
+	{"MUDS_NEO4J_USERNAME", "neo4j-username", "Neo4j username", stringSetter(func(c *Config) *string { return &c.Neo4j.Username })},
+	{"MUDS_NEO4J_PASSWORD", "", "", stringSetter(func(c *Config) *string { return &c.Neo4j.Password })},
+	{"MUDS_NEO4J_PASSWORD_FILE", "neo4j-password-file", "file containing the Neo4j password", stringSetter(func(c *Config) *string { return &c.Neo4j.PasswordFile })},
+	{"MUDS_AI_MODEL_URL", "ai-model-url", "base URL of the AI model server", stringSetter(func(c *Config) *string { return &c.AI.ModelURL })},
+	{"MUDS_AI_TIMEOUT", "ai-timeout", "deadline of a single AI model request", durationSetter(func(c *Config) *time.Duration { return &c.AI.Timeout })},
+	{"MUDS_AI_MAX_RETRIES", "ai-max-retries", "retries of failed AI model requests", intSetter(func(c *Config) *int { return &c.AI.MaxRetries })},
+	{"MUDS_SCORING_MODEL", "scoring-model", "scoring model: remote or mlp", stringSetter(func(c *Config) *string { return &c.Scoring.Model })},
+	{"MUDS_SCORING_MODEL_PATH", "scoring-model-path", "MLP model artifact used by the mlp scoring model", stringSetter(func(c *Config) *string { return &c.Scoring.ModelPath })},
+	{"MUDS_SCORING_FALLBACK", "scoring-fallback", "score with the heuristic when the AI model fails", boolSetter(func(c *Config) *bool { return &c.Scoring.Fallback })},
+	{"MUDS_FEATURE_WINDOWS", "feature-windows", "comma-separated lookback windows of the windowed features", listSetter(func(c *Config) *[]string { return &c.Features.Windows })},
+	{"MUDS_FEATURES_ENABLED", "features-enabled", "comma-separated features sent to the model, see /api/features", listSetter(func(c *Config) *[]string { return &c.Features.Enabled })},
+	{"MUDS_RESCORE_INTERVAL", "rescore-interval", "time between background re-scoring runs, 0 to disable", durationSetter(func(c *Config) *time.Duration { return &c.Rescoring.Interval })},
+	{"MUDS_RESCORE_WORKERS", "rescore-workers", "users re-scored concurrently", intSetter(func(c *Config) *int { return &c.Rescoring.Workers })},
+	{"MUDS_RESCORE_STALE_ONLY", "rescore-stale-only", "only re-score users with interactions newer than their score", boolSetter(func(c *Config) *bool { return &c.Rescoring.StaleOnly })},
+	{"MUDS_RISK_INTERVAL", "risk-interval", "time between risk propagation runs", durationSetter(func(c *Config) *time.Duration { return &c.Risk.Interval })},
+	{"MUDS_COMMUNITY_INTERVAL", "community-interval", "time between community detection runs", durationSetter(func(c *Config) *time.Duration { return &c.Communities.Interval })},
+	{"MUDS_INFER_INTERVAL", "infer-interval", "time between association inference runs", durationSetter(func(c *Config) *time.Duration { return &c.Inference.Interval })},
+	{"MUDS_INFER_SHARED_IP", "infer-shared-ip", "infer associations between users sharing an IP", boolSetter(func(c *Config) *bool { return &c.Inference.SharedIP.Enabled })},
+	{"MUDS_INFER_SHARED_HONEYTOKEN", "infer-shared-honeytoken", "infer associations between users triggering the same honeytoken", boolSetter(func(c *Config) *bool { return &c.Inference.SharedHoneytoken.Enabled })},
+	{"MUDS_INFER_SIMILAR_ENDPOINTS", "infer-similar-endpoints", "infer associations between users with near-identical endpoint sequences", boolSetter(func(c *Config) *bool { return &c.Inference.SimilarEndpoints.Enabled })},
+	{"MUDS_GEOIP_CITY_DB", "geoip-city-db", "MaxMind City or Country database used to enrich interactions", stringSetter(func(c *Config) *string { return &c.GeoIP.CityDB })},
+	{"MUDS_GEOIP_ASN_DB", "geoip-asn-db", "MaxMind ASN database used to enrich interactions", stringSetter(func(c *Config) *string { return &c.GeoIP.ASNDB })},
+	{"MUDS_REPUTATION_RELOAD_INTERVAL", "reputation-reload-interval", "how often the IP reputation lists are checked for changes", durationSetter(func(c *Config) *time.Duration { return &c.Reputation.ReloadInterval })},
+	{"MUDS_BATCH_SIZE", "batch-size", "interactions written per batch transaction", intSetter(func(c *Config) *int { return &c.Ingestion.BatchSize })},
+	{"MUDS_FLUSH_INTERVAL", "flush-interval", "maximum time an interaction waits for its batch to fill", durationSetter(func(c *Config) *time.Duration { return &c.Ingestion.FlushInterval })},
+	{"MUDS_QUEUE_SIZE", "queue-size", "interactions held in memory before returning 429", intSetter(func(c *Config) *int { return &c.Ingestion.QueueSize })},
+	{"MUDS_INGEST_WORKERS", "ingest-workers", "goroutines writing queued interactions", intSetter(func(c *Config) *int { return &c.Ingestion.Workers })},
+	{"MUDS_WAL_PATH", "wal-path", "file interactions spill to while the store is unavailable", stringSetter(func(c *Config) *string { return &c.Ingestion.WALPath })},
+	{"MUDS_HEALTH_INTERVAL", "health-interval", "time between dependency health checks", durationSetter(func(c *Config) *time.Duration { return &c.Health.Interval })},
+}
+
+// Load builds the configuration from, in increasing order of precedence: the
+// defaults, the YAML file given by -config or MUDS_CONFIG, environment
+// variables and command line flags. Secrets are then read from their files and
+// the result is validated.
+func Load(args []string) (Config, error) {
+	cfg := Default()
+
+	flags := flag.NewFlagSet("muds", flag.ContinueOnError)
+	configPath := flags.String("config", os.Getenv("MUDS_CONFIG"), "path to a YAML config file")
+	flagValues := make(map[string]*string)
+	for _, s := range settings {
+		if s.flag != "" {
+			flagValues[s.flag] = flags.String(s.flag, "", s.usage)
+		}
+	}
+	if err := flags.Parse(args); err != nil {
+		return Config{}, err
+	}
+
+	if *configPath != "" {
+		if err := loadFile(&cfg, *configPath); err != nil {
+			return Config{}, err
+		}
+	}
+
+	for _, s := range settings {
+		if value, ok := os.LookupEnv(s.env); ok {
+			if err := s.apply(&cfg, value); err != nil {
+				return Config{}, fmt.Errorf("invalid %s: %v", s.env, err)
+			}
+		}
+	}
+
+	var flagErr error
+	flags.Visit(func(f *flag.Flag) {
+		for _, s := range settings {
+			if s.flag == f.Name && flagErr == nil {
+				if err := s.apply(&cfg, *flagValues[s.flag]); err != nil {
+					flagErr = fmt.Errorf("invalid -%s: %v", s.flag, err)
+				}
+			}
+		}
+	})
+	if flagErr != nil {
+		return Config{}, flagErr
+	}
+
+	if err := cfg.readSecrets(); err != nil {
+		return Config{}, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return Config{}, err
+	}
+	return cfg, nil
+}
+
+// loadFile decodes a YAML config file over cfg. Unknown keys are rejected.
+func loadFile(cfg *Config, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open config file: %v", err)
+	}
+	defer file.Close()
+
+	decoder := yaml.NewDecoder(file)
+	decoder.KnownFields(true)
+	if err := decoder.Decode(cfg); err != nil && err != io.EOF {
+		return fmt.Errorf("failed to parse config file %s: %v", path, err)
+	}
+	return nil
+}
+
+// readSecrets replaces secrets with the contents of their files
+func (c *Config) readSecrets() error {
+	if c.Neo4j.PasswordFile != "" {
+		secret, err := os.ReadFile(c.Neo4j.PasswordFile)
+		if err != nil {
+			return fmt.Errorf("failed to read neo4j password file: %v", err)
+		}
+		c.Neo4j.Password = strings.TrimRight(string(secret), "\r\n")
+	}
+	return nil
+}
+
+// Validate checks that the configuration is usable
+func (c Config) Validate() error {
+	if _, err := utils.NewLoggerWithOptions(io.Discard, c.Log.Format, c.Log.Level); err != nil {
+		return fmt.Errorf("invalid log settings: %v", err)
+	}
+
+	if c.Server.Port <= 0 || c.Server.Port > 65535 {
+		return fmt.Errorf("server.port %d is out of range", c.Server.Port)
+	}
+	if c.Server.ReadTimeout <= 0 || c.Server.WriteTimeout <= 0 || c.Server.IdleTimeout <= 0 || c.Server.ShutdownTimeout <= 0 {
+		return fmt.Errorf("server timeouts must be positive")
+	}
+
+	switch c.Store.Backend {
+	case "memory":
+	case "neo4j":
+		if _, err := url.Parse(c.Neo4j.URI); err != nil || c.Neo4j.URI == "" {
+			return fmt.Errorf("neo4j.uri %q is not a valid URI", c.Neo4j.URI)
+		}
+		if c.Neo4j.Username == "" {
+			return fmt.Errorf("neo4j.username is required")
+		}
+		if c.Neo4j.Password == "" && c.Neo4j.PasswordFile == "" {
+			return fmt.Errorf("neo4j.password or neo4j.password_file is required")
+		}
+	default:
+		return fmt.Errorf("store.backend must be neo4j or memory, got %q", c.Store.Backend)
+	}
+
+	if u, err := url.Parse(c.AI.ModelURL); err != nil || u.Scheme == "" || u.Host == "" {
+		return fmt.Errorf("ai.model_url %q is not a valid URL", c.AI.ModelURL)
+	}
+	if c.AI.MaxRetries < 0 {
+		return fmt.Errorf("ai.max_retries must not be negative")
+	}
+	if c.AI.BreakerThreshold <= 0 || c.AI.MaxIdleConns <= 0 {
+		return fmt.Errorf("ai breaker_threshold and max_idle_conns must be positive")
+	}
+	if c.AI.Timeout <= 0 || c.AI.BaseBackoff <= 0 || c.AI.MaxBackoff <= 0 || c.AI.BreakerCooldown <= 0 {
+		return fmt.Errorf("ai durations must be positive")
+	}
+
+	in := c.Ingestion
+	if in.BatchSize <= 0 || in.QueueSize <= 0 || in.Workers <= 0 {
+		return fmt.Errorf("ingestion batch_size, queue_size and workers must be positive")
+	}
+	if in.MaxRetries < 0 {
+		return fmt.Errorf("ingestion.max_retries must not be negative")
+	}
+	if in.FlushInterval <= 0 || in.BaseBackoff <= 0 || in.MaxBackoff <= 0 || in.ReplayInterval <= 0 || in.RetryAfter <= 0 {
+		return fmt.Errorf("ingestion durations must be positive")
+	}
+	if in.WALPath == "" {
+		return fmt.Errorf("ingestion.wal_path is required")
+	}
+
+	if c.Health.Interval <= 0 || c.Health.CheckTimeout <= 0 {
+		return fmt.Errorf("health interval and check_timeout must be positive")
+	}
+
+	switch c.Scoring.Model {
+	case "remote":
+	case "mlp":
+		if c.Scoring.ModelPath == "" {
+			return fmt.Errorf("scoring.model_path is required for the mlp model")
+		}
+	default:
+		return fmt.Errorf("scoring.model must be remote or mlp, got %q", c.Scoring.Model)
+	}
+
+	h := c.Scoring.Heuristic
+	if h.TotalAccess < 0 || h.HoneytokenRatio < 0 || h.SharedIP < 0 || h.AssociatedScore < 0 {
+		return fmt.Errorf("scoring.heuristic weights must not be negative")
+	}
+	if h.TotalAccessCap <= 0 || h.SharedIPCap <= 0 {
+		return fmt.Errorf("scoring.heuristic caps must be positive")
+	}
+
+	if len(c.Features.Windows) == 0 {
+		return fmt.Errorf("features.windows must list at least one window")
+	}
+	if _, err := c.Features.FeatureWindows(); err != nil {
+		return fmt.Errorf("invalid features.windows: %v", err)
+	}
+
+	if c.Rescoring.Interval < 0 {
+		return fmt.Errorf("rescoring.interval must not be negative")
+	}
+	if c.Rescoring.Workers <= 0 || c.Rescoring.BatchSize <= 0 {
+		return fmt.Errorf("rescoring workers and batch_size must be positive")
+	}
+	if c.Rescoring.CheckpointPath == "" {
+		return fmt.Errorf("rescoring.checkpoint_path is required")
+	}
+
+	r := c.Risk
+	if r.Interval <= 0 {
+		return fmt.Errorf("risk_propagation.interval must be positive")
+	}
+	if r.Damping <= 0 || r.Damping >= 1 {
+		return fmt.Errorf("risk_propagation.damping must be between 0 and 1, got %v", r.Damping)
+	}
+	if r.Tolerance <= 0 || r.MaxIterations <= 0 {
+		return fmt.Errorf("risk_propagation tolerance and max_iterations must be positive")
+	}
+	if r.SeedScore <= 0 || r.SeedScore > 1 {
+		return fmt.Errorf("risk_propagation.seed_score must be in (0, 1], got %v", r.SeedScore)
+	}
+
+	if c.Communities.Interval <= 0 {
+		return fmt.Errorf("communities.interval must be positive")
+	}
+	if c.Communities.MaxIterations <= 0 || c.Communities.MinSize <= 0 {
+		return fmt.Errorf("communities max_iterations and min_size must be positive")
+	}
+
+	inf := c.Inference
+	if inf.Interval <= 0 || inf.Lookback <= 0 {
+		return fmt.Errorf("association_inference interval and lookback must be positive")
+	}
+	if ip := inf.SharedIP; ip.Enabled {
+		if ip.Window <= 0 || ip.MaxUsers < 2 {
+			return fmt.Errorf("association_inference.shared_ip needs a positive window and max_users of at least 2")
+		}
+		if ip.Confidence <= 0 || ip.Confidence > 1 {
+			return fmt.Errorf("association_inference.shared_ip.confidence must be in (0, 1], got %v", ip.Confidence)
+		}
+	}
+	if token := inf.SharedHoneytoken; token.Enabled {
+		if token.MaxUsers < 2 {
+			return fmt.Errorf("association_inference.shared_honeytoken.max_users must be at least 2")
+		}
+		if token.Confidence <= 0 || token.Confidence > 1 {
+			return fmt.Errorf("association_inference.shared_honeytoken.confidence must be in (0, 1], got %v", token.Confidence)
+		}
+	}
+	if e := inf.SimilarEndpoints; e.Enabled {
+		if e.MinLength <= 0 || e.MaxLength < e.MinLength {
+			return fmt.Errorf("association_inference.similar_endpoints needs 0 < min_length <= max_length")
+		}
+		if e.MaxUsers < 2 {
+			return fmt.Errorf("association_inference.similar_endpoints.max_users must be at least 2")
+		}
+		if e.Similarity <= 0 || e.Similarity > 1 || e.Confidence <= 0 || e.Confidence > 1 {
+			return fmt.Errorf("association_inference.similar_endpoints similarity and confidence must be in (0, 1]")
+		}
+	}
+
+	if c.GeoIP.CityDB != "" || c.GeoIP.ASNDB != "" {
+		if c.GeoIP.ReloadInterval <= 0 {
+			return fmt.Errorf("geoip.reload_interval must be positive")
+		}
+		for _, asn := range c.GeoIP.HostingASNs {
+			if asn <= 0 {
+				return fmt.Errorf("geoip.hosting_asns must be positive, got %d", asn)
+			}
+		}
+	}
+
+	if len(c.Reputation.Lists) > 0 && c.Reputation.ReloadInterval <= 0 {
+		return fmt.Errorf("reputation.reload_interval must be positive")
+	}
+	for i, list := range c.Reputation.Lists {
+		if list.Path == "" {
+			return fmt.Errorf("reputation.lists[%d].path is required", i)
+		}
+		// Categories name the reputation_<category>_ratio features
+		if !categoryPattern.MatchString(list.Category) {
+			return fmt.Errorf("reputation.lists[%d].category must be lowercase letters, digits and underscores, got %q", i, list.Category)
+		}
+		for _, category := range list.RowCategories {
+			if !categoryPattern.MatchString(category) {
+				return fmt.Errorf("reputation.lists[%d].row_categories must be lowercase letters, digits and underscores, got %q", i, category)
+			}
+		}
+		if list.Format != "" && list.Format != "text" && list.Format != "csv" {
+			return fmt.Errorf("reputation.lists[%d].format must be text or csv, got %q", i, list.Format)
+		}
+	}
+	return nil
+}
+
+// categoryPattern matches valid reputation list categories
+var categoryPattern = regexp.MustCompile(`^[a-z0-9_]+$`)
+
+func stringSetter(field func(*Config) *string) func(*Config, string) error {
+	return func(c *Config, value string) error {
+		*field(c) = value
+		return nil
+	}
+}
+
+func intSetter(field func(*Config) *int) func(*Config, string) error {
+	return func(c *Config, value string) error {
+		parsed, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		*field(c) = parsed
+		return nil
+	}
+}
+
+func boolSetter(field func(*Config) *bool) func(*Config, string) error {
+	return func(c *Config, value string) error {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		*field(c) = parsed
+		return nil
+	}
+}
+
+func listSetter(field func(*Config) *[]string) func(*Config, string) error {
+	return func(c *Config, value string) error {
+		var items []string
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		*field(c) = items
+		return nil
+	}
+}
+
+func durationSetter(field func(*Config) *time.Duration) func(*Config, string) error {
+	return func(c *Config, value string) error {
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		*field(c) = parsed
+		return nil
+	}
+}
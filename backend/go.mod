@@ -2,4 +2,22 @@ module backend
 
 go 1.23.4
 
-require github.com/neo4j/neo4j-go-driver/v5 v5.27.0 
+require github.com/neo4j/neo4j-go-driver/v5 v5.27.0
+
+require gopkg.in/yaml.v3 v3.0.1
+
+require github.com/prometheus/client_golang v1.20.5
+
+require github.com/oschwald/maxminddb-golang v1.13.1
+
+require (
+	github.com/beorn7/perks v1.0.1 // indirect
+	github.com/cespare/xxhash/v2 v2.3.0 // indirect
+	github.com/klauspost/compress v1.17.9 // indirect
+	github.com/munnerz/goautoneg v0.0.0-20191010083416-a7dc8b61c822 // indirect
+	github.com/prometheus/client_model v0.6.1 // indirect
+	github.com/prometheus/common v0.55.0 // indirect
+	github.com/prometheus/procfs v0.15.1 // indirect
+	golang.org/x/sys v0.22.0 // indirect
+	google.golang.org/protobuf v1.34.2 // indirect
+)
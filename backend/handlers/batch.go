@@ -0,0 +1,200 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"backend/models"
+	"backend/services"
+	"backend/utils"
+)
+
+const (
+	// MaxBatchRecords is the maximum number of interactions accepted per request
+	MaxBatchRecords = 10000
+	// MaxBatchBodySize is the maximum size of a batch request body in bytes
+	MaxBatchBodySize = 16 << 20
+	// maxNDJSONLineSize is the maximum size of a single NDJSON line
+	maxNDJSONLineSize = 1 << 20
+)
+
+// BatchRecordResult is the outcome for one record of a batch request
+type BatchRecordResult struct {
+	Index  int    `json:"index"`           // Position of the record in the request
+	Status string `json:"status"`          // "accepted" or "rejected"
+	Error  string `json:"error,omitempty"` // Reason the record was rejected
+}
+
+// BatchResponse is the body returned by LogInteractionsBatch
+type BatchResponse struct {
+	Accepted int                 `json:"accepted"`
+	Rejected int                 `json:"rejected"`
+	Results  []BatchRecordResult `json:"results"`
+}
+
+// BatchHandler handles bulk interaction ingestion
+type BatchHandler struct {
+	Queue  *services.IngestionQueue
+	Logger *utils.Logger
+}
+
+// NewBatchHandler creates a new BatchHandler
+func NewBatchHandler(queue *services.IngestionQueue, logger *utils.Logger) *BatchHandler {
+	return &BatchHandler{
+		Queue:  queue,
+		Logger: logger,
+	}
+}
+
+// LogInteractionsBatch handles bulk requests to log interactions.
+// The body is either a JSON array of interactions or NDJSON with one
+// interaction per line. Each record is validated like /api/log-interaction and
+// the response reports whether each record was accepted or rejected. Accepted
+// records are queued together and written asynchronously. A batch without
+// any valid record is answered with 400.
+func (h *BatchHandler) LogInteractionsBatch(w http.ResponseWriter, r *http.Request) {
+	logger := h.Logger.WithContext(r.Context())
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	records, err := readBatchRecords(http.MaxBytesReader(w, r.Body, MaxBatchBodySize))
+	if err != nil {
+		logger.Error("Failed to read batch request body", "error", err)
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, fmt.Sprintf("Request body exceeds %d bytes", MaxBatchBodySize), http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	response := BatchResponse{Results: make([]BatchRecordResult, len(records))}
+	var interactions []models.Interaction
+	var accepted []int
+	for idx, record := range records {
+		response.Results[idx] = BatchRecordResult{Index: idx, Status: "rejected"}
+
+		var interaction models.Interaction
+		if err := json.Unmarshal(record, &interaction); err != nil {
+			response.Results[idx].Error = "invalid JSON: " + err.Error()
+			continue
+		}
+		if err := prepareInteraction(&interaction, r); err != nil {
+			response.Results[idx].Error = err.Error()
+			continue
+		}
+		interactions = append(interactions, interaction)
+		accepted = append(accepted, idx)
+	}
+
+	status := http.StatusAccepted
+	if len(interactions) == 0 {
+		status = http.StatusBadRequest
+	} else if err := h.Queue.Enqueue(interactions); err != nil {
+		logger.Error("Failed to queue interaction batch", "error", err)
+		status = http.StatusServiceUnavailable
+		if errors.Is(err, services.ErrQueueFull) {
+			status = http.StatusTooManyRequests
+			setRetryAfter(w, h.Queue)
+		}
+		for _, idx := range accepted {
+			response.Results[idx].Error = err.Error()
+		}
+	} else {
+		for _, idx := range accepted {
+			response.Results[idx].Status = "accepted"
+		}
+	}
+
+	for _, result := range response.Results {
+		if result.Status == "accepted" {
+			response.Accepted++
+		} else {
+			response.Rejected++
+		}
+	}
+
+	logger.Info("Batch ingestion complete", "accepted", response.Accepted, "rejected", response.Rejected)
+	body, _ := json.Marshal(response)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(body)
+}
+
+// readBatchRecords splits a JSON array or NDJSON body into raw records
+func readBatchRecords(body io.Reader) ([]json.RawMessage, error) {
+	reader := bufio.NewReader(body)
+
+	// Skip leading whitespace to find out whether the body is an array
+	for {
+		b, err := reader.ReadByte()
+		if err == io.EOF {
+			return nil, fmt.Errorf("empty body")
+		}
+		if err != nil {
+			return nil, err
+		}
+		if b == ' ' || b == '\t' || b == '\r' || b == '\n' {
+			continue
+		}
+		reader.UnreadByte()
+		if b == '[' {
+			return readJSONArray(reader)
+		}
+		return readNDJSON(reader)
+	}
+}
+
+// readJSONArray reads the elements of a JSON array without decoding them
+func readJSONArray(reader io.Reader) ([]json.RawMessage, error) {
+	var records []json.RawMessage
+	decoder := json.NewDecoder(reader)
+	if _, err := decoder.Token(); err != nil {
+		return nil, err
+	}
+	for decoder.More() {
+		if len(records) >= MaxBatchRecords {
+			return nil, fmt.Errorf("batch exceeds %d records", MaxBatchRecords)
+		}
+		var record json.RawMessage
+		if err := decoder.Decode(&record); err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	if _, err := decoder.Token(); err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+// readNDJSON reads one record per non-empty line. Malformed lines are kept so
+// that they are reported as rejected records.
+func readNDJSON(reader io.Reader) ([]json.RawMessage, error) {
+	var records []json.RawMessage
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxNDJSONLineSize)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		if len(records) >= MaxBatchRecords {
+			return nil, fmt.Errorf("batch exceeds %d records", MaxBatchRecords)
+		}
+		records = append(records, json.RawMessage(append([]byte(nil), line...)))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return records, nil
+}
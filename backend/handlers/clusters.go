@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"backend/models"
+	"backend/services"
+	"backend/utils"
+)
+
+// defaultClusterLimit and maxClusterLimit bound the clusters listed per request
+const (
+	defaultClusterLimit = 20
+	maxClusterLimit     = 500
+)
+
+// ClustersHandler lists the clusters found by community detection
+type ClustersHandler struct {
+	Job    *services.CommunityDetectionJob
+	Logger *utils.Logger
+}
+
+// NewClustersHandler creates a new ClustersHandler
+func NewClustersHandler(job *services.CommunityDetectionJob, logger *utils.Logger) *ClustersHandler {
+	return &ClustersHandler{
+		Job:    job,
+		Logger: logger,
+	}
+}
+
+// ClustersResponse is the response of ListClusters
+type ClustersResponse struct {
+	ComputedAt time.Time        `json:"computed_at"`
+	Users      int              `json:"users"`
+	Clusters   []models.Cluster `json:"clusters"`
+}
+
+// ListClusters lists the most suspicious clusters of the last community
+// detection run with their members. The optional limit and min_size query
+// parameters bound the number and size of the clusters.
+func (h *ClustersHandler) ListClusters(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	limit, err := queryInt(r, "limit", defaultClusterLimit)
+	if err != nil || limit <= 0 || limit > maxClusterLimit {
+		http.Error(w, "Invalid limit query parameter", http.StatusBadRequest)
+		return
+	}
+	minSize, err := queryInt(r, "min_size", 0)
+	if err != nil || minSize < 0 {
+		http.Error(w, "Invalid min_size query parameter", http.StatusBadRequest)
+		return
+	}
+
+	result, clusters := h.Job.Clusters(limit, minSize)
+	if result == nil {
+		http.Error(w, "Clusters have not been computed yet", http.StatusServiceUnavailable)
+		return
+	}
+
+	response, _ := json.Marshal(ClustersResponse{ComputedAt: result.ComputedAt, Users: result.Users, Clusters: clusters})
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(response)
+}
+
+// queryInt parses an integer query parameter, or returns fallback if it is absent
+func queryInt(r *http.Request, name string, fallback int) (int, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return fallback, nil
+	}
+	return strconv.Atoi(value)
+}
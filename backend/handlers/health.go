@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"backend/services"
+	"backend/utils"
+)
+
+// HealthHandler serves liveness, readiness and status endpoints
+type HealthHandler struct {
+	HealthService *services.HealthService
+	Logger        *utils.Logger
+}
+
+// NewHealthHandler creates a new HealthHandler
+func NewHealthHandler(healthService *services.HealthService, logger *utils.Logger) *HealthHandler {
+	return &HealthHandler{
+		HealthService: healthService,
+		Logger:        logger,
+	}
+}
+
+// Healthz reports liveness: the process is up and serving HTTP
+func (h *HealthHandler) Healthz(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("ok"))
+}
+
+// Readyz reports readiness: 200 when every dependency is healthy, 503 otherwise
+func (h *HealthHandler) Readyz(w http.ResponseWriter, r *http.Request) {
+	if !h.HealthService.Ready() {
+		http.Error(w, "not ready", http.StatusServiceUnavailable)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("ready"))
+}
+
+// Status reports the build version and the latest check of each dependency
+func (h *HealthHandler) Status(w http.ResponseWriter, r *http.Request) {
+	status := h.HealthService.Status()
+
+	response, _ := json.Marshal(status)
+	w.Header().Set("Content-Type", "application/json")
+	if status.Ready {
+		w.WriteHeader(http.StatusOK)
+	} else {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	w.Write(response)
+}
@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 
 	"backend/models"
@@ -9,48 +10,169 @@ import (
 	"backend/utils"
 )
 
+// DefaultHoneytokenEndpoint is recorded for triggers that do not report an endpoint
+const DefaultHoneytokenEndpoint = "/api/honeytoken-endpoint"
+
 // HoneytokenHandler handles honeytoken-related requests
 type HoneytokenHandler struct {
-	Neo4jService *services.Neo4jService
-	Logger       *utils.Logger
+	Store  services.GraphStore
+	Queue  *services.IngestionQueue
+	Logger *utils.Logger
 }
 
 // NewHoneytokenHandler creates a new HoneytokenHandler
-func NewHoneytokenHandler(neo4jService *services.Neo4jService, logger *utils.Logger) *HoneytokenHandler {
+func NewHoneytokenHandler(store services.GraphStore, queue *services.IngestionQueue, logger *utils.Logger) *HoneytokenHandler {
 	return &HoneytokenHandler{
-		Neo4jService: neo4jService,
-		Logger:       logger,
+		Store:  store,
+		Queue:  queue,
+		Logger: logger,
 	}
 }
 
-// DetectHoneytoken detects and logs honeytoken access
-func (h *HoneytokenHandler) DetectHoneytoken(w http.ResponseWriter, r *http.Request) {
+// Honeytokens handles the honeytoken registry: GET lists tokens and POST creates one
+func (h *HoneytokenHandler) Honeytokens(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		h.ListHoneytokens(w, r)
+	case http.MethodPost:
+		h.CreateHoneytoken(w, r)
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// CreateHoneytoken registers a new honeytoken and returns it with its token_id
+func (h *HoneytokenHandler) CreateHoneytoken(w http.ResponseWriter, r *http.Request) {
+	logger := h.Logger.WithContext(r.Context())
 	type RequestBody struct {
-		UserID string `json:"user_id"`
+		Type        models.HoneytokenType     `json:"type"`
+		Severity    models.HoneytokenSeverity `json:"severity"`
+		Placement   string                    `json:"placement"`
+		Description string                    `json:"description"`
 	}
 
 	var requestBody RequestBody
 	if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
-		h.Logger.Error("Failed to decode request body: " + err.Error())
+		logger.Error("Failed to decode request body", "error", err)
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
 
-	honeytokenInteraction := models.NewInteraction(
-		requestBody.UserID,
-		"/api/honeytoken-endpoint",
-		http.StatusOK,
-		false,
-		r.RemoteAddr,
-	)
+	token := models.NewHoneytoken(requestBody.Type, requestBody.Severity, requestBody.Placement, requestBody.Description)
+	if err := token.Validate(); err != nil {
+		http.Error(w, "Invalid honeytoken: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := h.Store.CreateHoneytoken(r.Context(), token); err != nil {
+		logger.Error("Failed to create honeytoken", "error", err)
+		http.Error(w, "Failed to create honeytoken", http.StatusInternalServerError)
+		return
+	}
+
+	response, _ := json.Marshal(token)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	w.Write(response)
+}
+
+// ListHoneytokens lists active honeytokens, or all of them with ?include_retired=true
+func (h *HoneytokenHandler) ListHoneytokens(w http.ResponseWriter, r *http.Request) {
+	logger := h.Logger.WithContext(r.Context())
+	includeRetired := r.URL.Query().Get("include_retired") == "true"
 
-	if err := h.Neo4jService.SaveInteraction(honeytokenInteraction); err != nil {
-		h.Logger.Error("Failed to log honeytoken access: " + err.Error())
-		http.Error(w, "Failed to log honeytoken access", http.StatusInternalServerError)
+	tokens, err := h.Store.ListHoneytokens(r.Context(), includeRetired)
+	if err != nil {
+		logger.Error("Failed to list honeytokens", "error", err)
+		http.Error(w, "Failed to list honeytokens", http.StatusInternalServerError)
 		return
 	}
 
-	h.Logger.Info("Honeytoken access logged for user_id: " + requestBody.UserID)
+	response, _ := json.Marshal(tokens)
+	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
+	w.Write(response)
+}
+
+// RetireHoneytoken marks a honeytoken as retired. Triggers of retired tokens are still recorded.
+func (h *HoneytokenHandler) RetireHoneytoken(w http.ResponseWriter, r *http.Request) {
+	logger := h.Logger.WithContext(r.Context())
+	type RequestBody struct {
+		TokenID string `json:"token_id"`
+	}
+
+	var requestBody RequestBody
+	if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
+		logger.Error("Failed to decode request body", "error", err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.Store.RetireHoneytoken(r.Context(), requestBody.TokenID); err != nil {
+		if errors.Is(err, services.ErrHoneytokenNotFound) {
+			http.Error(w, "Honeytoken not found", http.StatusNotFound)
+			return
+		}
+		logger.Error("Failed to retire honeytoken", "error", err)
+		http.Error(w, "Failed to retire honeytoken", http.StatusInternalServerError)
+		return
+	}
+
+	logger.Info("Honeytoken retired", "token_id", requestBody.TokenID)
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("Honeytoken retired successfully"))
+}
+
+// DetectHoneytoken detects and logs honeytoken access.
+// The body is a models.Interaction that must reference a registered honeytoken_id.
+func (h *HoneytokenHandler) DetectHoneytoken(w http.ResponseWriter, r *http.Request) {
+	logger := h.Logger.WithContext(r.Context())
+	var interaction models.Interaction
+	if err := json.NewDecoder(r.Body).Decode(&interaction); err != nil {
+		logger.Error("Failed to decode request body", "error", err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if interaction.HoneytokenID == "" {
+		http.Error(w, "honeytoken_id is required", http.StatusBadRequest)
+		return
+	}
+	token, err := h.Store.GetHoneytoken(r.Context(), interaction.HoneytokenID)
+	if err != nil {
+		if errors.Is(err, services.ErrHoneytokenNotFound) {
+			http.Error(w, "Honeytoken not found", http.StatusNotFound)
+			return
+		}
+		logger.Error("Failed to look up honeytoken", "error", err)
+		http.Error(w, "Failed to look up honeytoken", http.StatusInternalServerError)
+		return
+	}
+
+	interaction.HoneytokenTriggered = true
+	if interaction.Endpoint == "" {
+		interaction.Endpoint = DefaultHoneytokenEndpoint
+	}
+	if interaction.ResponseStatusCode == 0 {
+		interaction.ResponseStatusCode = http.StatusOK
+	}
+	if err := prepareInteraction(&interaction, r); err != nil {
+		logger.Error("Invalid honeytoken interaction", "error", err)
+		http.Error(w, "Invalid interaction: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := h.Queue.Enqueue([]models.Interaction{interaction}); err != nil {
+		logger.Error("Failed to queue honeytoken access", "error", err)
+		writeEnqueueError(w, h.Queue, err)
+		return
+	}
+
+	if !token.Active() {
+		logger.Warn("Retired honeytoken was triggered", "token_id", token.TokenID)
+	}
+	logger.Info("Honeytoken access logged", "token_id", token.TokenID, "severity", token.Severity, "user_id", interaction.UserID)
+	w.WriteHeader(http.StatusAccepted)
 	w.Write([]byte("Honeytoken access detected and logged"))
 }
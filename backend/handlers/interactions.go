@@ -2,7 +2,12 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
+	"math"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"backend/models"
 	"backend/services"
@@ -11,54 +16,55 @@ import (
 
 // InteractionHandler handles interaction-related requests
 type InteractionHandler struct {
-	Neo4jService *services.Neo4jService
-	Logger       *utils.Logger
+	Store  services.GraphStore
+	Queue  *services.IngestionQueue
+	Logger *utils.Logger
 }
 
 // NewInteractionHandler creates a new InteractionHandler
-func NewInteractionHandler(neo4jService *services.Neo4jService, logger *utils.Logger) *InteractionHandler {
+func NewInteractionHandler(store services.GraphStore, queue *services.IngestionQueue, logger *utils.Logger) *InteractionHandler {
 	return &InteractionHandler{
-		Neo4jService: neo4jService,
-		Logger:       logger,
+		Store:  store,
+		Queue:  queue,
+		Logger: logger,
 	}
 }
 
-// LogInteraction handles requests to log user interactions
+// LogInteraction handles requests to log user interactions.
+// The body is a models.Interaction as observed by the upstream service. When no
+// timestamp is given the current time is used, and when no ip_address is given
+// the address of the caller is used. The interaction is queued and written
+// asynchronously, so a successful response is 202 Accepted.
 func (h *InteractionHandler) LogInteraction(w http.ResponseWriter, r *http.Request) {
-
-	type RequestBody struct {
-		UserID string `json:"user_id"`
+	logger := h.Logger.WithContext(r.Context())
+	var interaction models.Interaction
+	if err := json.NewDecoder(r.Body).Decode(&interaction); err != nil {
+		logger.Error("Failed to decode request body", "error", err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
 	}
 
-	var requestBody RequestBody
-	if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
-		h.Logger.Error("Failed to decode request body: " + err.Error())
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+	if err := prepareInteraction(&interaction, r); err != nil {
+		logger.Error("Invalid interaction", "error", err)
+		http.Error(w, "Invalid interaction: "+err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	interaction := models.NewInteraction(
-		requestBody.UserID,
-		"/api/valid-endpoint",
-		http.StatusOK,
-		false,
-		r.RemoteAddr,
-	)
-
-	// Save the interaction to Neo4j
-	if err := h.Neo4jService.SaveInteraction(interaction); err != nil {
-		h.Logger.Error("Failed to save interaction: " + err.Error())
-		http.Error(w, "Failed to save interaction", http.StatusInternalServerError)
+	// Queue the interaction for the graph store
+	if err := h.Queue.Enqueue([]models.Interaction{interaction}); err != nil {
+		logger.Error("Failed to queue interaction", "error", err)
+		writeEnqueueError(w, h.Queue, err)
 		return
 	}
 
-	h.Logger.Info("Interaction logged successfully for user_id: " + interaction.UserID)
-	w.WriteHeader(http.StatusOK)
+	logger.Info("Interaction queued", "user_id", interaction.UserID)
+	w.WriteHeader(http.StatusAccepted)
 	w.Write([]byte("Interaction logged successfully"))
 }
 
 // LogAssociation handles requests to associate two users
 func (h *InteractionHandler) LogAssociation(w http.ResponseWriter, r *http.Request) {
+	logger := h.Logger.WithContext(r.Context())
 	type RequestBody struct {
 		User1 string `json:"user1"`
 		User2 string `json:"user2"`
@@ -66,19 +72,85 @@ func (h *InteractionHandler) LogAssociation(w http.ResponseWriter, r *http.Reque
 
 	var requestBody RequestBody
 	if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
-		h.Logger.Error("Failed to decode request body: " + err.Error())
+		logger.Error("Failed to decode request body", "error", err)
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
 
-	// Call the service to associate the two users in Neo4j
-	if err := h.Neo4jService.AssociatedWith(requestBody.User1, requestBody.User2); err != nil {
-		h.Logger.Error("Failed to associate users: " + err.Error())
+	// Call the store to associate the two users
+	if err := h.Store.AssociatedWith(r.Context(), requestBody.User1, requestBody.User2); err != nil {
+		logger.Error("Failed to associate users", "error", err)
 		http.Error(w, "Failed to associate users", http.StatusInternalServerError)
 		return
 	}
 
-	h.Logger.Info("Users associated successfully: " + requestBody.User1 + " <-> " + requestBody.User2)
+	logger.Info("Users associated successfully", "user1", requestBody.User1, "user2", requestBody.User2)
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte("Users associated successfully"))
 }
+
+// ListAssociations returns the explicit and inferred associations of a user
+// with their type, confidence and evidence
+func (h *InteractionHandler) ListAssociations(w http.ResponseWriter, r *http.Request) {
+	logger := h.Logger.WithContext(r.Context())
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	userID := r.URL.Query().Get("user_id")
+	if userID == "" {
+		http.Error(w, "Missing user_id query parameter", http.StatusBadRequest)
+		return
+	}
+
+	associations, err := h.Store.GetAssociations(r.Context(), userID)
+	if err != nil {
+		logger.Error("Failed to fetch associations", "error", err)
+		http.Error(w, "Failed to fetch associations", http.StatusInternalServerError)
+		return
+	}
+
+	response, _ := json.Marshal(associations)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(response)
+}
+
+// prepareInteraction fills in defaults for a client-supplied interaction,
+// normalizes its IP address and validates it
+func prepareInteraction(interaction *models.Interaction, r *http.Request) error {
+	now := time.Now()
+	if interaction.Timestamp.IsZero() {
+		interaction.Timestamp = now
+	}
+	if interaction.IPAddress == "" {
+		interaction.IPAddress = r.RemoteAddr
+	}
+	interaction.Method = strings.ToUpper(interaction.Method)
+
+	ip, err := utils.NormalizeIP(interaction.IPAddress)
+	if err != nil {
+		return err
+	}
+	interaction.IPAddress = ip
+
+	return interaction.Validate(now)
+}
+
+// writeEnqueueError responds to a failed Enqueue: 429 with Retry-After when the
+// queue is full and 503 when it is shutting down
+func writeEnqueueError(w http.ResponseWriter, queue *services.IngestionQueue, err error) {
+	if errors.Is(err, services.ErrQueueFull) {
+		setRetryAfter(w, queue)
+		http.Error(w, "Too many interactions, retry later", http.StatusTooManyRequests)
+		return
+	}
+	http.Error(w, "Interaction ingestion unavailable", http.StatusServiceUnavailable)
+}
+
+// setRetryAfter sets the Retry-After header to the queue's RetryAfter in whole seconds
+func setRetryAfter(w http.ResponseWriter, queue *services.IngestionQueue) {
+	retryAfter := int(math.Ceil(queue.Options.RetryAfter.Seconds()))
+	w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+}
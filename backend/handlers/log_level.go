@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"backend/utils"
+)
+
+// LogLevelHandler reads and changes the log level at runtime
+type LogLevelHandler struct {
+	Logger *utils.Logger
+}
+
+// NewLogLevelHandler creates a new LogLevelHandler
+func NewLogLevelHandler(logger *utils.Logger) *LogLevelHandler {
+	return &LogLevelHandler{
+		Logger: logger,
+	}
+}
+
+// LogLevel returns the current level on GET and sets it on PUT or POST with {"level": "debug"}
+func (h *LogLevelHandler) LogLevel(w http.ResponseWriter, r *http.Request) {
+	type Body struct {
+		Level string `json:"level"`
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut, http.MethodPost:
+		var requestBody Body
+		if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if err := h.Logger.SetLevel(requestBody.Level); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		h.Logger.WithContext(r.Context()).Info("Log level changed", "level", h.Logger.Level())
+	default:
+		w.Header().Set("Allow", "GET, PUT, POST")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	response, _ := json.Marshal(Body{Level: h.Logger.Level()})
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(response)
+}
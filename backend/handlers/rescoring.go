@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"backend/services"
+	"backend/utils"
+)
+
+// RescoringHandler reports on and triggers bulk re-scoring runs
+type RescoringHandler struct {
+	Job    *services.RescoringJob
+	Logger *utils.Logger
+}
+
+// NewRescoringHandler creates a new RescoringHandler
+func NewRescoringHandler(job *services.RescoringJob, logger *utils.Logger) *RescoringHandler {
+	return &RescoringHandler{
+		Job:    job,
+		Logger: logger,
+	}
+}
+
+// Rescoring returns the progress of the current or last run on GET. POST
+// starts a run, optionally with {"stale_only": true}, and answers 202 or 409
+// if a run is already in progress.
+func (h *RescoringHandler) Rescoring(w http.ResponseWriter, r *http.Request) {
+	status := http.StatusOK
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		var requestBody struct {
+			StaleOnly bool `json:"stale_only"`
+		}
+		if r.ContentLength != 0 {
+			if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
+				http.Error(w, "Invalid request body", http.StatusBadRequest)
+				return
+			}
+		}
+		_, err := h.Job.Trigger(requestBody.StaleOnly)
+		if errors.Is(err, services.ErrRescoringRunning) {
+			status = http.StatusConflict
+		} else if err != nil {
+			h.Logger.WithContext(r.Context()).Error("Failed to start re-scoring run", "error", err)
+			http.Error(w, "Failed to start re-scoring run", http.StatusServiceUnavailable)
+			return
+		} else {
+			h.Logger.WithContext(r.Context()).Info("Re-scoring run triggered", "stale_only", requestBody.StaleOnly)
+			status = http.StatusAccepted
+		}
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	response, _ := json.Marshal(h.Job.Status())
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(response)
+}
@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 
 	"backend/services"
@@ -24,6 +25,7 @@ func NewUserAnalysisHandler(userAnalysisService *services.UserAnalysisService, l
 
 // AnalyzeUser handles requests to analyze a user
 func (h *UserAnalysisHandler) AnalyzeUser(w http.ResponseWriter, r *http.Request) {
+	logger := h.Logger.WithContext(r.Context())
 
 	type RequestBody struct {
 		UserID string `json:"user_id"`
@@ -31,14 +33,18 @@ func (h *UserAnalysisHandler) AnalyzeUser(w http.ResponseWriter, r *http.Request
 
 	var requestBody RequestBody
 	if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
-		h.Logger.Error("Failed to decode request body: " + err.Error())
+		logger.Error("Failed to decode request body", "error", err)
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
 
-	analysisResult, err := h.UserAnalysisService.AnalyzeUser(requestBody.UserID)
+	analysisResult, err := h.UserAnalysisService.AnalyzeUser(r.Context(), requestBody.UserID)
+	if errors.Is(err, services.ErrUserNotFound) {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
 	if err != nil {
-		h.Logger.Error("Failed to analyze user: " + err.Error())
+		logger.Error("Failed to analyze user", "error", err)
 		http.Error(w, "Failed to analyze user", http.StatusInternalServerError)
 		return
 	}
@@ -48,3 +54,39 @@ func (h *UserAnalysisHandler) AnalyzeUser(w http.ResponseWriter, r *http.Request
 	w.WriteHeader(http.StatusOK)
 	w.Write(response)
 }
+
+// ScoreHistory handles requests for the score history of a user
+func (h *UserAnalysisHandler) ScoreHistory(w http.ResponseWriter, r *http.Request) {
+	logger := h.Logger.WithContext(r.Context())
+	userID := r.URL.Query().Get("user_id")
+	if userID == "" {
+		http.Error(w, "Missing user_id query parameter", http.StatusBadRequest)
+		return
+	}
+
+	history, err := h.UserAnalysisService.ScoreHistory(r.Context(), userID)
+	if err != nil {
+		logger.Error("Failed to fetch score history", "error", err)
+		http.Error(w, "Failed to fetch score history", http.StatusInternalServerError)
+		return
+	}
+
+	response, _ := json.Marshal(history)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(response)
+}
+
+// ListFeatures lists the registered features and whether they are sent to the model
+func (h *UserAnalysisHandler) ListFeatures(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	response, _ := json.Marshal(h.UserAnalysisService.Features.List())
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(response)
+}
@@ -1,32 +1,379 @@
 package main
 
 import (
+	"backend/config"
 	"backend/handlers"
+	"backend/metrics"
 	"backend/services"
 	"backend/utils"
+	"context"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 )
 
+// Version is the build version reported by /status, set with
+// -ldflags "-X main.Version=..."
+var Version = "dev"
+
 func main() {
+	cfg, err := config.Load(os.Args[1:])
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+
+	logger, err := utils.NewLoggerWithOptions(os.Stdout, cfg.Log.Format, cfg.Log.Level)
+	if err != nil {
+		log.Fatalf("Failed to create logger: %v", err)
+	}
+
+	if err := run(cfg, logger); err != nil {
+		logger.Error("Server stopped with error", "error", err)
+		os.Exit(1)
+	}
+}
+
+// ensureSchema creates the Neo4j schema constraints, retrying until it
+// succeeds or the server is stopped. Without the uniqueness constraints
+// concurrent MERGEs can create duplicate nodes, which would break idempotent
+// retries and WAL replay, so the server does not start without them.
+func ensureSchema(ctx context.Context, neo4jService *services.Neo4jService, timeout time.Duration, logger *utils.Logger) error {
+	for delay := time.Second; ; delay = min(2*delay, 30*time.Second) {
+		attemptCtx, cancel := context.WithTimeout(ctx, timeout)
+		err := neo4jService.EnsureSchema(attemptCtx)
+		cancel()
+		if err == nil {
+			return nil
+		}
+		logger.Warn("Failed to create Neo4j schema constraints, retrying", "error", err, "delay", delay)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return fmt.Errorf("failed to create Neo4j schema constraints: %v", err)
+		}
+	}
+}
+
+// run starts the server and blocks until SIGINT or SIGTERM, then drains
+// in-flight requests, flushes queued interactions and closes the store
+func run(cfg config.Config, logger *utils.Logger) error {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	appMetrics := metrics.New()
+
+	featureWindows, err := cfg.Features.FeatureWindows()
+	if err != nil {
+		return err
+	}
+
 	// Initialize services
-	logger := utils.NewLogger()
-	neo4jService := services.NewNeo4jService("bolt://localhost:7687", "neo4j", "Password", logger)
-	AIIntegrationService := services.NewAIIntegrationService("http://127.0.0.1:5000", logger)
-	userAnalysisService := services.NewUserAnalysisService(neo4jService, AIIntegrationService, logger)
+	var store services.GraphStore
+	var neo4jService *services.Neo4jService
+	switch cfg.Store.Backend {
+	case "neo4j":
+		neo4jService, err = services.NewNeo4jService(cfg.Neo4j.URI, cfg.Neo4j.Username, cfg.Neo4j.Password, logger)
+		if err != nil {
+			return err
+		}
+		neo4jService.QueryObserver = appMetrics.ObserveQuery
+		neo4jService.FeatureWindows = featureWindows
+		if err := ensureSchema(ctx, neo4jService, cfg.Health.CheckTimeout, logger); err != nil {
+			return err
+		}
+		store = neo4jService
+	case "memory":
+		memoryStore := services.NewMemoryStore(logger)
+		memoryStore.FeatureWindows = featureWindows
+		store = memoryStore
+	}
+	store = appMetrics.InstrumentStore(store)
+
+	AIIntegrationService := services.NewAIIntegrationServiceWithOptions(cfg.AI.ModelURL, services.AIClientOptions{
+		Timeout:          cfg.AI.Timeout,
+		MaxRetries:       cfg.AI.MaxRetries,
+		BaseBackoff:      cfg.AI.BaseBackoff,
+		MaxBackoff:       cfg.AI.MaxBackoff,
+		BreakerThreshold: cfg.AI.BreakerThreshold,
+		BreakerCooldown:  cfg.AI.BreakerCooldown,
+		MaxIdleConns:     cfg.AI.MaxIdleConns,
+	}, logger)
+	var enrichers []services.InteractionEnricher
+	var geoIP *services.GeoIPEnricher
+	if cfg.GeoIP.CityDB != "" || cfg.GeoIP.ASNDB != "" {
+		geoIP, err = services.NewGeoIPEnricher(services.GeoIPOptions{
+			CityDB:         cfg.GeoIP.CityDB,
+			ASNDB:          cfg.GeoIP.ASNDB,
+			ReloadInterval: cfg.GeoIP.ReloadInterval,
+			HostingASNs:    cfg.GeoIP.HostingASNs,
+		}, logger)
+		if err != nil {
+			return err
+		}
+		logger.Info("Loaded GeoIP databases", "city_db", cfg.GeoIP.CityDB, "asn_db", cfg.GeoIP.ASNDB)
+		enrichers = append(enrichers, geoIP)
+	}
+	var reputation *services.IPReputation
+	if len(cfg.Reputation.Lists) > 0 {
+		lists := make([]services.ReputationList, len(cfg.Reputation.Lists))
+		for i, list := range cfg.Reputation.Lists {
+			lists[i] = services.ReputationList{Path: list.Path, Category: list.Category, Format: list.Format, RowCategories: list.RowCategories}
+		}
+		reputation, err = services.NewIPReputation(services.ReputationOptions{
+			Lists:          lists,
+			ReloadInterval: cfg.Reputation.ReloadInterval,
+		}, logger)
+		if err != nil {
+			return err
+		}
+		logger.Info("Loaded reputation lists", "lists", len(lists), "categories", reputation.Categories())
+		enrichers = append(enrichers, reputation)
+	}
+	featureRegistry := services.NewDefaultFeatureRegistry(featureWindows)
+	if reputation != nil {
+		for _, category := range reputation.Categories() {
+			if err := featureRegistry.Register(services.ReputationCategoryFeature{Category: category}, false); err != nil {
+				return err
+			}
+		}
+	}
+	if len(cfg.Features.Enabled) > 0 {
+		if err := featureRegistry.Enable(cfg.Features.Enabled); err != nil {
+			return fmt.Errorf("invalid features.enabled: %v", err)
+		}
+	}
+
+	var scorer services.Scorer
+	switch cfg.Scoring.Model {
+	case "remote":
+		if err := featureRegistry.Require(services.RemoteModelFeatures); err != nil {
+			return fmt.Errorf("AI model needs a feature that is not available: %v", err)
+		}
+		scorer = appMetrics.InstrumentScorer(AIIntegrationService)
+	case "mlp":
+		mlpScorer, err := services.NewMLPScorer(cfg.Scoring.ModelPath)
+		if err != nil {
+			return err
+		}
+		if err := featureRegistry.Require(mlpScorer.Model.FeatureNames); err != nil {
+			return fmt.Errorf("MLP model %s needs a feature that is not available: %v", cfg.Scoring.ModelPath, err)
+		}
+		logger.Info("Loaded MLP model", "model_version", mlpScorer.Model.ModelVersion, "path", cfg.Scoring.ModelPath)
+		scorer = appMetrics.InstrumentScorer(mlpScorer)
+	}
+	if cfg.Scoring.Fallback {
+		h := cfg.Scoring.Heuristic
+		heuristicScorer := services.NewHeuristicScorer(services.HeuristicWeights{
+			TotalAccess:     h.TotalAccess,
+			HoneytokenRatio: h.HoneytokenRatio,
+			SharedIP:        h.SharedIP,
+			AssociatedScore: h.AssociatedScore,
+			TotalAccessCap:  h.TotalAccessCap,
+			SharedIPCap:     h.SharedIPCap,
+		})
+		scorer = services.NewFallbackScorer(scorer, appMetrics.InstrumentScorer(heuristicScorer), logger)
+	}
+	userAnalysisService := services.NewUserAnalysisService(store, scorer, logger)
+	userAnalysisService.Features = featureRegistry
+	riskJob := services.NewRiskPropagationJob(store, services.RiskPropagationOptions{
+		Interval:      cfg.Risk.Interval,
+		Damping:       cfg.Risk.Damping,
+		Tolerance:     cfg.Risk.Tolerance,
+		MaxIterations: cfg.Risk.MaxIterations,
+		SeedScore:     cfg.Risk.SeedScore,
+	}, logger)
+	inference := cfg.Inference
+	inferenceJob := services.NewAssociationInferenceJob(store, services.AssociationOptions{
+		Interval: inference.Interval,
+		Lookback: inference.Lookback,
+		SharedIP: services.SharedIPRule{
+			Enabled:    inference.SharedIP.Enabled,
+			Window:     inference.SharedIP.Window,
+			MaxUsers:   inference.SharedIP.MaxUsers,
+			Confidence: inference.SharedIP.Confidence,
+		},
+		SharedHoneytoken: services.SharedHoneytokenRule{
+			Enabled:    inference.SharedHoneytoken.Enabled,
+			MaxUsers:   inference.SharedHoneytoken.MaxUsers,
+			Confidence: inference.SharedHoneytoken.Confidence,
+		},
+		SimilarEndpoints: services.SimilarEndpointsRule{
+			Enabled:    inference.SimilarEndpoints.Enabled,
+			MinLength:  inference.SimilarEndpoints.MinLength,
+			MaxLength:  inference.SimilarEndpoints.MaxLength,
+			MaxUsers:   inference.SimilarEndpoints.MaxUsers,
+			Similarity: inference.SimilarEndpoints.Similarity,
+			Confidence: inference.SimilarEndpoints.Confidence,
+		},
+	}, logger)
+	communityJob := services.NewCommunityDetectionJob(store, services.CommunityOptions{
+		Interval:      cfg.Communities.Interval,
+		MaxIterations: cfg.Communities.MaxIterations,
+		MinSize:       cfg.Communities.MinSize,
+	}, logger)
+	rescoringJob := services.NewRescoringJob(userAnalysisService, services.RescoringOptions{
+		Interval:       cfg.Rescoring.Interval,
+		Workers:        cfg.Rescoring.Workers,
+		BatchSize:      cfg.Rescoring.BatchSize,
+		StaleOnly:      cfg.Rescoring.StaleOnly,
+		CheckpointPath: cfg.Rescoring.CheckpointPath,
+	}, logger)
+	batchWriter := services.NewBatchWriter(store, cfg.Ingestion.BatchSize, cfg.Ingestion.FlushInterval, logger)
+	ingestionQueue, err := services.NewIngestionQueue(batchWriter, services.IngestionQueueOptions{
+		MaxPending:     cfg.Ingestion.QueueSize,
+		Workers:        cfg.Ingestion.Workers,
+		MaxRetries:     cfg.Ingestion.MaxRetries,
+		BaseBackoff:    cfg.Ingestion.BaseBackoff,
+		MaxBackoff:     cfg.Ingestion.MaxBackoff,
+		ReplayInterval: cfg.Ingestion.ReplayInterval,
+		RetryAfter:     cfg.Ingestion.RetryAfter,
+		WALPath:        cfg.Ingestion.WALPath,
+		ReplayBatch:    cfg.Ingestion.BatchSize,
+		WriteBatch:     cfg.Ingestion.BatchSize,
+		Enrichers:      enrichers,
+	}, logger)
+	if err != nil {
+		return fmt.Errorf("failed to start ingestion queue: %v", err)
+	}
+	appMetrics.RegisterGauge("ingestion_queue_pending", "Interactions waiting in the ingestion queue.", func() float64 {
+		return float64(ingestionQueue.Pending())
+	})
+
+	appMetrics.RegisterGauge("rescoring_running", "1 while a bulk re-scoring run is in progress.", func() float64 {
+		if rescoringJob.Status().Running {
+			return 1
+		}
+		return 0
+	})
+
+	healthService := services.NewHealthService(Version, cfg.Health.Interval, cfg.Health.CheckTimeout, logger)
+	if neo4jService != nil {
+		healthService.Register("neo4j", neo4jService.VerifyConnectivity)
+	}
+	if cfg.Scoring.Model == "remote" {
+		healthService.Register("ai_model", AIIntegrationService.Ping)
+	}
+	healthService.Start()
+	defer healthService.Stop()
+	inferenceJob.Start()
+	riskJob.Start()
+	communityJob.Start()
+	rescoringJob.Start()
+	if geoIP != nil {
+		geoIP.Start()
+	}
+	if reputation != nil {
+		reputation.Start()
+	}
 
 	// Initialize handlers
-	interactionHandler := handlers.NewInteractionHandler(neo4jService, logger)
-	honeytokenHandler := handlers.NewHoneytokenHandler(neo4jService, logger)
+	interactionHandler := handlers.NewInteractionHandler(store, ingestionQueue, logger)
+	batchHandler := handlers.NewBatchHandler(ingestionQueue, logger)
+	honeytokenHandler := handlers.NewHoneytokenHandler(store, ingestionQueue, logger)
 	userAnalysisHandler := handlers.NewUserAnalysisHandler(userAnalysisService, logger)
+	logLevelHandler := handlers.NewLogLevelHandler(logger)
+	healthHandler := handlers.NewHealthHandler(healthService, logger)
+	rescoringHandler := handlers.NewRescoringHandler(rescoringJob, logger)
+	clustersHandler := handlers.NewClustersHandler(communityJob, logger)
 
 	// Define routes
-	http.HandleFunc("/api/log-interaction", interactionHandler.LogInteraction)
-	http.HandleFunc("/api/detect-honeytoken", honeytokenHandler.DetectHoneytoken)
-	http.HandleFunc("/api/analyze-user", userAnalysisHandler.AnalyzeUser)
-	http.HandleFunc("/api/associate-users", interactionHandler.LogAssociation)
+	mux := http.NewServeMux()
+	handle := func(route string, handler http.HandlerFunc) {
+		mux.HandleFunc(route, appMetrics.InstrumentHandler(route, handler))
+	}
+	handle("/api/log-interaction", interactionHandler.LogInteraction)
+	handle("/api/log-interactions", batchHandler.LogInteractionsBatch)
+	handle("/api/detect-honeytoken", honeytokenHandler.DetectHoneytoken)
+	handle("/api/honeytokens", honeytokenHandler.Honeytokens)
+	handle("/api/honeytokens/retire", honeytokenHandler.RetireHoneytoken)
+	handle("/api/analyze-user", userAnalysisHandler.AnalyzeUser)
+	handle("/api/associate-users", interactionHandler.LogAssociation)
+	handle("/api/associations", interactionHandler.ListAssociations)
+	handle("/api/score-history", userAnalysisHandler.ScoreHistory)
+	handle("/api/features", userAnalysisHandler.ListFeatures)
+	handle("/api/rescoring", rescoringHandler.Rescoring)
+	handle("/api/clusters", clustersHandler.ListClusters)
+	handle("/api/log-level", logLevelHandler.LogLevel)
+	mux.HandleFunc("/healthz", healthHandler.Healthz)
+	mux.HandleFunc("/readyz", healthHandler.Readyz)
+	mux.HandleFunc("/status", healthHandler.Status)
+	mux.Handle("/metrics", appMetrics.Handler())
+
+	server := &http.Server{
+		Addr:         fmt.Sprintf(":%d", cfg.Server.Port),
+		Handler:      handlers.RequestID(mux),
+		ReadTimeout:  cfg.Server.ReadTimeout,
+		WriteTimeout: cfg.Server.WriteTimeout,
+		IdleTimeout:  cfg.Server.IdleTimeout,
+	}
 
 	// Start the server
-	logger.Info("Starting server on port 8080...")
-	log.Fatal(http.ListenAndServe(":8080", nil))
+	serverErr := make(chan error, 1)
+	go func() {
+		logger.Info("Starting server", "port", cfg.Server.Port, "store", cfg.Store.Backend, "version", Version)
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			serverErr <- err
+		}
+		close(serverErr)
+	}()
+
+	var runErr error
+	select {
+	case runErr = <-serverErr:
+	case <-ctx.Done():
+		logger.Info("Shutdown signal received, draining requests")
+	}
+	stop()
+	healthService.SetShuttingDown()
+
+	// Shut down in dependency order: stop taking requests, interrupt
+	// re-scoring (it resumes from its checkpoint) and graph jobs, flush queued
+	// interactions, then close the store
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	defer cancel()
+
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		logger.Error("Failed to drain HTTP requests", "error", err)
+	}
+	rescoringJob.Stop()
+	inferenceJob.Stop()
+	riskJob.Stop()
+	communityJob.Stop()
+	if geoIP != nil {
+		geoIP.Stop()
+	}
+	if reputation != nil {
+		reputation.Stop()
+	}
+
+	flushed := make(chan struct{})
+	go func() {
+		ingestionQueue.Close()
+		batchWriter.Close()
+		close(flushed)
+	}()
+	select {
+	case <-flushed:
+		logger.Info("Flushed pending interactions")
+	case <-shutdownCtx.Done():
+		logger.Error("Timed out flushing pending interactions, spilling them to the WAL", "pending", ingestionQueue.Pending(), "wal_path", cfg.Ingestion.WALPath)
+		ingestionQueue.Abandon()
+	}
+
+	// Writes still in progress fail once the driver is closed and are spilled
+	// to the WAL, so wait for them before exiting
+	if neo4jService != nil {
+		if err := neo4jService.CloseDriver(shutdownCtx); err != nil && runErr == nil {
+			runErr = err
+		}
+	}
+	<-flushed
+
+	logger.Info("Server stopped")
+	return runErr
 }
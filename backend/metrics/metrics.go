@@ -0,0 +1,132 @@
+// Package metrics exposes Prometheus metrics for the backend. Services are
+// instrumented by wrapping them, so their callers do not change.
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "muds"
+
+// Metrics holds the collectors of the backend and the registry they are exposed from
+type Metrics struct {
+	Registry *prometheus.Registry
+
+	httpRequests        *prometheus.CounterVec
+	httpRequestDuration *prometheus.HistogramVec
+	storeDuration       *prometheus.HistogramVec
+	storeErrors         *prometheus.CounterVec
+	queryDuration       prometheus.Histogram
+	queryErrors         prometheus.Counter
+	predictionDuration  *prometheus.HistogramVec
+	predictionFailures  *prometheus.CounterVec
+	honeytokenTriggers  prometheus.Counter
+	maliciousnessScores *prometheus.HistogramVec
+}
+
+// New creates the collectors and registers them, along with the Go runtime
+// and process collectors, on a new registry
+func New() *Metrics {
+	m := &Metrics{
+		Registry: prometheus.NewRegistry(),
+		httpRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "http_requests_total",
+			Help:      "HTTP requests by route, method and status code.",
+		}, []string{"route", "method", "code"}),
+		httpRequestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "HTTP request latency by route and method.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"route", "method"}),
+		storeDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "store_operation_duration_seconds",
+			Help:      "Graph store operation latency by operation.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"operation"}),
+		storeErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "store_operation_errors_total",
+			Help:      "Failed graph store operations by operation.",
+		}, []string{"operation"}),
+		queryDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "neo4j_query_duration_seconds",
+			Help:      "Latency of read queries run through Neo4jService.RunQuery.",
+			Buckets:   prometheus.DefBuckets,
+		}),
+		queryErrors: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "neo4j_query_errors_total",
+			Help:      "Failed queries run through Neo4jService.RunQuery.",
+		}),
+		predictionDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "prediction_duration_seconds",
+			Help:      "Scoring latency by scorer.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"scorer"}),
+		predictionFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "prediction_failures_total",
+			Help:      "Failed scoring calls by scorer.",
+		}, []string{"scorer"}),
+		honeytokenTriggers: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "honeytoken_triggers_total",
+			Help:      "Stored interactions that triggered a honeytoken.",
+		}),
+		maliciousnessScores: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "maliciousness_score",
+			Help:      "Maliciousness scores by scorer.",
+			Buckets:   []float64{0.1, 0.2, 0.3, 0.4, 0.5, 0.6, 0.7, 0.8, 0.9, 1},
+		}, []string{"scorer"}),
+	}
+
+	m.Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.httpRequests,
+		m.httpRequestDuration,
+		m.storeDuration,
+		m.storeErrors,
+		m.queryDuration,
+		m.queryErrors,
+		m.predictionDuration,
+		m.predictionFailures,
+		m.honeytokenTriggers,
+		m.maliciousnessScores,
+	)
+	return m
+}
+
+// Handler serves the metrics in the Prometheus text format
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.Registry, promhttp.HandlerOpts{Registry: m.Registry})
+}
+
+// ObserveQuery records a Neo4j query; it matches services.QueryObserver
+func (m *Metrics) ObserveQuery(ctx context.Context, duration time.Duration, err error) {
+	m.queryDuration.Observe(duration.Seconds())
+	if err != nil {
+		m.queryErrors.Inc()
+	}
+}
+
+// RegisterGauge exposes a value read at scrape time, such as a queue length
+func (m *Metrics) RegisterGauge(name, help string, value func() float64) {
+	m.Registry.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      name,
+		Help:      help,
+	}, value))
+}
@@ -0,0 +1,35 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"backend/models"
+	"backend/services"
+)
+
+// InstrumentedScorer times a scorer and records the scores it returns
+type InstrumentedScorer struct {
+	services.Scorer
+	metrics *Metrics
+}
+
+// InstrumentScorer wraps a scorer such as services.AIIntegrationService.
+// Metrics are labeled with the scorer's name.
+func (m *Metrics) InstrumentScorer(scorer services.Scorer) *InstrumentedScorer {
+	return &InstrumentedScorer{Scorer: scorer, metrics: m}
+}
+
+// Score calls the wrapped scorer
+func (s *InstrumentedScorer) Score(ctx context.Context, vector models.FeatureVector) (services.ScoreResult, error) {
+	name := s.Scorer.Name()
+	start := time.Now()
+	result, err := s.Scorer.Score(ctx, vector)
+	s.metrics.predictionDuration.WithLabelValues(name).Observe(time.Since(start).Seconds())
+	if err != nil {
+		s.metrics.predictionFailures.WithLabelValues(name).Inc()
+		return result, err
+	}
+	s.metrics.maliciousnessScores.WithLabelValues(name).Observe(result.Score())
+	return result, nil
+}
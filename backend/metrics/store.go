@@ -0,0 +1,209 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"backend/models"
+	"backend/services"
+)
+
+// InstrumentedStore times the operations of a graph store and counts their
+// errors and the honeytoken triggers it stores
+type InstrumentedStore struct {
+	services.GraphStore
+	metrics *Metrics
+}
+
+// InstrumentStore wraps a graph store
+func (m *Metrics) InstrumentStore(store services.GraphStore) *InstrumentedStore {
+	return &InstrumentedStore{GraphStore: store, metrics: m}
+}
+
+// observe records the duration and outcome of an operation started at start
+func (s *InstrumentedStore) observe(operation string, start time.Time, err error) {
+	s.metrics.storeDuration.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+	if err != nil {
+		s.metrics.storeErrors.WithLabelValues(operation).Inc()
+	}
+}
+
+func (s *InstrumentedStore) SaveInteraction(ctx context.Context, interaction models.Interaction) error {
+	start := time.Now()
+	err := s.GraphStore.SaveInteraction(ctx, interaction)
+	s.observe("SaveInteraction", start, err)
+	if err == nil && interaction.HoneytokenTriggered {
+		s.metrics.honeytokenTriggers.Inc()
+	}
+	return err
+}
+
+func (s *InstrumentedStore) SaveInteractions(ctx context.Context, interactions []models.Interaction) error {
+	start := time.Now()
+	err := s.GraphStore.SaveInteractions(ctx, interactions)
+	s.observe("SaveInteractions", start, err)
+	if err == nil {
+		for _, interaction := range interactions {
+			if interaction.HoneytokenTriggered {
+				s.metrics.honeytokenTriggers.Inc()
+			}
+		}
+	}
+	return err
+}
+
+func (s *InstrumentedStore) AssociatedWith(ctx context.Context, user1, user2 string) error {
+	start := time.Now()
+	err := s.GraphStore.AssociatedWith(ctx, user1, user2)
+	s.observe("AssociatedWith", start, err)
+	return err
+}
+
+func (s *InstrumentedStore) GetMaliciousScore(ctx context.Context, userID string) (float64, error) {
+	start := time.Now()
+	score, err := s.GraphStore.GetMaliciousScore(ctx, userID)
+	s.observe("GetMaliciousScore", start, err)
+	return score, err
+}
+
+func (s *InstrumentedStore) UpdateMaliciousScore(ctx context.Context, userID string, newScore float64) error {
+	start := time.Now()
+	err := s.GraphStore.UpdateMaliciousScore(ctx, userID, newScore)
+	s.observe("UpdateMaliciousScore", start, err)
+	return err
+}
+
+func (s *InstrumentedStore) RecordScore(ctx context.Context, snapshot models.ScoreSnapshot) error {
+	start := time.Now()
+	err := s.GraphStore.RecordScore(ctx, snapshot)
+	s.observe("RecordScore", start, err)
+	return err
+}
+
+func (s *InstrumentedStore) GetScoreHistory(ctx context.Context, userID string) ([]models.ScoreSnapshot, error) {
+	start := time.Now()
+	history, err := s.GraphStore.GetScoreHistory(ctx, userID)
+	s.observe("GetScoreHistory", start, err)
+	return history, err
+}
+
+func (s *InstrumentedStore) CreateHoneytoken(ctx context.Context, token models.Honeytoken) error {
+	start := time.Now()
+	err := s.GraphStore.CreateHoneytoken(ctx, token)
+	s.observe("CreateHoneytoken", start, err)
+	return err
+}
+
+func (s *InstrumentedStore) GetHoneytoken(ctx context.Context, tokenID string) (models.Honeytoken, error) {
+	start := time.Now()
+	token, err := s.GraphStore.GetHoneytoken(ctx, tokenID)
+	s.observe("GetHoneytoken", start, err)
+	return token, err
+}
+
+func (s *InstrumentedStore) ListHoneytokens(ctx context.Context, includeRetired bool) ([]models.Honeytoken, error) {
+	start := time.Now()
+	tokens, err := s.GraphStore.ListHoneytokens(ctx, includeRetired)
+	s.observe("ListHoneytokens", start, err)
+	return tokens, err
+}
+
+func (s *InstrumentedStore) RetireHoneytoken(ctx context.Context, tokenID string) error {
+	start := time.Now()
+	err := s.GraphStore.RetireHoneytoken(ctx, tokenID)
+	s.observe("RetireHoneytoken", start, err)
+	return err
+}
+
+func (s *InstrumentedStore) ExtractFeatures(ctx context.Context, userID string) (models.UserFeatures, error) {
+	start := time.Now()
+	features, err := s.GraphStore.ExtractFeatures(ctx, userID)
+	s.observe("ExtractFeatures", start, err)
+	return features, err
+}
+
+func (s *InstrumentedStore) GetInteractions(ctx context.Context, userID string, since time.Time) ([]models.Interaction, error) {
+	start := time.Now()
+	interactions, err := s.GraphStore.GetInteractions(ctx, userID, since)
+	s.observe("GetInteractions", start, err)
+	return interactions, err
+}
+
+func (s *InstrumentedStore) ListUserIDs(ctx context.Context, after string, limit int, staleOnly bool) ([]string, error) {
+	start := time.Now()
+	userIDs, err := s.GraphStore.ListUserIDs(ctx, after, limit, staleOnly)
+	s.observe("ListUserIDs", start, err)
+	return userIDs, err
+}
+
+func (s *InstrumentedStore) ExportUserGraph(ctx context.Context) (models.UserGraph, error) {
+	start := time.Now()
+	graph, err := s.GraphStore.ExportUserGraph(ctx)
+	s.observe("ExportUserGraph", start, err)
+	return graph, err
+}
+
+func (s *InstrumentedStore) SavePropagatedRisk(ctx context.Context, risks map[string]float64) error {
+	start := time.Now()
+	err := s.GraphStore.SavePropagatedRisk(ctx, risks)
+	s.observe("SavePropagatedRisk", start, err)
+	return err
+}
+
+func (s *InstrumentedStore) SaveClusters(ctx context.Context, clusters map[string]string) error {
+	start := time.Now()
+	err := s.GraphStore.SaveClusters(ctx, clusters)
+	s.observe("SaveClusters", start, err)
+	return err
+}
+
+func (s *InstrumentedStore) ListInteractions(ctx context.Context, since time.Time) ([]models.Interaction, error) {
+	start := time.Now()
+	interactions, err := s.GraphStore.ListInteractions(ctx, since)
+	s.observe("ListInteractions", start, err)
+	return interactions, err
+}
+
+func (s *InstrumentedStore) ListSharedIPs(ctx context.Context, since time.Time, maxUsers int) (map[string][]models.Interaction, error) {
+	start := time.Now()
+	byIP, err := s.GraphStore.ListSharedIPs(ctx, since, maxUsers)
+	s.observe("ListSharedIPs", start, err)
+	return byIP, err
+}
+
+func (s *InstrumentedStore) ListSharedHoneytokens(ctx context.Context, since time.Time, maxUsers int) (map[string][]string, error) {
+	start := time.Now()
+	usersByToken, err := s.GraphStore.ListSharedHoneytokens(ctx, since, maxUsers)
+	s.observe("ListSharedHoneytokens", start, err)
+	return usersByToken, err
+}
+
+func (s *InstrumentedStore) ListEndpointSequences(ctx context.Context, since time.Time, minLength, maxLength int) (map[string][]string, error) {
+	start := time.Now()
+	sequences, err := s.GraphStore.ListEndpointSequences(ctx, since, minLength, maxLength)
+	s.observe("ListEndpointSequences", start, err)
+	return sequences, err
+}
+
+func (s *InstrumentedStore) PruneAssociations(ctx context.Context, inferredAt time.Time) (int, error) {
+	start := time.Now()
+	pruned, err := s.GraphStore.PruneAssociations(ctx, inferredAt)
+	s.observe("PruneAssociations", start, err)
+	return pruned, err
+}
+
+func (s *InstrumentedStore) SaveAssociations(ctx context.Context, associations []models.Association) error {
+	start := time.Now()
+	err := s.GraphStore.SaveAssociations(ctx, associations)
+	s.observe("SaveAssociations", start, err)
+	return err
+}
+
+func (s *InstrumentedStore) GetAssociations(ctx context.Context, userID string) ([]models.Association, error) {
+	start := time.Now()
+	associations, err := s.GraphStore.GetAssociations(ctx, userID)
+	s.observe("GetAssociations", start, err)
+	return associations, err
+}
+
+var _ services.GraphStore = (*InstrumentedStore)(nil)
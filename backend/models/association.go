@@ -0,0 +1,46 @@
+package models
+
+import "time"
+
+// Association types. Explicit associations come from /api/associate-users;
+// the others are inferred from interactions.
+const (
+	AssociationExplicit         = "explicit"
+	AssociationSharedIP         = "shared_ip"
+	AssociationSharedHoneytoken = "shared_honeytoken"
+	AssociationSimilarEndpoints = "similar_endpoints"
+)
+
+// MaxAssociationEvidence bounds the evidence recorded on an association
+const MaxAssociationEvidence = 5
+
+// Association is a typed ASSOCIATED_WITH edge between two users. Inferred
+// associations are stored once per pair of users and type, in both directions.
+type Association struct {
+	UserID      string     `json:"user_id"`
+	AssociateID string     `json:"associate_id"`
+	Type        string     `json:"type"`
+	Confidence  float64    `json:"confidence"`            // In (0, 1]; 1 for explicit associations
+	Weight      int        `json:"weight"`                // Observations supporting the association
+	Evidence    []string   `json:"evidence"`              // Up to MaxAssociationEvidence human-readable observations
+	InferredAt  *time.Time `json:"inferred_at,omitempty"` // Last inference run that found the association
+}
+
+// CombinedConfidence returns the confidence that two users are associated
+// given the confidences of their associations of different types, each an
+// independent observation: 1 - (1 - c1)(1 - c2)...
+func CombinedConfidence(confidences ...float64) float64 {
+	independent := 1.0
+	for _, confidence := range confidences {
+		independent *= 1 - confidence
+	}
+	return 1 - independent
+}
+
+// AddEvidence counts an observation and records it if there is room
+func (a *Association) AddEvidence(evidence string) {
+	a.Weight++
+	if len(a.Evidence) < MaxAssociationEvidence {
+		a.Evidence = append(a.Evidence, evidence)
+	}
+}
@@ -0,0 +1,31 @@
+package models
+
+// Cluster is a community of users found on the association graph, with
+// aggregate risk statistics of its members
+type Cluster struct {
+	ClusterID      string   `json:"cluster_id"` // Smallest member user ID
+	Size           int      `json:"size"`
+	MeanScore      float64  `json:"mean_score"` // Mean malicious_score of the members
+	MaxScore       float64  `json:"max_score"`
+	HoneytokenHits int64    `json:"honeytoken_hits"` // Honeytoken triggers by all members
+	SharedIPs      []string `json:"shared_ips"`      // IPs used by at least two members
+	Members        []string `json:"members"`
+}
+
+// MoreSuspiciousThan orders clusters by mean score, then honeytoken hits,
+// shared IPs and size
+func (c Cluster) MoreSuspiciousThan(other Cluster) bool {
+	if c.MeanScore != other.MeanScore {
+		return c.MeanScore > other.MeanScore
+	}
+	if c.HoneytokenHits != other.HoneytokenHits {
+		return c.HoneytokenHits > other.HoneytokenHits
+	}
+	if len(c.SharedIPs) != len(other.SharedIPs) {
+		return len(c.SharedIPs) > len(other.SharedIPs)
+	}
+	if c.Size != other.Size {
+		return c.Size > other.Size
+	}
+	return c.ClusterID < other.ClusterID
+}
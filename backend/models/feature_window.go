@@ -0,0 +1,124 @@
+package models
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FeatureSetVersion identifies the features sent to the model. Version 1 had
+// lifetime totals only; version 2 adds windowed counts, velocity and
+// acceleration; version 3 adds propagated_risk; version 4 adds the shared-IP
+// counts ips_shared_with_others, users_sharing_ips and subnets_shared_with_others;
+// version 5 adds the GeoIP features distinct_countries and hosting_traffic_ratio;
+// version 6 adds reputation_traffic_ratio.
+const FeatureSetVersion = 6
+
+// FeatureWindow is the lookback window of windowed features
+type FeatureWindow time.Duration
+
+// DefaultFeatureWindows are the windows used unless configured otherwise
+var DefaultFeatureWindows = []FeatureWindow{
+	FeatureWindow(time.Hour),
+	FeatureWindow(24 * time.Hour),
+	FeatureWindow(7 * 24 * time.Hour),
+}
+
+// ParseFeatureWindow parses a window such as "90m", "1h" or "7d"
+func ParseFeatureWindow(value string) (FeatureWindow, error) {
+	var duration time.Duration
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, fmt.Errorf("invalid feature window %q", value)
+		}
+		duration = time.Duration(n) * 24 * time.Hour
+	} else {
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			return 0, fmt.Errorf("invalid feature window %q", value)
+		}
+		duration = parsed
+	}
+	if duration < time.Minute || duration%time.Minute != 0 {
+		return 0, fmt.Errorf("feature window %q must be a positive number of minutes", value)
+	}
+	return FeatureWindow(duration), nil
+}
+
+// String returns the window in its largest whole unit, e.g. "7d" or "90m",
+// except that a single day is "24h". It is used as the suffix of windowed
+// feature names.
+func (w FeatureWindow) String() string {
+	d := time.Duration(w)
+	switch {
+	case d > 24*time.Hour && d%(24*time.Hour) == 0:
+		return fmt.Sprintf("%dd", d/(24*time.Hour))
+	case d%time.Hour == 0:
+		return fmt.Sprintf("%dh", d/time.Hour)
+	}
+	return fmt.Sprintf("%dm", d/time.Minute)
+}
+
+// SortFeatureWindows returns the windows shortest first without duplicates
+func SortFeatureWindows(windows []FeatureWindow) []FeatureWindow {
+	sorted := append([]FeatureWindow(nil), windows...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	unique := sorted[:0]
+	for i, window := range sorted {
+		if i == 0 || window != sorted[i-1] {
+			unique = append(unique, window)
+		}
+	}
+	return unique
+}
+
+// WindowFeatures counts a user's activity within one window ending now
+type WindowFeatures struct {
+	Window         FeatureWindow `json:"-"`
+	Name           string        `json:"window"`          // Window.String()
+	Interactions   int64         `json:"interactions"`    // Interactions in the window
+	HoneytokenHits int64         `json:"honeytoken_hits"` // Honeytoken triggers in the window
+	DistinctIPs    int64         `json:"distinct_ips"`    // Distinct IPs used in the window
+	ErrorResponses int64         `json:"error_responses"` // Interactions answered with status >= 400
+}
+
+// NewWindowFeatures creates empty counts for a window
+func NewWindowFeatures(window FeatureWindow) WindowFeatures {
+	return WindowFeatures{Window: window, Name: window.String()}
+}
+
+// rate returns count per hour of the window
+func (w WindowFeatures) rate(count int64) float64 {
+	return float64(count) / time.Duration(w.Window).Hours()
+}
+
+// ratio divides two rates; windows are nested, so a zero denominator implies
+// a zero numerator and the ratio is 0
+func ratio(numerator, denominator float64) float64 {
+	if denominator == 0 {
+		return 0
+	}
+	return numerator / denominator
+}
+
+// velocity compares the rate of the shortest window with the next one: 1 is
+// steady activity, above 1 a burst. Acceleration compares that velocity with
+// the velocity of the next pair of windows.
+func velocity(windows []WindowFeatures, count func(WindowFeatures) int64) (float64, float64) {
+	rates := make([]float64, len(windows))
+	for i, window := range windows {
+		rates[i] = window.rate(count(window))
+	}
+
+	var v, a float64
+	if len(rates) >= 2 {
+		v = ratio(rates[0], rates[1])
+	}
+	if len(rates) >= 3 {
+		a = ratio(v, ratio(rates[1], rates[2]))
+	}
+	return v, a
+}
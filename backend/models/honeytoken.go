@@ -0,0 +1,108 @@
+package models
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// HoneytokenType is the kind of bait a honeytoken represents
+type HoneytokenType string
+
+const (
+	HoneytokenAPIKey    HoneytokenType = "api_key"    // Fake API key or credential
+	HoneytokenDecoyURL  HoneytokenType = "decoy_url"  // Decoy URL or endpoint
+	HoneytokenCanaryRow HoneytokenType = "canary_row" // Canary database row
+)
+
+// HoneytokenSeverity is how strongly a trigger indicates malicious intent
+type HoneytokenSeverity string
+
+const (
+	SeverityLow      HoneytokenSeverity = "low"
+	SeverityMedium   HoneytokenSeverity = "medium"
+	SeverityHigh     HoneytokenSeverity = "high"
+	SeverityCritical HoneytokenSeverity = "critical"
+)
+
+// DefaultHoneytokenWeight is the weight of a honeytoken trigger that does not
+// reference a registered token
+const DefaultHoneytokenWeight = 1.0
+
+// severityWeights maps each severity to the weight of a trigger
+var severityWeights = map[HoneytokenSeverity]float64{
+	SeverityLow:      1.0,
+	SeverityMedium:   2.0,
+	SeverityHigh:     4.0,
+	SeverityCritical: 8.0,
+}
+
+// Weight returns how much a trigger of this severity counts towards a user's
+// weighted honeytoken score
+func (s HoneytokenSeverity) Weight() float64 {
+	if weight, ok := severityWeights[s]; ok {
+		return weight
+	}
+	return DefaultHoneytokenWeight
+}
+
+// Honeytoken represents a registered piece of bait
+type Honeytoken struct {
+	TokenID     string             `json:"token_id"`             // Unique ID of the honeytoken
+	Type        HoneytokenType     `json:"type"`                 // Kind of bait
+	Severity    HoneytokenSeverity `json:"severity"`             // How suspicious a trigger is
+	Placement   string             `json:"placement"`            // Where the bait is planted
+	Description string             `json:"description"`          // Free-form notes
+	CreatedAt   time.Time          `json:"created_at"`           // Time the token was registered
+	RetiredAt   *time.Time         `json:"retired_at,omitempty"` // Time the token was retired, if it was
+}
+
+// NewHoneytoken creates a new Honeytoken instance with a random token ID
+func NewHoneytoken(tokenType HoneytokenType, severity HoneytokenSeverity, placement, description string) Honeytoken {
+	id := make([]byte, 8)
+	rand.Read(id)
+	return Honeytoken{
+		TokenID:     "ht_" + hex.EncodeToString(id),
+		Type:        tokenType,
+		Severity:    severity,
+		Placement:   placement,
+		Description: description,
+		CreatedAt:   time.Now(),
+	}
+}
+
+// Active reports whether the honeytoken has not been retired
+func (h Honeytoken) Active() bool {
+	return h.RetiredAt == nil
+}
+
+// Validate checks that the honeytoken is well formed
+func (h Honeytoken) Validate() error {
+	switch h.Type {
+	case HoneytokenAPIKey, HoneytokenDecoyURL, HoneytokenCanaryRow:
+	default:
+		return fmt.Errorf("unknown honeytoken type %q", h.Type)
+	}
+	if _, ok := severityWeights[h.Severity]; !ok {
+		return fmt.Errorf("unknown honeytoken severity %q", h.Severity)
+	}
+	if strings.TrimSpace(h.Placement) == "" {
+		return fmt.Errorf("placement is required")
+	}
+	return nil
+}
+
+// ToMap converts the Honeytoken struct to a map for easier handling
+func (h Honeytoken) ToMap() map[string]interface{} {
+	return map[string]interface{}{
+		"token_id":    h.TokenID,
+		"type":        string(h.Type),
+		"severity":    string(h.Severity),
+		"weight":      h.Severity.Weight(),
+		"placement":   h.Placement,
+		"description": h.Description,
+		"created_at":  h.CreatedAt.Format(time.RFC3339),
+	}
+}
@@ -1,6 +1,34 @@
 package models
 
-import "time"
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// MaxTimestampSkew is how far in the future a client-supplied timestamp may be
+	MaxTimestampSkew = 5 * time.Minute
+	// MaxTimestampAge is how far in the past a client-supplied timestamp may be
+	MaxTimestampAge = 7 * 24 * time.Hour
+)
+
+// validMethods lists the HTTP methods accepted on an interaction
+var validMethods = map[string]bool{
+	http.MethodGet:     true,
+	http.MethodHead:    true,
+	http.MethodPost:    true,
+	http.MethodPut:     true,
+	http.MethodPatch:   true,
+	http.MethodDelete:  true,
+	http.MethodConnect: true,
+	http.MethodOptions: true,
+	http.MethodTrace:   true,
+}
 
 // Interaction represents a user's interaction with the system
 type Interaction struct {
@@ -9,7 +37,26 @@ type Interaction struct {
 	Timestamp           time.Time `json:"timestamp"`            // Time of the interaction
 	ResponseStatusCode  int       `json:"response_status_code"` // HTTP response status code
 	HoneytokenTriggered bool      `json:"honeytoken_triggered"` // Whether this interaction involved a honeytoken
+	HoneytokenID        string    `json:"honeytoken_id"`        // Registered honeytoken that was triggered, if any
 	IPAddress           string    `json:"ip_address"`           // User's IP address
+	Method              string    `json:"method"`               // HTTP method of the request
+	UserAgent           string    `json:"user_agent"`           // User-Agent header of the request
+	SessionID           string    `json:"session_id"`           // Session the request belongs to
+	RequestSize         int64     `json:"request_size"`         // Request body size in bytes
+	LatencyMs           float64   `json:"latency_ms"`           // Time taken to serve the request in milliseconds
+
+	// Filled in from the GeoIP databases on ingestion, see services.GeoIPEnricher
+	Country         string `json:"country,omitempty"`          // ISO 3166-1 country code of the IP address
+	City            string `json:"city,omitempty"`             // English city name of the IP address
+	ASN             int    `json:"asn,omitempty"`              // Autonomous system number of the IP address
+	ASOrg           string `json:"as_org,omitempty"`           // Organization owning the autonomous system
+	HostingProvider bool   `json:"hosting_provider,omitempty"` // Whether the IP address belongs to a cloud or hosting provider
+
+	// Filled in from the reputation lists on ingestion, see services.IPReputation
+	Reputation []string `json:"reputation,omitempty"` // Categories of the lists the IP address is on, e.g. tor
+
+	// Assigned on ingestion, see services.IngestionQueue
+	ID string `json:"interaction_id,omitempty"` // Identifies the interaction so retried and replayed writes store it once
 }
 
 // NewInteraction creates a new Interaction instance
@@ -24,14 +71,73 @@ func NewInteraction(userID, endpoint string, statusCode int, honeytoken bool, ip
 	}
 }
 
+// NewInteractionID returns a random interaction ID
+func NewInteractionID() string {
+	id := make([]byte, 16)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// Validate checks that the interaction is well formed. Timestamps are checked
+// against now with MaxTimestampSkew and MaxTimestampAge.
+func (i Interaction) Validate(now time.Time) error {
+	if strings.TrimSpace(i.UserID) == "" {
+		return fmt.Errorf("user_id is required")
+	}
+	if !strings.HasPrefix(i.Endpoint, "/") {
+		return fmt.Errorf("endpoint must be a path starting with '/'")
+	}
+	if i.ResponseStatusCode < 100 || i.ResponseStatusCode > 599 {
+		return fmt.Errorf("response_status_code %d is not a valid HTTP status code", i.ResponseStatusCode)
+	}
+	if net.ParseIP(i.IPAddress) == nil {
+		return fmt.Errorf("ip_address %q is not a valid IP address", i.IPAddress)
+	}
+	if i.HoneytokenID != "" && !i.HoneytokenTriggered {
+		return fmt.Errorf("honeytoken_id is set but honeytoken_triggered is false")
+	}
+	if i.Method != "" && !validMethods[i.Method] {
+		return fmt.Errorf("method %q is not a valid HTTP method", i.Method)
+	}
+	if i.RequestSize < 0 {
+		return fmt.Errorf("request_size must not be negative")
+	}
+	if i.LatencyMs < 0 {
+		return fmt.Errorf("latency_ms must not be negative")
+	}
+	if i.Timestamp.IsZero() {
+		return fmt.Errorf("timestamp is required")
+	}
+	if i.Timestamp.After(now.Add(MaxTimestampSkew)) {
+		return fmt.Errorf("timestamp %s is too far in the future", i.Timestamp.Format(time.RFC3339))
+	}
+	if i.Timestamp.Before(now.Add(-MaxTimestampAge)) {
+		return fmt.Errorf("timestamp %s is too far in the past", i.Timestamp.Format(time.RFC3339))
+	}
+	return nil
+}
+
 // ToMap converts the Interaction struct to a map for easier handling
 func (i Interaction) ToMap() map[string]interface{} {
 	return map[string]interface{}{
+		"interaction_id":       i.ID,
 		"user_id":              i.UserID,
 		"endpoint":             i.Endpoint,
 		"timestamp":            i.Timestamp.Format(time.RFC3339),
 		"response_status_code": i.ResponseStatusCode,
 		"honeytoken_triggered": i.HoneytokenTriggered,
+		"honeytoken_id":        i.HoneytokenID,
 		"ip_address":           i.IPAddress,
+		"method":               i.Method,
+		"user_agent":           i.UserAgent,
+		"session_id":           i.SessionID,
+		"request_size":         i.RequestSize,
+		"latency_ms":           i.LatencyMs,
+		"country":              i.Country,
+		"city":                 i.City,
+		"asn":                  i.ASN,
+		"as_org":               i.ASOrg,
+		"hosting_provider":     i.HostingProvider,
+		"reputation":           i.Reputation,
 	}
 }
@@ -0,0 +1,131 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"time"
+)
+
+// PredictionSchemaVersion is the version of the FeatureVector/Prediction
+// contract between the backend and the model server. Bump it whenever a field
+// is renamed, removed or changes meaning.
+const PredictionSchemaVersion = 1
+
+// Default bounds of a maliciousness score, used when a model reports none
+const (
+	DefaultScoreMin = 0.0
+	DefaultScoreMax = 1.0
+)
+
+// FeatureVector is the request sent to a model: the user's features tagged
+// with the schema and feature set versions they follow
+type FeatureVector struct {
+	SchemaVersion     int
+	FeatureSetVersion int
+	UserFeatures
+	// Values are the enabled features by name, assembled by a feature
+	// registry. Nil sends every feature of UserFeatures.ToMap.
+	Values map[string]interface{}
+}
+
+// NewFeatureVector creates a FeatureVector for the current schema and feature set versions
+func NewFeatureVector(features UserFeatures) FeatureVector {
+	return FeatureVector{
+		SchemaVersion:     PredictionSchemaVersion,
+		FeatureSetVersion: FeatureSetVersion,
+		UserFeatures:      features,
+	}
+}
+
+// Features returns the named features sent to the model
+func (v FeatureVector) Features() map[string]interface{} {
+	if v.Values != nil {
+		return v.Values
+	}
+	return v.UserFeatures.ToMap()
+}
+
+// MarshalJSON encodes the vector as one flat object: the versions, the
+// windows and every named feature
+func (v FeatureVector) MarshalJSON() ([]byte, error) {
+	features := v.Features()
+	fields := make(map[string]interface{}, len(features)+3)
+	for name, value := range features {
+		fields[name] = value
+	}
+	fields["schema_version"] = v.SchemaVersion
+	fields["feature_set_version"] = v.FeatureSetVersion
+	fields["feature_windows"] = v.UserFeatures.WindowNames()
+	return json.Marshal(fields)
+}
+
+// Prediction is the response of a model
+type Prediction struct {
+	SchemaVersion int      `json:"schema_version"`
+	Score         *float64 `json:"maliciousness_score"` // Nil when the model sent no score
+	ModelName     string   `json:"model_name"`
+	ModelVersion  string   `json:"model_version"`
+	ScoreMin      *float64 `json:"score_min,omitempty"` // Lower bound of Score, DefaultScoreMin if nil
+	ScoreMax      *float64 `json:"score_max,omitempty"` // Upper bound of Score, DefaultScoreMax if nil
+}
+
+// NewPrediction creates a Prediction with the default score bounds
+func NewPrediction(score float64, modelName, modelVersion string) Prediction {
+	return Prediction{
+		SchemaVersion: PredictionSchemaVersion,
+		Score:         &score,
+		ModelName:     modelName,
+		ModelVersion:  modelVersion,
+	}
+}
+
+// Bounds returns the range the score must lie in
+func (p Prediction) Bounds() (float64, float64) {
+	low, high := DefaultScoreMin, DefaultScoreMax
+	if p.ScoreMin != nil {
+		low = *p.ScoreMin
+	}
+	if p.ScoreMax != nil {
+		high = *p.ScoreMax
+	}
+	return low, high
+}
+
+// Validate rejects predictions of another schema version and missing, NaN,
+// infinite or out-of-range scores
+func (p Prediction) Validate() error {
+	if p.SchemaVersion != PredictionSchemaVersion {
+		return fmt.Errorf("unsupported schema_version %d, expected %d", p.SchemaVersion, PredictionSchemaVersion)
+	}
+	if p.Score == nil {
+		return fmt.Errorf("maliciousness_score is required")
+	}
+	score := *p.Score
+	if math.IsNaN(score) || math.IsInf(score, 0) {
+		return fmt.Errorf("maliciousness_score %v is not a finite number", score)
+	}
+	low, high := p.Bounds()
+	if low > high {
+		return fmt.Errorf("score_min %v exceeds score_max %v", low, high)
+	}
+	if score < low || score > high {
+		return fmt.Errorf("maliciousness_score %v is outside [%v, %v]", score, low, high)
+	}
+	return nil
+}
+
+// AnalysisResult is the response of /api/analyze-user
+type AnalysisResult struct {
+	SchemaVersion      int                    `json:"schema_version"`            // PredictionSchemaVersion
+	UserID             string                 `json:"user_id"`                   // Analyzed user
+	MaliciousnessScore float64                `json:"maliciousness_score"`       // Score between ScoreMin and ScoreMax
+	ScoreMin           float64                `json:"score_min"`                 // Lower bound of the score
+	ScoreMax           float64                `json:"score_max"`                 // Upper bound of the score
+	ModelName          string                 `json:"model_name"`                // Model that produced the score
+	ModelVersion       string                 `json:"model_version"`             // Version of that model
+	Scorer             string                 `json:"scorer"`                    // Scorer that ran the model, e.g. remote_model or heuristic
+	FallbackReason     string                 `json:"fallback_reason,omitempty"` // Why the primary scorer was bypassed, if it was
+	Features           map[string]interface{} `json:"features"`                  // Features the model was given, by name
+	AnalyzedAt         time.Time              `json:"analyzed_at"`               // Time of the analysis
+}
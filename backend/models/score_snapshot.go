@@ -0,0 +1,41 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// ScoreSnapshot records a single scoring event for a user
+type ScoreSnapshot struct {
+	UserID       string       `json:"user_id"`       // Unique ID of the scored user
+	Timestamp    time.Time    `json:"timestamp"`     // Time the features were read, before scoring
+	Score        float64      `json:"score"`         // Predicted maliciousness score
+	ModelVersion string       `json:"model_version"` // Version of the model that produced the score
+	Features     UserFeatures `json:"features"`      // Features the model was given
+}
+
+// NewScoreSnapshot creates a new ScoreSnapshot instance. timestamp is when
+// the features were read, so interactions saved while scoring make the user
+// stale again.
+func NewScoreSnapshot(userID string, timestamp time.Time, score float64, modelVersion string, features UserFeatures) ScoreSnapshot {
+	return ScoreSnapshot{
+		UserID:       userID,
+		Timestamp:    timestamp,
+		Score:        score,
+		ModelVersion: modelVersion,
+		Features:     features,
+	}
+}
+
+// ToMap converts the ScoreSnapshot struct to a map for easier handling.
+// Features are stored as a JSON string since graph properties cannot be maps.
+func (s ScoreSnapshot) ToMap() map[string]interface{} {
+	features, _ := json.Marshal(s.Features)
+	return map[string]interface{}{
+		"user_id":       s.UserID,
+		"timestamp":     s.Timestamp.Format(time.RFC3339Nano), // Compared with User.last_interaction_at
+		"score":         s.Score,
+		"model_version": s.ModelVersion,
+		"features":      string(features),
+	}
+}
@@ -0,0 +1,73 @@
+package models
+
+// windowedFeaturePrefixes name the windowed counts; the window follows, e.g. interactions_24h
+var windowedFeaturePrefixes = []string{"interactions_", "honeytoken_hits_", "distinct_ips_", "error_responses_"}
+
+// UserFeatures holds the behavioral features extracted for a user
+type UserFeatures struct {
+	TotalAccessCount            int64   `json:"total_access_count"`             // Number of interactions made by the user
+	HoneytokenAccessCount       int64   `json:"honeytoken_access_count"`        // Number of honeytoken triggers
+	WeightedHoneytokenScore     float64 `json:"weighted_honeytoken_score"`      // Honeytoken triggers weighted by token severity
+	SharedIPCount               int64   `json:"shared_ip_count"`                // Number of distinct IPs used; the name predates IPsSharedWithOthers
+	AvgAssociatedMaliciousScore float64 `json:"avg_associated_malicious_score"` // Confidence-weighted average malicious_score of associated users
+	PropagatedRisk              float64 `json:"propagated_risk"`                // Risk propagated over associations by the risk propagation job
+	IPsSharedWithOthers         int64   `json:"ips_shared_with_others"`         // Number of the user's IPs other users also used
+	UsersSharingIPs             int64   `json:"users_sharing_ips"`              // Number of other users who used any of the user's IPs
+	SubnetsSharedWithOthers     int64   `json:"subnets_shared_with_others"`     // Number of the user's /24 or /64 subnets other users also used
+	DistinctCountries           int64   `json:"distinct_countries"`             // Number of distinct GeoIP countries of the user's interactions
+	HostingTrafficRatio         float64 `json:"hosting_traffic_ratio"`          // Share of the user's interactions from cloud or hosting provider IPs
+	ReputationTrafficRatio      float64 `json:"reputation_traffic_ratio"`       // Share of the user's interactions from IPs on any reputation list
+
+	Windows                 []WindowFeatures `json:"windows,omitempty"`        // Activity per window, shortest first
+	InteractionVelocity     float64          `json:"interaction_velocity"`     // Interaction rate of the shortest window over the next
+	InteractionAcceleration float64          `json:"interaction_acceleration"` // Change of the interaction velocity across the three shortest windows
+	HoneytokenVelocity      float64          `json:"honeytoken_velocity"`      // Honeytoken hit rate of the shortest window over the next
+	HoneytokenAcceleration  float64          `json:"honeytoken_acceleration"`  // Change of the honeytoken velocity across the three shortest windows
+}
+
+// SetWindows stores the windowed counts, shortest window first, and derives
+// the velocity and acceleration ratios from them
+func (f *UserFeatures) SetWindows(windows []WindowFeatures) {
+	f.Windows = windows
+	f.InteractionVelocity, f.InteractionAcceleration = velocity(windows, func(w WindowFeatures) int64 { return w.Interactions })
+	f.HoneytokenVelocity, f.HoneytokenAcceleration = velocity(windows, func(w WindowFeatures) int64 { return w.HoneytokenHits })
+}
+
+// ToMap converts the UserFeatures struct to a flat map of named features.
+// Windowed counts are named after their window, e.g. interactions_24h.
+func (f UserFeatures) ToMap() map[string]interface{} {
+	features := map[string]interface{}{
+		"total_access_count":             f.TotalAccessCount,
+		"honeytoken_access_count":        f.HoneytokenAccessCount,
+		"weighted_honeytoken_score":      f.WeightedHoneytokenScore,
+		"shared_ip_count":                f.SharedIPCount,
+		"avg_associated_malicious_score": f.AvgAssociatedMaliciousScore,
+		"propagated_risk":                f.PropagatedRisk,
+		"ips_shared_with_others":         f.IPsSharedWithOthers,
+		"users_sharing_ips":              f.UsersSharingIPs,
+		"subnets_shared_with_others":     f.SubnetsSharedWithOthers,
+		"distinct_countries":             f.DistinctCountries,
+		"hosting_traffic_ratio":          f.HostingTrafficRatio,
+		"reputation_traffic_ratio":       f.ReputationTrafficRatio,
+		"interaction_velocity":           f.InteractionVelocity,
+		"interaction_acceleration":       f.InteractionAcceleration,
+		"honeytoken_velocity":            f.HoneytokenVelocity,
+		"honeytoken_acceleration":        f.HoneytokenAcceleration,
+	}
+	for _, window := range f.Windows {
+		features[windowedFeaturePrefixes[0]+window.Name] = window.Interactions
+		features[windowedFeaturePrefixes[1]+window.Name] = window.HoneytokenHits
+		features[windowedFeaturePrefixes[2]+window.Name] = window.DistinctIPs
+		features[windowedFeaturePrefixes[3]+window.Name] = window.ErrorResponses
+	}
+	return features
+}
+
+// WindowNames returns the names of the windows of the features
+func (f UserFeatures) WindowNames() []string {
+	names := make([]string, len(f.Windows))
+	for i, window := range f.Windows {
+		names[i] = window.Name
+	}
+	return names
+}
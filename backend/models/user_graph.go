@@ -0,0 +1,51 @@
+package models
+
+// GraphUser is a user node of an exported UserGraph
+type GraphUser struct {
+	UserID         string   `json:"user_id"`
+	MaliciousScore float64  `json:"malicious_score"`
+	HoneytokenHits int64    `json:"honeytoken_hits"` // Honeytoken triggers by the user
+	IPAddresses    []string `json:"ip_addresses"`    // Distinct IPs used by the user
+	ClusterID      string   `json:"cluster_id"`      // Cluster of the last community detection run, if any
+}
+
+// GraphEdge is an undirected association between two users
+type GraphEdge struct {
+	From   string  `json:"from"`
+	To     string  `json:"to"`
+	Weight float64 `json:"weight"` // CombinedConfidence of the users' associations; 1 if one is explicit
+}
+
+// Neighbor is an associate of a user in the adjacency of a UserGraph
+type Neighbor struct {
+	Index  int     // Index of the associate in Users
+	Weight float64 // Weight of the edge to the associate
+}
+
+// UserGraph is a snapshot of the users and ASSOCIATED_WITH edges, exported for
+// graph algorithms that run in the backend. Every edge appears once.
+type UserGraph struct {
+	Users []GraphUser `json:"users"`
+	Edges []GraphEdge `json:"edges"`
+}
+
+// Adjacency returns the neighbors of each user index, indexed like Users.
+// Edges to users missing from Users and self-loops are ignored.
+func (g UserGraph) Adjacency() [][]Neighbor {
+	index := make(map[string]int, len(g.Users))
+	for i, user := range g.Users {
+		index[user.UserID] = i
+	}
+
+	neighbors := make([][]Neighbor, len(g.Users))
+	for _, edge := range g.Edges {
+		from, ok1 := index[edge.From]
+		to, ok2 := index[edge.To]
+		if !ok1 || !ok2 || from == to {
+			continue
+		}
+		neighbors[from] = append(neighbors[from], Neighbor{to, edge.Weight})
+		neighbors[to] = append(neighbors[to], Neighbor{from, edge.Weight})
+	}
+	return neighbors
+}
@@ -2,51 +2,248 @@ package services
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"math/rand"
 	"net/http"
+	"strings"
+	"time"
 
+	"backend/models"
 	"backend/utils"
 )
 
+// maxErrorBodySize limits how much of an error response is kept in ModelStatusError
+const maxErrorBodySize = 512
+
+// RemoteModelFeatures are the features the AI model server reads from a
+// prediction request, see ai/backend/server.py
+var RemoteModelFeatures = []string{"total_access_count", "honeytoken_access_count", "shared_ip_count", "avg_associated_malicious_score"}
+
+// errModelUnreachable marks attempts that failed before the model answered
+var errModelUnreachable = errors.New("failed to contact AI model")
+
+// ModelStatusError is returned when the AI model answers with a non-2xx status
+type ModelStatusError struct {
+	StatusCode int
+	Body       string // Start of the response body, e.g. Flask's HTML error page
+}
+
+func (e *ModelStatusError) Error() string {
+	return fmt.Sprintf("AI model returned status %d: %s", e.StatusCode, e.Body)
+}
+
+// retryable reports whether the request may succeed if sent again
+func (e *ModelStatusError) retryable() bool {
+	return e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= 500
+}
+
+// AIClientOptions configures timeouts, retries and the circuit breaker of AIIntegrationService
+type AIClientOptions struct {
+	Timeout          time.Duration // Deadline of a single attempt
+	MaxRetries       int           // Retries after the first attempt for network errors, 429 and 5xx
+	BaseBackoff      time.Duration // Backoff before the first retry, doubled for each further retry
+	MaxBackoff       time.Duration // Upper bound of the backoff
+	BreakerThreshold int           // Consecutive failed calls that open the circuit
+	BreakerCooldown  time.Duration // Time the circuit stays open before a trial call
+	MaxIdleConns     int           // Idle keep-alive connections kept to the model server
+}
+
+// DefaultAIClientOptions returns the options used by NewAIIntegrationService
+func DefaultAIClientOptions() AIClientOptions {
+	return AIClientOptions{
+		Timeout:          5 * time.Second,
+		MaxRetries:       2,
+		BaseBackoff:      100 * time.Millisecond,
+		MaxBackoff:       2 * time.Second,
+		BreakerThreshold: 5,
+		BreakerCooldown:  30 * time.Second,
+		MaxIdleConns:     32,
+	}
+}
+
 // AIIntegrationService handles AI model predictions
 type AIIntegrationService struct {
 	ModelEndpoint string
+	Options       AIClientOptions
+	Client        *http.Client
+	Breaker       *CircuitBreaker
 	Logger        *utils.Logger
 }
 
-// NewAIIntegrationService creates a new AIIntegrationService
+// NewAIIntegrationService creates a new AIIntegrationService with DefaultAIClientOptions
 func NewAIIntegrationService(endpoint string, logger *utils.Logger) *AIIntegrationService {
+	return NewAIIntegrationServiceWithOptions(endpoint, DefaultAIClientOptions(), logger)
+}
+
+// NewAIIntegrationServiceWithOptions creates a new AIIntegrationService. Its
+// HTTP client keeps connections to the model server alive between calls.
+func NewAIIntegrationServiceWithOptions(endpoint string, options AIClientOptions, logger *utils.Logger) *AIIntegrationService {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConns = options.MaxIdleConns
+	transport.MaxIdleConnsPerHost = options.MaxIdleConns
+
 	return &AIIntegrationService{
 		ModelEndpoint: endpoint,
+		Options:       options,
+		Client:        &http.Client{Transport: transport},
+		Breaker:       NewCircuitBreaker(options.BreakerThreshold, options.BreakerCooldown),
 		Logger:        logger,
 	}
 }
 
-// PredictMaliciousness sends user interaction data to the AI model and gets a prediction
-func (s *AIIntegrationService) PredictMaliciousness(data map[string]interface{}) (map[string]interface{}, error) {
-	s.Logger.Info("Preparing to send prediction request to AI model")
+// PredictMaliciousness sends a feature vector to the AI model and returns its
+// validated prediction. The request ID of ctx is forwarded to the model server
+// in the X-Request-ID header. Failed attempts are retried with backoff; while
+// the model is down the circuit breaker makes calls fail fast with ErrCircuitOpen.
+func (s *AIIntegrationService) PredictMaliciousness(ctx context.Context, vector models.FeatureVector) (models.Prediction, error) {
+	logger := s.Logger.WithContext(ctx)
+	logger.Info("Preparing to send prediction request to AI model")
 
-	jsonData, err := json.Marshal(data)
+	jsonData, err := json.Marshal(vector)
 	if err != nil {
-		s.Logger.Error("Failed to serialize data: " + err.Error())
-		return nil, fmt.Errorf("failed to serialize data: %v", err)
+		logger.Error("Failed to serialize data", "error", err)
+		return models.Prediction{}, fmt.Errorf("failed to serialize data: %v", err)
+	}
+
+	if err := s.Breaker.Allow(); err != nil {
+		logger.Warn("AI model circuit is open, failing fast")
+		return models.Prediction{}, fmt.Errorf("failed to contact AI model: %w", err)
 	}
 
-	s.Logger.Debug("Sending data to AI model: "+s.ModelEndpoint+"/predict", true)
-	resp, err := http.Post(s.ModelEndpoint+"/predict", "application/json", bytes.NewBuffer(jsonData))
+	var result models.Prediction
+	for attempt := 0; ; attempt++ {
+		result, err = s.predictOnce(ctx, jsonData)
+		if err == nil || !retryable(err) || attempt >= s.Options.MaxRetries || ctx.Err() != nil {
+			break
+		}
+
+		delay := s.backoff(attempt + 1)
+		logger.Warn("AI model request failed, retrying", "attempt", attempt+1, "delay", delay, "error", err)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+		}
+	}
+
+	if err != nil {
+		// Neither a canceled caller nor a rejected request says anything about
+		// the model server's health, so they neither reset the failure count
+		// nor decide a half-open trial
+		var statusErr *ModelStatusError
+		switch {
+		case ctx.Err() != nil:
+			s.Breaker.Release()
+		case errors.As(err, &statusErr) && !statusErr.retryable():
+			s.Breaker.Release()
+		default:
+			s.Breaker.Failure()
+		}
+		logger.Error("Failed to get prediction from AI model", "error", err)
+		return models.Prediction{}, err
+	}
+	s.Breaker.Success()
+
+	logger.Info("Received prediction response from AI model")
+	return result, nil
+}
+
+// Name identifies the remote AI model scorer
+func (s *AIIntegrationService) Name() string {
+	return "remote_model"
+}
+
+// Score sends the feature vector to the AI model. The model version reported
+// by the model server is recorded, or DefaultModelVersion if it reports none.
+func (s *AIIntegrationService) Score(ctx context.Context, vector models.FeatureVector) (ScoreResult, error) {
+	prediction, err := s.PredictMaliciousness(ctx, vector)
 	if err != nil {
-		s.Logger.Error("Failed to contact AI model: " + err.Error())
-		return nil, fmt.Errorf("failed to contact AI model: %v", err)
+		return ScoreResult{}, err
+	}
+	if prediction.ModelVersion == "" {
+		prediction.ModelVersion = DefaultModelVersion
+	}
+	return ScoreResult{Prediction: prediction, Scorer: s.Name()}, nil
+}
+
+// predictOnce sends one prediction request bounded by Options.Timeout
+func (s *AIIntegrationService) predictOnce(ctx context.Context, jsonData []byte) (models.Prediction, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.Options.Timeout)
+	defer cancel()
+
+	url := s.ModelEndpoint + "/predict"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(jsonData))
+	if err != nil {
+		return models.Prediction{}, fmt.Errorf("failed to build AI model request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	if requestID := utils.RequestIDFromContext(ctx); requestID != "" {
+		req.Header.Set(utils.RequestIDHeader, requestID)
+	}
+
+	s.Logger.WithContext(ctx).Debug("Sending data to AI model", "url", url)
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return models.Prediction{}, fmt.Errorf("%w: %v", errModelUnreachable, err)
 	}
 	defer resp.Body.Close()
 
-	var result map[string]interface{}
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		s.Logger.Error("Failed to decode AI model response: " + err.Error())
-		return nil, fmt.Errorf("failed to decode AI model response: %v", err)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBodySize))
+		return models.Prediction{}, &ModelStatusError{StatusCode: resp.StatusCode, Body: strings.TrimSpace(string(body))}
 	}
 
-	s.Logger.Info("Received prediction response from AI model")
-	return result, nil
+	var prediction models.Prediction
+	if err := json.NewDecoder(resp.Body).Decode(&prediction); err != nil {
+		return models.Prediction{}, fmt.Errorf("failed to decode AI model response (Content-Type %q): %v", resp.Header.Get("Content-Type"), err)
+	}
+	// Drain the body so the connection can be reused
+	io.Copy(io.Discard, resp.Body)
+
+	if err := prediction.Validate(); err != nil {
+		return models.Prediction{}, fmt.Errorf("invalid prediction: %v", err)
+	}
+	return prediction, nil
+}
+
+// retryable reports whether a failed attempt may succeed if sent again:
+// network errors, timeouts of a single attempt, 429 and 5xx responses
+func retryable(err error) bool {
+	var statusErr *ModelStatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.retryable()
+	}
+	return errors.Is(err, errModelUnreachable)
+}
+
+// backoff returns the delay before the given retry attempt: exponential with
+// full jitter, capped at MaxBackoff
+func (s *AIIntegrationService) backoff(attempt int) time.Duration {
+	delay := s.Options.BaseBackoff << (attempt - 1)
+	if delay <= 0 || delay > s.Options.MaxBackoff {
+		delay = s.Options.MaxBackoff
+	}
+	return time.Duration(rand.Int63n(int64(delay)) + 1)
+}
+
+// Ping checks that the AI model server answers its /health endpoint
+func (s *AIIntegrationService) Ping(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.ModelEndpoint+"/health", nil)
+	if err != nil {
+		return err
+	}
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to contact AI model: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("AI model health check returned status %d", resp.StatusCode)
+	}
+	return nil
 }
@@ -0,0 +1,538 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"backend/models"
+	"backend/utils"
+)
+
+// SharedIPRule associates users seen on the same IP address within Window of
+// each other
+type SharedIPRule struct {
+	Enabled    bool
+	Window     time.Duration // Largest gap between the two users' interactions
+	MaxUsers   int           // IPs used by more users in the lookback, such as NAT gateways, are ignored
+	Confidence float64       // Confidence of a single shared IP; every further one raises it
+}
+
+// SharedHoneytokenRule associates users who triggered the same honeytoken
+type SharedHoneytokenRule struct {
+	Enabled    bool
+	MaxUsers   int     // Honeytokens triggered by more users in the lookback are ignored
+	Confidence float64 // Confidence of a single shared honeytoken; every further one raises it
+}
+
+// SimilarEndpointsRule associates users whose endpoint sequences are
+// near-identical, such as copies of the same script
+type SimilarEndpointsRule struct {
+	Enabled    bool
+	MinLength  int     // Users with fewer interactions in the lookback are not compared
+	MaxLength  int     // Only the latest MaxLength endpoints of a user are compared
+	MaxUsers   int     // Buckets of more candidate users, such as clients polling the same endpoint, are ignored
+	Similarity float64 // Smallest similarity, 1 - edit distance / longer length, that counts
+	Confidence float64 // Confidence of identical sequences, scaled by the similarity
+}
+
+// AssociationOptions configures InferAssociations and AssociationInferenceJob
+type AssociationOptions struct {
+	Interval         time.Duration // Time between runs of the job
+	Lookback         time.Duration // Interactions older than this are not considered
+	SharedIP         SharedIPRule
+	SharedHoneytoken SharedHoneytokenRule
+	SimilarEndpoints SimilarEndpointsRule
+}
+
+// DefaultAssociationOptions returns the default AssociationOptions with every rule enabled
+func DefaultAssociationOptions() AssociationOptions {
+	return AssociationOptions{
+		Interval: 10 * time.Minute,
+		Lookback: 24 * time.Hour,
+		SharedIP: SharedIPRule{
+			Enabled:    true,
+			Window:     10 * time.Minute,
+			MaxUsers:   20,
+			Confidence: 0.5,
+		},
+		SharedHoneytoken: SharedHoneytokenRule{
+			Enabled:    true,
+			MaxUsers:   50,
+			Confidence: 0.9,
+		},
+		SimilarEndpoints: SimilarEndpointsRule{
+			Enabled:    true,
+			MinLength:  10,
+			MaxLength:  50,
+			MaxUsers:   50,
+			Similarity: 0.9,
+			Confidence: 0.7,
+		},
+	}
+}
+
+// AssociationEvidence holds what the rules look at, grouped by the store so
+// that inference never loads every interaction of the lookback. Only the
+// groups of enabled rules are filled in.
+type AssociationEvidence struct {
+	IPUses            map[string][]models.Interaction // Interactions by normalized IP, for IPs used by 2 to SharedIP.MaxUsers users
+	HoneytokenUsers   map[string][]string             // Sorted user IDs by honeytoken, for honeytokens triggered by 2 to SharedHoneytoken.MaxUsers users
+	EndpointSequences map[string][]string             // Latest endpoints of each user with enough interactions, oldest first
+}
+
+// NewAssociationEvidence groups interactions the way the stores do
+func NewAssociationEvidence(interactions []models.Interaction, options AssociationOptions) AssociationEvidence {
+	var evidence AssociationEvidence
+	if options.SharedIP.Enabled {
+		evidence.IPUses = groupSharedIPs(interactions, options.SharedIP.MaxUsers)
+	}
+	if options.SharedHoneytoken.Enabled {
+		evidence.HoneytokenUsers = groupSharedHoneytokens(interactions, options.SharedHoneytoken.MaxUsers)
+	}
+	if options.SimilarEndpoints.Enabled {
+		evidence.EndpointSequences = groupEndpointSequences(interactions, options.SimilarEndpoints.MinLength, options.SimilarEndpoints.MaxLength)
+	}
+	return evidence
+}
+
+// groupSharedIPs returns interactions by normalized IP, for IPs used by 2 to
+// maxUsers users
+func groupSharedIPs(interactions []models.Interaction, maxUsers int) map[string][]models.Interaction {
+	byIP := make(map[string][]models.Interaction)
+	users := make(map[string]map[string]struct{})
+	for _, interaction := range interactions {
+		ip, err := utils.NormalizeIP(interaction.IPAddress)
+		if err != nil {
+			continue
+		}
+		byIP[ip] = append(byIP[ip], interaction)
+		addToIndex(users, ip, interaction.UserID)
+	}
+	for ip := range byIP {
+		if len(users[ip]) < 2 || len(users[ip]) > maxUsers {
+			delete(byIP, ip)
+		}
+	}
+	return byIP
+}
+
+// groupSharedHoneytokens returns the sorted users of each honeytoken
+// triggered by 2 to maxUsers users
+func groupSharedHoneytokens(interactions []models.Interaction, maxUsers int) map[string][]string {
+	byToken := make(map[string]map[string]struct{})
+	for _, interaction := range interactions {
+		if interaction.HoneytokenID != "" {
+			addToIndex(byToken, interaction.HoneytokenID, interaction.UserID)
+		}
+	}
+	usersByToken := make(map[string][]string)
+	for tokenID, users := range byToken {
+		if len(users) < 2 || len(users) > maxUsers {
+			continue
+		}
+		userIDs := make([]string, 0, len(users))
+		for userID := range users {
+			userIDs = append(userIDs, userID)
+		}
+		sort.Strings(userIDs)
+		usersByToken[tokenID] = userIDs
+	}
+	return usersByToken
+}
+
+// groupEndpointSequences returns the latest maxLength endpoints, oldest
+// first, of each user with at least minLength interactions
+func groupEndpointSequences(interactions []models.Interaction, minLength, maxLength int) map[string][]string {
+	byUser := make(map[string][]models.Interaction)
+	for _, interaction := range interactions {
+		byUser[interaction.UserID] = append(byUser[interaction.UserID], interaction)
+	}
+	sequences := make(map[string][]string)
+	for userID, userInteractions := range byUser {
+		if len(userInteractions) < minLength {
+			continue
+		}
+		sort.SliceStable(userInteractions, func(i, j int) bool {
+			return userInteractions[i].Timestamp.Before(userInteractions[j].Timestamp)
+		})
+		if len(userInteractions) > maxLength {
+			userInteractions = userInteractions[len(userInteractions)-maxLength:]
+		}
+		endpoints := make([]string, len(userInteractions))
+		for i, interaction := range userInteractions {
+			endpoints[i] = interaction.Endpoint
+		}
+		sequences[userID] = endpoints
+	}
+	return sequences
+}
+
+// associationKey identifies an inferred association; User1 < User2
+type associationKey struct {
+	User1, User2, Type string
+}
+
+// associationSet collects the evidence of inferred associations
+type associationSet map[associationKey]*models.Association
+
+// add records evidence for an association between two different users
+func (s associationSet) add(user1, user2, kind, evidence string) *models.Association {
+	if user1 > user2 {
+		user1, user2 = user2, user1
+	}
+	key := associationKey{user1, user2, kind}
+	association, ok := s[key]
+	if !ok {
+		association = &models.Association{UserID: user1, AssociateID: user2, Type: kind, Evidence: []string{}}
+		s[key] = association
+	}
+	association.AddEvidence(evidence)
+	return association
+}
+
+// InferAssociations applies the enabled rules to the evidence and returns
+// one association per pair of users and rule, ordered by user IDs and type.
+// For shared IPs and honeytokens every distinct IP or honeytoken is an
+// independent observation, so n of them give a confidence of
+// 1 - (1 - Confidence)^n.
+func InferAssociations(evidence AssociationEvidence, options AssociationOptions, now time.Time) []models.Association {
+	set := make(associationSet)
+	if options.SharedIP.Enabled {
+		inferSharedIPs(set, evidence.IPUses, options.SharedIP)
+	}
+	if options.SharedHoneytoken.Enabled {
+		inferSharedHoneytokens(set, evidence.HoneytokenUsers)
+	}
+	if options.SimilarEndpoints.Enabled {
+		inferSimilarEndpoints(set, evidence.EndpointSequences, options.SimilarEndpoints)
+	}
+
+	associations := make([]models.Association, 0, len(set))
+	for key, association := range set {
+		switch key.Type {
+		case models.AssociationSharedIP:
+			association.Confidence = 1 - math.Pow(1-options.SharedIP.Confidence, float64(association.Weight))
+		case models.AssociationSharedHoneytoken:
+			association.Confidence = 1 - math.Pow(1-options.SharedHoneytoken.Confidence, float64(association.Weight))
+		}
+		association.InferredAt = &now
+		associations = append(associations, *association)
+	}
+	sort.Slice(associations, func(i, j int) bool {
+		a, b := associations[i], associations[j]
+		if a.UserID != b.UserID {
+			return a.UserID < b.UserID
+		}
+		if a.AssociateID != b.AssociateID {
+			return a.AssociateID < b.AssociateID
+		}
+		return a.Type < b.Type
+	})
+	return associations
+}
+
+// inferSharedIPs adds one observation per IP two users used within the window
+func inferSharedIPs(set associationSet, byIP map[string][]models.Interaction, rule SharedIPRule) {
+	for ip, uses := range byIP {
+		// Smallest gap between each pair of users on this IP
+		sort.Slice(uses, func(i, j int) bool { return uses[i].Timestamp.Before(uses[j].Timestamp) })
+		gaps := make(map[[2]string]time.Duration)
+		for i := range uses {
+			for j := i + 1; j < len(uses); j++ {
+				gap := uses[j].Timestamp.Sub(uses[i].Timestamp)
+				if gap > rule.Window {
+					break
+				}
+				pair := [2]string{uses[i].UserID, uses[j].UserID}
+				if pair[0] == pair[1] {
+					continue
+				}
+				if pair[0] > pair[1] {
+					pair[0], pair[1] = pair[1], pair[0]
+				}
+				if previous, ok := gaps[pair]; !ok || gap < previous {
+					gaps[pair] = gap
+				}
+			}
+		}
+		for pair, gap := range gaps {
+			set.add(pair[0], pair[1], models.AssociationSharedIP, fmt.Sprintf("used %s %s apart", ip, gap.Round(time.Second)))
+		}
+	}
+}
+
+// inferSharedHoneytokens adds one observation per honeytoken two users triggered
+func inferSharedHoneytokens(set associationSet, usersByToken map[string][]string) {
+	for tokenID, userIDs := range usersByToken {
+		for i := range userIDs {
+			for j := i + 1; j < len(userIDs); j++ {
+				set.add(userIDs[i], userIDs[j], models.AssociationSharedHoneytoken, fmt.Sprintf("triggered honeytoken %s", tokenID))
+			}
+		}
+	}
+}
+
+// MinHash parameters of inferSimilarEndpoints. Sequences are compared as sets
+// of endpoint bigrams: an edit changes at most two bigrams, so sequences at
+// the default similarity of 0.9 share about two thirds of their bigrams and
+// 16 bands of 2 hashes make them candidates with a probability above 0.999.
+const (
+	minHashBands = 16
+	minHashRows  = 2
+)
+
+// inferSimilarEndpoints compares the endpoint sequences of users that share a
+// MinHash bucket. Comparing only candidates keeps the number of edit
+// distances computed near linear in the number of users rather than
+// quadratic; buckets of more than MaxUsers users are skipped, as for the
+// other rules.
+func inferSimilarEndpoints(set associationSet, sequences map[string][]string, rule SimilarEndpointsRule) {
+	type sequence struct {
+		userID    string
+		endpoints []int
+	}
+
+	// Endpoints are interned so sequences compare as ints. Users are sorted
+	// so the evidence of a run does not depend on map order.
+	userIDs := make([]string, 0, len(sequences))
+	for userID := range sequences {
+		userIDs = append(userIDs, userID)
+	}
+	sort.Strings(userIDs)
+	endpointIDs := make(map[string]int)
+	all := make([]sequence, len(userIDs))
+	buckets := make(map[[minHashRows + 1]uint64][]int)
+	for idx, userID := range userIDs {
+		endpoints := make([]int, len(sequences[userID]))
+		for i, endpoint := range sequences[userID] {
+			id, ok := endpointIDs[endpoint]
+			if !ok {
+				id = len(endpointIDs)
+				endpointIDs[endpoint] = id
+			}
+			endpoints[i] = id
+		}
+		all[idx] = sequence{userID, endpoints}
+
+		signature := minHashSignature(endpoints)
+		for band := 0; band < minHashBands; band++ {
+			var key [minHashRows + 1]uint64
+			key[0] = uint64(band)
+			copy(key[1:], signature[band*minHashRows:(band+1)*minHashRows])
+			buckets[key] = append(buckets[key], idx)
+		}
+	}
+
+	compared := make(map[[2]int]bool)
+	for _, members := range buckets {
+		if len(members) < 2 || len(members) > rule.MaxUsers {
+			continue
+		}
+		for i, x := range members {
+			for _, y := range members[i+1:] {
+				if compared[[2]int{x, y}] {
+					continue
+				}
+				compared[[2]int{x, y}] = true
+
+				a, b := all[x], all[y]
+				if len(a.endpoints) > len(b.endpoints) {
+					a, b = b, a
+				}
+				// The edit distance is at least the difference in length
+				if float64(len(a.endpoints)) < rule.Similarity*float64(len(b.endpoints)) {
+					continue
+				}
+				similarity := 1 - float64(editDistance(a.endpoints, b.endpoints))/float64(len(b.endpoints))
+				if similarity < rule.Similarity {
+					continue
+				}
+				association := set.add(a.userID, b.userID, models.AssociationSimilarEndpoints,
+					fmt.Sprintf("%.0f%% similar endpoint sequences of %d and %d requests", similarity*100, len(a.endpoints), len(b.endpoints)))
+				association.Confidence = rule.Confidence * similarity
+			}
+		}
+	}
+}
+
+// minHashSignature returns the MinHash signature of the set of endpoint
+// bigrams of a sequence, or of its single endpoint
+func minHashSignature(endpoints []int) [minHashBands * minHashRows]uint64 {
+	var signature [minHashBands * minHashRows]uint64
+	for i := range signature {
+		signature[i] = math.MaxUint64
+	}
+	for i := range endpoints {
+		if i == 0 && len(endpoints) > 1 {
+			continue
+		}
+		// The previous endpoint is offset by one so a bigram never equals a single endpoint
+		shingle := uint64(endpoints[i])
+		if i > 0 {
+			shingle |= uint64(endpoints[i-1]+1) << 32
+		}
+		for h := range signature {
+			signature[h] = min(signature[h], splitMix64(shingle^uint64(h)*0x9e3779b97f4a7c15))
+		}
+	}
+	return signature
+}
+
+// splitMix64 is the SplitMix64 finalizer, used as a family of hash functions
+// by mixing in a different constant per function
+func splitMix64(x uint64) uint64 {
+	x += 0x9e3779b97f4a7c15
+	x = (x ^ (x >> 30)) * 0xbf58476d1ce4e5b9
+	x = (x ^ (x >> 27)) * 0x94d049bb133111eb
+	return x ^ (x >> 31)
+}
+
+// editDistance returns the Levenshtein distance between two sequences
+func editDistance(a, b []int) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(b)]
+}
+
+// AssociationInferenceResult summarizes a run of AssociationInferenceJob
+type AssociationInferenceResult struct {
+	SharedIPs         int            `json:"shared_ips"`         // IPs used by several users
+	SharedHoneytokens int            `json:"shared_honeytokens"` // Honeytokens triggered by several users
+	Sequences         int            `json:"sequences"`          // Endpoint sequences compared
+	Associations      int            `json:"associations"`
+	Pruned            int            `json:"pruned"` // Edges of associations no longer inferred
+	ByType            map[string]int `json:"by_type"`
+	InferredAt        time.Time      `json:"inferred_at"`
+}
+
+// AssociationInferenceJob periodically infers associations from the
+// interactions of the lookback and saves them as typed ASSOCIATED_WITH edges,
+// which feature extraction and the other graph jobs then use like explicit
+// ones, weighted by confidence. Each run stamps the edges it saves with its
+// start time and deletes the inferred edges it did not save.
+type AssociationInferenceJob struct {
+	Store   GraphStore
+	Options AssociationOptions
+	Logger  *utils.Logger
+
+	mu   sync.Mutex
+	last *AssociationInferenceResult
+	loop periodicLoop
+}
+
+// NewAssociationInferenceJob creates an AssociationInferenceJob; call Start to schedule runs
+func NewAssociationInferenceJob(store GraphStore, options AssociationOptions, logger *utils.Logger) *AssociationInferenceJob {
+	defaults := DefaultAssociationOptions()
+	if options.Interval <= 0 {
+		options.Interval = defaults.Interval
+	}
+	if options.Lookback <= 0 {
+		options.Lookback = defaults.Lookback
+	}
+	return &AssociationInferenceJob{
+		Store:   store,
+		Options: options,
+		Logger:  logger,
+		loop:    newPeriodicLoop(),
+	}
+}
+
+// Start runs the job now and then every Interval in the background
+func (j *AssociationInferenceJob) Start() {
+	j.loop.start(j.Options.Interval, func(ctx context.Context) error {
+		_, err := j.Run(ctx)
+		return err
+	}, j.Logger, "Failed to infer associations")
+}
+
+// Stop cancels the current run and stops the schedule
+func (j *AssociationInferenceJob) Stop() {
+	j.loop.stop()
+}
+
+// Run infers associations from the interactions of the lookback and saves them
+func (j *AssociationInferenceJob) Run(ctx context.Context) (AssociationInferenceResult, error) {
+	logger := j.Logger.WithContext(ctx)
+	now := time.Now().UTC()
+
+	evidence, err := j.listEvidence(ctx, now.Add(-j.Options.Lookback))
+	if err != nil {
+		return AssociationInferenceResult{}, err
+	}
+	associations := InferAssociations(evidence, j.Options, now)
+	if err := j.Store.SaveAssociations(ctx, associations); err != nil {
+		return AssociationInferenceResult{}, fmt.Errorf("failed to save associations: %v", err)
+	}
+	// Edges the run did not save again, including every edge of a rule that
+	// was disabled since, no longer have evidence in the lookback
+	pruned, err := j.Store.PruneAssociations(ctx, now)
+	if err != nil {
+		return AssociationInferenceResult{}, fmt.Errorf("failed to prune associations: %v", err)
+	}
+
+	result := AssociationInferenceResult{
+		SharedIPs:         len(evidence.IPUses),
+		SharedHoneytokens: len(evidence.HoneytokenUsers),
+		Sequences:         len(evidence.EndpointSequences),
+		Associations:      len(associations),
+		Pruned:            pruned,
+		ByType:            make(map[string]int),
+		InferredAt:        now,
+	}
+	for _, association := range associations {
+		result.ByType[association.Type]++
+	}
+	j.mu.Lock()
+	j.last = &result
+	j.mu.Unlock()
+	logger.Info("Inferred associations", "shared_ips", result.SharedIPs, "shared_honeytokens", result.SharedHoneytokens,
+		"sequences", result.Sequences, "associations", result.Associations, "pruned", result.Pruned, "duration", time.Since(now))
+	return result, nil
+}
+
+// listEvidence reads the evidence of the enabled rules from the store
+func (j *AssociationInferenceJob) listEvidence(ctx context.Context, since time.Time) (AssociationEvidence, error) {
+	var evidence AssociationEvidence
+	var err error
+	if rule := j.Options.SharedIP; rule.Enabled {
+		if evidence.IPUses, err = j.Store.ListSharedIPs(ctx, since, rule.MaxUsers); err != nil {
+			return evidence, fmt.Errorf("failed to list shared IPs: %v", err)
+		}
+	}
+	if rule := j.Options.SharedHoneytoken; rule.Enabled {
+		if evidence.HoneytokenUsers, err = j.Store.ListSharedHoneytokens(ctx, since, rule.MaxUsers); err != nil {
+			return evidence, fmt.Errorf("failed to list shared honeytokens: %v", err)
+		}
+	}
+	if rule := j.Options.SimilarEndpoints; rule.Enabled {
+		if evidence.EndpointSequences, err = j.Store.ListEndpointSequences(ctx, since, rule.MinLength, rule.MaxLength); err != nil {
+			return evidence, fmt.Errorf("failed to list endpoint sequences: %v", err)
+		}
+	}
+	return evidence, nil
+}
+
+// LastResult returns the result of the last successful run, or nil
+func (j *AssociationInferenceJob) LastResult() *AssociationInferenceResult {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.last
+}
@@ -0,0 +1,162 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"backend/models"
+	"backend/utils"
+)
+
+const (
+	// DefaultBatchSize is the number of interactions written per transaction
+	DefaultBatchSize = 500
+	// DefaultFlushInterval is how long interactions may wait for a batch to fill
+	DefaultFlushInterval = time.Second
+)
+
+// ErrBatchWriterClosed is returned when submitting to a closed BatchWriter
+var ErrBatchWriterClosed = errors.New("batch writer is closed")
+
+// batchRequest is a group of interactions waiting to be written
+type batchRequest struct {
+	interactions []models.Interaction
+	done         chan error
+}
+
+// BatchWriter buffers interactions from concurrent callers and writes them to
+// the store with SaveInteractions. A batch is flushed once it holds BatchSize
+// interactions or FlushInterval has passed, whichever comes first.
+type BatchWriter struct {
+	Store         GraphStore
+	BatchSize     int
+	FlushInterval time.Duration
+	Logger        *utils.Logger
+
+	requests  chan *batchRequest
+	stop      chan struct{}
+	stopped   chan struct{}
+	closeOnce sync.Once
+}
+
+// NewBatchWriter creates a BatchWriter and starts its flush loop.
+// Non-positive values select DefaultBatchSize and DefaultFlushInterval.
+func NewBatchWriter(store GraphStore, batchSize int, flushInterval time.Duration, logger *utils.Logger) *BatchWriter {
+	if batchSize <= 0 {
+		batchSize = DefaultBatchSize
+	}
+	if flushInterval <= 0 {
+		flushInterval = DefaultFlushInterval
+	}
+
+	w := &BatchWriter{
+		Store:         store,
+		BatchSize:     batchSize,
+		FlushInterval: flushInterval,
+		Logger:        logger,
+		requests:      make(chan *batchRequest),
+		stop:          make(chan struct{}),
+		stopped:       make(chan struct{}),
+	}
+	go w.run()
+	return w
+}
+
+// Submit queues interactions for writing and blocks until they are written
+func (w *BatchWriter) Submit(interactions []models.Interaction) error {
+	if len(interactions) == 0 {
+		return nil
+	}
+
+	request := &batchRequest{interactions: interactions, done: make(chan error, 1)}
+	select {
+	case w.requests <- request:
+	case <-w.stop:
+		return ErrBatchWriterClosed
+	}
+	return <-request.done
+}
+
+// Close flushes any pending interactions and stops the flush loop
+func (w *BatchWriter) Close() {
+	w.closeOnce.Do(func() {
+		close(w.stop)
+	})
+	<-w.stopped
+}
+
+// run accumulates requests and flushes them by size or interval
+func (w *BatchWriter) run() {
+	defer close(w.stopped)
+
+	ticker := time.NewTicker(w.FlushInterval)
+	defer ticker.Stop()
+
+	var pending []*batchRequest
+	pendingCount := 0
+
+	for {
+		select {
+		case request := <-w.requests:
+			pending = append(pending, request)
+			pendingCount += len(request.interactions)
+			if pendingCount >= w.BatchSize {
+				w.flush(pending)
+				pending, pendingCount = nil, 0
+			}
+		case <-ticker.C:
+			if len(pending) > 0 {
+				w.flush(pending)
+				pending, pendingCount = nil, 0
+			}
+		case <-w.stop:
+			if len(pending) > 0 {
+				w.flush(pending)
+			}
+			return
+		}
+	}
+}
+
+// flush writes the pending requests in chunks of BatchSize and reports the
+// outcome to each request. A request fails if any chunk holding its
+// interactions fails.
+func (w *BatchWriter) flush(pending []*batchRequest) {
+	errs := make([]error, len(pending))
+
+	var chunk []models.Interaction
+	var owners []int
+	writeChunk := func() {
+		if len(chunk) == 0 {
+			return
+		}
+		if err := w.Store.SaveInteractions(context.Background(), chunk); err != nil {
+			w.Logger.Error("Failed to write interaction batch", "count", len(chunk), "error", err)
+			for _, owner := range owners {
+				if errs[owner] == nil {
+					errs[owner] = err
+				}
+			}
+		}
+		chunk, owners = nil, nil
+	}
+
+	for idx, request := range pending {
+		for _, interaction := range request.interactions {
+			chunk = append(chunk, interaction)
+			if len(owners) == 0 || owners[len(owners)-1] != idx {
+				owners = append(owners, idx)
+			}
+			if len(chunk) >= w.BatchSize {
+				writeChunk()
+			}
+		}
+	}
+	writeChunk()
+
+	for idx, request := range pending {
+		request.done <- errs[idx]
+	}
+}
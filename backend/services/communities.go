@@ -0,0 +1,301 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"backend/models"
+	"backend/utils"
+)
+
+// CommunityOptions configures DetectCommunities and CommunityDetectionJob
+type CommunityOptions struct {
+	Interval      time.Duration // Time between runs of the job
+	MaxIterations int           // Passes over the users per Louvain level before moving on even if users still move
+	MinSize       int           // Smallest cluster listed by Clusters; smaller ones are usually lone users
+}
+
+// DefaultCommunityOptions returns the default CommunityOptions
+func DefaultCommunityOptions() CommunityOptions {
+	return CommunityOptions{
+		Interval:      15 * time.Minute,
+		MaxIterations: 50,
+		MinSize:       2,
+	}
+}
+
+// CommunityResult is the outcome of DetectCommunities
+type CommunityResult struct {
+	Assignments map[string]string `json:"-"` // cluster_id by user ID
+	Clusters    []models.Cluster  `json:"-"` // Every cluster, most suspicious first
+	Users       int               `json:"users"`
+	Iterations  int               `json:"iterations"`
+	Converged   bool              `json:"converged"`
+	ComputedAt  time.Time         `json:"computed_at"`
+}
+
+// DetectCommunities groups the users of graph into clusters with the Louvain
+// method, with each edge weighted by the confidence of the association so
+// weak inferred associations pull users together less. Every user starts in its own cluster and, in user order, moves to
+// the neighboring cluster that raises the modularity of the graph most, until
+// no user moves; the clusters then become the nodes of a smaller graph and the
+// process repeats until merging clusters stops paying off. Users without
+// associates form clusters of one. A cluster is named after its smallest
+// member user ID so the ID survives reruns as long as that member stays.
+func DetectCommunities(graph models.UserGraph, options CommunityOptions) CommunityResult {
+	result := CommunityResult{Users: len(graph.Users), ComputedAt: time.Now().UTC(), Converged: true}
+
+	// level holds the weighted edges between the nodes of the current level,
+	// in both directions; a cluster merged into a node keeps its internal
+	// edges as a self-loop so degrees are preserved
+	level := make([]map[int]float64, len(graph.Users))
+	for i := range level {
+		level[i] = make(map[int]float64)
+	}
+	for i, neighbors := range graph.Adjacency() {
+		for _, neighbor := range neighbors {
+			level[i][neighbor.Index] += neighbor.Weight
+		}
+	}
+	// node maps each user to its node of the current level
+	node := make([]int, len(graph.Users))
+	for i := range node {
+		node[i] = i
+	}
+
+	for {
+		community, passes, settled := louvainLocalMoving(level, options.MaxIterations)
+		result.Iterations += passes
+		result.Converged = result.Converged && settled
+
+		// Renumber the communities in order and merge each into one node
+		index := make(map[int]int)
+		for _, c := range community {
+			if _, ok := index[c]; !ok {
+				index[c] = len(index)
+			}
+		}
+		if len(index) == len(level) {
+			break // No clusters merged
+		}
+		next := make([]map[int]float64, len(index))
+		for i := range next {
+			next[i] = make(map[int]float64)
+		}
+		for i, edges := range level {
+			for j, weight := range edges {
+				next[index[community[i]]][index[community[j]]] += weight
+			}
+		}
+		for i := range node {
+			node[i] = index[community[node[i]]]
+		}
+		level = next
+	}
+
+	members := make(map[int][]int)
+	for i, n := range node {
+		members[n] = append(members[n], i)
+	}
+	result.Assignments = make(map[string]string, len(graph.Users))
+	for _, indexes := range members {
+		cluster := newCluster(graph.Users, indexes)
+		for _, userID := range cluster.Members {
+			result.Assignments[userID] = cluster.ClusterID
+		}
+		result.Clusters = append(result.Clusters, cluster)
+	}
+	sort.Slice(result.Clusters, func(i, j int) bool { return result.Clusters[i].MoreSuspiciousThan(result.Clusters[j]) })
+	return result
+}
+
+// louvainLocalMoving moves each node of level to the neighboring community
+// with the best modularity gain until a pass moves no node or maxPasses
+// passes ran. It returns the community of each node, the number of passes and
+// whether the last pass moved no node.
+func louvainLocalMoving(level []map[int]float64, maxPasses int) ([]int, int, bool) {
+	community := make([]int, len(level))
+	degree := make([]float64, len(level))
+	total := make([]float64, len(level)) // Sum of the degrees in each community
+	var m2 float64                       // Twice the total edge weight
+	for i, edges := range level {
+		community[i] = i
+		for _, weight := range edges {
+			degree[i] += weight
+		}
+		total[i] = degree[i]
+		m2 += degree[i]
+	}
+	if m2 == 0 {
+		return community, 0, true
+	}
+
+	weights := make(map[int]float64)
+	passes := 0
+	for passes < maxPasses {
+		passes++
+		changed := false
+		for i, edges := range level {
+			if degree[i] == 0 {
+				continue
+			}
+			clear(weights)
+			for j, weight := range edges {
+				if j != i {
+					weights[community[j]] += weight
+				}
+			}
+			candidates := make([]int, 0, len(weights))
+			for c := range weights {
+				candidates = append(candidates, c)
+			}
+			sort.Ints(candidates)
+
+			// Take i out of its community and put it back where the gain
+			// weights[c] - total[c] * degree[i] / m2 is highest; staying wins ties
+			own := community[i]
+			total[own] -= degree[i]
+			best, bestGain := own, weights[own]-total[own]*degree[i]/m2
+			for _, c := range candidates {
+				if gain := weights[c] - total[c]*degree[i]/m2; gain > bestGain+1e-12 {
+					best, bestGain = c, gain
+				}
+			}
+			total[best] += degree[i]
+			if best != own {
+				community[i] = best
+				changed = true
+			}
+		}
+		if !changed {
+			return community, passes, true
+		}
+	}
+	return community, passes, false
+}
+
+// newCluster aggregates the users at indexes into a cluster
+func newCluster(users []models.GraphUser, indexes []int) models.Cluster {
+	cluster := models.Cluster{Size: len(indexes), SharedIPs: []string{}}
+	ipUsers := make(map[string]int)
+	var total float64
+	for _, i := range indexes {
+		user := users[i]
+		cluster.Members = append(cluster.Members, user.UserID)
+		total += user.MaliciousScore
+		cluster.MaxScore = max(cluster.MaxScore, user.MaliciousScore)
+		cluster.HoneytokenHits += user.HoneytokenHits
+		for _, ip := range user.IPAddresses {
+			ipUsers[ip]++
+		}
+	}
+	sort.Strings(cluster.Members)
+	cluster.ClusterID = cluster.Members[0]
+	cluster.MeanScore = total / float64(cluster.Size)
+	for ip, count := range ipUsers {
+		if count > 1 {
+			cluster.SharedIPs = append(cluster.SharedIPs, ip)
+		}
+	}
+	sort.Strings(cluster.SharedIPs)
+	return cluster
+}
+
+// CommunityDetectionJob periodically exports the user graph from the store,
+// detects clusters on it, saves every user's cluster_id and keeps the cluster
+// statistics of the last run for Clusters
+type CommunityDetectionJob struct {
+	Store   GraphStore
+	Options CommunityOptions
+	Logger  *utils.Logger
+
+	mu   sync.Mutex
+	last *CommunityResult
+	loop periodicLoop
+}
+
+// NewCommunityDetectionJob creates a CommunityDetectionJob; call Start to schedule runs
+func NewCommunityDetectionJob(store GraphStore, options CommunityOptions, logger *utils.Logger) *CommunityDetectionJob {
+	defaults := DefaultCommunityOptions()
+	if options.Interval <= 0 {
+		options.Interval = defaults.Interval
+	}
+	if options.MaxIterations <= 0 {
+		options.MaxIterations = defaults.MaxIterations
+	}
+	if options.MinSize <= 0 {
+		options.MinSize = defaults.MinSize
+	}
+	return &CommunityDetectionJob{
+		Store:   store,
+		Options: options,
+		Logger:  logger,
+		loop:    newPeriodicLoop(),
+	}
+}
+
+// Start runs the job now and then every Interval in the background
+func (j *CommunityDetectionJob) Start() {
+	j.loop.start(j.Options.Interval, func(ctx context.Context) error {
+		_, err := j.Run(ctx)
+		return err
+	}, j.Logger, "Failed to detect communities")
+}
+
+// Stop cancels the current run and stops the schedule
+func (j *CommunityDetectionJob) Stop() {
+	j.loop.stop()
+}
+
+// Run detects clusters on the current graph and saves the assignments
+func (j *CommunityDetectionJob) Run(ctx context.Context) (CommunityResult, error) {
+	logger := j.Logger.WithContext(ctx)
+	start := time.Now()
+
+	graph, err := j.Store.ExportUserGraph(ctx)
+	if err != nil {
+		return CommunityResult{}, fmt.Errorf("failed to export user graph: %v", err)
+	}
+	result := DetectCommunities(graph, j.Options)
+	if !result.Converged {
+		logger.Warn("Community detection did not converge", "iterations", result.Iterations)
+	}
+	if err := j.Store.SaveClusters(ctx, result.Assignments); err != nil {
+		return CommunityResult{}, fmt.Errorf("failed to save clusters: %v", err)
+	}
+
+	j.mu.Lock()
+	j.last = &result
+	j.mu.Unlock()
+	logger.Info("Detected communities", "users", result.Users, "clusters", len(result.Clusters), "iterations", result.Iterations, "duration", time.Since(start))
+	return result, nil
+}
+
+// Clusters returns up to limit of the most suspicious clusters of the last
+// run with at least minSize members, or nil before the first run finished.
+// A minSize of 0 uses Options.MinSize.
+func (j *CommunityDetectionJob) Clusters(limit, minSize int) (*CommunityResult, []models.Cluster) {
+	if minSize <= 0 {
+		minSize = j.Options.MinSize
+	}
+	j.mu.Lock()
+	last := j.last
+	j.mu.Unlock()
+	if last == nil {
+		return nil, nil
+	}
+
+	clusters := []models.Cluster{}
+	for _, cluster := range last.Clusters {
+		if len(clusters) == limit {
+			break
+		}
+		if cluster.Size >= minSize {
+			clusters = append(clusters, cluster)
+		}
+	}
+	return last, clusters
+}
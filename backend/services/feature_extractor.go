@@ -0,0 +1,295 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"backend/models"
+	"backend/utils"
+
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+)
+
+// QueryRunner runs a read query; Neo4jService implements it
+type QueryRunner interface {
+	RunQuery(ctx context.Context, query string, params map[string]interface{}) ([]neo4j.Record, error)
+}
+
+// featureQuery computes each feature in its own subquery so that users without
+// interactions or associations still get a row, and interactions are not
+// multiplied by associates. Every column has an explicit default. Windowed
+// counts are returned as one map per entry of $windows.
+const featureQuery = `
+	MATCH (u:User {user_id: $user_id})
+	CALL {
+		WITH u
+		OPTIONAL MATCH (u)-[:HAS_INTERACTION]->(i:Interaction)
+		OPTIONAL MATCH (i)-[:TRIGGERED]->(h:Honeytoken)
+		RETURN
+			count(i) AS total_access_count,
+			sum(CASE WHEN i.honeytoken_triggered THEN 1 ELSE 0 END) AS honeytoken_access_count,
+			sum(CASE WHEN i.honeytoken_triggered THEN coalesce(h.weight, $default_weight) ELSE 0.0 END) AS weighted_honeytoken_score,
+			count(DISTINCT i.ip_address) AS shared_ip_count
+	}
+	CALL {
+		WITH u
+		OPTIONAL MATCH (u)-[r:ASSOCIATED_WITH]->(p:User)
+		WITH p, coalesce(r.type, 'explicit') AS type, max(coalesce(r.confidence, 1.0)) AS confidence
+		WHERE p IS NOT NULL
+		WITH p, 1 - reduce(independent = 1.0, c IN collect(confidence) | independent * (1 - c)) AS confidence
+		WITH sum(confidence * coalesce(p.malicious_score, 0.0)) AS weighted, sum(confidence) AS total
+		RETURN CASE WHEN total > 1 THEN weighted / total ELSE weighted END AS avg_associated_malicious_score
+	}
+	CALL {
+		WITH u
+		OPTIONAL MATCH (u)-[:HAS_INTERACTION]->(:Interaction)-[:FROM_IP]->(ip:IP)
+		WITH DISTINCT u, ip
+		OPTIONAL MATCH (ip)<-[:FROM_IP]-(:Interaction)<-[:HAS_INTERACTION]-(other:User)
+		WHERE other <> u
+		WITH ip, collect(DISTINCT other) AS others
+		WITH sum(CASE WHEN size(others) > 0 THEN 1 ELSE 0 END) AS ips_shared_with_others,
+			reduce(acc = [], list IN collect(others) | acc + [o IN list WHERE NOT o IN acc]) AS sharing
+		RETURN ips_shared_with_others, size(sharing) AS users_sharing_ips
+	}
+	CALL {
+		WITH u
+		OPTIONAL MATCH (u)-[:HAS_INTERACTION]->(:Interaction)-[:FROM_IP]->(:IP)-[:IN_SUBNET]->(s:Subnet)
+		WITH DISTINCT u, s
+		WHERE s IS NOT NULL AND EXISTS {
+			MATCH (s)<-[:IN_SUBNET]-(:IP)<-[:FROM_IP]-(:Interaction)<-[:HAS_INTERACTION]-(other:User)
+			WHERE other <> u
+		}
+		RETURN count(s) AS subnets_shared_with_others
+	}
+	CALL {
+		WITH u
+		OPTIONAL MATCH (u)-[:HAS_INTERACTION]->(i:Interaction)
+		WITH count(i) AS total,
+			count(DISTINCT CASE WHEN i.country <> '' THEN i.country END) AS distinct_countries,
+			sum(CASE WHEN i.hosting_provider THEN 1 ELSE 0 END) AS hosting,
+			sum(CASE WHEN size(coalesce(i.reputation, [])) > 0 THEN 1 ELSE 0 END) AS listed
+		RETURN distinct_countries,
+			CASE WHEN total = 0 THEN 0.0 ELSE toFloat(hosting) / total END AS hosting_traffic_ratio,
+			CASE WHEN total = 0 THEN 0.0 ELSE toFloat(listed) / total END AS reputation_traffic_ratio
+	}
+	CALL {
+		WITH u
+		UNWIND $windows AS window
+		OPTIONAL MATCH (u)-[:HAS_INTERACTION]->(i:Interaction)
+		WHERE datetime(i.timestamp) >= datetime(window.since)
+		WITH window,
+			count(i) AS interactions,
+			sum(CASE WHEN i.honeytoken_triggered THEN 1 ELSE 0 END) AS honeytoken_hits,
+			count(DISTINCT i.ip_address) AS distinct_ips,
+			sum(CASE WHEN i.response_status_code >= 400 THEN 1 ELSE 0 END) AS error_responses
+		RETURN collect({
+			window: window.name,
+			interactions: interactions,
+			honeytoken_hits: honeytoken_hits,
+			distinct_ips: distinct_ips,
+			error_responses: error_responses
+		}) AS windows
+	}
+	RETURN
+		total_access_count,
+		honeytoken_access_count,
+		toFloat(weighted_honeytoken_score) AS weighted_honeytoken_score,
+		shared_ip_count,
+		coalesce(avg_associated_malicious_score, 0.0) AS avg_associated_malicious_score,
+		coalesce(u.propagated_risk, 0.0) AS propagated_risk,
+		ips_shared_with_others,
+		users_sharing_ips,
+		subnets_shared_with_others,
+		distinct_countries,
+		hosting_traffic_ratio,
+		reputation_traffic_ratio,
+		windows
+`
+
+// Neo4jFeatureExtractor extracts the model features of a user from Neo4j
+type Neo4jFeatureExtractor struct {
+	Runner  QueryRunner
+	Windows []models.FeatureWindow // Windows of the windowed features
+	Now     func() time.Time       // End of every window
+	Logger  *utils.Logger
+}
+
+// NewNeo4jFeatureExtractor creates a new Neo4jFeatureExtractor with models.DefaultFeatureWindows
+func NewNeo4jFeatureExtractor(runner QueryRunner, logger *utils.Logger) *Neo4jFeatureExtractor {
+	return &Neo4jFeatureExtractor{
+		Runner:  runner,
+		Windows: models.DefaultFeatureWindows,
+		Now:     time.Now,
+		Logger:  logger,
+	}
+}
+
+// ExtractFeatures returns the features of a user, or ErrUserNotFound. A user
+// without interactions or associations gets zero for the missing features.
+func (e *Neo4jFeatureExtractor) ExtractFeatures(ctx context.Context, userID string) (models.UserFeatures, error) {
+	logger := e.Logger.WithContext(ctx)
+	windows := models.SortFeatureWindows(e.Windows)
+	now := e.Now().UTC()
+	windowParams := make([]map[string]interface{}, len(windows))
+	for i, window := range windows {
+		windowParams[i] = map[string]interface{}{
+			"name":  window.String(),
+			"since": now.Add(-time.Duration(window)).Format(time.RFC3339Nano),
+		}
+	}
+	params := map[string]interface{}{
+		"user_id":        userID,
+		"default_weight": models.DefaultHoneytokenWeight,
+		"windows":        windowParams,
+	}
+	logger.Debug("Executing feature query", "user_id", userID)
+
+	records, err := e.Runner.RunQuery(ctx, featureQuery, params)
+	if err != nil {
+		return models.UserFeatures{}, fmt.Errorf("failed to run feature query: %v", err)
+	}
+	if len(records) == 0 {
+		return models.UserFeatures{}, fmt.Errorf("%w: %s", ErrUserNotFound, userID)
+	}
+
+	features, err := DecodeUserFeatures(records[0], windows)
+	if err != nil {
+		logger.Error("Failed to decode features", "user_id", userID, "error", err)
+		return models.UserFeatures{}, err
+	}
+	return features, nil
+}
+
+// DecodeUserFeatures decodes a row of the feature query run with the given
+// windows, shortest first. Null values decode to zero; missing columns and
+// unexpected types are errors.
+func DecodeUserFeatures(record neo4j.Record, windows []models.FeatureWindow) (models.UserFeatures, error) {
+	var features models.UserFeatures
+	var err error
+	if features.TotalAccessCount, err = recordInt(record, "total_access_count"); err != nil {
+		return models.UserFeatures{}, err
+	}
+	if features.HoneytokenAccessCount, err = recordInt(record, "honeytoken_access_count"); err != nil {
+		return models.UserFeatures{}, err
+	}
+	if features.WeightedHoneytokenScore, err = recordFloat(record, "weighted_honeytoken_score"); err != nil {
+		return models.UserFeatures{}, err
+	}
+	if features.SharedIPCount, err = recordInt(record, "shared_ip_count"); err != nil {
+		return models.UserFeatures{}, err
+	}
+	if features.AvgAssociatedMaliciousScore, err = recordFloat(record, "avg_associated_malicious_score"); err != nil {
+		return models.UserFeatures{}, err
+	}
+	if features.PropagatedRisk, err = recordFloat(record, "propagated_risk"); err != nil {
+		return models.UserFeatures{}, err
+	}
+	if features.IPsSharedWithOthers, err = recordInt(record, "ips_shared_with_others"); err != nil {
+		return models.UserFeatures{}, err
+	}
+	if features.UsersSharingIPs, err = recordInt(record, "users_sharing_ips"); err != nil {
+		return models.UserFeatures{}, err
+	}
+	if features.SubnetsSharedWithOthers, err = recordInt(record, "subnets_shared_with_others"); err != nil {
+		return models.UserFeatures{}, err
+	}
+	if features.DistinctCountries, err = recordInt(record, "distinct_countries"); err != nil {
+		return models.UserFeatures{}, err
+	}
+	if features.HostingTrafficRatio, err = recordFloat(record, "hosting_traffic_ratio"); err != nil {
+		return models.UserFeatures{}, err
+	}
+	if features.ReputationTrafficRatio, err = recordFloat(record, "reputation_traffic_ratio"); err != nil {
+		return models.UserFeatures{}, err
+	}
+
+	windowFeatures, err := decodeWindows(record, windows)
+	if err != nil {
+		return models.UserFeatures{}, err
+	}
+	features.SetWindows(windowFeatures)
+	return features, nil
+}
+
+// decodeWindows reads the windows column; windows missing from it count zero
+func decodeWindows(record neo4j.Record, windows []models.FeatureWindow) ([]models.WindowFeatures, error) {
+	raw, ok := record.Get("windows")
+	if !ok {
+		return nil, fmt.Errorf("feature query returned no windows column")
+	}
+	rows, ok := raw.([]any)
+	if raw != nil && !ok {
+		return nil, fmt.Errorf("feature windows has type %T, expected a list", raw)
+	}
+
+	byName := make(map[string]map[string]any, len(rows))
+	for _, row := range rows {
+		values, ok := row.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("feature window has type %T, expected a map", row)
+		}
+		name, _ := values["window"].(string)
+		byName[name] = values
+	}
+
+	result := make([]models.WindowFeatures, len(windows))
+	for i, window := range windows {
+		result[i] = models.NewWindowFeatures(window)
+		values, ok := byName[window.String()]
+		if !ok {
+			continue
+		}
+		counts := []struct {
+			key   string
+			value *int64
+		}{
+			{"interactions", &result[i].Interactions},
+			{"honeytoken_hits", &result[i].HoneytokenHits},
+			{"distinct_ips", &result[i].DistinctIPs},
+			{"error_responses", &result[i].ErrorResponses},
+		}
+		for _, count := range counts {
+			switch value := values[count.key].(type) {
+			case nil:
+			case int64:
+				*count.value = value
+			default:
+				return nil, fmt.Errorf("feature %s_%s has type %T, expected an integer", count.key, window, value)
+			}
+		}
+	}
+	return result, nil
+}
+
+// recordInt reads an integer column
+func recordInt(record neo4j.Record, key string) (int64, error) {
+	raw, ok := record.Get(key)
+	if !ok {
+		return 0, fmt.Errorf("feature query returned no %s column", key)
+	}
+	switch value := raw.(type) {
+	case nil:
+		return 0, nil
+	case int64:
+		return value, nil
+	}
+	return 0, fmt.Errorf("feature %s has type %T, expected an integer", key, raw)
+}
+
+// recordFloat reads a numeric column; integers are converted
+func recordFloat(record neo4j.Record, key string) (float64, error) {
+	raw, ok := record.Get(key)
+	if !ok {
+		return 0, fmt.Errorf("feature query returned no %s column", key)
+	}
+	switch value := raw.(type) {
+	case nil:
+		return 0, nil
+	case float64:
+		return value, nil
+	case int64:
+		return float64(value), nil
+	}
+	return 0, fmt.Errorf("feature %s has type %T, expected a number", key, raw)
+}
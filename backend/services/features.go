@@ -0,0 +1,293 @@
+package services
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"backend/models"
+)
+
+// FeatureSource is the stored data a feature is computed from
+type FeatureSource string
+
+const (
+	// SourceAggregates features read the counts of GraphStore.ExtractFeatures
+	SourceAggregates FeatureSource = "aggregates"
+	// SourceInteractions features read the user's recent interactions
+	SourceInteractions FeatureSource = "interactions"
+)
+
+// FeatureData is the stored data of one user that features are computed from.
+// Interactions is only loaded when an enabled feature reads SourceInteractions.
+type FeatureData struct {
+	UserID       string
+	Aggregates   models.UserFeatures
+	Interactions []models.Interaction // Interactions within the registry's Lookback, oldest first
+	Now          time.Time
+}
+
+// Feature is one named input of the scoring model
+type Feature interface {
+	// Name is the key of the feature in the model's feature vector
+	Name() string
+	// Description explains the feature in /api/features
+	Description() string
+	// Source is the stored data Compute reads
+	Source() FeatureSource
+	// Compute returns the value of the feature, an int64 or a float64
+	Compute(data FeatureData) (interface{}, error)
+}
+
+// FeatureInfo describes a registered feature
+type FeatureInfo struct {
+	Name        string        `json:"name"`
+	Description string        `json:"description"`
+	Source      FeatureSource `json:"source"`
+	Enabled     bool          `json:"enabled"`
+}
+
+// FeatureRegistry holds the built-in and custom features and which of them
+// make up the feature vector. It is safe for concurrent use.
+type FeatureRegistry struct {
+	// Lookback bounds the interactions loaded for SourceInteractions features
+	Lookback time.Duration
+
+	mu       sync.RWMutex
+	features map[string]Feature
+	enabled  map[string]bool
+}
+
+// NewFeatureRegistry creates an empty FeatureRegistry
+func NewFeatureRegistry(lookback time.Duration) *FeatureRegistry {
+	return &FeatureRegistry{
+		Lookback: lookback,
+		features: make(map[string]Feature),
+		enabled:  make(map[string]bool),
+	}
+}
+
+// NewDefaultFeatureRegistry registers the built-in aggregate features for the
+// given windows, enabled, and the custom interaction features, disabled. The
+// lookback of interaction features is the longest window.
+func NewDefaultFeatureRegistry(windows []models.FeatureWindow) *FeatureRegistry {
+	windows = models.SortFeatureWindows(windows)
+	lookback := 7 * 24 * time.Hour
+	if len(windows) > 0 {
+		lookback = time.Duration(windows[len(windows)-1])
+	}
+
+	registry := NewFeatureRegistry(lookback)
+	for _, feature := range BuiltinFeatures(windows) {
+		registry.mustRegister(feature, true)
+	}
+	registry.mustRegister(ErrorRateFeature{}, false)
+	registry.mustRegister(EndpointDiversityFeature{}, false)
+	return registry
+}
+
+// Register adds a feature. Names must be unique.
+func (r *FeatureRegistry) Register(feature Feature, enabled bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	name := feature.Name()
+	if name == "" {
+		return fmt.Errorf("feature name is required")
+	}
+	if _, ok := r.features[name]; ok {
+		return fmt.Errorf("feature %s is already registered", name)
+	}
+	r.features[name] = feature
+	r.enabled[name] = enabled
+	return nil
+}
+
+// mustRegister registers a built-in feature; a conflict is a programming error
+func (r *FeatureRegistry) mustRegister(feature Feature, enabled bool) {
+	if err := r.Register(feature, enabled); err != nil {
+		panic(err)
+	}
+}
+
+// Enable replaces the set of enabled features with names
+func (r *FeatureRegistry) Enable(names []string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	enabled := make(map[string]bool, len(r.features))
+	for name := range r.features {
+		enabled[name] = false
+	}
+	for _, name := range names {
+		if _, ok := r.features[name]; !ok {
+			return fmt.Errorf("unknown feature %q", name)
+		}
+		enabled[name] = true
+	}
+	r.enabled = enabled
+	return nil
+}
+
+// Require checks that every named feature is registered and enabled, e.g. the
+// inputs of a model artifact
+func (r *FeatureRegistry) Require(names []string) error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, name := range names {
+		if _, ok := r.features[name]; !ok {
+			return fmt.Errorf("unknown feature %q", name)
+		}
+		if !r.enabled[name] {
+			return fmt.Errorf("feature %q is not enabled", name)
+		}
+	}
+	return nil
+}
+
+// List describes every registered feature, sorted by name
+func (r *FeatureRegistry) List() []FeatureInfo {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	infos := make([]FeatureInfo, 0, len(r.features))
+	for name, feature := range r.features {
+		infos = append(infos, FeatureInfo{
+			Name:        name,
+			Description: feature.Description(),
+			Source:      feature.Source(),
+			Enabled:     r.enabled[name],
+		})
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+	return infos
+}
+
+// NeedsInteractions reports whether an enabled feature reads SourceInteractions
+func (r *FeatureRegistry) NeedsInteractions() bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for name, feature := range r.features {
+		if r.enabled[name] && feature.Source() == SourceInteractions {
+			return true
+		}
+	}
+	return false
+}
+
+// Assemble computes every enabled feature
+func (r *FeatureRegistry) Assemble(data FeatureData) (map[string]interface{}, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	values := make(map[string]interface{}, len(r.features))
+	for name, feature := range r.features {
+		if !r.enabled[name] {
+			continue
+		}
+		value, err := feature.Compute(data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to compute feature %s: %v", name, err)
+		}
+		values[name] = value
+	}
+	return values, nil
+}
+
+// AggregateFeature exposes one value of models.UserFeatures.ToMap
+type AggregateFeature struct {
+	FeatureName string
+	Help        string
+}
+
+// BuiltinFeatures returns the aggregate features for the given windows
+func BuiltinFeatures(windows []models.FeatureWindow) []Feature {
+	features := []Feature{
+		AggregateFeature{"total_access_count", "Number of interactions made by the user"},
+		AggregateFeature{"honeytoken_access_count", "Number of honeytoken triggers"},
+		AggregateFeature{"weighted_honeytoken_score", "Honeytoken triggers weighted by token severity"},
+		AggregateFeature{"shared_ip_count", "Number of distinct IPs used, shared or not"},
+		AggregateFeature{"avg_associated_malicious_score", "Confidence-weighted average malicious_score of associated users"},
+		AggregateFeature{"propagated_risk", "Risk propagated from malicious users and honeytoken triggerers over associations"},
+		AggregateFeature{"ips_shared_with_others", "Number of the user's IPs other users also used"},
+		AggregateFeature{"users_sharing_ips", "Number of other users who used any of the user's IPs"},
+		AggregateFeature{"subnets_shared_with_others", "Number of the user's /24 or /64 subnets other users also used"},
+		AggregateFeature{"distinct_countries", "Number of distinct GeoIP countries of the user's interactions"},
+		AggregateFeature{"hosting_traffic_ratio", "Share of the user's interactions from cloud or hosting provider IPs"},
+		AggregateFeature{"reputation_traffic_ratio", "Share of the user's interactions from IPs on any reputation list"},
+		AggregateFeature{"interaction_velocity", "Interaction rate of the shortest window over the next"},
+		AggregateFeature{"interaction_acceleration", "Change of the interaction velocity across the three shortest windows"},
+		AggregateFeature{"honeytoken_velocity", "Honeytoken hit rate of the shortest window over the next"},
+		AggregateFeature{"honeytoken_acceleration", "Change of the honeytoken velocity across the three shortest windows"},
+	}
+	for _, window := range windows {
+		features = append(features,
+			AggregateFeature{"interactions_" + window.String(), "Interactions in the last " + window.String()},
+			AggregateFeature{"honeytoken_hits_" + window.String(), "Honeytoken triggers in the last " + window.String()},
+			AggregateFeature{"distinct_ips_" + window.String(), "Distinct IPs used in the last " + window.String()},
+			AggregateFeature{"error_responses_" + window.String(), "Interactions answered with status >= 400 in the last " + window.String()},
+		)
+	}
+	return features
+}
+
+func (f AggregateFeature) Name() string          { return f.FeatureName }
+func (f AggregateFeature) Description() string   { return f.Help }
+func (f AggregateFeature) Source() FeatureSource { return SourceAggregates }
+
+// Compute reads the feature from the extracted aggregates
+func (f AggregateFeature) Compute(data FeatureData) (interface{}, error) {
+	value, ok := data.Aggregates.ToMap()[f.FeatureName]
+	if !ok {
+		return nil, fmt.Errorf("feature %s was not extracted", f.FeatureName)
+	}
+	return value, nil
+}
+
+// ErrorRateFeature is the share of recent interactions answered with status >= 400
+type ErrorRateFeature struct{}
+
+func (ErrorRateFeature) Name() string { return "error_rate" }
+func (ErrorRateFeature) Description() string {
+	return "Share of recent interactions answered with status >= 400"
+}
+func (ErrorRateFeature) Source() FeatureSource { return SourceInteractions }
+
+// Compute returns 0 for a user without recent interactions
+func (ErrorRateFeature) Compute(data FeatureData) (interface{}, error) {
+	if len(data.Interactions) == 0 {
+		return 0.0, nil
+	}
+	var failed int
+	for _, interaction := range data.Interactions {
+		if interaction.ResponseStatusCode >= 400 {
+			failed++
+		}
+	}
+	return float64(failed) / float64(len(data.Interactions)), nil
+}
+
+// EndpointDiversityFeature is the share of distinct endpoints among recent
+// interactions: close to 1 for scanners, low for users repeating a workflow
+type EndpointDiversityFeature struct{}
+
+func (EndpointDiversityFeature) Name() string { return "endpoint_diversity" }
+func (EndpointDiversityFeature) Description() string {
+	return "Distinct endpoints over the number of recent interactions"
+}
+func (EndpointDiversityFeature) Source() FeatureSource { return SourceInteractions }
+
+// Compute returns 0 for a user without recent interactions
+func (EndpointDiversityFeature) Compute(data FeatureData) (interface{}, error) {
+	if len(data.Interactions) == 0 {
+		return 0.0, nil
+	}
+	endpoints := make(map[string]struct{})
+	for _, interaction := range data.Interactions {
+		endpoints[interaction.Endpoint] = struct{}{}
+	}
+	return float64(len(endpoints)) / float64(len(data.Interactions)), nil
+}
@@ -0,0 +1,235 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"backend/models"
+	"backend/utils"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// DefaultHostingASNs are autonomous systems of large cloud and hosting
+// providers: AWS, Google, Microsoft, DigitalOcean, OVH, Hetzner, Linode,
+// Alibaba, Vultr and Oracle
+var DefaultHostingASNs = []int{16509, 14618, 15169, 396982, 8075, 14061, 16276, 24940, 63949, 45102, 20473, 31898}
+
+// GeoIPOptions configures a GeoIPEnricher
+type GeoIPOptions struct {
+	CityDB         string        // MaxMind City or Country database; empty leaves country and city unset
+	ASNDB          string        // MaxMind ASN database; empty leaves asn and as_org unset
+	ReloadInterval time.Duration // How often the databases are checked for changes
+	HostingASNs    []int         // ASNs whose IPs count as hosting providers; empty uses DefaultHostingASNs
+}
+
+// DefaultGeoIPOptions returns the default GeoIPOptions, without databases
+func DefaultGeoIPOptions() GeoIPOptions {
+	return GeoIPOptions{
+		ReloadInterval: time.Minute,
+		HostingASNs:    DefaultHostingASNs,
+	}
+}
+
+// geoIPRecord holds the fields read from either database. City databases
+// have country and city, ASN databases the autonomous system; traits are
+// only present in commercial databases.
+type geoIPRecord struct {
+	Country struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+	City struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"city"`
+	Traits struct {
+		IsHostingProvider bool `maxminddb:"is_hosting_provider"`
+	} `maxminddb:"traits"`
+	ASN   int    `maxminddb:"autonomous_system_number"`
+	ASOrg string `maxminddb:"autonomous_system_organization"`
+}
+
+// fileVersion identifies the contents of a file that is reloaded when it changes
+type fileVersion struct {
+	modTime time.Time
+	size    int64
+}
+
+// statFileVersion returns the current version of the file at path
+func statFileVersion(path string) (fileVersion, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fileVersion{}, err
+	}
+	return fileVersion{modTime: info.ModTime(), size: info.Size()}, nil
+}
+
+// changed reports whether the file at path is no longer at version v. A file
+// that cannot be read is not reported, so a file being replaced keeps its
+// loaded version until it reappears.
+func (v fileVersion) changed(path string) bool {
+	current, err := statFileVersion(path)
+	return err == nil && (!current.modTime.Equal(v.modTime) || current.size != v.size)
+}
+
+// geoIPDatabase is a database read into memory and the version of the file it
+// was read from
+type geoIPDatabase struct {
+	reader  *maxminddb.Reader
+	version fileVersion
+}
+
+// loadGeoIPDatabase reads a database file into memory
+func loadGeoIPDatabase(path string) (*geoIPDatabase, error) {
+	version, err := statFileVersion(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat GeoIP database: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read GeoIP database: %v", err)
+	}
+	reader, err := maxminddb.FromBytes(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open GeoIP database %s: %v", path, err)
+	}
+	return &geoIPDatabase{reader: reader, version: version}, nil
+}
+
+// GeoIPEnricher fills in the country, city, ASN and organization of
+// interactions from local MaxMind databases, without network calls. The
+// databases are read into memory rather than mapped, so they can be replaced
+// on disk while in use; Start checks them every ReloadInterval and swaps in
+// files that changed.
+type GeoIPEnricher struct {
+	Options GeoIPOptions
+	Logger  *utils.Logger
+
+	hosting map[int]bool
+	mu      sync.RWMutex
+	city    *geoIPDatabase
+	asn     *geoIPDatabase
+	loop    periodicLoop
+}
+
+// NewGeoIPEnricher loads the configured databases; call Start to reload them
+// when they change
+func NewGeoIPEnricher(options GeoIPOptions, logger *utils.Logger) (*GeoIPEnricher, error) {
+	if options.CityDB == "" && options.ASNDB == "" {
+		return nil, fmt.Errorf("no GeoIP database configured")
+	}
+	defaults := DefaultGeoIPOptions()
+	if options.ReloadInterval <= 0 {
+		options.ReloadInterval = defaults.ReloadInterval
+	}
+	if len(options.HostingASNs) == 0 {
+		options.HostingASNs = defaults.HostingASNs
+	}
+
+	g := &GeoIPEnricher{
+		Options: options,
+		Logger:  logger,
+		hosting: make(map[int]bool, len(options.HostingASNs)),
+		loop:    newPeriodicLoop(),
+	}
+	for _, asn := range options.HostingASNs {
+		g.hosting[asn] = true
+	}
+
+	var err error
+	if options.CityDB != "" {
+		if g.city, err = loadGeoIPDatabase(options.CityDB); err != nil {
+			return nil, err
+		}
+	}
+	if options.ASNDB != "" {
+		if g.asn, err = loadGeoIPDatabase(options.ASNDB); err != nil {
+			return nil, err
+		}
+	}
+	return g, nil
+}
+
+// Start checks the databases for changes every ReloadInterval in the background
+func (g *GeoIPEnricher) Start() {
+	g.loop.start(g.Options.ReloadInterval, func(ctx context.Context) error {
+		_, err := g.Reload()
+		return err
+	}, g.Logger, "Failed to reload GeoIP database")
+}
+
+// Stop stops checking the databases for changes
+func (g *GeoIPEnricher) Stop() {
+	g.loop.stop()
+}
+
+// Reload re-reads the databases whose files changed since they were loaded
+// and reports whether any was replaced. A database that fails to load keeps
+// its previous version.
+func (g *GeoIPEnricher) Reload() (bool, error) {
+	g.mu.RLock()
+	city, asn := g.city, g.asn
+	g.mu.RUnlock()
+
+	reloaded := false
+	for _, db := range []struct {
+		path    string
+		current **geoIPDatabase
+		loaded  *geoIPDatabase
+	}{
+		{g.Options.CityDB, &g.city, city},
+		{g.Options.ASNDB, &g.asn, asn},
+	} {
+		if db.loaded == nil || !db.loaded.version.changed(db.path) {
+			continue
+		}
+		next, err := loadGeoIPDatabase(db.path)
+		if err != nil {
+			return reloaded, err
+		}
+		g.mu.Lock()
+		*db.current = next
+		g.mu.Unlock()
+		reloaded = true
+		g.Logger.Info("Reloaded GeoIP database", "path", db.path, "database_type", next.reader.Metadata.DatabaseType,
+			"build_epoch", next.reader.Metadata.BuildEpoch)
+	}
+	return reloaded, nil
+}
+
+// Enrich sets the GeoIP fields of an interaction from its IP address.
+// Values sent by the client are overwritten, and addresses missing from the
+// databases leave the fields empty.
+func (g *GeoIPEnricher) Enrich(interaction *models.Interaction) {
+	interaction.Country, interaction.City, interaction.ASN, interaction.ASOrg = "", "", 0, ""
+	interaction.HostingProvider = false
+
+	address, err := utils.NormalizeIP(interaction.IPAddress)
+	if err != nil {
+		return
+	}
+	ip := net.ParseIP(address)
+	g.mu.RLock()
+	city, asn := g.city, g.asn
+	g.mu.RUnlock()
+
+	var record geoIPRecord
+	for _, db := range []*geoIPDatabase{city, asn} {
+		if db == nil {
+			continue
+		}
+		// IPv6 lookups fail on IPv4-only databases; the fields stay empty
+		if err := db.reader.Lookup(ip, &record); err != nil {
+			g.Logger.Debug("GeoIP lookup failed", "ip_address", interaction.IPAddress, "error", err)
+		}
+	}
+
+	interaction.Country = record.Country.ISOCode
+	interaction.City = record.City.Names["en"]
+	interaction.ASN = record.ASN
+	interaction.ASOrg = record.ASOrg
+	interaction.HostingProvider = record.Traits.IsHostingProvider || g.hosting[record.ASN]
+}
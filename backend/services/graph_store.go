@@ -0,0 +1,91 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"backend/models"
+)
+
+var (
+	// ErrHoneytokenNotFound is returned when a honeytoken ID is not registered
+	ErrHoneytokenNotFound = errors.New("honeytoken not found")
+	// ErrHoneytokenExists is returned when a honeytoken ID is already registered
+	ErrHoneytokenExists = errors.New("honeytoken already exists")
+	// ErrUserNotFound is returned when a user ID is not in the graph
+	ErrUserNotFound = errors.New("user not found")
+)
+
+// GraphStore is the storage backend used by the handlers and analysis services.
+// Neo4jService is the production implementation; MemoryStore keeps everything in
+// process so the backend can run without a Neo4j server. The request ID carried
+// by ctx is attached to the log messages and queries of each call.
+type GraphStore interface {
+	// SaveInteraction records an interaction for a user, creating the user if needed.
+	// An interaction with a HoneytokenID is linked to that honeytoken. Saving an
+	// interaction again with the same ID has no further effect.
+	SaveInteraction(ctx context.Context, interaction models.Interaction) error
+	// SaveInteractions records a batch of interactions in a single write
+	SaveInteractions(ctx context.Context, interactions []models.Interaction) error
+	// AssociatedWith links two users, creating either user if needed
+	AssociatedWith(ctx context.Context, user1, user2 string) error
+	// GetMaliciousScore returns the malicious_score of a user or ErrUserNotFound
+	GetMaliciousScore(ctx context.Context, userID string) (float64, error)
+	// UpdateMaliciousScore sets the malicious_score of an existing user
+	UpdateMaliciousScore(ctx context.Context, userID string, newScore float64) error
+	// RecordScore sets a user's malicious_score and stores the scoring event
+	RecordScore(ctx context.Context, snapshot models.ScoreSnapshot) error
+	// GetScoreHistory returns a user's score snapshots, oldest first
+	GetScoreHistory(ctx context.Context, userID string) ([]models.ScoreSnapshot, error)
+	// CreateHoneytoken registers a new honeytoken or returns ErrHoneytokenExists
+	CreateHoneytoken(ctx context.Context, token models.Honeytoken) error
+	// GetHoneytoken returns a registered honeytoken or ErrHoneytokenNotFound
+	GetHoneytoken(ctx context.Context, tokenID string) (models.Honeytoken, error)
+	// ListHoneytokens returns registered honeytokens, optionally including retired ones
+	ListHoneytokens(ctx context.Context, includeRetired bool) ([]models.Honeytoken, error)
+	// RetireHoneytoken marks a honeytoken as retired or returns ErrHoneytokenNotFound
+	RetireHoneytoken(ctx context.Context, tokenID string) error
+	// ExtractFeatures returns the AI model features for a user or ErrUserNotFound.
+	// Users without interactions or associations get zero for those features.
+	ExtractFeatures(ctx context.Context, userID string) (models.UserFeatures, error)
+	// GetInteractions returns a user's interactions since the given time, oldest first
+	GetInteractions(ctx context.Context, userID string, since time.Time) ([]models.Interaction, error)
+	// ListInteractions returns the interactions of every user since the given time, oldest first
+	ListInteractions(ctx context.Context, since time.Time) ([]models.Interaction, error)
+	// ListSharedIPs returns the interactions since the given time by normalized
+	// IP, for IPs used by 2 to maxUsers users. Only UserID and Timestamp are set.
+	ListSharedIPs(ctx context.Context, since time.Time, maxUsers int) (map[string][]models.Interaction, error)
+	// ListSharedHoneytokens returns the sorted IDs of the users who triggered
+	// each honeytoken since the given time, for honeytokens triggered by 2 to
+	// maxUsers users
+	ListSharedHoneytokens(ctx context.Context, since time.Time, maxUsers int) (map[string][]string, error)
+	// ListEndpointSequences returns the latest maxLength endpoints since the
+	// given time, oldest first, of each user with at least minLength of them
+	ListEndpointSequences(ctx context.Context, since time.Time, minLength, maxLength int) (map[string][]string, error)
+	// ListUserIDs returns up to limit user IDs greater than after, in ascending
+	// order. With staleOnly it skips users without an interaction saved after
+	// their last score, by the backend's clock rather than the interaction
+	// timestamp; users never scored are stale once they have interactions.
+	ListUserIDs(ctx context.Context, after string, limit int, staleOnly bool) ([]string, error)
+	// ExportUserGraph returns every user and ASSOCIATED_WITH edge for graph algorithms
+	ExportUserGraph(ctx context.Context) (models.UserGraph, error)
+	// SavePropagatedRisk sets the propagated_risk of the given users
+	SavePropagatedRisk(ctx context.Context, risks map[string]float64) error
+	// SaveClusters sets the cluster_id of the given users
+	SaveClusters(ctx context.Context, clusters map[string]string) error
+	// SaveAssociations stores inferred associations in both directions,
+	// replacing earlier ones of the same users and type
+	SaveAssociations(ctx context.Context, associations []models.Association) error
+	// PruneAssociations deletes the inferred associations not saved by the
+	// inference run at inferredAt, in both directions, and returns how many
+	// edges it deleted. Explicit associations are kept.
+	PruneAssociations(ctx context.Context, inferredAt time.Time) (int, error)
+	// GetAssociations returns the explicit and inferred associations of a user
+	GetAssociations(ctx context.Context, userID string) ([]models.Association, error)
+}
+
+var (
+	_ GraphStore = (*Neo4jService)(nil)
+	_ GraphStore = (*MemoryStore)(nil)
+)
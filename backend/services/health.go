@@ -0,0 +1,191 @@
+package services
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"backend/utils"
+)
+
+// HealthCheckFunc probes a dependency and returns an error if it is unusable
+type HealthCheckFunc func(ctx context.Context) error
+
+// DependencyStatus is the result of the latest check of a dependency
+type DependencyStatus struct {
+	Name        string     `json:"name"`
+	Healthy     bool       `json:"healthy"`
+	LatencyMs   float64    `json:"latency_ms"`
+	CheckedAt   time.Time  `json:"checked_at"`
+	LastError   string     `json:"last_error,omitempty"`
+	LastErrorAt *time.Time `json:"last_error_at,omitempty"`
+}
+
+// HealthStatus summarizes the health of the service and its dependencies
+type HealthStatus struct {
+	Version       string             `json:"version"`
+	Ready         bool               `json:"ready"`
+	ShuttingDown  bool               `json:"shutting_down"`
+	UptimeSeconds float64            `json:"uptime_seconds"`
+	Dependencies  []DependencyStatus `json:"dependencies"`
+}
+
+// HealthService periodically checks dependencies such as Neo4j and the AI
+// model server. The service is ready once every dependency passed its latest
+// check and it is not shutting down.
+type HealthService struct {
+	Version      string
+	Interval     time.Duration
+	CheckTimeout time.Duration
+	Logger       *utils.Logger
+
+	mu           sync.RWMutex
+	checks       map[string]HealthCheckFunc
+	statuses     map[string]*DependencyStatus
+	startedAt    time.Time
+	shuttingDown bool
+	stop         chan struct{}
+	stopped      chan struct{}
+}
+
+// NewHealthService creates a HealthService; call Register for each dependency and then Start
+func NewHealthService(version string, interval, checkTimeout time.Duration, logger *utils.Logger) *HealthService {
+	return &HealthService{
+		Version:      version,
+		Interval:     interval,
+		CheckTimeout: checkTimeout,
+		Logger:       logger,
+		checks:       make(map[string]HealthCheckFunc),
+		statuses:     make(map[string]*DependencyStatus),
+		startedAt:    time.Now(),
+		stop:         make(chan struct{}),
+		stopped:      make(chan struct{}),
+	}
+}
+
+// Register adds a dependency check
+func (s *HealthService) Register(name string, check HealthCheckFunc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.checks[name] = check
+}
+
+// Start runs all checks once and then every Interval until Stop is called
+func (s *HealthService) Start() {
+	s.CheckAll(context.Background())
+	go func() {
+		defer close(s.stopped)
+		ticker := time.NewTicker(s.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				s.CheckAll(context.Background())
+			case <-s.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop stops the periodic checks
+func (s *HealthService) Stop() {
+	close(s.stop)
+	<-s.stopped
+}
+
+// SetShuttingDown marks the service as not ready so traffic is drained
+func (s *HealthService) SetShuttingDown() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.shuttingDown = true
+}
+
+// CheckAll runs every dependency check concurrently and records the results
+func (s *HealthService) CheckAll(ctx context.Context) {
+	s.mu.RLock()
+	checks := make(map[string]HealthCheckFunc, len(s.checks))
+	for name, check := range s.checks {
+		checks[name] = check
+	}
+	s.mu.RUnlock()
+
+	var wg sync.WaitGroup
+	for name, check := range checks {
+		wg.Add(1)
+		go func(name string, check HealthCheckFunc) {
+			defer wg.Done()
+			s.runCheck(ctx, name, check)
+		}(name, check)
+	}
+	wg.Wait()
+}
+
+// runCheck runs one check with CheckTimeout and records its result
+func (s *HealthService) runCheck(ctx context.Context, name string, check HealthCheckFunc) {
+	ctx, cancel := context.WithTimeout(ctx, s.CheckTimeout)
+	defer cancel()
+
+	start := time.Now()
+	err := check(ctx)
+	latency := time.Since(start)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	status, ok := s.statuses[name]
+	if !ok {
+		status = &DependencyStatus{Name: name}
+		s.statuses[name] = status
+	}
+	wasHealthy := status.Healthy || !ok
+	status.Healthy = err == nil
+	status.LatencyMs = float64(latency.Microseconds()) / 1000
+	status.CheckedAt = start
+	if err != nil {
+		status.LastError = err.Error()
+		status.LastErrorAt = &start
+		if wasHealthy {
+			s.Logger.Error("Dependency check failed", "dependency", name, "error", err)
+		}
+	} else if !wasHealthy {
+		s.Logger.Info("Dependency recovered", "dependency", name)
+	}
+}
+
+// Ready reports whether every dependency passed its latest check
+func (s *HealthService) Ready() bool {
+	return s.Status().Ready
+}
+
+// Status returns the current health of the service and its dependencies
+func (s *HealthService) Status() HealthStatus {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	status := HealthStatus{
+		Version:       s.Version,
+		Ready:         !s.shuttingDown,
+		ShuttingDown:  s.shuttingDown,
+		UptimeSeconds: time.Since(s.startedAt).Seconds(),
+		Dependencies:  make([]DependencyStatus, 0, len(s.checks)),
+	}
+	for name := range s.checks {
+		dependency, ok := s.statuses[name]
+		if !ok {
+			// Not checked yet
+			status.Ready = false
+			status.Dependencies = append(status.Dependencies, DependencyStatus{Name: name})
+			continue
+		}
+		if !dependency.Healthy {
+			status.Ready = false
+		}
+		status.Dependencies = append(status.Dependencies, *dependency)
+	}
+	sort.Slice(status.Dependencies, func(i, j int) bool {
+		return status.Dependencies[i].Name < status.Dependencies[j].Name
+	})
+	return status
+}
@@ -0,0 +1,341 @@
+package services
+
+import (
+	"errors"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"backend/models"
+	"backend/utils"
+)
+
+var (
+	// ErrQueueFull is returned when the ingestion queue cannot take more interactions
+	ErrQueueFull = errors.New("ingestion queue is full")
+	// ErrQueueClosed is returned when enqueuing to a closed ingestion queue
+	ErrQueueClosed = errors.New("ingestion queue is closed")
+)
+
+// InteractionWriter writes interactions to the store, e.g. a BatchWriter
+type InteractionWriter interface {
+	Submit(interactions []models.Interaction) error
+}
+
+// InteractionEnricher adds data derived from an interaction, such as the
+// GeoIP fields, before it is written
+type InteractionEnricher interface {
+	Enrich(interaction *models.Interaction)
+}
+
+// IngestionQueueOptions configures an IngestionQueue
+type IngestionQueueOptions struct {
+	MaxPending     int           // Maximum interactions waiting in memory before load shedding
+	Workers        int           // Number of goroutines writing to the store
+	MaxRetries     int           // Write retries before spilling to the WAL
+	BaseBackoff    time.Duration // Delay before the first retry, doubled on each retry
+	MaxBackoff     time.Duration // Upper bound on the retry delay
+	ReplayInterval time.Duration // How often to try replaying the WAL
+	RetryAfter     time.Duration // Retry-After sent to clients when the queue is full
+	WALPath        string        // File that interactions spill to when the store is unavailable
+	ReplayBatch    int           // Interactions read from the WAL per write when replaying it
+	WriteBatch     int           // Most queued interactions a worker takes for one write
+
+	Enrichers []InteractionEnricher // Applied in order to every enqueued interaction
+}
+
+// DefaultIngestionQueueOptions returns the default IngestionQueueOptions
+func DefaultIngestionQueueOptions() IngestionQueueOptions {
+	return IngestionQueueOptions{
+		MaxPending:     10000,
+		Workers:        4,
+		MaxRetries:     3,
+		BaseBackoff:    100 * time.Millisecond,
+		MaxBackoff:     5 * time.Second,
+		ReplayInterval: 10 * time.Second,
+		RetryAfter:     time.Second,
+		WALPath:        "data/ingestion.wal",
+		ReplayBatch:    DefaultBatchSize,
+		WriteBatch:     DefaultBatchSize,
+	}
+}
+
+// IngestionQueue decouples HTTP handlers from the store. Interactions are
+// queued in memory and written by a pool of workers, which retry with
+// exponential backoff. Interactions that still cannot be written are spilled
+// to a write-ahead log and replayed once the store recovers.
+type IngestionQueue struct {
+	Writer  InteractionWriter
+	WAL     *WriteAheadLog
+	Options IngestionQueueOptions
+	Logger  *utils.Logger
+
+	items       chan []models.Interaction
+	pending     atomic.Int64
+	unavailable atomic.Bool
+	abandoned   atomic.Bool
+	mu          sync.RWMutex
+	closed      bool
+	workers     sync.WaitGroup
+	stopReplay  chan struct{}
+	replayDone  chan struct{}
+}
+
+// NewIngestionQueue creates an IngestionQueue, replays any interactions left
+// in the WAL by a previous run and starts its workers
+func NewIngestionQueue(writer InteractionWriter, options IngestionQueueOptions, logger *utils.Logger) (*IngestionQueue, error) {
+	defaults := DefaultIngestionQueueOptions()
+	if options.MaxPending <= 0 {
+		options.MaxPending = defaults.MaxPending
+	}
+	if options.Workers <= 0 {
+		options.Workers = defaults.Workers
+	}
+	if options.MaxRetries < 0 {
+		options.MaxRetries = 0
+	}
+	if options.BaseBackoff <= 0 {
+		options.BaseBackoff = defaults.BaseBackoff
+	}
+	if options.MaxBackoff < options.BaseBackoff {
+		options.MaxBackoff = options.BaseBackoff
+	}
+	if options.ReplayInterval <= 0 {
+		options.ReplayInterval = defaults.ReplayInterval
+	}
+	if options.RetryAfter <= 0 {
+		options.RetryAfter = defaults.RetryAfter
+	}
+	if options.WALPath == "" {
+		options.WALPath = defaults.WALPath
+	}
+	if options.ReplayBatch <= 0 {
+		options.ReplayBatch = defaults.ReplayBatch
+	}
+	if options.WriteBatch <= 0 {
+		options.WriteBatch = defaults.WriteBatch
+	}
+
+	wal, err := NewWriteAheadLog(options.WALPath)
+	if err != nil {
+		return nil, err
+	}
+
+	q := &IngestionQueue{
+		Writer:     writer,
+		WAL:        wal,
+		Options:    options,
+		Logger:     logger,
+		items:      make(chan []models.Interaction, options.MaxPending),
+		stopReplay: make(chan struct{}),
+		replayDone: make(chan struct{}),
+	}
+
+	q.replay()
+	for i := 0; i < options.Workers; i++ {
+		q.workers.Add(1)
+		go q.work()
+	}
+	go q.replayLoop()
+
+	return q, nil
+}
+
+// Enqueue gives interactions new IDs, enriches them in place and queues them
+// for writing. The IDs make retried and replayed writes idempotent. Enqueue
+// never blocks: when the queue cannot hold all of them it returns
+// ErrQueueFull and queues none.
+func (q *IngestionQueue) Enqueue(interactions []models.Interaction) error {
+	if len(interactions) == 0 {
+		return nil
+	}
+
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	if q.closed {
+		return ErrQueueClosed
+	}
+
+	count := int64(len(interactions))
+	if q.pending.Add(count) > int64(q.Options.MaxPending) {
+		q.pending.Add(-count)
+		return ErrQueueFull
+	}
+	for i := range interactions {
+		interactions[i].ID = models.NewInteractionID()
+		// Only the enrichers may set the GeoIP and reputation fields, clients could forge them
+		interactions[i].Country = ""
+		interactions[i].City = ""
+		interactions[i].ASN = 0
+		interactions[i].ASOrg = ""
+		interactions[i].HostingProvider = false
+		interactions[i].Reputation = nil
+	}
+	for _, enricher := range q.Options.Enrichers {
+		for i := range interactions {
+			enricher.Enrich(&interactions[i])
+		}
+	}
+	// Every item holds at least one interaction, so the channel cannot be full
+	q.items <- interactions
+	return nil
+}
+
+// Pending returns the number of interactions waiting to be written
+func (q *IngestionQueue) Pending() int {
+	return int(q.pending.Load())
+}
+
+// Available reports whether the last write to the store succeeded
+func (q *IngestionQueue) Available() bool {
+	return !q.unavailable.Load()
+}
+
+// Close stops accepting interactions, waits for queued interactions to be
+// written or spilled and makes a final attempt to replay the WAL. While
+// closing, failed writes are spilled without retrying so shutdown is not held
+// up by an unavailable store.
+func (q *IngestionQueue) Close() {
+	q.mu.Lock()
+	if q.closed {
+		q.mu.Unlock()
+		return
+	}
+	q.closed = true
+	close(q.items)
+	q.mu.Unlock()
+
+	q.workers.Wait()
+	close(q.stopReplay)
+	<-q.replayDone
+}
+
+// Abandon stops writing to the store, for a shutdown that ran out of time.
+// Queued interactions go straight to the WAL, as do writes in progress that
+// fail once the store is closed; the next start replays them. Close still
+// waits for the spilling to finish.
+func (q *IngestionQueue) Abandon() {
+	q.abandoned.Store(true)
+}
+
+// isClosed reports whether Close has been called
+func (q *IngestionQueue) isClosed() bool {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	return q.closed
+}
+
+// work writes queued interactions until the queue is closed
+func (q *IngestionQueue) work() {
+	defer q.workers.Done()
+	for interactions := range q.items {
+		interactions = q.take(interactions)
+		q.write(interactions)
+		q.pending.Add(-int64(len(interactions)))
+	}
+}
+
+// take adds the interactions already waiting in the queue to first, up to
+// WriteBatch. A write blocks until the BatchWriter flushes, so a worker must
+// not write one queued item at a time.
+func (q *IngestionQueue) take(first []models.Interaction) []models.Interaction {
+	interactions := first
+	for len(interactions) < q.Options.WriteBatch {
+		select {
+		case more, ok := <-q.items:
+			if !ok {
+				return interactions
+			}
+			if len(interactions) == len(first) {
+				// Do not append into the caller's slice
+				interactions = append(make([]models.Interaction, 0, q.Options.WriteBatch), first...)
+			}
+			interactions = append(interactions, more...)
+		default:
+			return interactions
+		}
+	}
+	return interactions
+}
+
+// write writes interactions with retries, spilling them to the WAL on failure.
+// While the store is unavailable or the queue abandoned, interactions go
+// straight to the WAL.
+func (q *IngestionQueue) write(interactions []models.Interaction) {
+	if !q.unavailable.Load() && !q.abandoned.Load() {
+		maxRetries := q.Options.MaxRetries
+		if q.isClosed() {
+			maxRetries = 0
+		}
+
+		var err error
+		for attempt := 0; attempt <= maxRetries; attempt++ {
+			if attempt > 0 {
+				time.Sleep(q.backoff(attempt))
+			}
+			if err = q.Writer.Submit(interactions); err == nil {
+				return
+			}
+			q.Logger.Warn("Failed to write interactions", "count", len(interactions), "attempt", attempt+1, "error", err)
+		}
+		if q.unavailable.CompareAndSwap(false, true) {
+			q.Logger.Error("Store unavailable, spilling interactions to WAL", "wal_path", q.WAL.Path)
+		}
+	}
+
+	if err := q.WAL.Append(interactions); err != nil {
+		q.Logger.Error("Failed to spill interactions to WAL, dropping them", "count", len(interactions), "error", err)
+	}
+}
+
+// backoff returns the delay before the given retry attempt: exponential with
+// full jitter, capped at MaxBackoff
+func (q *IngestionQueue) backoff(attempt int) time.Duration {
+	delay := q.Options.BaseBackoff << (attempt - 1)
+	if delay <= 0 || delay > q.Options.MaxBackoff {
+		delay = q.Options.MaxBackoff
+	}
+	return time.Duration(rand.Int63n(int64(delay)) + 1)
+}
+
+// replayLoop periodically replays the WAL until the queue is closed
+func (q *IngestionQueue) replayLoop() {
+	defer close(q.replayDone)
+
+	ticker := time.NewTicker(q.Options.ReplayInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			q.replay()
+		case <-q.stopReplay:
+			q.replay()
+			return
+		}
+	}
+}
+
+// replay writes the WAL to the store and marks the store available on success
+func (q *IngestionQueue) replay() {
+	if q.abandoned.Load() {
+		return
+	}
+	if q.WAL.Size() == 0 {
+		// Nothing to replay, so let the next write probe the store
+		q.unavailable.Store(false)
+		return
+	}
+
+	count, err := q.WAL.Replay(q.Options.ReplayBatch, q.Writer.Submit)
+	if err != nil {
+		q.Logger.Error("Failed to replay WAL", "error", err)
+		return
+	}
+
+	if q.unavailable.CompareAndSwap(true, false) {
+		q.Logger.Info("Store available again")
+	}
+	q.Logger.Info("Replayed interactions from WAL", "count", count)
+}
@@ -0,0 +1,629 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"backend/models"
+	"backend/utils"
+)
+
+// memoryUser is the in-memory equivalent of a User node and its relationships
+type memoryUser struct {
+	maliciousScore    float64
+	interactions      []models.Interaction
+	lastInteractionAt time.Time // When the newest interaction was saved, by the server's clock
+	associates        []string
+	inferred          map[inferredAssociation]models.Association
+	scoreHistory      []models.ScoreSnapshot
+	propagatedRisk    float64
+	clusterID         string
+}
+
+// inferredAssociation keys the inferred associations of a memoryUser
+type inferredAssociation struct {
+	associateID string
+	kind        string
+}
+
+// associateConfidences returns the CombinedConfidence of the associations
+// with each associate of the user; explicit associations have confidence 1
+func (u *memoryUser) associateConfidences() map[string]float64 {
+	confidences := make(map[string]float64)
+	for _, associateID := range u.associates {
+		confidences[associateID] = 1
+	}
+	for key, association := range u.inferred {
+		confidences[key.associateID] = models.CombinedConfidence(confidences[key.associateID], association.Confidence)
+	}
+	return confidences
+}
+
+// setInferred stores an inferred association of the user
+func (u *memoryUser) setInferred(association models.Association) {
+	if u.inferred == nil {
+		u.inferred = make(map[inferredAssociation]models.Association)
+	}
+	u.inferred[inferredAssociation{association.AssociateID, association.Type}] = association
+}
+
+// MemoryStore is an in-memory GraphStore for running the backend without Neo4j
+type MemoryStore struct {
+	mu          sync.RWMutex
+	users       map[string]*memoryUser
+	honeytokens map[string]models.Honeytoken
+	ipUsers     map[string]map[string]struct{} // Users by normalized IP, like IP nodes
+	subnetUsers map[string]map[string]struct{} // Users by /24 or /64 subnet, like Subnet nodes
+	savedIDs    map[string]struct{}            // IDs of saved interactions, like the interaction_id constraint
+	Logger      *utils.Logger
+
+	FeatureWindows []models.FeatureWindow // Windows of the windowed features
+	Now            func() time.Time       // End of every feature window
+}
+
+// stale reports whether an interaction was saved for the user after its last
+// score. Client timestamps are not used, since late or backdated interactions
+// would never make a user stale.
+func (u *memoryUser) stale() bool {
+	if u.lastInteractionAt.IsZero() {
+		return false
+	}
+	if len(u.scoreHistory) == 0 {
+		return true
+	}
+	return u.lastInteractionAt.After(u.scoreHistory[len(u.scoreHistory)-1].Timestamp)
+}
+
+// NewMemoryStore creates a new, empty MemoryStore with models.DefaultFeatureWindows
+func NewMemoryStore(logger *utils.Logger) *MemoryStore {
+	return &MemoryStore{
+		users:          make(map[string]*memoryUser),
+		honeytokens:    make(map[string]models.Honeytoken),
+		ipUsers:        make(map[string]map[string]struct{}),
+		subnetUsers:    make(map[string]map[string]struct{}),
+		savedIDs:       make(map[string]struct{}),
+		Logger:         logger,
+		FeatureWindows: models.DefaultFeatureWindows,
+		Now:            time.Now,
+	}
+}
+
+// mergeUser returns the user with the given ID, creating it if needed.
+// The caller must hold the write lock.
+func (s *MemoryStore) mergeUser(userID string) *memoryUser {
+	user, ok := s.users[userID]
+	if !ok {
+		user = &memoryUser{maliciousScore: 0.0}
+		s.users[userID] = user
+	}
+	return user
+}
+
+// addInteraction records an interaction and indexes its IP and subnet. An
+// interaction whose ID was already saved is skipped. The caller must hold the
+// write lock.
+func (s *MemoryStore) addInteraction(interaction models.Interaction) {
+	if interaction.ID != "" {
+		if _, ok := s.savedIDs[interaction.ID]; ok {
+			return
+		}
+		s.savedIDs[interaction.ID] = struct{}{}
+	}
+	user := s.mergeUser(interaction.UserID)
+	user.interactions = append(user.interactions, interaction)
+	user.lastInteractionAt = time.Now()
+	if ip, err := utils.NormalizeIP(interaction.IPAddress); err == nil {
+		addToIndex(s.ipUsers, ip, interaction.UserID)
+	}
+	if subnet, err := utils.IPSubnet(interaction.IPAddress); err == nil {
+		addToIndex(s.subnetUsers, subnet, interaction.UserID)
+	}
+}
+
+// addToIndex adds a user to the set of users under key
+func addToIndex(index map[string]map[string]struct{}, key, userID string) {
+	if index[key] == nil {
+		index[key] = make(map[string]struct{})
+	}
+	index[key][userID] = struct{}{}
+}
+
+// SaveInteraction records an interaction for a user
+func (s *MemoryStore) SaveInteraction(ctx context.Context, interaction models.Interaction) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.addInteraction(interaction)
+
+	s.Logger.WithContext(ctx).Info("Interaction saved successfully", "user_id", interaction.UserID)
+	return nil
+}
+
+// SaveInteractions records a batch of interactions
+func (s *MemoryStore) SaveInteractions(ctx context.Context, interactions []models.Interaction) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, interaction := range interactions {
+		s.addInteraction(interaction)
+	}
+
+	s.Logger.WithContext(ctx).Info("Saved interaction batch", "count", len(interactions))
+	return nil
+}
+
+// AssociatedWith associates two user_ids in both directions
+func (s *MemoryStore) AssociatedWith(ctx context.Context, user1, user2 string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u1 := s.mergeUser(user1)
+	u2 := s.mergeUser(user2)
+	u1.associates = append(u1.associates, user2)
+	u2.associates = append(u2.associates, user1)
+
+	s.Logger.WithContext(ctx).Info("Users associated successfully", "user1", user1, "user2", user2)
+	return nil
+}
+
+// GetMaliciousScore returns the malicious_score of a user
+func (s *MemoryStore) GetMaliciousScore(ctx context.Context, userID string) (float64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	user, ok := s.users[userID]
+	if !ok {
+		err := fmt.Errorf("%w: %s", ErrUserNotFound, userID)
+		s.Logger.WithContext(ctx).Error("Failed to get malicious score", "user_id", userID, "error", err)
+		return 0.0, err
+	}
+
+	s.Logger.WithContext(ctx).Info("Retrieved malicious score", "user_id", userID, "score", user.maliciousScore)
+	return user.maliciousScore, nil
+}
+
+// UpdateMaliciousScore updates the malicious_score of a user.
+// Like the Neo4j query, updating an unknown user is a no-op.
+func (s *MemoryStore) UpdateMaliciousScore(ctx context.Context, userID string, newScore float64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if user, ok := s.users[userID]; ok {
+		user.maliciousScore = newScore
+	}
+
+	s.Logger.WithContext(ctx).Info("Updated malicious score", "user_id", userID, "score", newScore)
+	return nil
+}
+
+// RecordScore updates the malicious_score of a user and appends the snapshot to its history
+func (s *MemoryStore) RecordScore(ctx context.Context, snapshot models.ScoreSnapshot) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[snapshot.UserID]
+	if !ok {
+		return nil
+	}
+	user.maliciousScore = snapshot.Score
+	user.scoreHistory = append(user.scoreHistory, snapshot)
+
+	s.Logger.WithContext(ctx).Info("Recorded score", "user_id", snapshot.UserID, "score", snapshot.Score, "model_version", snapshot.ModelVersion)
+	return nil
+}
+
+// GetScoreHistory returns the score snapshots of a user, oldest first
+func (s *MemoryStore) GetScoreHistory(ctx context.Context, userID string) ([]models.ScoreSnapshot, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	user, ok := s.users[userID]
+	if !ok {
+		return []models.ScoreSnapshot{}, nil
+	}
+	return append([]models.ScoreSnapshot{}, user.scoreHistory...), nil
+}
+
+// CreateHoneytoken registers a new honeytoken
+func (s *MemoryStore) CreateHoneytoken(ctx context.Context, token models.Honeytoken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.honeytokens[token.TokenID]; exists {
+		return fmt.Errorf("%w: %s", ErrHoneytokenExists, token.TokenID)
+	}
+	s.honeytokens[token.TokenID] = token
+
+	s.Logger.WithContext(ctx).Info("Honeytoken created successfully", "token_id", token.TokenID)
+	return nil
+}
+
+// GetHoneytoken returns a registered honeytoken
+func (s *MemoryStore) GetHoneytoken(ctx context.Context, tokenID string) (models.Honeytoken, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	token, ok := s.honeytokens[tokenID]
+	if !ok {
+		return models.Honeytoken{}, ErrHoneytokenNotFound
+	}
+	return token, nil
+}
+
+// ListHoneytokens returns registered honeytokens ordered by creation time
+func (s *MemoryStore) ListHoneytokens(ctx context.Context, includeRetired bool) ([]models.Honeytoken, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	tokens := make([]models.Honeytoken, 0, len(s.honeytokens))
+	for _, token := range s.honeytokens {
+		if includeRetired || token.Active() {
+			tokens = append(tokens, token)
+		}
+	}
+	sort.Slice(tokens, func(i, j int) bool {
+		return tokens[i].CreatedAt.Before(tokens[j].CreatedAt)
+	})
+	return tokens, nil
+}
+
+// RetireHoneytoken marks a honeytoken as retired
+func (s *MemoryStore) RetireHoneytoken(ctx context.Context, tokenID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	token, ok := s.honeytokens[tokenID]
+	if !ok {
+		return ErrHoneytokenNotFound
+	}
+	if token.RetiredAt == nil {
+		now := time.Now()
+		token.RetiredAt = &now
+		s.honeytokens[tokenID] = token
+	}
+
+	s.Logger.WithContext(ctx).Info("Honeytoken retired successfully", "token_id", tokenID)
+	return nil
+}
+
+// ExtractFeatures computes the AI model features for a user
+func (s *MemoryStore) ExtractFeatures(ctx context.Context, userID string) (models.UserFeatures, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	user, ok := s.users[userID]
+	if !ok {
+		return models.UserFeatures{}, fmt.Errorf("%w: %s", ErrUserNotFound, userID)
+	}
+
+	var features models.UserFeatures
+	ips := make(map[string]struct{})
+	countries := make(map[string]struct{})
+	var hosting, listed int64
+	for _, interaction := range user.interactions {
+		features.TotalAccessCount++
+		if interaction.HoneytokenTriggered {
+			features.HoneytokenAccessCount++
+			features.WeightedHoneytokenScore += s.honeytokenWeight(interaction.HoneytokenID)
+		}
+		ips[interaction.IPAddress] = struct{}{}
+		if interaction.Country != "" {
+			countries[interaction.Country] = struct{}{}
+		}
+		if interaction.HostingProvider {
+			hosting++
+		}
+		if len(interaction.Reputation) > 0 {
+			listed++
+		}
+	}
+	features.SharedIPCount = int64(len(ips))
+	features.DistinctCountries = int64(len(countries))
+	if features.TotalAccessCount > 0 {
+		features.HostingTrafficRatio = float64(hosting) / float64(features.TotalAccessCount)
+		features.ReputationTrafficRatio = float64(listed) / float64(features.TotalAccessCount)
+	}
+	features.IPsSharedWithOthers, features.UsersSharingIPs, features.SubnetsSharedWithOthers = s.sharedIPFeatures(userID, user)
+	features.SetWindows(s.windowFeatures(user.interactions))
+	features.PropagatedRisk = user.propagatedRisk
+
+	// Users associated more than once count once, weighted by confidence
+	var weighted, total float64
+	for associateID, confidence := range user.associateConfidences() {
+		weighted += confidence * s.users[associateID].maliciousScore
+		total += confidence
+	}
+	features.AvgAssociatedMaliciousScore = weighted / math.Max(total, 1)
+
+	return features, nil
+}
+
+// sharedIPFeatures counts the user's IPs and subnets that other users also
+// used, and those other users. The caller must hold the read lock.
+func (s *MemoryStore) sharedIPFeatures(userID string, user *memoryUser) (sharedIPs, sharingUsers, sharedSubnets int64) {
+	ips := make(map[string]struct{})
+	subnets := make(map[string]struct{})
+	for _, interaction := range user.interactions {
+		if ip, err := utils.NormalizeIP(interaction.IPAddress); err == nil {
+			ips[ip] = struct{}{}
+		}
+		if subnet, err := utils.IPSubnet(interaction.IPAddress); err == nil {
+			subnets[subnet] = struct{}{}
+		}
+	}
+
+	others := make(map[string]struct{})
+	for ip := range ips {
+		if len(s.ipUsers[ip]) > 1 {
+			sharedIPs++
+			for otherID := range s.ipUsers[ip] {
+				if otherID != userID {
+					others[otherID] = struct{}{}
+				}
+			}
+		}
+	}
+	for subnet := range subnets {
+		if len(s.subnetUsers[subnet]) > 1 {
+			sharedSubnets++
+		}
+	}
+	return sharedIPs, int64(len(others)), sharedSubnets
+}
+
+// GetInteractions returns the interactions of a user since the given time, oldest first
+func (s *MemoryStore) GetInteractions(ctx context.Context, userID string, since time.Time) ([]models.Interaction, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	user, ok := s.users[userID]
+	if !ok {
+		return nil, nil
+	}
+	var interactions []models.Interaction
+	for _, interaction := range user.interactions {
+		if !interaction.Timestamp.Before(since) {
+			interactions = append(interactions, interaction)
+		}
+	}
+	sort.SliceStable(interactions, func(i, j int) bool { return interactions[i].Timestamp.Before(interactions[j].Timestamp) })
+	return interactions, nil
+}
+
+// ListInteractions returns the interactions of every user since the given
+// time, oldest first
+func (s *MemoryStore) ListInteractions(ctx context.Context, since time.Time) ([]models.Interaction, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var interactions []models.Interaction
+	for _, user := range s.users {
+		for _, interaction := range user.interactions {
+			if !interaction.Timestamp.Before(since) {
+				interactions = append(interactions, interaction)
+			}
+		}
+	}
+	sort.SliceStable(interactions, func(i, j int) bool { return interactions[i].Timestamp.Before(interactions[j].Timestamp) })
+	return interactions, nil
+}
+
+// ListSharedIPs returns the interactions since the given time by normalized
+// IP, for IPs used by 2 to maxUsers users
+func (s *MemoryStore) ListSharedIPs(ctx context.Context, since time.Time, maxUsers int) (map[string][]models.Interaction, error) {
+	interactions, _ := s.ListInteractions(ctx, since)
+	return groupSharedIPs(interactions, maxUsers), nil
+}
+
+// ListSharedHoneytokens returns the sorted users of each honeytoken triggered
+// since the given time by 2 to maxUsers users
+func (s *MemoryStore) ListSharedHoneytokens(ctx context.Context, since time.Time, maxUsers int) (map[string][]string, error) {
+	interactions, _ := s.ListInteractions(ctx, since)
+	return groupSharedHoneytokens(interactions, maxUsers), nil
+}
+
+// ListEndpointSequences returns the latest maxLength endpoints since the
+// given time of each user with at least minLength of them
+func (s *MemoryStore) ListEndpointSequences(ctx context.Context, since time.Time, minLength, maxLength int) (map[string][]string, error) {
+	interactions, _ := s.ListInteractions(ctx, since)
+	return groupEndpointSequences(interactions, minLength, maxLength), nil
+}
+
+// ListUserIDs returns a page of user IDs in ascending order, optionally only
+// users with an interaction newer than their last score
+func (s *MemoryStore) ListUserIDs(ctx context.Context, after string, limit int, staleOnly bool) ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var userIDs []string
+	for userID, user := range s.users {
+		if userID <= after || (staleOnly && !user.stale()) {
+			continue
+		}
+		userIDs = append(userIDs, userID)
+	}
+	sort.Strings(userIDs)
+	if len(userIDs) > limit {
+		userIDs = userIDs[:limit]
+	}
+	return userIDs, nil
+}
+
+// ExportUserGraph returns every user and association, sorted by user ID
+func (s *MemoryStore) ExportUserGraph(ctx context.Context) (models.UserGraph, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var graph models.UserGraph
+	edges := make(map[[2]string]float64) // CombinedConfidence by ordered pair of users
+	for userID, user := range s.users {
+		node := models.GraphUser{UserID: userID, MaliciousScore: user.maliciousScore, ClusterID: user.clusterID}
+		ips := make(map[string]struct{})
+		for _, interaction := range user.interactions {
+			if interaction.HoneytokenTriggered {
+				node.HoneytokenHits++
+			}
+			if _, ok := ips[interaction.IPAddress]; !ok {
+				ips[interaction.IPAddress] = struct{}{}
+				node.IPAddresses = append(node.IPAddresses, interaction.IPAddress)
+			}
+		}
+		graph.Users = append(graph.Users, node)
+
+		for associateID, confidence := range user.associateConfidences() {
+			pair := [2]string{userID, associateID}
+			if pair[0] > pair[1] {
+				pair[0], pair[1] = pair[1], pair[0]
+			}
+			edges[pair] = confidence
+		}
+	}
+	for pair, confidence := range edges {
+		graph.Edges = append(graph.Edges, models.GraphEdge{From: pair[0], To: pair[1], Weight: confidence})
+	}
+	sort.Slice(graph.Users, func(i, j int) bool { return graph.Users[i].UserID < graph.Users[j].UserID })
+	sort.Slice(graph.Edges, func(i, j int) bool {
+		if graph.Edges[i].From != graph.Edges[j].From {
+			return graph.Edges[i].From < graph.Edges[j].From
+		}
+		return graph.Edges[i].To < graph.Edges[j].To
+	})
+	return graph, nil
+}
+
+// SavePropagatedRisk sets the propagated_risk of known users
+func (s *MemoryStore) SavePropagatedRisk(ctx context.Context, risks map[string]float64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for userID, risk := range risks {
+		if user, ok := s.users[userID]; ok {
+			user.propagatedRisk = risk
+		}
+	}
+	return nil
+}
+
+// SaveClusters sets the cluster_id of known users
+func (s *MemoryStore) SaveClusters(ctx context.Context, clusters map[string]string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for userID, clusterID := range clusters {
+		if user, ok := s.users[userID]; ok {
+			user.clusterID = clusterID
+		}
+	}
+	return nil
+}
+
+// SaveAssociations stores inferred associations in both directions, replacing
+// earlier ones of the same users and type
+func (s *MemoryStore) SaveAssociations(ctx context.Context, associations []models.Association) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, association := range associations {
+		s.mergeUser(association.UserID).setInferred(association)
+		reverse := association
+		reverse.UserID, reverse.AssociateID = association.AssociateID, association.UserID
+		s.mergeUser(reverse.UserID).setInferred(reverse)
+	}
+	return nil
+}
+
+// PruneAssociations deletes the inferred associations not saved by the
+// inference run at inferredAt
+func (s *MemoryStore) PruneAssociations(ctx context.Context, inferredAt time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	pruned := 0
+	for _, user := range s.users {
+		for key, association := range user.inferred {
+			if association.InferredAt == nil || !association.InferredAt.Equal(inferredAt) {
+				delete(user.inferred, key)
+				pruned++
+			}
+		}
+	}
+	return pruned, nil
+}
+
+// GetAssociations returns the associations of a user ordered by associate
+// and type; explicit associations made more than once have a weight above 1
+func (s *MemoryStore) GetAssociations(ctx context.Context, userID string) ([]models.Association, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	associations := []models.Association{}
+	user, ok := s.users[userID]
+	if !ok {
+		return associations, nil
+	}
+	explicit := make(map[string]int)
+	for _, associateID := range user.associates {
+		explicit[associateID]++
+	}
+	for associateID, count := range explicit {
+		associations = append(associations, models.Association{
+			UserID:      userID,
+			AssociateID: associateID,
+			Type:        models.AssociationExplicit,
+			Confidence:  1,
+			Weight:      count,
+			Evidence:    []string{},
+		})
+	}
+	for _, association := range user.inferred {
+		associations = append(associations, association)
+	}
+	sort.Slice(associations, func(i, j int) bool {
+		if associations[i].AssociateID != associations[j].AssociateID {
+			return associations[i].AssociateID < associations[j].AssociateID
+		}
+		return associations[i].Type < associations[j].Type
+	})
+	return associations, nil
+}
+
+// windowFeatures counts interactions within each feature window
+func (s *MemoryStore) windowFeatures(interactions []models.Interaction) []models.WindowFeatures {
+	now := s.Now()
+	windows := models.SortFeatureWindows(s.FeatureWindows)
+	result := make([]models.WindowFeatures, len(windows))
+	for i, window := range windows {
+		counts := models.NewWindowFeatures(window)
+		since := now.Add(-time.Duration(window))
+		ips := make(map[string]struct{})
+		for _, interaction := range interactions {
+			if interaction.Timestamp.Before(since) {
+				continue
+			}
+			counts.Interactions++
+			if interaction.HoneytokenTriggered {
+				counts.HoneytokenHits++
+			}
+			if interaction.ResponseStatusCode >= 400 {
+				counts.ErrorResponses++
+			}
+			ips[interaction.IPAddress] = struct{}{}
+		}
+		counts.DistinctIPs = int64(len(ips))
+		result[i] = counts
+	}
+	return result
+}
+
+// honeytokenWeight returns the weight of a trigger of the given honeytoken.
+// The caller must hold the read lock.
+func (s *MemoryStore) honeytokenWeight(tokenID string) float64 {
+	if token, ok := s.honeytokens[tokenID]; ok {
+		return token.Severity.Weight()
+	}
+	return models.DefaultHoneytokenWeight
+}
@@ -0,0 +1,222 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+
+	"backend/models"
+)
+
+// MLPModelName is reported as the model_name of in-process MLP predictions
+const MLPModelName = "mlp_regressor"
+
+// MLPModelFormatVersion is the artifact format understood by LoadMLPModel
+const MLPModelFormatVersion = 1
+
+// MinMaxScaler holds the fitted parameters of scikit-learn's MinMaxScaler:
+// scaled = value*Scale + Min
+type MinMaxScaler struct {
+	Scale []float64 `json:"scale"`
+	Min   []float64 `json:"min"`
+}
+
+// MLPLayer holds the weights (inputs x outputs, as in coefs_) and biases of a layer
+type MLPLayer struct {
+	Weights [][]float64 `json:"weights"`
+	Biases  []float64   `json:"biases"`
+}
+
+// MLPReference is an input and the prediction scikit-learn made for it
+type MLPReference struct {
+	Features   []float64 `json:"features"`
+	Prediction float64   `json:"prediction"`
+}
+
+// MLPModel is an MLPRegressor exported by ai/models/export_model.py
+type MLPModel struct {
+	FormatVersion    int            `json:"format_version"`
+	ModelVersion     string         `json:"model_version"`
+	FeatureNames     []string       `json:"feature_names"`
+	Activation       string         `json:"activation"`        // Hidden layers: identity, logistic, tanh or relu
+	OutputActivation string         `json:"output_activation"` // identity for regressors
+	InputScaler      MinMaxScaler   `json:"input_scaler"`
+	TargetScaler     MinMaxScaler   `json:"target_scaler"`
+	Layers           []MLPLayer     `json:"layers"`
+	Clip             [2]float64     `json:"clip"`      // Bounds of the returned score
+	Reference        []MLPReference `json:"reference"` // Predictions used for parity tests
+}
+
+// LoadMLPModel reads and validates a model artifact
+func LoadMLPModel(path string) (*MLPModel, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read model artifact: %v", err)
+	}
+
+	var model MLPModel
+	if err := json.Unmarshal(data, &model); err != nil {
+		return nil, fmt.Errorf("failed to parse model artifact %s: %v", path, err)
+	}
+	if err := model.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid model artifact %s: %v", path, err)
+	}
+	return &model, nil
+}
+
+// Validate checks that the layer shapes chain together, that feature names are
+// unique and that every activation is known. Whether the features are enabled
+// is checked against the feature registry with FeatureRegistry.Require.
+func (m *MLPModel) Validate() error {
+	if m.FormatVersion != MLPModelFormatVersion {
+		return fmt.Errorf("unsupported format_version %d", m.FormatVersion)
+	}
+	if len(m.FeatureNames) == 0 {
+		return fmt.Errorf("feature_names is required")
+	}
+	seen := make(map[string]bool, len(m.FeatureNames))
+	for _, name := range m.FeatureNames {
+		if name == "" || seen[name] {
+			return fmt.Errorf("feature %q is empty or listed twice", name)
+		}
+		seen[name] = true
+	}
+	for _, activation := range []string{m.Activation, m.OutputActivation} {
+		if _, err := activate(activation, 0); err != nil {
+			return err
+		}
+	}
+
+	inputs := len(m.FeatureNames)
+	if len(m.InputScaler.Scale) != inputs || len(m.InputScaler.Min) != inputs {
+		return fmt.Errorf("input_scaler has %d/%d parameters for %d features", len(m.InputScaler.Scale), len(m.InputScaler.Min), inputs)
+	}
+	if len(m.TargetScaler.Scale) != 1 || len(m.TargetScaler.Min) != 1 || m.TargetScaler.Scale[0] == 0 {
+		return fmt.Errorf("target_scaler must have one non-zero scale and one min")
+	}
+	if len(m.Layers) == 0 {
+		return fmt.Errorf("layers is required")
+	}
+
+	for i, layer := range m.Layers {
+		if len(layer.Weights) != inputs {
+			return fmt.Errorf("layer %d has %d weight rows, expected %d", i, len(layer.Weights), inputs)
+		}
+		outputs := len(layer.Biases)
+		for _, row := range layer.Weights {
+			if len(row) != outputs {
+				return fmt.Errorf("layer %d has a weight row of %d columns, expected %d", i, len(row), outputs)
+			}
+		}
+		inputs = outputs
+	}
+	if inputs != 1 {
+		return fmt.Errorf("output layer has %d units, expected 1", inputs)
+	}
+	// A missing clip decodes as [0, 0], which would score every user 0
+	if m.Clip[0] >= m.Clip[1] {
+		return fmt.Errorf("clip lower bound %f must be below upper bound %f", m.Clip[0], m.Clip[1])
+	}
+	return nil
+}
+
+// Predict runs the forward pass on unscaled features ordered as FeatureNames,
+// matching MaliciousnessPredictor.predict_maliciousness
+func (m *MLPModel) Predict(features []float64) (float64, error) {
+	if len(features) != len(m.FeatureNames) {
+		return 0, fmt.Errorf("expected %d features, got %d", len(m.FeatureNames), len(features))
+	}
+
+	values := make([]float64, len(features))
+	for i, value := range features {
+		values[i] = value*m.InputScaler.Scale[i] + m.InputScaler.Min[i]
+	}
+
+	for i, layer := range m.Layers {
+		activation := m.Activation
+		if i == len(m.Layers)-1 {
+			activation = m.OutputActivation
+		}
+
+		next := make([]float64, len(layer.Biases))
+		copy(next, layer.Biases)
+		for in, value := range values {
+			for out, weight := range layer.Weights[in] {
+				next[out] += value * weight
+			}
+		}
+		for out := range next {
+			next[out], _ = activate(activation, next[out])
+		}
+		values = next
+	}
+
+	score := (values[0] - m.TargetScaler.Min[0]) / m.TargetScaler.Scale[0]
+	return math.Max(m.Clip[0], math.Min(m.Clip[1], score)), nil
+}
+
+// activate applies one of scikit-learn's MLP activation functions
+func activate(activation string, x float64) (float64, error) {
+	switch activation {
+	case "identity":
+		return x, nil
+	case "relu":
+		return math.Max(0, x), nil
+	case "tanh":
+		return math.Tanh(x), nil
+	case "logistic":
+		return 1 / (1 + math.Exp(-x)), nil
+	}
+	return 0, fmt.Errorf("unsupported activation %q", activation)
+}
+
+// MLPScorer scores users in process with an exported MLPRegressor, so
+// analysis does not depend on the model server
+type MLPScorer struct {
+	Model *MLPModel
+}
+
+// NewMLPScorer loads the model artifact at path
+func NewMLPScorer(path string) (*MLPScorer, error) {
+	model, err := LoadMLPModel(path)
+	if err != nil {
+		return nil, err
+	}
+	return &MLPScorer{Model: model}, nil
+}
+
+// Name identifies the in-process MLP scorer
+func (s *MLPScorer) Name() string {
+	return "mlp"
+}
+
+// Score runs the model on the features named by the artifact
+func (s *MLPScorer) Score(ctx context.Context, vector models.FeatureVector) (ScoreResult, error) {
+	featureMap := vector.Features()
+	values := make([]float64, len(s.Model.FeatureNames))
+	for i, name := range s.Model.FeatureNames {
+		switch value := featureMap[name].(type) {
+		case int64:
+			values[i] = float64(value)
+		case float64:
+			values[i] = value
+		case nil:
+			return ScoreResult{}, fmt.Errorf("feature %s is not extracted; check features.windows and features.enabled", name)
+		default:
+			return ScoreResult{}, fmt.Errorf("feature %s has unsupported type %T", name, value)
+		}
+	}
+
+	score, err := s.Model.Predict(values)
+	if err != nil {
+		return ScoreResult{}, err
+	}
+	prediction := models.NewPrediction(score, MLPModelName, s.Model.ModelVersion)
+	prediction.ScoreMin, prediction.ScoreMax = &s.Model.Clip[0], &s.Model.Clip[1]
+	if err := prediction.Validate(); err != nil {
+		return ScoreResult{}, fmt.Errorf("invalid prediction: %v", err)
+	}
+	return ScoreResult{Prediction: prediction, Scorer: s.Name()}, nil
+}
@@ -4,31 +4,92 @@ import (
 	"backend/models"
 	"backend/utils"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"sort"
+	"time"
 
 	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
 )
 
+// QueryObserver is notified after each query run through RunQuery
+type QueryObserver func(ctx context.Context, duration time.Duration, err error)
+
 // Neo4jService handles Neo4j interactions
 type Neo4jService struct {
-	Driver neo4j.DriverWithContext
-	Logger *utils.Logger
+	Driver        neo4j.DriverWithContext
+	Logger        *utils.Logger
+	QueryObserver QueryObserver // Optional, e.g. for metrics
+	// FeatureWindows are the windows of the windowed features, models.DefaultFeatureWindows if empty
+	FeatureWindows []models.FeatureWindow
 }
 
-// NewNeo4jService creates a new Neo4jService
-func NewNeo4jService(uri, username, password string, logger *utils.Logger) *Neo4jService {
+// NewNeo4jService creates a new Neo4jService. The driver connects lazily, so
+// an unreachable server surfaces on the first query rather than here.
+func NewNeo4jService(uri, username, password string, logger *utils.Logger) (*Neo4jService, error) {
 	driver, err := neo4j.NewDriverWithContext(uri, neo4j.BasicAuth(username, password, ""))
 	if err != nil {
-		logger.Error("Failed to create Neo4j driver: " + err.Error())
-		log.Fatalf("Failed to create Neo4j driver: %v", err)
+		logger.Error("Failed to create Neo4j driver", "error", err)
+		return nil, fmt.Errorf("failed to create Neo4j driver: %v", err)
 	}
-	logger.Info("Successfully connected to Neo4j")
-	return &Neo4jService{Driver: driver, Logger: logger}
+	logger.Info("Neo4j driver created", "uri", uri)
+	return &Neo4jService{Driver: driver, Logger: logger}, nil
+}
+
+// interactionParams returns the query parameters of an interaction: its
+// properties, plus the normalized address of its IP node and the /24 or /64
+// Subnet node of that IP. Both are empty for addresses that are not IPs.
+// Interactions that were not given an ID on ingestion get a new one.
+func interactionParams(interaction models.Interaction) map[string]interface{} {
+	if interaction.ID == "" {
+		interaction.ID = models.NewInteractionID()
+	}
+	params := interaction.ToMap()
+	params["ip"], _ = utils.NormalizeIP(interaction.IPAddress)
+	params["ip_subnet"], _ = utils.IPSubnet(interaction.IPAddress)
+	return params
+}
+
+// ingestedAt returns the User.last_interaction_at of interactions saved now.
+// It is taken from the backend's clock, like ScoreSnapshot timestamps, so the
+// two compare without client clock skew.
+func ingestedAt() string {
+	return time.Now().Format(time.RFC3339Nano)
+}
+
+// EnsureSchema creates the uniqueness constraints that MERGE relies on to
+// write each interaction once and to share IP and Subnet nodes between
+// interactions, and the index analysts use to pivot from an ASN to its IPs.
+// Schema changes cannot run in the read transactions of RunQuery, so each
+// runs in an auto-commit transaction.
+func (s *Neo4jService) EnsureSchema(ctx context.Context) error {
+	session := s.Driver.NewSession(ctx, neo4j.SessionConfig{})
+	defer session.Close(ctx)
+
+	statements := []string{
+		"CREATE CONSTRAINT interaction_id IF NOT EXISTS FOR (i:Interaction) REQUIRE i.interaction_id IS UNIQUE",
+		"CREATE CONSTRAINT ip_address IF NOT EXISTS FOR (ip:IP) REQUIRE ip.address IS UNIQUE",
+		"CREATE CONSTRAINT subnet_cidr IF NOT EXISTS FOR (s:Subnet) REQUIRE s.cidr IS UNIQUE",
+		"CREATE CONSTRAINT honeytoken_id IF NOT EXISTS FOR (h:Honeytoken) REQUIRE h.token_id IS UNIQUE",
+		"CREATE INDEX ip_asn IF NOT EXISTS FOR (ip:IP) ON (ip.asn)",
+	}
+	for _, statement := range statements {
+		result, err := session.Run(ctx, statement, nil)
+		if err == nil {
+			_, err = result.Consume(ctx)
+		}
+		if err != nil {
+			s.Logger.WithContext(ctx).Error("Failed to update schema", "statement", statement, "error", err)
+			return err
+		}
+	}
+	return nil
 }
 
-func (s *Neo4jService) SaveInteraction(interaction models.Interaction) error {
-	ctx := context.Background()
+// SaveInteraction saves an interaction and links it to its user, IP and honeytoken
+func (s *Neo4jService) SaveInteraction(ctx context.Context, interaction models.Interaction) error {
+	logger := s.Logger.WithContext(ctx)
 	session := s.Driver.NewSession(ctx, neo4j.SessionConfig{})
 	defer session.Close(ctx)
 
@@ -37,33 +98,148 @@ func (s *Neo4jService) SaveInteraction(interaction models.Interaction) error {
 			MERGE (u:User {user_id: $user_id})
 			ON CREATE SET u.malicious_score = 0.0
 
-			CREATE (i:Interaction {
+			MERGE (i:Interaction {interaction_id: $interaction_id})
+			ON CREATE SET u.last_interaction_at = $ingested_at
+			SET i += {
 				endpoint: $endpoint,
 				timestamp: $timestamp,
 				response_status_code: $response_status_code,
 				honeytoken_triggered: $honeytoken_triggered,
-				ip_address: $ip_address
-			})
-			CREATE (u)-[:HAS_INTERACTION]->(i)
+				ip_address: $ip_address,
+				method: $method,
+				user_agent: $user_agent,
+				session_id: $session_id,
+				request_size: $request_size,
+				latency_ms: $latency_ms,
+				country: $country,
+				city: $city,
+				asn: $asn,
+				as_org: $as_org,
+				hosting_provider: $hosting_provider,
+				reputation: $reputation
+			}
+			MERGE (u)-[:HAS_INTERACTION]->(i)
+
+			WITH i
+			FOREACH (_ IN CASE WHEN $ip = '' THEN [] ELSE [1] END |
+				MERGE (ip:IP {address: $ip})
+				MERGE (i)-[:FROM_IP]->(ip)
+				SET ip.reputation = $reputation
+				FOREACH (_ IN CASE WHEN $country = '' AND $asn = 0 THEN [] ELSE [1] END |
+					SET ip.country = $country, ip.city = $city, ip.asn = $asn,
+						ip.as_org = $as_org, ip.hosting_provider = $hosting_provider
+				)
+				FOREACH (_ IN CASE WHEN $ip_subnet = '' THEN [] ELSE [1] END |
+					MERGE (s:Subnet {cidr: $ip_subnet})
+					MERGE (ip)-[:IN_SUBNET]->(s)
+				)
+			)
+
+			WITH i
+			OPTIONAL MATCH (h:Honeytoken {token_id: $honeytoken_id})
+			FOREACH (_ IN CASE WHEN h IS NULL THEN [] ELSE [1] END |
+				MERGE (i)-[:TRIGGERED]->(h)
+			)
+		`
+
+		logger.Debug("Executing SaveInteraction query")
+
+		params := interactionParams(interaction)
+		params["ingested_at"] = ingestedAt()
+		return tx.Run(ctx, query, params)
+	}, txMetadata(ctx))
+
+	if err != nil {
+		logger.Error("Failed to save interaction", "user_id", interaction.UserID, "error", err)
+		return err
+	}
+
+	logger.Info("Interaction saved successfully", "user_id", interaction.UserID)
+	return nil
+}
+
+// SaveInteractions saves a batch of interactions in one write transaction using UNWIND
+func (s *Neo4jService) SaveInteractions(ctx context.Context, interactions []models.Interaction) error {
+	logger := s.Logger.WithContext(ctx)
+	if len(interactions) == 0 {
+		return nil
+	}
+
+	session := s.Driver.NewSession(ctx, neo4j.SessionConfig{})
+	defer session.Close(ctx)
+
+	rows := make([]any, len(interactions))
+	for idx, interaction := range interactions {
+		rows[idx] = interactionParams(interaction)
+	}
+
+	_, err := session.ExecuteWrite(ctx, func(tx neo4j.ManagedTransaction) (any, error) {
+		query := `
+			UNWIND $interactions AS row
+			MERGE (u:User {user_id: row.user_id})
+			ON CREATE SET u.malicious_score = 0.0
+
+			MERGE (i:Interaction {interaction_id: row.interaction_id})
+			ON CREATE SET u.last_interaction_at = $ingested_at
+			SET i += {
+				endpoint: row.endpoint,
+				timestamp: row.timestamp,
+				response_status_code: row.response_status_code,
+				honeytoken_triggered: row.honeytoken_triggered,
+				ip_address: row.ip_address,
+				method: row.method,
+				user_agent: row.user_agent,
+				session_id: row.session_id,
+				request_size: row.request_size,
+				latency_ms: row.latency_ms,
+				country: row.country,
+				city: row.city,
+				asn: row.asn,
+				as_org: row.as_org,
+				hosting_provider: row.hosting_provider,
+				reputation: row.reputation
+			}
+			MERGE (u)-[:HAS_INTERACTION]->(i)
+
+			WITH i, row
+			FOREACH (_ IN CASE WHEN row.ip = '' THEN [] ELSE [1] END |
+				MERGE (ip:IP {address: row.ip})
+				MERGE (i)-[:FROM_IP]->(ip)
+				SET ip.reputation = row.reputation
+				FOREACH (_ IN CASE WHEN row.country = '' AND row.asn = 0 THEN [] ELSE [1] END |
+					SET ip.country = row.country, ip.city = row.city, ip.asn = row.asn,
+						ip.as_org = row.as_org, ip.hosting_provider = row.hosting_provider
+				)
+				FOREACH (_ IN CASE WHEN row.ip_subnet = '' THEN [] ELSE [1] END |
+					MERGE (s:Subnet {cidr: row.ip_subnet})
+					MERGE (ip)-[:IN_SUBNET]->(s)
+				)
+			)
+
+			WITH i, row
+			OPTIONAL MATCH (h:Honeytoken {token_id: row.honeytoken_id})
+			FOREACH (_ IN CASE WHEN h IS NULL THEN [] ELSE [1] END |
+				MERGE (i)-[:TRIGGERED]->(h)
+			)
 		`
 
-		s.Logger.Debug("Executing SaveInteraction query", true)
+		logger.Debug("Executing SaveInteractions query", "count", len(rows))
 
-		return tx.Run(ctx, query, interaction.ToMap())
-	})
+		return tx.Run(ctx, query, map[string]interface{}{"interactions": rows, "ingested_at": ingestedAt()})
+	}, txMetadata(ctx))
 
 	if err != nil {
-		s.Logger.Error("Failed to save interaction: " + err.Error())
+		logger.Error("Failed to save interaction batch", "count", len(interactions), "error", err)
 		return err
 	}
 
-	s.Logger.Info("Interaction saved successfully for user_id: " + interaction.UserID)
+	logger.Info("Saved interaction batch", "count", len(interactions))
 	return nil
 }
 
 // Associated with associates two user_ids in the Neo4j database
-func (s *Neo4jService) AssociatedWith(user1, user2 string) error {
-	ctx := context.Background()
+func (s *Neo4jService) AssociatedWith(ctx context.Context, user1, user2 string) error {
+	logger := s.Logger.WithContext(ctx)
 	session := s.Driver.NewSession(ctx, neo4j.SessionConfig{})
 	defer session.Close(ctx)
 
@@ -77,23 +253,23 @@ func (s *Neo4jService) AssociatedWith(user1, user2 string) error {
 			CREATE (u2)-[:ASSOCIATED_WITH]->(u1)
 		`
 
-		s.Logger.Debug("Executing AssociatedWith query", true)
+		logger.Debug("Executing AssociatedWith query")
 
 		return tx.Run(ctx, query, map[string]interface{}{"user1": user1, "user2": user2})
-	})
+	}, txMetadata(ctx))
 
 	if err != nil {
-		s.Logger.Error("Failed to associate users: " + err.Error())
+		logger.Error("Failed to associate users", "user1", user1, "user2", user2, "error", err)
 		return err
 	}
 
-	s.Logger.Info("Users associated successfully: " + user1 + ", " + user2)
+	logger.Info("Users associated successfully", "user1", user1, "user2", user2)
 	return nil
 }
 
 // GetMaliciousScore returns the malicious_score of a user
-func (s *Neo4jService) GetMaliciousScore(userID string) (float64, error) {
-	ctx := context.Background()
+func (s *Neo4jService) GetMaliciousScore(ctx context.Context, userID string) (float64, error) {
+	logger := s.Logger.WithContext(ctx)
 	session := s.Driver.NewSession(ctx, neo4j.SessionConfig{})
 	defer session.Close(ctx)
 
@@ -103,7 +279,7 @@ func (s *Neo4jService) GetMaliciousScore(userID string) (float64, error) {
 			RETURN u.malicious_score AS malicious_score
 		`
 
-		s.Logger.Debug("Executing GetMaliciousScore query", true)
+		logger.Debug("Executing GetMaliciousScore query")
 		res, err := tx.Run(ctx, query, map[string]interface{}{"user_id": userID})
 		if err != nil {
 			return nil, err
@@ -115,11 +291,11 @@ func (s *Neo4jService) GetMaliciousScore(userID string) (float64, error) {
 			return maliciousScore, nil
 		}
 
-		return nil, fmt.Errorf("user not found")
-	})
+		return nil, fmt.Errorf("%w: %s", ErrUserNotFound, userID)
+	}, txMetadata(ctx))
 
 	if err != nil {
-		s.Logger.Error("Failed to get malicious score for user_id: " + userID + " - " + err.Error())
+		logger.Error("Failed to get malicious score", "user_id", userID, "error", err)
 		return 0.0, err
 	}
 
@@ -128,13 +304,13 @@ func (s *Neo4jService) GetMaliciousScore(userID string) (float64, error) {
 		return 0.0, fmt.Errorf("malicious score retrieval failed: expected float64, got %T", result)
 	}
 
-	s.Logger.Info(fmt.Sprintf("Retrieved malicious score for user_id %s: %f", userID, score))
+	logger.Info("Retrieved malicious score", "user_id", userID, "score", score)
 	return score, nil
 }
 
 // UpdateMaliciousScore updates the malicious_score of a user
-func (s *Neo4jService) UpdateMaliciousScore(userID string, newScore float64) error {
-	ctx := context.Background()
+func (s *Neo4jService) UpdateMaliciousScore(ctx context.Context, userID string, newScore float64) error {
+	logger := s.Logger.WithContext(ctx)
 	session := s.Driver.NewSession(ctx, neo4j.SessionConfig{})
 	defer session.Close(ctx)
 
@@ -144,29 +320,239 @@ func (s *Neo4jService) UpdateMaliciousScore(userID string, newScore float64) err
 			SET u.malicious_score = $new_score
 		`
 
-		s.Logger.Debug("Executing UpdateMaliciousScore query", true)
+		logger.Debug("Executing UpdateMaliciousScore query")
 		return tx.Run(ctx, query, map[string]interface{}{
 			"user_id":   userID,
 			"new_score": newScore,
 		})
-	})
+	}, txMetadata(ctx))
 
 	if err != nil {
-		s.Logger.Error("Failed to update malicious score for user_id: " + userID + " - " + err.Error())
+		logger.Error("Failed to update malicious score", "user_id", userID, "error", err)
 		return err
 	}
 
-	s.Logger.Info(fmt.Sprintf("Updated malicious score for user_id %s to %f", userID, newScore))
+	logger.Info("Updated malicious score", "user_id", userID, "score", newScore)
 	return nil
 }
 
+// RecordScore updates the malicious_score of a user and links a ScoreSnapshot node to it
+func (s *Neo4jService) RecordScore(ctx context.Context, snapshot models.ScoreSnapshot) error {
+	logger := s.Logger.WithContext(ctx)
+	session := s.Driver.NewSession(ctx, neo4j.SessionConfig{})
+	defer session.Close(ctx)
+
+	_, err := session.ExecuteWrite(ctx, func(tx neo4j.ManagedTransaction) (any, error) {
+		query := `
+			MATCH (u:User {user_id: $user_id})
+			SET u.malicious_score = $score
+			CREATE (s:ScoreSnapshot {
+				timestamp: $timestamp,
+				score: $score,
+				model_version: $model_version,
+				features: $features
+			})
+			CREATE (u)-[:HAS_SCORE]->(s)
+		`
+
+		logger.Debug("Executing RecordScore query")
+		return tx.Run(ctx, query, snapshot.ToMap())
+	}, txMetadata(ctx))
+
+	if err != nil {
+		logger.Error("Failed to record score", "user_id", snapshot.UserID, "error", err)
+		return err
+	}
+
+	logger.Info("Recorded score", "user_id", snapshot.UserID, "score", snapshot.Score, "model_version", snapshot.ModelVersion)
+	return nil
+}
+
+// GetScoreHistory returns the ScoreSnapshot nodes of a user, oldest first
+func (s *Neo4jService) GetScoreHistory(ctx context.Context, userID string) ([]models.ScoreSnapshot, error) {
+	query := `
+		MATCH (u:User {user_id: $user_id})-[:HAS_SCORE]->(s:ScoreSnapshot)
+		RETURN s.timestamp AS timestamp, s.score AS score, s.model_version AS model_version, s.features AS features
+		ORDER BY datetime(s.timestamp)
+	`
+	records, err := s.RunQuery(ctx, query, map[string]interface{}{"user_id": userID})
+	if err != nil {
+		return nil, err
+	}
+
+	history := make([]models.ScoreSnapshot, 0, len(records))
+	for _, record := range records {
+		timestamp, _ := record.Get("timestamp")
+		score, _ := record.Get("score")
+		modelVersion, _ := record.Get("model_version")
+		features, _ := record.Get("features")
+
+		snapshot := models.ScoreSnapshot{UserID: userID}
+		if ts, ok := timestamp.(string); ok {
+			snapshot.Timestamp, _ = time.Parse(time.RFC3339Nano, ts)
+		}
+		snapshot.Score, _ = score.(float64)
+		snapshot.ModelVersion, _ = modelVersion.(string)
+		if raw, ok := features.(string); ok {
+			if err := json.Unmarshal([]byte(raw), &snapshot.Features); err != nil {
+				return nil, fmt.Errorf("failed to decode snapshot features: %v", err)
+			}
+		}
+		history = append(history, snapshot)
+	}
+
+	return history, nil
+}
+
+// CreateHoneytoken creates a Honeytoken node
+func (s *Neo4jService) CreateHoneytoken(ctx context.Context, token models.Honeytoken) error {
+	logger := s.Logger.WithContext(ctx)
+	session := s.Driver.NewSession(ctx, neo4j.SessionConfig{})
+	defer session.Close(ctx)
+
+	_, err := session.ExecuteWrite(ctx, func(tx neo4j.ManagedTransaction) (any, error) {
+		query := `
+			CREATE (h:Honeytoken {
+				token_id: $token_id,
+				type: $type,
+				severity: $severity,
+				weight: $weight,
+				placement: $placement,
+				description: $description,
+				created_at: $created_at
+			})
+		`
+
+		logger.Debug("Executing CreateHoneytoken query")
+		return tx.Run(ctx, query, token.ToMap())
+	}, txMetadata(ctx))
+
+	// The honeytoken_id constraint rejects a second node with the same token_id
+	var neo4jErr *neo4j.Neo4jError
+	if errors.As(err, &neo4jErr) && neo4jErr.Code == "Neo.ClientError.Schema.ConstraintValidationFailed" {
+		err = fmt.Errorf("%w: %s", ErrHoneytokenExists, token.TokenID)
+	}
+	if err != nil {
+		logger.Error("Failed to create honeytoken", "token_id", token.TokenID, "error", err)
+		return err
+	}
+
+	logger.Info("Honeytoken created successfully", "token_id", token.TokenID)
+	return nil
+}
+
+// GetHoneytoken returns the Honeytoken node with the given token_id
+func (s *Neo4jService) GetHoneytoken(ctx context.Context, tokenID string) (models.Honeytoken, error) {
+	query := `
+		MATCH (h:Honeytoken {token_id: $token_id})
+		RETURN h
+	`
+	records, err := s.RunQuery(ctx, query, map[string]interface{}{"token_id": tokenID})
+	if err != nil {
+		return models.Honeytoken{}, err
+	}
+	if len(records) == 0 {
+		return models.Honeytoken{}, ErrHoneytokenNotFound
+	}
+	return honeytokenFromRecord(records[0])
+}
+
+// ListHoneytokens returns all Honeytoken nodes, optionally including retired ones
+func (s *Neo4jService) ListHoneytokens(ctx context.Context, includeRetired bool) ([]models.Honeytoken, error) {
+	query := `
+		MATCH (h:Honeytoken)
+		WHERE $include_retired OR h.retired_at IS NULL
+		RETURN h
+		ORDER BY h.created_at
+	`
+	records, err := s.RunQuery(ctx, query, map[string]interface{}{"include_retired": includeRetired})
+	if err != nil {
+		return nil, err
+	}
+
+	tokens := make([]models.Honeytoken, 0, len(records))
+	for _, record := range records {
+		token, err := honeytokenFromRecord(record)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, token)
+	}
+	return tokens, nil
+}
+
+// RetireHoneytoken sets retired_at on a Honeytoken node
+func (s *Neo4jService) RetireHoneytoken(ctx context.Context, tokenID string) error {
+	logger := s.Logger.WithContext(ctx)
+	session := s.Driver.NewSession(ctx, neo4j.SessionConfig{})
+	defer session.Close(ctx)
+
+	result, err := session.ExecuteWrite(ctx, func(tx neo4j.ManagedTransaction) (any, error) {
+		query := `
+			MATCH (h:Honeytoken {token_id: $token_id})
+			SET h.retired_at = coalesce(h.retired_at, $retired_at)
+			RETURN h.token_id AS token_id
+		`
+
+		logger.Debug("Executing RetireHoneytoken query")
+		res, err := tx.Run(ctx, query, map[string]interface{}{
+			"token_id":   tokenID,
+			"retired_at": time.Now().Format(time.RFC3339),
+		})
+		if err != nil {
+			return nil, err
+		}
+		return res.Next(ctx), res.Err()
+	}, txMetadata(ctx))
+
+	if err != nil {
+		logger.Error("Failed to retire honeytoken", "token_id", tokenID, "error", err)
+		return err
+	}
+	if found, _ := result.(bool); !found {
+		return ErrHoneytokenNotFound
+	}
+
+	logger.Info("Honeytoken retired successfully", "token_id", tokenID)
+	return nil
+}
+
+// honeytokenFromRecord decodes a record with a Honeytoken node in column "h"
+func honeytokenFromRecord(record neo4j.Record) (models.Honeytoken, error) {
+	raw, _ := record.Get("h")
+	node, ok := raw.(neo4j.Node)
+	if !ok {
+		return models.Honeytoken{}, fmt.Errorf("expected neo4j.Node but got %T", raw)
+	}
+
+	props := node.Props
+	token := models.Honeytoken{}
+	token.TokenID, _ = props["token_id"].(string)
+	tokenType, _ := props["type"].(string)
+	token.Type = models.HoneytokenType(tokenType)
+	severity, _ := props["severity"].(string)
+	token.Severity = models.HoneytokenSeverity(severity)
+	token.Placement, _ = props["placement"].(string)
+	token.Description, _ = props["description"].(string)
+	if createdAt, ok := props["created_at"].(string); ok {
+		token.CreatedAt, _ = time.Parse(time.RFC3339, createdAt)
+	}
+	if retiredAt, ok := props["retired_at"].(string); ok {
+		if t, err := time.Parse(time.RFC3339, retiredAt); err == nil {
+			token.RetiredAt = &t
+		}
+	}
+	return token, nil
+}
+
 // RunQuery executes a Cypher query on the Neo4j database
-func (s *Neo4jService) RunQuery(query string, params map[string]interface{}) ([]neo4j.Record, error) {
-	ctx := context.Background()
+func (s *Neo4jService) RunQuery(ctx context.Context, query string, params map[string]interface{}) ([]neo4j.Record, error) {
+	logger := s.Logger.WithContext(ctx)
 	session := s.Driver.NewSession(ctx, neo4j.SessionConfig{})
 	defer session.Close(ctx)
 
-	s.Logger.Debug("Running query: "+query, true)
+	logger.Debug("Running query", "query", query)
+	start := time.Now()
 	result, err := session.ExecuteRead(ctx, func(tx neo4j.ManagedTransaction) (any, error) {
 		res, err := tx.Run(ctx, query, params)
 		if err != nil {
@@ -186,10 +572,13 @@ func (s *Neo4jService) RunQuery(query string, params map[string]interface{}) ([]
 		}
 
 		return records, nil
-	})
+	}, txMetadata(ctx))
+	if s.QueryObserver != nil {
+		s.QueryObserver(ctx, time.Since(start), err)
+	}
 
 	if err != nil {
-		s.Logger.Error("Failed to execute query: " + err.Error())
+		logger.Error("Failed to execute query", "error", err)
 		return nil, err
 	}
 
@@ -198,16 +587,493 @@ func (s *Neo4jService) RunQuery(query string, params map[string]interface{}) ([]
 		return nil, fmt.Errorf("expected []neo4j.Record but got %T", result)
 	}
 
-	s.Logger.Info("Query executed successfully")
+	logger.Debug("Query executed successfully", "records", len(records))
 	return records, nil
 }
 
-// Close closes the Neo4j driver
-func (s *Neo4jService) CloseDriver() {
-	ctx := context.Background()
+// VerifyConnectivity checks that the Neo4j server is reachable and the credentials are valid
+func (s *Neo4jService) VerifyConnectivity(ctx context.Context) error {
+	return s.Driver.VerifyConnectivity(ctx)
+}
+
+// CloseDriver closes the Neo4j driver and its connection pool
+func (s *Neo4jService) CloseDriver(ctx context.Context) error {
 	if err := s.Driver.Close(ctx); err != nil {
-		s.Logger.Error("Failed to close Neo4j driver: " + err.Error())
-		log.Fatalf("Failed to close Neo4j driver: %v", err)
+		s.Logger.Error("Failed to close Neo4j driver", "error", err)
+		return fmt.Errorf("failed to close Neo4j driver: %v", err)
 	}
 	s.Logger.Info("Neo4j driver closed successfully")
+	return nil
+}
+
+// ExtractFeatures returns the AI model features for a user
+func (s *Neo4jService) ExtractFeatures(ctx context.Context, userID string) (models.UserFeatures, error) {
+	extractor := NewNeo4jFeatureExtractor(s, s.Logger)
+	if len(s.FeatureWindows) > 0 {
+		extractor.Windows = s.FeatureWindows
+	}
+	return extractor.ExtractFeatures(ctx, userID)
+}
+
+// interactionColumns returns the columns of an Interaction node i, and of the
+// honeytoken h it triggered, decoded by decodeInteraction
+const interactionColumns = `i.interaction_id AS interaction_id, i.endpoint AS endpoint, i.timestamp AS timestamp, i.response_status_code AS response_status_code,
+			i.honeytoken_triggered AS honeytoken_triggered, h.token_id AS honeytoken_id, i.ip_address AS ip_address,
+			i.method AS method, i.user_agent AS user_agent, i.session_id AS session_id,
+			i.request_size AS request_size, i.latency_ms AS latency_ms, i.country AS country, i.city AS city,
+			i.asn AS asn, i.as_org AS as_org, i.hosting_provider AS hosting_provider, i.reputation AS reputation`
+
+// GetInteractions returns the Interaction nodes of a user since the given time, oldest first
+func (s *Neo4jService) GetInteractions(ctx context.Context, userID string, since time.Time) ([]models.Interaction, error) {
+	query := `
+		MATCH (u:User {user_id: $user_id})-[:HAS_INTERACTION]->(i:Interaction)
+		WHERE datetime(i.timestamp) >= datetime($since)
+		OPTIONAL MATCH (i)-[:TRIGGERED]->(h:Honeytoken)
+		RETURN ` + interactionColumns + `
+		ORDER BY datetime(i.timestamp)
+	`
+	params := map[string]interface{}{"user_id": userID, "since": since.UTC().Format(time.RFC3339)}
+	records, err := s.RunQuery(ctx, query, params)
+	if err != nil {
+		return nil, err
+	}
+
+	interactions := make([]models.Interaction, 0, len(records))
+	for _, record := range records {
+		interaction := decodeInteraction(record.AsMap())
+		interaction.UserID = userID
+		interactions = append(interactions, interaction)
+	}
+	return interactions, nil
+}
+
+// ListInteractions returns the Interaction nodes of every user since the given time, oldest first
+func (s *Neo4jService) ListInteractions(ctx context.Context, since time.Time) ([]models.Interaction, error) {
+	query := `
+		MATCH (u:User)-[:HAS_INTERACTION]->(i:Interaction)
+		WHERE datetime(i.timestamp) >= datetime($since)
+		OPTIONAL MATCH (i)-[:TRIGGERED]->(h:Honeytoken)
+		RETURN u.user_id AS user_id, ` + interactionColumns + `
+		ORDER BY datetime(i.timestamp)
+	`
+	records, err := s.RunQuery(ctx, query, map[string]interface{}{"since": since.UTC().Format(time.RFC3339)})
+	if err != nil {
+		return nil, err
+	}
+
+	interactions := make([]models.Interaction, 0, len(records))
+	for _, record := range records {
+		values := record.AsMap()
+		interaction := decodeInteraction(values)
+		interaction.UserID, _ = values["user_id"].(string)
+		interactions = append(interactions, interaction)
+	}
+	return interactions, nil
+}
+
+// ListSharedIPs returns the interactions since the given time by IP node,
+// for IPs used by 2 to maxUsers users. Users are counted first so the uses of
+// busy IPs, such as NAT gateways, are never returned.
+func (s *Neo4jService) ListSharedIPs(ctx context.Context, since time.Time, maxUsers int) (map[string][]models.Interaction, error) {
+	query := `
+		MATCH (u:User)-[:HAS_INTERACTION]->(i:Interaction)-[:FROM_IP]->(ip:IP)
+		WHERE datetime(i.timestamp) >= datetime($since)
+		WITH ip, count(DISTINCT u) AS users
+		WHERE users >= 2 AND users <= $max_users
+		MATCH (u:User)-[:HAS_INTERACTION]->(i:Interaction)-[:FROM_IP]->(ip)
+		WHERE datetime(i.timestamp) >= datetime($since)
+		RETURN ip.address AS address, u.user_id AS user_id, i.timestamp AS timestamp
+	`
+	params := map[string]interface{}{"since": since.UTC().Format(time.RFC3339), "max_users": maxUsers}
+	records, err := s.RunQuery(ctx, query, params)
+	if err != nil {
+		return nil, err
+	}
+
+	byIP := make(map[string][]models.Interaction)
+	for _, record := range records {
+		values := record.AsMap()
+		address, _ := values["address"].(string)
+		var interaction models.Interaction
+		interaction.UserID, _ = values["user_id"].(string)
+		if ts, ok := values["timestamp"].(string); ok {
+			interaction.Timestamp, _ = time.Parse(time.RFC3339, ts)
+		}
+		byIP[address] = append(byIP[address], interaction)
+	}
+	return byIP, nil
+}
+
+// ListSharedHoneytokens returns the sorted users of each honeytoken triggered
+// since the given time by 2 to maxUsers users
+func (s *Neo4jService) ListSharedHoneytokens(ctx context.Context, since time.Time, maxUsers int) (map[string][]string, error) {
+	query := `
+		MATCH (u:User)-[:HAS_INTERACTION]->(i:Interaction)-[:TRIGGERED]->(h:Honeytoken)
+		WHERE datetime(i.timestamp) >= datetime($since)
+		WITH h, collect(DISTINCT u.user_id) AS users
+		WHERE size(users) >= 2 AND size(users) <= $max_users
+		RETURN h.token_id AS token_id, users
+	`
+	params := map[string]interface{}{"since": since.UTC().Format(time.RFC3339), "max_users": maxUsers}
+	records, err := s.RunQuery(ctx, query, params)
+	if err != nil {
+		return nil, err
+	}
+
+	usersByToken := make(map[string][]string, len(records))
+	for _, record := range records {
+		values := record.AsMap()
+		tokenID, _ := values["token_id"].(string)
+		users, _ := values["users"].([]any)
+		userIDs := make([]string, 0, len(users))
+		for _, user := range users {
+			if userID, ok := user.(string); ok {
+				userIDs = append(userIDs, userID)
+			}
+		}
+		sort.Strings(userIDs)
+		usersByToken[tokenID] = userIDs
+	}
+	return usersByToken, nil
+}
+
+// ListEndpointSequences returns the latest maxLength endpoints since the
+// given time, oldest first, of each user with at least minLength of them
+func (s *Neo4jService) ListEndpointSequences(ctx context.Context, since time.Time, minLength, maxLength int) (map[string][]string, error) {
+	query := `
+		MATCH (u:User)-[:HAS_INTERACTION]->(i:Interaction)
+		WHERE datetime(i.timestamp) >= datetime($since)
+		WITH u, i ORDER BY datetime(i.timestamp)
+		WITH u, collect(i.endpoint) AS endpoints
+		WHERE size(endpoints) >= $min_length
+		RETURN u.user_id AS user_id, endpoints[-$max_length..] AS endpoints
+	`
+	params := map[string]interface{}{
+		"since":      since.UTC().Format(time.RFC3339),
+		"min_length": minLength,
+		"max_length": maxLength,
+	}
+	records, err := s.RunQuery(ctx, query, params)
+	if err != nil {
+		return nil, err
+	}
+
+	sequences := make(map[string][]string, len(records))
+	for _, record := range records {
+		values := record.AsMap()
+		userID, _ := values["user_id"].(string)
+		endpoints, _ := values["endpoints"].([]any)
+		sequence := make([]string, 0, len(endpoints))
+		for _, endpoint := range endpoints {
+			if endpoint, ok := endpoint.(string); ok {
+				sequence = append(sequence, endpoint)
+			}
+		}
+		sequences[userID] = sequence
+	}
+	return sequences, nil
+}
+
+// decodeInteraction decodes the interactionColumns of a record
+func decodeInteraction(values map[string]any) models.Interaction {
+	var interaction models.Interaction
+	interaction.ID, _ = values["interaction_id"].(string)
+	interaction.Endpoint, _ = values["endpoint"].(string)
+	if ts, ok := values["timestamp"].(string); ok {
+		interaction.Timestamp, _ = time.Parse(time.RFC3339, ts)
+	}
+	if status, ok := values["response_status_code"].(int64); ok {
+		interaction.ResponseStatusCode = int(status)
+	}
+	interaction.HoneytokenTriggered, _ = values["honeytoken_triggered"].(bool)
+	interaction.HoneytokenID, _ = values["honeytoken_id"].(string)
+	interaction.IPAddress, _ = values["ip_address"].(string)
+	interaction.Method, _ = values["method"].(string)
+	interaction.UserAgent, _ = values["user_agent"].(string)
+	interaction.SessionID, _ = values["session_id"].(string)
+	interaction.RequestSize, _ = values["request_size"].(int64)
+	interaction.LatencyMs, _ = values["latency_ms"].(float64)
+	interaction.Country, _ = values["country"].(string)
+	interaction.City, _ = values["city"].(string)
+	if asn, ok := values["asn"].(int64); ok {
+		interaction.ASN = int(asn)
+	}
+	interaction.ASOrg, _ = values["as_org"].(string)
+	interaction.HostingProvider, _ = values["hosting_provider"].(bool)
+	if categories, ok := values["reputation"].([]any); ok {
+		for _, category := range categories {
+			if category, ok := category.(string); ok {
+				interaction.Reputation = append(interaction.Reputation, category)
+			}
+		}
+	}
+	return interaction
+}
+
+// ListUserIDs returns a page of user IDs in ascending order. With staleOnly it
+// compares User.last_interaction_at with the newest ScoreSnapshot.
+func (s *Neo4jService) ListUserIDs(ctx context.Context, after string, limit int, staleOnly bool) ([]string, error) {
+	query := `
+		MATCH (u:User)
+		WHERE u.user_id > $after
+		WITH u, datetime(u.last_interaction_at) AS active_at
+		CALL {
+			WITH u
+			OPTIONAL MATCH (u)-[:HAS_SCORE]->(s:ScoreSnapshot)
+			RETURN max(datetime(s.timestamp)) AS scored_at
+		}
+		WITH u, active_at, scored_at
+		WHERE NOT $stale_only OR (active_at IS NOT NULL AND (scored_at IS NULL OR active_at > scored_at))
+		RETURN u.user_id AS user_id
+		ORDER BY u.user_id
+		LIMIT $limit
+	`
+	params := map[string]interface{}{"after": after, "limit": limit, "stale_only": staleOnly}
+	records, err := s.RunQuery(ctx, query, params)
+	if err != nil {
+		return nil, err
+	}
+
+	userIDs := make([]string, 0, len(records))
+	for _, record := range records {
+		if userID, ok := record.Values[0].(string); ok {
+			userIDs = append(userIDs, userID)
+		}
+	}
+	return userIDs, nil
+}
+
+// ExportUserGraph returns every User node with its honeytoken hits and IPs,
+// and every association once
+func (s *Neo4jService) ExportUserGraph(ctx context.Context) (models.UserGraph, error) {
+	usersQuery := `
+		MATCH (u:User)
+		CALL {
+			WITH u
+			OPTIONAL MATCH (u)-[:HAS_INTERACTION]->(i:Interaction)
+			RETURN sum(CASE WHEN i.honeytoken_triggered THEN 1 ELSE 0 END) AS honeytoken_hits,
+				collect(DISTINCT i.ip_address) AS ip_addresses
+		}
+		RETURN u.user_id AS user_id, coalesce(u.malicious_score, 0.0) AS malicious_score, honeytoken_hits, ip_addresses,
+			coalesce(u.cluster_id, '') AS cluster_id
+		ORDER BY u.user_id
+	`
+	records, err := s.RunQuery(ctx, usersQuery, nil)
+	if err != nil {
+		return models.UserGraph{}, err
+	}
+
+	var graph models.UserGraph
+	for _, record := range records {
+		values := record.AsMap()
+		user := models.GraphUser{}
+		user.UserID, _ = values["user_id"].(string)
+		user.MaliciousScore, _ = values["malicious_score"].(float64)
+		user.HoneytokenHits, _ = values["honeytoken_hits"].(int64)
+		user.ClusterID, _ = values["cluster_id"].(string)
+		ips, _ := values["ip_addresses"].([]any)
+		for _, ip := range ips {
+			if address, ok := ip.(string); ok {
+				user.IPAddresses = append(user.IPAddresses, address)
+			}
+		}
+		graph.Users = append(graph.Users, user)
+	}
+
+	edgesQuery := `
+		MATCH (a:User)-[r:ASSOCIATED_WITH]-(b:User)
+		WHERE a.user_id < b.user_id
+		WITH a, b, coalesce(r.type, 'explicit') AS type, max(coalesce(r.confidence, 1.0)) AS confidence
+		WITH a, b, 1 - reduce(independent = 1.0, c IN collect(confidence) | independent * (1 - c)) AS weight
+		RETURN a.user_id AS from, b.user_id AS to, weight
+	`
+	records, err = s.RunQuery(ctx, edgesQuery, nil)
+	if err != nil {
+		return models.UserGraph{}, err
+	}
+	for _, record := range records {
+		from, _ := record.Values[0].(string)
+		to, _ := record.Values[1].(string)
+		weight, _ := record.Values[2].(float64)
+		graph.Edges = append(graph.Edges, models.GraphEdge{From: from, To: to, Weight: weight})
+	}
+	return graph, nil
+}
+
+// graphWriteBatchSize bounds the rows written per transaction by graph jobs
+const graphWriteBatchSize = 5000
+
+// SavePropagatedRisk sets u.propagated_risk in batches of graphWriteBatchSize users
+func (s *Neo4jService) SavePropagatedRisk(ctx context.Context, risks map[string]float64) error {
+	rows := make([]any, 0, len(risks))
+	for userID, risk := range risks {
+		rows = append(rows, map[string]any{"user_id": userID, "risk": risk})
+	}
+	query := `
+		UNWIND $rows AS row
+		MATCH (u:User {user_id: row.user_id})
+		SET u.propagated_risk = row.risk
+	`
+	return s.writeRows(ctx, query, rows)
+}
+
+// SaveClusters sets u.cluster_id in batches of graphWriteBatchSize users
+func (s *Neo4jService) SaveClusters(ctx context.Context, clusters map[string]string) error {
+	rows := make([]any, 0, len(clusters))
+	for userID, clusterID := range clusters {
+		rows = append(rows, map[string]any{"user_id": userID, "cluster_id": clusterID})
+	}
+	query := `
+		UNWIND $rows AS row
+		MATCH (u:User {user_id: row.user_id})
+		SET u.cluster_id = row.cluster_id
+	`
+	return s.writeRows(ctx, query, rows)
+}
+
+// SaveAssociations merges one ASSOCIATED_WITH edge per direction and type
+// for each association and overwrites its confidence, weight and evidence, in
+// batches of graphWriteBatchSize associations
+func (s *Neo4jService) SaveAssociations(ctx context.Context, associations []models.Association) error {
+	rows := make([]any, 0, len(associations))
+	for _, association := range associations {
+		var inferredAt string
+		if association.InferredAt != nil {
+			inferredAt = association.InferredAt.UTC().Format(time.RFC3339Nano)
+		}
+		rows = append(rows, map[string]any{
+			"user1":       association.UserID,
+			"user2":       association.AssociateID,
+			"type":        association.Type,
+			"confidence":  association.Confidence,
+			"weight":      association.Weight,
+			"evidence":    association.Evidence,
+			"inferred_at": inferredAt,
+		})
+	}
+	query := `
+		UNWIND $rows AS row
+		MATCH (u1:User {user_id: row.user1})
+		MATCH (u2:User {user_id: row.user2})
+		MERGE (u1)-[r1:ASSOCIATED_WITH {type: row.type}]->(u2)
+		MERGE (u2)-[r2:ASSOCIATED_WITH {type: row.type}]->(u1)
+		SET r1.confidence = row.confidence, r1.weight = row.weight, r1.evidence = row.evidence, r1.inferred_at = row.inferred_at,
+			r2.confidence = row.confidence, r2.weight = row.weight, r2.evidence = row.evidence, r2.inferred_at = row.inferred_at
+	`
+	return s.writeRows(ctx, query, rows)
+}
+
+// PruneAssociations deletes the inferred ASSOCIATED_WITH edges whose
+// inferred_at is not the given run time, in batches of graphWriteBatchSize
+// edges, and returns how many it deleted. Explicit edges have no type and
+// are kept.
+func (s *Neo4jService) PruneAssociations(ctx context.Context, inferredAt time.Time) (int, error) {
+	logger := s.Logger.WithContext(ctx)
+	session := s.Driver.NewSession(ctx, neo4j.SessionConfig{})
+	defer session.Close(ctx)
+
+	query := `
+		MATCH (:User)-[r:ASSOCIATED_WITH]->(:User)
+		WHERE r.type IS NOT NULL AND coalesce(r.inferred_at, '') <> $inferred_at
+		WITH r LIMIT $limit
+		DELETE r
+		RETURN count(r) AS deleted
+	`
+	params := map[string]any{"inferred_at": inferredAt.UTC().Format(time.RFC3339Nano), "limit": graphWriteBatchSize}
+	pruned := 0
+	for {
+		deleted, err := session.ExecuteWrite(ctx, func(tx neo4j.ManagedTransaction) (any, error) {
+			result, err := tx.Run(ctx, query, params)
+			if err != nil {
+				return nil, err
+			}
+			record, err := result.Single(ctx)
+			if err != nil {
+				return nil, err
+			}
+			deleted, _ := record.Get("deleted")
+			return deleted, nil
+		}, txMetadata(ctx))
+		if err != nil {
+			logger.Error("Failed to prune associations", "error", err)
+			return pruned, err
+		}
+		count, _ := deleted.(int64)
+		pruned += int(count)
+		if count < graphWriteBatchSize {
+			return pruned, nil
+		}
+	}
+}
+
+// GetAssociations returns the associations of a user ordered by associate and
+// type. Edges without a type were created by AssociatedWith and are explicit;
+// repeated explicit associations are counted in the weight.
+func (s *Neo4jService) GetAssociations(ctx context.Context, userID string) ([]models.Association, error) {
+	query := `
+		MATCH (u:User {user_id: $user_id})-[r:ASSOCIATED_WITH]->(p:User)
+		WITH p, coalesce(r.type, 'explicit') AS type, collect(r) AS edges
+		WITH p, type, edges[0] AS r, size(edges) AS count
+		RETURN p.user_id AS associate_id, type, coalesce(r.confidence, 1.0) AS confidence,
+			coalesce(r.weight, count) AS weight, coalesce(r.evidence, []) AS evidence, r.inferred_at AS inferred_at
+		ORDER BY associate_id, type
+	`
+	records, err := s.RunQuery(ctx, query, map[string]interface{}{"user_id": userID})
+	if err != nil {
+		return nil, err
+	}
+
+	associations := make([]models.Association, 0, len(records))
+	for _, record := range records {
+		values := record.AsMap()
+		association := models.Association{UserID: userID, Evidence: []string{}}
+		association.AssociateID, _ = values["associate_id"].(string)
+		association.Type, _ = values["type"].(string)
+		association.Confidence, _ = values["confidence"].(float64)
+		if weight, ok := values["weight"].(int64); ok {
+			association.Weight = int(weight)
+		}
+		evidence, _ := values["evidence"].([]any)
+		for _, item := range evidence {
+			if text, ok := item.(string); ok {
+				association.Evidence = append(association.Evidence, text)
+			}
+		}
+		if ts, ok := values["inferred_at"].(string); ok && ts != "" {
+			if inferredAt, err := time.Parse(time.RFC3339, ts); err == nil {
+				association.InferredAt = &inferredAt
+			}
+		}
+		associations = append(associations, association)
+	}
+	return associations, nil
+}
+
+// writeRows runs an UNWIND $rows write query in batches of graphWriteBatchSize
+func (s *Neo4jService) writeRows(ctx context.Context, query string, rows []any) error {
+	logger := s.Logger.WithContext(ctx)
+	session := s.Driver.NewSession(ctx, neo4j.SessionConfig{})
+	defer session.Close(ctx)
+
+	for start := 0; start < len(rows); start += graphWriteBatchSize {
+		batch := rows[start:min(start+graphWriteBatchSize, len(rows))]
+		_, err := session.ExecuteWrite(ctx, func(tx neo4j.ManagedTransaction) (any, error) {
+			return tx.Run(ctx, query, map[string]any{"rows": batch})
+		}, txMetadata(ctx))
+		if err != nil {
+			logger.Error("Failed to write graph job results", "rows", len(batch), "error", err)
+			return err
+		}
+	}
+	return nil
+}
+
+// txMetadata attaches the request ID of ctx to a transaction so it shows up
+// in the Neo4j query log
+func txMetadata(ctx context.Context) func(*neo4j.TransactionConfig) {
+	return func(config *neo4j.TransactionConfig) {
+		if requestID := utils.RequestIDFromContext(ctx); requestID != "" {
+			config.Metadata = map[string]any{"request_id": requestID}
+		}
+	}
 }
@@ -0,0 +1,53 @@
+package services
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"backend/utils"
+)
+
+// periodicLoop runs a task now and then every interval in the background
+// until stopped, such as a graph job or a check for changed data files. A run
+// that is still going when the next tick fires delays it rather than
+// overlapping, since tasks like graph jobs export the whole user graph.
+type periodicLoop struct {
+	ctx       context.Context
+	cancel    context.CancelFunc
+	startOnce sync.Once
+	stopped   chan struct{}
+}
+
+func newPeriodicLoop() periodicLoop {
+	ctx, cancel := context.WithCancel(context.Background())
+	return periodicLoop{ctx: ctx, cancel: cancel, stopped: make(chan struct{})}
+}
+
+// start runs run now and then every interval; failures are logged as failure
+func (l *periodicLoop) start(interval time.Duration, run func(context.Context) error, logger *utils.Logger, failure string) {
+	l.startOnce.Do(func() {
+		go func() {
+			defer close(l.stopped)
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+			for {
+				if err := run(l.ctx); err != nil && l.ctx.Err() == nil {
+					logger.Error(failure, "error", err)
+				}
+				select {
+				case <-ticker.C:
+				case <-l.ctx.Done():
+					return
+				}
+			}
+		}()
+	})
+}
+
+// stop cancels the current run and waits for the loop to exit
+func (l *periodicLoop) stop() {
+	l.cancel()
+	l.startOnce.Do(func() { close(l.stopped) }) // Never started: there is no loop
+	<-l.stopped
+}
@@ -0,0 +1,330 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"backend/models"
+	"backend/utils"
+)
+
+// Reputation list formats
+const (
+	ReputationFormatText = "text" // One network or address per line; # starts a comment
+	ReputationFormatCSV  = "csv"  // Network or address in the first column, optional category in the second
+)
+
+// ReputationList is a file of networks that share a reputation category,
+// such as Tor exit nodes or internally banned ranges
+type ReputationList struct {
+	Path          string
+	Category      string   // Tag of interactions from the listed networks, e.g. tor, vpn, datacenter or banned
+	Format        string   // ReputationFormatText or ReputationFormatCSV; empty picks CSV for .csv files
+	RowCategories []string // Further categories the second column of a CSV list may use
+}
+
+// reputationCategoryPattern matches valid categories, which name features
+var reputationCategoryPattern = regexp.MustCompile(`^[a-z0-9_]+$`)
+
+// allows reports whether entries of the list may be tagged category
+func (l ReputationList) allows(category string) bool {
+	if category == l.Category {
+		return true
+	}
+	for _, allowed := range l.RowCategories {
+		if category == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// format returns the format of the list
+func (l ReputationList) format() string {
+	if l.Format != "" {
+		return l.Format
+	}
+	if strings.EqualFold(filepath.Ext(l.Path), ".csv") {
+		return ReputationFormatCSV
+	}
+	return ReputationFormatText
+}
+
+// ReputationOptions configures an IPReputation
+type ReputationOptions struct {
+	Lists          []ReputationList
+	ReloadInterval time.Duration // How often the lists are checked for changes
+}
+
+// DefaultReputationOptions returns the default ReputationOptions, without lists
+func DefaultReputationOptions() ReputationOptions {
+	return ReputationOptions{ReloadInterval: 10 * time.Minute}
+}
+
+// IPReputation tags interactions with the categories of the reputation lists
+// their IP address is on. The lists are indexed in a utils.IPTree. Start
+// checks the files every ReloadInterval; when any changed, all lists are
+// loaded into a new tree that replaces the old one, so lookups never see a
+// partly loaded set of lists.
+type IPReputation struct {
+	Options ReputationOptions
+	Logger  *utils.Logger
+
+	mu       sync.RWMutex
+	tree     *utils.IPTree
+	versions []fileVersion // Of Options.Lists, as loaded into tree
+	loop     periodicLoop
+}
+
+// NewIPReputation loads the lists; call Start to reload them when they change
+func NewIPReputation(options ReputationOptions, logger *utils.Logger) (*IPReputation, error) {
+	if len(options.Lists) == 0 {
+		return nil, fmt.Errorf("no reputation list configured")
+	}
+	for _, list := range options.Lists {
+		for _, category := range append([]string{list.Category}, list.RowCategories...) {
+			if !reputationCategoryPattern.MatchString(category) {
+				return nil, fmt.Errorf("invalid reputation category %q of %s: must be lowercase letters, digits and underscores", category, list.Path)
+			}
+		}
+	}
+	if options.ReloadInterval <= 0 {
+		options.ReloadInterval = DefaultReputationOptions().ReloadInterval
+	}
+
+	r := &IPReputation{
+		Options: options,
+		Logger:  logger,
+		loop:    newPeriodicLoop(),
+	}
+	tree, versions, err := r.load()
+	if err != nil {
+		return nil, err
+	}
+	r.tree, r.versions = tree, versions
+	return r, nil
+}
+
+// Start checks the lists for changes every ReloadInterval in the background
+func (r *IPReputation) Start() {
+	r.loop.start(r.Options.ReloadInterval, func(ctx context.Context) error {
+		_, err := r.Reload()
+		return err
+	}, r.Logger, "Failed to reload reputation lists")
+}
+
+// Stop stops checking the lists for changes
+func (r *IPReputation) Stop() {
+	r.loop.stop()
+}
+
+// Reload reloads every list if any of their files changed since the last
+// load and reports whether it did. When a list fails to load, the previous
+// lists stay in use.
+func (r *IPReputation) Reload() (bool, error) {
+	r.mu.RLock()
+	versions := r.versions
+	r.mu.RUnlock()
+
+	changed := false
+	for i, list := range r.Options.Lists {
+		if versions[i].changed(list.Path) {
+			changed = true
+			break
+		}
+	}
+	if !changed {
+		return false, nil
+	}
+
+	tree, versions, err := r.load()
+	if err != nil {
+		return false, err
+	}
+	r.mu.Lock()
+	r.tree, r.versions = tree, versions
+	r.mu.Unlock()
+	r.Logger.Info("Reloaded reputation lists", "networks", tree.Len())
+	return true, nil
+}
+
+// load reads every list into a new tree
+func (r *IPReputation) load() (*utils.IPTree, []fileVersion, error) {
+	tree := utils.NewIPTree()
+	versions := make([]fileVersion, len(r.Options.Lists))
+	for i, list := range r.Options.Lists {
+		version, err := statFileVersion(list.Path)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to stat reputation list: %v", err)
+		}
+		file, err := os.Open(list.Path)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to open reputation list: %v", err)
+		}
+		before := tree.Len()
+		skipped, err := readReputationList(file, list, tree)
+		file.Close()
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read reputation list %s: %v", list.Path, err)
+		}
+		if skipped > 0 {
+			r.Logger.Warn("Skipped invalid reputation list entries", "path", list.Path, "skipped", skipped)
+		}
+		r.Logger.Debug("Loaded reputation list", "path", list.Path, "category", list.Category, "networks", tree.Len()-before)
+		versions[i] = version
+	}
+	return tree, versions, nil
+}
+
+// readReputationList inserts the networks of a list into tree and returns
+// the number of entries that are not networks or addresses, such as a CSV
+// header. A CSV category the list does not allow fails the whole list, since
+// no feature would count it.
+func readReputationList(reader io.Reader, list ReputationList, tree *utils.IPTree) (int, error) {
+	skipped := 0
+	insert := func(entry, category string) error {
+		network, err := parseReputationEntry(entry)
+		if err != nil {
+			skipped++
+			return nil
+		}
+		if category == "" {
+			category = list.Category
+		}
+		if !list.allows(category) {
+			return fmt.Errorf("category %q is not configured for the list", category)
+		}
+		tree.Insert(network, category)
+		return nil
+	}
+
+	switch list.format() {
+	case ReputationFormatText:
+		scanner := bufio.NewScanner(reader)
+		for scanner.Scan() {
+			line, _, _ := strings.Cut(scanner.Text(), "#")
+			if fields := strings.Fields(line); len(fields) > 0 {
+				insert(fields[0], "") // Always the list's category
+			}
+		}
+		return skipped, scanner.Err()
+	case ReputationFormatCSV:
+		records := csv.NewReader(reader)
+		records.Comment = '#'
+		records.FieldsPerRecord = -1
+		records.TrimLeadingSpace = true
+		for {
+			record, err := records.Read()
+			if errors.Is(err, io.EOF) {
+				return skipped, nil
+			}
+			if err != nil {
+				return skipped, err
+			}
+			var category string
+			if len(record) > 1 {
+				category = strings.TrimSpace(record[1])
+			}
+			if err := insert(strings.TrimSpace(record[0]), category); err != nil {
+				line, _ := records.FieldPos(0)
+				return skipped, fmt.Errorf("line %d: %v", line, err)
+			}
+		}
+	default:
+		return 0, fmt.Errorf("unknown format %q", list.Format)
+	}
+}
+
+// parseReputationEntry parses a CIDR network or a single address, which is
+// taken as its /32 or /128
+func parseReputationEntry(entry string) (*net.IPNet, error) {
+	if strings.Contains(entry, "/") {
+		_, network, err := net.ParseCIDR(entry)
+		return network, err
+	}
+	ip := net.ParseIP(entry)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid network or address: %q", entry)
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(8*len(ip), 8*len(ip))}, nil
+}
+
+// Lookup returns the sorted categories of the lists containing an address,
+// which may carry a port
+func (r *IPReputation) Lookup(address string) []string {
+	normalized, err := utils.NormalizeIP(address)
+	if err != nil {
+		return nil
+	}
+	r.mu.RLock()
+	tree := r.tree
+	r.mu.RUnlock()
+	return tree.Lookup(net.ParseIP(normalized))
+}
+
+// Categories returns the sorted categories of the configured lists,
+// including the row categories their CSV files may use
+func (r *IPReputation) Categories() []string {
+	seen := make(map[string]bool)
+	var categories []string
+	for _, list := range r.Options.Lists {
+		for _, category := range append([]string{list.Category}, list.RowCategories...) {
+			if !seen[category] {
+				seen[category] = true
+				categories = append(categories, category)
+			}
+		}
+	}
+	sort.Strings(categories)
+	return categories
+}
+
+// Enrich sets the reputation categories of an interaction from its IP
+// address. Values sent by the client are overwritten.
+func (r *IPReputation) Enrich(interaction *models.Interaction) {
+	interaction.Reputation = r.Lookup(interaction.IPAddress)
+}
+
+// ReputationCategoryFeature is the share of recent interactions from IPs on
+// the reputation lists of one category
+type ReputationCategoryFeature struct {
+	Category string
+}
+
+func (f ReputationCategoryFeature) Name() string { return "reputation_" + f.Category + "_ratio" }
+func (f ReputationCategoryFeature) Description() string {
+	return "Share of recent interactions from IPs on " + f.Category + " reputation lists"
+}
+func (ReputationCategoryFeature) Source() FeatureSource { return SourceInteractions }
+
+// Compute returns 0 for a user without recent interactions
+func (f ReputationCategoryFeature) Compute(data FeatureData) (interface{}, error) {
+	if len(data.Interactions) == 0 {
+		return 0.0, nil
+	}
+	var listed int
+	for _, interaction := range data.Interactions {
+		for _, category := range interaction.Reputation {
+			if category == f.Category {
+				listed++
+				break
+			}
+		}
+	}
+	return float64(listed) / float64(len(data.Interactions)), nil
+}
@@ -0,0 +1,381 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"backend/utils"
+)
+
+// ErrRescoringRunning is returned when triggering a run while another is in progress
+var ErrRescoringRunning = errors.New("a re-scoring run is already in progress")
+
+// Triggers of a re-scoring run
+const (
+	RescoringTriggerSchedule = "schedule"
+	RescoringTriggerManual   = "manual"
+	RescoringTriggerResume   = "resume"
+)
+
+// RescoringOptions configures a RescoringJob
+type RescoringOptions struct {
+	Interval       time.Duration // Time between scheduled runs; 0 disables the schedule
+	Workers        int           // Users analyzed concurrently
+	BatchSize      int           // Users listed per page; the checkpoint advances after each page
+	StaleOnly      bool          // Scheduled runs only re-score users with interactions newer than their score
+	CheckpointPath string        // File recording the progress of the current run
+}
+
+// DefaultRescoringOptions returns the default RescoringOptions
+func DefaultRescoringOptions() RescoringOptions {
+	return RescoringOptions{
+		Interval:       time.Hour,
+		Workers:        4,
+		BatchSize:      100,
+		StaleOnly:      true,
+		CheckpointPath: "data/rescoring.checkpoint",
+	}
+}
+
+// RescoringStatus reports the progress of the current or last run
+type RescoringStatus struct {
+	Running    bool       `json:"running"`
+	RunID      string     `json:"run_id,omitempty"`
+	Trigger    string     `json:"trigger,omitempty"` // schedule, manual or resume
+	StaleOnly  bool       `json:"stale_only"`
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	Scored     int64      `json:"scored"`                 // Users scored so far
+	Failed     int64      `json:"failed"`                 // Users whose analysis failed
+	LastUserID string     `json:"last_user_id,omitempty"` // Checkpoint: every user up to this ID is done
+	LastError  string     `json:"last_error,omitempty"`
+	NextRunAt  *time.Time `json:"next_run_at,omitempty"` // Next scheduled run, if scheduled
+}
+
+// rescoringCheckpoint is the state of a run saved after each page of users
+type rescoringCheckpoint struct {
+	RunID      string    `json:"run_id"`
+	Trigger    string    `json:"trigger"`
+	StaleOnly  bool      `json:"stale_only"`
+	StartedAt  time.Time `json:"started_at"`
+	LastUserID string    `json:"last_user_id"`
+	Scored     int64     `json:"scored"`
+	Failed     int64     `json:"failed"`
+}
+
+// RescoringJob periodically re-analyzes users in the background, persisting
+// their malicious_score. Users are listed in pages by user ID and analyzed by a
+// bounded pool of workers. The last completed user ID is checkpointed to disk
+// after every page, so a run interrupted by a crash or shutdown resumes there
+// on the next start.
+type RescoringJob struct {
+	Analysis *UserAnalysisService
+	Options  RescoringOptions
+	Logger   *utils.Logger
+
+	mu        sync.Mutex
+	status    RescoringStatus
+	scored    atomic.Int64
+	failed    atomic.Int64
+	ctx       context.Context
+	cancel    context.CancelFunc
+	runs      sync.WaitGroup
+	stopLoop  chan struct{}
+	loopDone  chan struct{}
+	startOnce sync.Once
+	stopOnce  sync.Once
+}
+
+// NewRescoringJob creates a RescoringJob; call Start to schedule runs
+func NewRescoringJob(analysis *UserAnalysisService, options RescoringOptions, logger *utils.Logger) *RescoringJob {
+	defaults := DefaultRescoringOptions()
+	if options.Interval < 0 {
+		options.Interval = 0
+	}
+	if options.Workers <= 0 {
+		options.Workers = defaults.Workers
+	}
+	if options.BatchSize <= 0 {
+		options.BatchSize = defaults.BatchSize
+	}
+	if options.CheckpointPath == "" {
+		options.CheckpointPath = defaults.CheckpointPath
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &RescoringJob{
+		Analysis: analysis,
+		Options:  options,
+		Logger:   logger,
+		ctx:      ctx,
+		cancel:   cancel,
+		stopLoop: make(chan struct{}),
+		loopDone: make(chan struct{}),
+	}
+}
+
+// Start resumes a run left unfinished by a previous process and starts the
+// schedule
+func (j *RescoringJob) Start() {
+	j.startOnce.Do(func() {
+		checkpoint, err := j.loadCheckpoint()
+		if err != nil {
+			j.Logger.Error("Failed to read re-scoring checkpoint, starting over", "path", j.Options.CheckpointPath, "error", err)
+		} else if checkpoint != nil {
+			j.Logger.Info("Resuming interrupted re-scoring run", "run_id", checkpoint.RunID, "last_user_id", checkpoint.LastUserID)
+			checkpoint.Trigger = RescoringTriggerResume
+			j.begin(*checkpoint)
+		}
+		go j.loop()
+	})
+}
+
+// Stop cancels the current run, keeping its checkpoint, and stops the
+// schedule. It may be called more than once.
+func (j *RescoringJob) Stop() {
+	j.cancel()
+	j.startOnce.Do(func() { close(j.loopDone) }) // Never started: there is no loop
+	j.stopOnce.Do(func() { close(j.stopLoop) })
+	<-j.loopDone
+	j.runs.Wait()
+}
+
+// Trigger starts a run immediately, or returns ErrRescoringRunning
+func (j *RescoringJob) Trigger(staleOnly bool) (RescoringStatus, error) {
+	if err := j.begin(newRescoringCheckpoint(RescoringTriggerManual, staleOnly)); err != nil {
+		return j.Status(), err
+	}
+	return j.Status(), nil
+}
+
+// Status returns the progress of the current or last run
+func (j *RescoringJob) Status() RescoringStatus {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	status := j.status
+	status.Scored = j.scored.Load()
+	status.Failed = j.failed.Load()
+	return status
+}
+
+// loop starts a run every Interval
+func (j *RescoringJob) loop() {
+	defer close(j.loopDone)
+	if j.Options.Interval == 0 {
+		<-j.stopLoop
+		return
+	}
+
+	ticker := time.NewTicker(j.Options.Interval)
+	defer ticker.Stop()
+	j.setNextRun(time.Now().Add(j.Options.Interval))
+	for {
+		select {
+		case <-ticker.C:
+			j.setNextRun(time.Now().Add(j.Options.Interval))
+			if err := j.begin(newRescoringCheckpoint(RescoringTriggerSchedule, j.Options.StaleOnly)); err != nil {
+				j.Logger.Info("Skipping scheduled re-scoring run", "reason", err)
+			}
+		case <-j.stopLoop:
+			return
+		}
+	}
+}
+
+func (j *RescoringJob) setNextRun(next time.Time) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.status.NextRunAt = &next
+}
+
+// newRescoringCheckpoint creates the checkpoint of a new run
+func newRescoringCheckpoint(trigger string, staleOnly bool) rescoringCheckpoint {
+	return rescoringCheckpoint{
+		RunID:     utils.NewRequestID(),
+		Trigger:   trigger,
+		StaleOnly: staleOnly,
+		StartedAt: time.Now(),
+	}
+}
+
+// begin starts a run from checkpoint unless one is in progress
+func (j *RescoringJob) begin(checkpoint rescoringCheckpoint) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.status.Running {
+		return ErrRescoringRunning
+	}
+	if j.ctx.Err() != nil {
+		return fmt.Errorf("re-scoring job is stopped")
+	}
+
+	startedAt := checkpoint.StartedAt
+	j.status = RescoringStatus{
+		Running:    true,
+		RunID:      checkpoint.RunID,
+		Trigger:    checkpoint.Trigger,
+		StaleOnly:  checkpoint.StaleOnly,
+		StartedAt:  &startedAt,
+		LastUserID: checkpoint.LastUserID,
+		NextRunAt:  j.status.NextRunAt,
+	}
+	j.scored.Store(checkpoint.Scored)
+	j.failed.Store(checkpoint.Failed)
+
+	j.runs.Add(1)
+	go func() {
+		defer j.runs.Done()
+		j.run(checkpoint)
+	}()
+	return nil
+}
+
+// run re-scores every listed user after checkpoint.LastUserID, one page at a time
+func (j *RescoringJob) run(checkpoint rescoringCheckpoint) {
+	ctx := utils.WithRequestID(j.ctx, checkpoint.RunID)
+	logger := j.Logger.WithContext(ctx)
+	logger.Info("Starting re-scoring run", "trigger", checkpoint.Trigger, "stale_only", checkpoint.StaleOnly, "after", checkpoint.LastUserID)
+
+	err := j.saveCheckpoint(checkpoint)
+	if err == nil {
+		err = j.runPages(ctx, &checkpoint)
+	}
+	if ctx.Err() != nil {
+		// Interrupted by Stop: the checkpoint stays for the next start
+		logger.Info("Re-scoring run interrupted", "last_user_id", checkpoint.LastUserID)
+		j.finish(checkpoint, "interrupted by shutdown")
+		return
+	}
+	if err != nil {
+		logger.Error("Re-scoring run failed", "last_user_id", checkpoint.LastUserID, "error", err)
+		j.finish(checkpoint, err.Error())
+		return
+	}
+
+	if err := os.Remove(j.Options.CheckpointPath); err != nil && !os.IsNotExist(err) {
+		logger.Error("Failed to remove re-scoring checkpoint", "error", err)
+	}
+	logger.Info("Finished re-scoring run", "scored", j.scored.Load(), "failed", j.failed.Load())
+	j.finish(checkpoint, "")
+}
+
+// runPages lists and analyzes pages of users until none are left, saving the
+// checkpoint after each page
+func (j *RescoringJob) runPages(ctx context.Context, checkpoint *rescoringCheckpoint) error {
+	for {
+		userIDs, err := j.Analysis.Store.ListUserIDs(ctx, checkpoint.LastUserID, j.Options.BatchSize, checkpoint.StaleOnly)
+		if err != nil {
+			return fmt.Errorf("failed to list users: %v", err)
+		}
+		if len(userIDs) == 0 {
+			return nil
+		}
+
+		j.analyzePage(ctx, userIDs)
+		if ctx.Err() != nil {
+			// The page may be incomplete, so it is redone on resume
+			return ctx.Err()
+		}
+
+		checkpoint.LastUserID = userIDs[len(userIDs)-1]
+		checkpoint.Scored, checkpoint.Failed = j.scored.Load(), j.failed.Load()
+		if err := j.saveCheckpoint(*checkpoint); err != nil {
+			return err
+		}
+		j.mu.Lock()
+		j.status.LastUserID = checkpoint.LastUserID
+		j.mu.Unlock()
+	}
+}
+
+// analyzePage analyzes users with at most Options.Workers at a time
+func (j *RescoringJob) analyzePage(ctx context.Context, userIDs []string) {
+	logger := j.Logger.WithContext(ctx)
+	jobs := make(chan string)
+	var workers sync.WaitGroup
+	for i := 0; i < j.Options.Workers && i < len(userIDs); i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for userID := range jobs {
+				if _, err := j.Analysis.AnalyzeUser(ctx, userID); err != nil {
+					if ctx.Err() == nil {
+						logger.Warn("Failed to re-score user", "user_id", userID, "error", err)
+						j.failed.Add(1)
+					}
+					continue
+				}
+				j.scored.Add(1)
+			}
+		}()
+	}
+
+	for _, userID := range userIDs {
+		select {
+		case jobs <- userID:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	close(jobs)
+	workers.Wait()
+}
+
+// finish records the end of a run
+func (j *RescoringJob) finish(checkpoint rescoringCheckpoint, lastError string) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	finishedAt := time.Now()
+	j.status.Running = false
+	j.status.FinishedAt = &finishedAt
+	j.status.LastUserID = checkpoint.LastUserID
+	j.status.LastError = lastError
+}
+
+// saveCheckpoint atomically replaces the checkpoint file
+func (j *RescoringJob) saveCheckpoint(checkpoint rescoringCheckpoint) error {
+	path := j.Options.CheckpointPath
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to create checkpoint directory: %v", err)
+	}
+	data, err := json.Marshal(checkpoint)
+	if err != nil {
+		return fmt.Errorf("failed to encode checkpoint: %v", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write checkpoint: %v", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to write checkpoint: %v", err)
+	}
+	return nil
+}
+
+// loadCheckpoint reads the checkpoint of an unfinished run, or nil if there is none
+func (j *RescoringJob) loadCheckpoint() (*rescoringCheckpoint, error) {
+	data, err := os.ReadFile(j.Options.CheckpointPath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var checkpoint rescoringCheckpoint
+	if err := json.Unmarshal(data, &checkpoint); err != nil {
+		return nil, err
+	}
+	return &checkpoint, nil
+}
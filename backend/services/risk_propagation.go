@@ -0,0 +1,178 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"backend/models"
+	"backend/utils"
+)
+
+// RiskPropagationOptions configures PropagateRisk and RiskPropagationJob
+type RiskPropagationOptions struct {
+	Interval      time.Duration // Time between runs of the job
+	Damping       float64       // Share of a user's risk taken from its associates, in (0, 1)
+	Tolerance     float64       // Iteration stops when no risk changes by more than this
+	MaxIterations int           // Iteration stops after this many rounds even if not converged
+	SeedScore     float64       // Users with a malicious_score of at least this are confirmed malicious
+}
+
+// DefaultRiskPropagationOptions returns the default RiskPropagationOptions
+func DefaultRiskPropagationOptions() RiskPropagationOptions {
+	return RiskPropagationOptions{
+		Interval:      15 * time.Minute,
+		Damping:       0.85,
+		Tolerance:     1e-6,
+		MaxIterations: 100,
+		SeedScore:     0.8,
+	}
+}
+
+// RiskPropagationResult is the outcome of PropagateRisk
+type RiskPropagationResult struct {
+	Risks      map[string]float64 `json:"-"` // propagated_risk by user ID, in [0, 1]
+	Users      int                `json:"users"`
+	Seeds      int                `json:"seeds"` // Confirmed malicious users and honeytoken triggerers
+	Iterations int                `json:"iterations"`
+	Converged  bool               `json:"converged"`
+	Delta      float64            `json:"delta"` // Largest change of the last iteration
+}
+
+// PropagateRisk spreads risk from seed users over the association graph with
+// a random walk with restart, i.e. personalized PageRank towards the seeds.
+// Seeds are users with a malicious_score of at least SeedScore or with a
+// honeytoken trigger; they have a seed value of 1, everyone else 0. Each
+// round sets
+//
+//	risk(u) = (1 - Damping) * seed(u) + Damping * sum(w(u, v) * risk(v)) / max(sum(w(u, v)), 1)
+//
+// over the associates v of u, where w is the confidence of the association.
+// With only explicit associations this is the mean risk of the associates;
+// when a user's confidences add up to less than 1 the walk ends in a clean
+// user with the remaining probability, so a weak association passes on only
+// part of the risk. A user's risk is the chance that a walk from it,
+// restarting with probability 1 - Damping, restarts at a seed. Users without
+// associates keep their seed value. Risks stay in [0, 1] and converge because
+// Damping < 1.
+func PropagateRisk(graph models.UserGraph, options RiskPropagationOptions) RiskPropagationResult {
+	neighbors := graph.Adjacency()
+	seeds := make([]float64, len(graph.Users))
+	result := RiskPropagationResult{Users: len(graph.Users)}
+	for i, user := range graph.Users {
+		if user.MaliciousScore >= options.SeedScore || user.HoneytokenHits > 0 {
+			seeds[i] = 1
+			result.Seeds++
+		}
+	}
+
+	risk := append([]float64(nil), seeds...)
+	next := make([]float64, len(risk))
+	for result.Iterations < options.MaxIterations {
+		result.Iterations++
+		result.Delta = 0
+		for i := range risk {
+			if len(neighbors[i]) == 0 {
+				next[i] = seeds[i]
+				continue
+			}
+			var sum, weights float64
+			for _, neighbor := range neighbors[i] {
+				sum += neighbor.Weight * risk[neighbor.Index]
+				weights += neighbor.Weight
+			}
+			next[i] = (1-options.Damping)*seeds[i] + options.Damping*sum/math.Max(weights, 1)
+			result.Delta = math.Max(result.Delta, math.Abs(next[i]-risk[i]))
+		}
+		risk, next = next, risk
+		if result.Delta <= options.Tolerance {
+			result.Converged = true
+			break
+		}
+	}
+
+	result.Risks = make(map[string]float64, len(risk))
+	for i, user := range graph.Users {
+		result.Risks[user.UserID] = risk[i]
+	}
+	return result
+}
+
+// RiskPropagationJob periodically exports the user graph from the store,
+// propagates risk over it and saves every user's propagated_risk, which
+// feature extraction then reads
+type RiskPropagationJob struct {
+	Store   GraphStore
+	Options RiskPropagationOptions
+	Logger  *utils.Logger
+
+	mu   sync.Mutex
+	last *RiskPropagationResult
+	loop periodicLoop
+}
+
+// NewRiskPropagationJob creates a RiskPropagationJob; call Start to schedule runs
+func NewRiskPropagationJob(store GraphStore, options RiskPropagationOptions, logger *utils.Logger) *RiskPropagationJob {
+	defaults := DefaultRiskPropagationOptions()
+	if options.Interval <= 0 {
+		options.Interval = defaults.Interval
+	}
+	if options.Damping <= 0 || options.Damping >= 1 {
+		options.Damping = defaults.Damping
+	}
+	if options.MaxIterations <= 0 {
+		options.MaxIterations = defaults.MaxIterations
+	}
+	return &RiskPropagationJob{
+		Store:   store,
+		Options: options,
+		Logger:  logger,
+		loop:    newPeriodicLoop(),
+	}
+}
+
+// Start runs the job now and then every Interval in the background
+func (j *RiskPropagationJob) Start() {
+	j.loop.start(j.Options.Interval, func(ctx context.Context) error {
+		_, err := j.Run(ctx)
+		return err
+	}, j.Logger, "Failed to propagate risk")
+}
+
+// Stop cancels the current run and stops the schedule
+func (j *RiskPropagationJob) Stop() {
+	j.loop.stop()
+}
+
+// Run propagates risk over the current graph and saves the result
+func (j *RiskPropagationJob) Run(ctx context.Context) (RiskPropagationResult, error) {
+	logger := j.Logger.WithContext(ctx)
+	start := time.Now()
+
+	graph, err := j.Store.ExportUserGraph(ctx)
+	if err != nil {
+		return RiskPropagationResult{}, fmt.Errorf("failed to export user graph: %v", err)
+	}
+	result := PropagateRisk(graph, j.Options)
+	if !result.Converged {
+		logger.Warn("Risk propagation did not converge", "iterations", result.Iterations, "delta", result.Delta)
+	}
+	if err := j.Store.SavePropagatedRisk(ctx, result.Risks); err != nil {
+		return RiskPropagationResult{}, fmt.Errorf("failed to save propagated risk: %v", err)
+	}
+
+	j.mu.Lock()
+	j.last = &result
+	j.mu.Unlock()
+	logger.Info("Propagated risk", "users", result.Users, "seeds", result.Seeds, "iterations", result.Iterations, "duration", time.Since(start))
+	return result, nil
+}
+
+// LastResult returns the result of the last successful run, or nil
+func (j *RiskPropagationJob) LastResult() *RiskPropagationResult {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.last
+}
@@ -0,0 +1,148 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"math"
+
+	"backend/models"
+	"backend/utils"
+)
+
+// HeuristicModelVersion is recorded for scores produced by HeuristicScorer
+const HeuristicModelVersion = "heuristic-v1"
+
+// ScoreResult is a validated prediction and the scorer that produced it
+type ScoreResult struct {
+	Prediction     models.Prediction
+	Scorer         string // Name of the scorer that produced Prediction
+	FallbackReason string // Why the primary scorer was bypassed, if it was
+}
+
+// Score returns the predicted maliciousness score
+func (r ScoreResult) Score() float64 {
+	return *r.Prediction.Score
+}
+
+// Scorer produces a maliciousness score from a user's features
+type Scorer interface {
+	// Name identifies the scorer in analysis responses and metrics
+	Name() string
+	// Score returns a validated prediction for the feature vector
+	Score(ctx context.Context, vector models.FeatureVector) (ScoreResult, error)
+}
+
+var (
+	_ Scorer = (*AIIntegrationService)(nil)
+	_ Scorer = (*HeuristicScorer)(nil)
+	_ Scorer = (*MLPScorer)(nil)
+	_ Scorer = (*FallbackScorer)(nil)
+)
+
+// HeuristicWeights configures HeuristicScorer. Counts are normalized by their
+// cap (and clamped to 1) before weighting; honeytoken triggers are normalized
+// by the total access count.
+type HeuristicWeights struct {
+	TotalAccess     float64
+	HoneytokenRatio float64
+	SharedIP        float64
+	AssociatedScore float64
+	TotalAccessCap  float64
+	SharedIPCap     float64
+}
+
+// DefaultHeuristicWeights mirrors the weighting used to label the training data
+func DefaultHeuristicWeights() HeuristicWeights {
+	return HeuristicWeights{
+		TotalAccess:     0.4,
+		HoneytokenRatio: 0.3,
+		SharedIP:        0.2,
+		AssociatedScore: 0.1,
+		TotalAccessCap:  100,
+		SharedIPCap:     10,
+	}
+}
+
+// HeuristicScorer scores users with a weighted sum of their normalized
+// features. It needs no model server, so it is the fallback of the AI model.
+type HeuristicScorer struct {
+	Weights HeuristicWeights
+}
+
+// NewHeuristicScorer creates a new HeuristicScorer
+func NewHeuristicScorer(weights HeuristicWeights) *HeuristicScorer {
+	return &HeuristicScorer{Weights: weights}
+}
+
+// Name identifies the heuristic scorer
+func (s *HeuristicScorer) Name() string {
+	return "heuristic"
+}
+
+// Score returns the weighted sum of the normalized features, clamped to [0, 1]
+func (s *HeuristicScorer) Score(ctx context.Context, vector models.FeatureVector) (ScoreResult, error) {
+	w := s.Weights
+	features := vector.UserFeatures
+	var honeytokenRatio float64
+	if features.TotalAccessCount > 0 {
+		honeytokenRatio = float64(features.HoneytokenAccessCount) / float64(features.TotalAccessCount)
+	}
+
+	score := w.TotalAccess*normalize(float64(features.TotalAccessCount), w.TotalAccessCap) +
+		w.HoneytokenRatio*math.Min(honeytokenRatio, 1) +
+		w.SharedIP*normalize(float64(features.SharedIPCount), w.SharedIPCap) +
+		w.AssociatedScore*features.AvgAssociatedMaliciousScore
+
+	score = math.Max(models.DefaultScoreMin, math.Min(models.DefaultScoreMax, score))
+	return ScoreResult{
+		Prediction: models.NewPrediction(score, s.Name(), HeuristicModelVersion),
+		Scorer:     s.Name(),
+	}, nil
+}
+
+// normalize scales value to [0, 1] by its cap
+func normalize(value, cap float64) float64 {
+	if cap <= 0 {
+		return 0
+	}
+	return math.Min(value/cap, 1)
+}
+
+// FallbackScorer uses Primary and switches to Fallback for any call Primary
+// fails, so detection degrades instead of stopping when the model is down
+type FallbackScorer struct {
+	Primary  Scorer
+	Fallback Scorer
+	Logger   *utils.Logger
+}
+
+// NewFallbackScorer creates a new FallbackScorer
+func NewFallbackScorer(primary, fallback Scorer, logger *utils.Logger) *FallbackScorer {
+	return &FallbackScorer{
+		Primary:  primary,
+		Fallback: fallback,
+		Logger:   logger,
+	}
+}
+
+// Name identifies the primary scorer
+func (s *FallbackScorer) Name() string {
+	return s.Primary.Name()
+}
+
+// Score scores with Primary, or with Fallback if Primary fails
+func (s *FallbackScorer) Score(ctx context.Context, vector models.FeatureVector) (ScoreResult, error) {
+	result, err := s.Primary.Score(ctx, vector)
+	if err == nil {
+		return result, nil
+	}
+
+	logger := s.Logger.WithContext(ctx)
+	logger.Warn("Primary scorer failed, using fallback", "primary", s.Primary.Name(), "fallback", s.Fallback.Name(), "error", err)
+	result, fallbackErr := s.Fallback.Score(ctx, vector)
+	if fallbackErr != nil {
+		return ScoreResult{}, fmt.Errorf("primary scorer failed: %v; fallback scorer failed: %v", err, fallbackErr)
+	}
+	result.FallbackReason = err.Error()
+	return result, nil
+}
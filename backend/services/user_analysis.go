@@ -1,75 +1,121 @@
 package services
 
 import (
+	"context"
 	"fmt"
+	"time"
 
+	"backend/models"
 	"backend/utils"
 )
 
+// DefaultModelVersion is recorded when the AI model does not report its version
+const DefaultModelVersion = "unversioned"
+
 // UserAnalysisService handles business logic for user analysis
 type UserAnalysisService struct {
-	Neo4jService         *Neo4jService
-	AIIntegrationService *AIIntegrationService
-	Logger               *utils.Logger
+	Store    GraphStore
+	Scorer   Scorer
+	Features *FeatureRegistry // Features that make up the vector sent to Scorer
+	Logger   *utils.Logger
 }
 
-// NewUserAnalysisService creates a new UserAnalysisService
-func NewUserAnalysisService(neo4jService *Neo4jService, aiService *AIIntegrationService, logger *utils.Logger) *UserAnalysisService {
+// NewUserAnalysisService creates a new UserAnalysisService with the default
+// feature registry. The scorer is usually the AI model, optionally wrapped in a FallbackScorer.
+func NewUserAnalysisService(store GraphStore, scorer Scorer, logger *utils.Logger) *UserAnalysisService {
 	return &UserAnalysisService{
-		Neo4jService:         neo4jService,
-		AIIntegrationService: aiService,
-		Logger:               logger,
+		Store:    store,
+		Scorer:   scorer,
+		Features: NewDefaultFeatureRegistry(models.DefaultFeatureWindows),
+		Logger:   logger,
 	}
 }
 
 // AnalyzeUser identifies and processes malicious users
-func (s *UserAnalysisService) AnalyzeUser(userID string) (map[string]interface{}, error) {
-	s.Logger.Info("Starting user analysis for user_id: " + userID)
+func (s *UserAnalysisService) AnalyzeUser(ctx context.Context, userID string) (models.AnalysisResult, error) {
+	logger := s.Logger.WithContext(ctx).With("user_id", userID)
+	logger.Info("Starting user analysis")
+
+	// Taken before reading, so the snapshot is older than any interaction
+	// the features miss
+	analyzedAt := time.Now()
+	features, err := s.Store.ExtractFeatures(ctx, userID)
+	if err != nil {
+		logger.Error("Failed to extract features", "error", err)
+		return models.AnalysisResult{}, fmt.Errorf("failed to analyze user: %w", err)
+	}
+	logger.Info("Extracted features", "features", features)
 
-	query := `
-	MATCH (u:User {user_id: $user_id})-[:HAS_INTERACTION]->(i:Interaction)
-	MATCH (u)-[:ASSOCIATED_WITH]->(p:User)
-	RETURN
-		COUNT(i) AS total_access_count,
-		SUM(CASE WHEN i.honeytoken_triggered THEN 1 ELSE 0 END) AS honeytoken_access_count,
-		COUNT(DISTINCT i.ip_address) AS shared_ip_count,
-		AVG(p.malicious_score) AS avg_associated_malicious_score
-	`
-	params := map[string]interface{}{"user_id": userID}
-	s.Logger.Debug("Executing Cypher query for user analysis", true)
+	vector, err := s.assembleFeatures(ctx, userID, features)
+	if err != nil {
+		logger.Error("Failed to assemble features", "error", err)
+		return models.AnalysisResult{}, fmt.Errorf("failed to analyze user: %v", err)
+	}
 
-	records, err := s.Neo4jService.RunQuery(query, params)
+	logger.Info("Scoring features", "scorer", s.Scorer.Name())
+	result, err := s.Scorer.Score(ctx, vector)
+	if err == nil {
+		err = result.Prediction.Validate()
+	}
 	if err != nil {
-		s.Logger.Error("Failed to run Cypher query: " + err.Error())
-		return nil, fmt.Errorf("failed to analyze user: %v", err)
+		logger.Error("Failed to score user", "error", err)
+		return models.AnalysisResult{}, fmt.Errorf("failed to predict user maliciousness: %v", err)
 	}
+	prediction := result.Prediction
+	logger.Info("Prediction result", "score", result.Score(), "scorer", result.Scorer, "model_version", prediction.ModelVersion)
 
-	if len(records) == 0 {
-		s.Logger.Info("No interactions found for user_id: " + userID)
-		return nil, fmt.Errorf("no interactions found for user_id: %s", userID)
+	snapshot := models.NewScoreSnapshot(userID, analyzedAt, result.Score(), prediction.ModelVersion, features)
+	if err := s.Store.RecordScore(ctx, snapshot); err != nil {
+		logger.Error("Failed to persist malicious score", "error", err)
+		return models.AnalysisResult{}, fmt.Errorf("failed to persist malicious score: %v", err)
 	}
 
-	record := records[0]
-	totalAccessCount, _ := record.Get("total_access_count")
-	honeytokenAccessCount, _ := record.Get("honeytoken_access_count")
-	sharedIPCount, _ := record.Get("shared_ip_count")
-	avgAssociatedMaliciousScore, _ := record.Get("avg_associated_malicious_score")
+	scoreMin, scoreMax := prediction.Bounds()
+	return models.AnalysisResult{
+		SchemaVersion:      models.PredictionSchemaVersion,
+		UserID:             userID,
+		MaliciousnessScore: result.Score(),
+		ScoreMin:           scoreMin,
+		ScoreMax:           scoreMax,
+		ModelName:          prediction.ModelName,
+		ModelVersion:       prediction.ModelVersion,
+		Scorer:             result.Scorer,
+		FallbackReason:     result.FallbackReason,
+		Features:           vector.Values,
+		AnalyzedAt:         snapshot.Timestamp,
+	}, nil
+}
 
-	features := map[string]interface{}{
-		"total_access_count":             totalAccessCount.(int64),
-		"honeytoken_access_count":        honeytokenAccessCount.(int64),
-		"shared_ip_count":                sharedIPCount.(int64),
-		"avg_associated_malicious_score": avgAssociatedMaliciousScore.(float64),
+// assembleFeatures computes the enabled features from the extracted aggregates,
+// loading recent interactions only if an enabled feature reads them
+func (s *UserAnalysisService) assembleFeatures(ctx context.Context, userID string, aggregates models.UserFeatures) (models.FeatureVector, error) {
+	data := FeatureData{UserID: userID, Aggregates: aggregates, Now: time.Now()}
+	if s.Features.NeedsInteractions() {
+		interactions, err := s.Store.GetInteractions(ctx, userID, data.Now.Add(-s.Features.Lookback))
+		if err != nil {
+			return models.FeatureVector{}, fmt.Errorf("failed to load interactions: %v", err)
+		}
+		data.Interactions = interactions
 	}
-	s.Logger.Info(fmt.Sprintf("Extracted features for user_id %s: %+v", userID, features))
 
-	s.Logger.Info("Sending features to AI model for prediction")
-	prediction, err := s.AIIntegrationService.PredictMaliciousness(features)
+	values, err := s.Features.Assemble(data)
 	if err != nil {
-		s.Logger.Error("Failed to get prediction from AI model: " + err.Error())
-		return nil, fmt.Errorf("failed to predict user maliciousness: %v", err)
+		return models.FeatureVector{}, err
 	}
+	vector := models.NewFeatureVector(aggregates)
+	vector.Values = values
+	return vector, nil
+}
 
-	s.Logger.Info(fmt.Sprintf("Prediction result for user_id %s: %+v", userID, prediction))
-	return prediction, nil
+// ScoreHistory returns the recorded scoring events of a user, oldest first
+func (s *UserAnalysisService) ScoreHistory(ctx context.Context, userID string) ([]models.ScoreSnapshot, error) {
+	logger := s.Logger.WithContext(ctx).With("user_id", userID)
+	logger.Info("Fetching score history")
+
+	history, err := s.Store.GetScoreHistory(ctx, userID)
+	if err != nil {
+		logger.Error("Failed to fetch score history", "error", err)
+		return nil, fmt.Errorf("failed to fetch score history: %v", err)
+	}
+	return history, nil
 }
@@ -0,0 +1,209 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"backend/models"
+)
+
+// WriteAheadLog is an append-only file of interactions that could not be
+// written to the store. Each line holds one JSON encoded interaction. Replay
+// moves the log aside before reading it, so appends continue on a new log
+// while the old one is written to the store.
+type WriteAheadLog struct {
+	Path string
+	mu   sync.Mutex
+}
+
+// NewWriteAheadLog opens the log at path, creating its directory if needed.
+// A torn final line left by a crash in the middle of Append is cut off, so
+// later appends start on a line of their own.
+func NewWriteAheadLog(path string) (*WriteAheadLog, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create WAL directory: %v", err)
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open WAL: %v", err)
+	}
+	defer file.Close()
+	if err := trimTornLine(file); err != nil {
+		return nil, fmt.Errorf("failed to repair WAL: %v", err)
+	}
+	return &WriteAheadLog{Path: path}, nil
+}
+
+// trimTornLine truncates file after its last newline
+func trimTornLine(file *os.File) error {
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	buf := make([]byte, 4096)
+	for offset := info.Size(); offset > 0; {
+		n := min(int64(len(buf)), offset)
+		offset -= n
+		if _, err := file.ReadAt(buf[:n], offset); err != nil {
+			return err
+		}
+		if i := bytes.LastIndexByte(buf[:n], '\n'); i >= 0 {
+			if end := offset + int64(i) + 1; end < info.Size() {
+				return file.Truncate(end)
+			}
+			return nil
+		}
+	}
+	return file.Truncate(0)
+}
+
+// replayPath returns the file the log is moved to while it is replayed
+func (l *WriteAheadLog) replayPath() string {
+	return l.Path + ".replay"
+}
+
+// Append durably appends interactions to the log. On failure the log is
+// truncated to its previous size, so it never ends in a partial entry.
+func (l *WriteAheadLog) Append(interactions []models.Interaction) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	file, err := os.OpenFile(l.Path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open WAL: %v", err)
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat WAL: %v", err)
+	}
+
+	writer := bufio.NewWriter(file)
+	encoder := json.NewEncoder(writer)
+	for _, interaction := range interactions {
+		if err := encoder.Encode(interaction); err != nil {
+			file.Truncate(info.Size())
+			return fmt.Errorf("failed to encode WAL entry: %v", err)
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		file.Truncate(info.Size())
+		return fmt.Errorf("failed to write WAL: %v", err)
+	}
+	return file.Sync()
+}
+
+// Replay passes the interactions in the log to write in batches of at most
+// batchSize. The log is moved aside under the lock and read without it, so
+// Append is not blocked while the batches are written. When a batch fails
+// the moved log is kept, and the next Replay starts over from it before
+// moving the log again; the interactions already written are written again,
+// which their IDs make harmless. A line that cannot be decoded is an error,
+// except for a torn final line left by a crash in the middle of Append.
+func (l *WriteAheadLog) Replay(batchSize int, write func([]models.Interaction) error) (int, error) {
+	if batchSize <= 0 {
+		batchSize = DefaultBatchSize
+	}
+	if err := l.moveForReplay(); err != nil {
+		return 0, err
+	}
+
+	file, err := os.Open(l.replayPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to open WAL: %v", err)
+	}
+	defer file.Close()
+
+	written := 0
+	var batch []models.Interaction
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := write(batch); err != nil {
+			return err
+		}
+		written += len(batch)
+		batch = nil
+		return nil
+	}
+
+	reader := bufio.NewReader(file)
+	for lineNumber := 1; ; lineNumber++ {
+		line, readErr := reader.ReadBytes('\n')
+		if readErr != nil && !errors.Is(readErr, io.EOF) {
+			return written, fmt.Errorf("failed to read WAL: %v", readErr)
+		}
+		if len(bytes.TrimSpace(line)) > 0 {
+			var interaction models.Interaction
+			if err := json.Unmarshal(line, &interaction); err == nil {
+				batch = append(batch, interaction)
+			} else if readErr == nil {
+				// Only the final line, which has no newline, can be torn
+				return written, fmt.Errorf("invalid WAL entry on line %d: %v", lineNumber, err)
+			}
+			if len(batch) >= batchSize {
+				if err := flush(); err != nil {
+					return written, err
+				}
+			}
+		}
+		if readErr != nil {
+			break
+		}
+	}
+	if err := flush(); err != nil {
+		return written, err
+	}
+	if err := os.Remove(l.replayPath()); err != nil {
+		return written, fmt.Errorf("failed to remove replayed WAL: %v", err)
+	}
+	return written, nil
+}
+
+// moveForReplay moves a non-empty log to replayPath, unless a failed replay
+// left a log there that must be finished first
+func (l *WriteAheadLog) moveForReplay() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if _, err := os.Stat(l.replayPath()); err == nil {
+		return nil
+	}
+	info, err := os.Stat(l.Path)
+	if errors.Is(err, os.ErrNotExist) || (err == nil && info.Size() == 0) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to stat WAL: %v", err)
+	}
+	if err := os.Rename(l.Path, l.replayPath()); err != nil {
+		return fmt.Errorf("failed to move WAL for replay: %v", err)
+	}
+	return nil
+}
+
+// Size returns the size in bytes of the log and of any log left by a
+// failed replay
+func (l *WriteAheadLog) Size() int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var size int64
+	for _, path := range []string{l.Path, l.replayPath()} {
+		if info, err := os.Stat(path); err == nil {
+			size += info.Size()
+		}
+	}
+	return size
+}
@@ -0,0 +1,324 @@
+package test
+
+import (
+	"backend/models"
+	"backend/services"
+	"backend/utils"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testAIClientOptions keeps retries and cooldowns short
+func testAIClientOptions() services.AIClientOptions {
+	options := services.DefaultAIClientOptions()
+	options.Timeout = 200 * time.Millisecond
+	options.BaseBackoff = time.Millisecond
+	options.MaxBackoff = 5 * time.Millisecond
+	options.BreakerThreshold = 2
+	options.BreakerCooldown = 50 * time.Millisecond
+	return options
+}
+
+func TestAIClientRetriesServerErrors(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) < 3 {
+			w.Header().Set("Content-Type", "text/html")
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte("<html>Internal Server Error</html>"))
+			return
+		}
+		w.Write([]byte(`{"schema_version": 1, "maliciousness_score": 0.5, "model_name": "mlp_regressor", "model_version": "v1"}`))
+	}))
+	defer server.Close()
+
+	service := services.NewAIIntegrationServiceWithOptions(server.URL, testAIClientOptions(), utils.NewLogger())
+	result, err := service.PredictMaliciousness(context.Background(), models.NewFeatureVector(models.UserFeatures{}))
+	if err != nil {
+		t.Fatalf("Expected the third attempt to succeed, got %v", err)
+	}
+	if *result.Score != 0.5 || result.ModelVersion != "v1" || calls.Load() != 3 {
+		t.Errorf("Expected a score after 3 calls, got %+v after %d calls", result, calls.Load())
+	}
+}
+
+func TestAIClientStatusErrors(t *testing.T) {
+	var calls atomic.Int32
+	status := http.StatusInternalServerError
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(status)
+		w.Write([]byte("<html>Boom</html>"))
+	}))
+	defer server.Close()
+
+	options := testAIClientOptions()
+	options.BreakerThreshold = 100
+	service := services.NewAIIntegrationServiceWithOptions(server.URL, options, utils.NewLogger())
+
+	_, err := service.PredictMaliciousness(context.Background(), models.NewFeatureVector(models.UserFeatures{}))
+	var statusErr *services.ModelStatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != 500 || statusErr.Body != "<html>Boom</html>" {
+		t.Fatalf("Expected a ModelStatusError with the response body, got %v", err)
+	}
+	if calls.Load() != int32(options.MaxRetries+1) {
+		t.Errorf("Expected %d attempts, got %d", options.MaxRetries+1, calls.Load())
+	}
+
+	// Client errors are not retried
+	calls.Store(0)
+	status = http.StatusBadRequest
+	if _, err := service.PredictMaliciousness(context.Background(), models.NewFeatureVector(models.UserFeatures{})); err == nil {
+		t.Fatal("Expected an error for a 400 response")
+	}
+	if calls.Load() != 1 {
+		t.Errorf("Expected a 400 response not to be retried, got %d attempts", calls.Load())
+	}
+}
+
+func TestAIClientClientErrorsKeepBreakerState(t *testing.T) {
+	var status atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(int(status.Load()))
+	}))
+	defer server.Close()
+
+	options := testAIClientOptions()
+	options.MaxRetries = 0
+	service := services.NewAIIntegrationServiceWithOptions(server.URL, options, utils.NewLogger())
+	predict := func(code int) error {
+		status.Store(int32(code))
+		_, err := service.PredictMaliciousness(context.Background(), models.NewFeatureVector(models.UserFeatures{}))
+		return err
+	}
+
+	// A rejected request between two server errors does not reset the count
+	predict(http.StatusInternalServerError)
+	predict(http.StatusBadRequest)
+	predict(http.StatusInternalServerError)
+	if service.Breaker.State() != services.CircuitOpen {
+		t.Fatalf("Expected the circuit to open, got %s", service.Breaker.State())
+	}
+
+	// A rejected trial call does not close the circuit
+	time.Sleep(options.BreakerCooldown)
+	if err := predict(http.StatusBadRequest); err == nil || errors.Is(err, services.ErrCircuitOpen) {
+		t.Fatalf("Expected the trial call to be attempted and rejected, got %v", err)
+	}
+	if service.Breaker.State() != services.CircuitHalfOpen {
+		t.Errorf("Expected the circuit to stay half-open, got %s", service.Breaker.State())
+	}
+}
+
+func TestAIClientTimeout(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	options := testAIClientOptions()
+	options.Timeout = 20 * time.Millisecond
+	options.MaxRetries = 1
+	service := services.NewAIIntegrationServiceWithOptions(server.URL, options, utils.NewLogger())
+
+	start := time.Now()
+	if _, err := service.PredictMaliciousness(context.Background(), models.NewFeatureVector(models.UserFeatures{})); err == nil {
+		t.Fatal("Expected a hung model server to time out")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected the call to give up quickly, took %v", elapsed)
+	}
+}
+
+func TestAIClientCircuitBreaker(t *testing.T) {
+	var calls atomic.Int32
+	var healthy atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if !healthy.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"schema_version": 1, "maliciousness_score": 0.1}`))
+	}))
+	defer server.Close()
+
+	options := testAIClientOptions()
+	options.MaxRetries = 0
+	service := services.NewAIIntegrationServiceWithOptions(server.URL, options, utils.NewLogger())
+	ctx := context.Background()
+
+	for i := 0; i < options.BreakerThreshold; i++ {
+		service.PredictMaliciousness(ctx, models.NewFeatureVector(models.UserFeatures{}))
+	}
+	if service.Breaker.State() != services.CircuitOpen {
+		t.Fatalf("Expected the circuit to open, got %s", service.Breaker.State())
+	}
+
+	_, err := service.PredictMaliciousness(ctx, models.NewFeatureVector(models.UserFeatures{}))
+	if !errors.Is(err, services.ErrCircuitOpen) {
+		t.Errorf("Expected ErrCircuitOpen, got %v", err)
+	}
+	if calls.Load() != int32(options.BreakerThreshold) {
+		t.Errorf("Expected an open circuit not to call the model, got %d calls", calls.Load())
+	}
+
+	// After the cooldown a successful trial call closes the circuit
+	healthy.Store(true)
+	time.Sleep(options.BreakerCooldown)
+	if _, err := service.PredictMaliciousness(ctx, models.NewFeatureVector(models.UserFeatures{})); err != nil {
+		t.Fatalf("Expected the trial call to succeed, got %v", err)
+	}
+	if service.Breaker.State() != services.CircuitClosed {
+		t.Errorf("Expected the circuit to close, got %s", service.Breaker.State())
+	}
+}
+
+func TestAIClientCanceledCalls(t *testing.T) {
+	var healthy atomic.Bool
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !healthy.Load() {
+			select {
+			case <-release:
+			case <-r.Context().Done():
+			}
+			return
+		}
+		w.Write([]byte(`{"schema_version": 1, "maliciousness_score": 0.1}`))
+	}))
+	defer server.Close()
+	defer close(release)
+
+	options := testAIClientOptions()
+	options.Timeout = time.Second
+	service := services.NewAIIntegrationServiceWithOptions(server.URL, options, utils.NewLogger())
+	predict := func() error {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		_, err := service.PredictMaliciousness(ctx, models.NewFeatureVector(models.UserFeatures{}))
+		return err
+	}
+
+	// Callers giving up say nothing about the model server
+	for i := 0; i < options.BreakerThreshold+1; i++ {
+		if err := predict(); err == nil {
+			t.Fatal("Expected a canceled call to fail")
+		}
+	}
+	if service.Breaker.State() != services.CircuitClosed {
+		t.Fatalf("Expected canceled calls not to open the circuit, got %s", service.Breaker.State())
+	}
+
+	// A canceled trial call leaves the circuit half-open for the next caller
+	for i := 0; i < options.BreakerThreshold; i++ {
+		service.Breaker.Failure()
+	}
+	time.Sleep(options.BreakerCooldown)
+	if err := predict(); err == nil || errors.Is(err, services.ErrCircuitOpen) {
+		t.Fatalf("Expected the trial call to be attempted and canceled, got %v", err)
+	}
+	healthy.Store(true)
+	if err := predict(); err != nil {
+		t.Fatalf("Expected the next call to be the trial, got %v", err)
+	}
+	if service.Breaker.State() != services.CircuitClosed {
+		t.Errorf("Expected the circuit to close, got %s", service.Breaker.State())
+	}
+}
+
+func TestAIClientRejectsInvalidPredictions(t *testing.T) {
+	tests := []struct {
+		name     string
+		response string
+	}{
+		{"MissingScore", `{"schema_version": 1, "model_version": "v1"}`},
+		{"NaNScore", `{"schema_version": 1, "maliciousness_score": NaN}`},
+		{"OutOfRange", `{"schema_version": 1, "maliciousness_score": 1.5}`},
+		{"OutOfCustomRange", `{"schema_version": 1, "maliciousness_score": 0.5, "score_min": 0.6, "score_max": 1}`},
+		{"StringScore", `{"schema_version": 1, "maliciousness_score": "0.5"}`},
+		{"WrongSchemaVersion", `{"schema_version": 2, "maliciousness_score": 0.5}`},
+		{"LegacyResponse", `{"maliciousness_score": 0.5}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(tt.response))
+			}))
+			defer server.Close()
+
+			options := testAIClientOptions()
+			options.MaxRetries = 0
+			service := services.NewAIIntegrationServiceWithOptions(server.URL, options, utils.NewLogger())
+			if prediction, err := service.PredictMaliciousness(context.Background(), models.NewFeatureVector(models.UserFeatures{})); err == nil {
+				t.Errorf("Expected %s to be rejected, got %+v", tt.response, prediction)
+			}
+		})
+	}
+}
+
+func TestAIClientSendsFeatureVector(t *testing.T) {
+	var request map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&request)
+		w.Write([]byte(`{"schema_version": 1, "maliciousness_score": 0.2}`))
+	}))
+	defer server.Close()
+
+	service := services.NewAIIntegrationServiceWithOptions(server.URL, testAIClientOptions(), utils.NewLogger())
+	features := models.UserFeatures{TotalAccessCount: 3, HoneytokenAccessCount: 1, SharedIPCount: 2, AvgAssociatedMaliciousScore: 0.4}
+	features.SetWindows([]models.WindowFeatures{{Name: "1h", Window: models.FeatureWindow(time.Hour), Interactions: 2, ErrorResponses: 1}})
+	if _, err := service.PredictMaliciousness(context.Background(), models.NewFeatureVector(features)); err != nil {
+		t.Fatalf("Failed to get prediction: %v", err)
+	}
+
+	expected := map[string]interface{}{
+		"schema_version":                 float64(models.PredictionSchemaVersion),
+		"feature_set_version":            float64(models.FeatureSetVersion),
+		"total_access_count":             float64(3),
+		"honeytoken_access_count":        float64(1),
+		"weighted_honeytoken_score":      float64(0),
+		"shared_ip_count":                float64(2),
+		"avg_associated_malicious_score": 0.4,
+		"propagated_risk":                float64(0),
+		"ips_shared_with_others":         float64(0),
+		"users_sharing_ips":              float64(0),
+		"subnets_shared_with_others":     float64(0),
+		"distinct_countries":             float64(0),
+		"hosting_traffic_ratio":          float64(0),
+		"reputation_traffic_ratio":       float64(0),
+		"interactions_1h":                float64(2),
+		"honeytoken_hits_1h":             float64(0),
+		"distinct_ips_1h":                float64(0),
+		"error_responses_1h":             float64(1),
+		"interaction_velocity":           float64(0),
+		"interaction_acceleration":       float64(0),
+		"honeytoken_velocity":            float64(0),
+		"honeytoken_acceleration":        float64(0),
+	}
+	// feature_windows is a list and is checked separately
+	if windows, ok := request["feature_windows"].([]interface{}); !ok || len(windows) != 1 || windows[0] != "1h" {
+		t.Errorf("Expected feature_windows [1h], got %v", request["feature_windows"])
+	}
+	delete(request, "feature_windows")
+	if len(request) != len(expected) {
+		t.Errorf("Expected request fields %v, got %v", expected, request)
+	}
+	for key, value := range expected {
+		if request[key] != value {
+			t.Errorf("Expected %s to be %v, got %v", key, value, request[key])
+		}
+	}
+}
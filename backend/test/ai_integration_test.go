@@ -1,8 +1,11 @@
 package test
 
 import (
+	"backend/config"
+	"backend/models"
 	"backend/services"
 	"backend/utils"
+	"context"
 	"fmt"
 	"testing"
 )
@@ -10,25 +13,30 @@ import (
 // TestPredictMaliciousness_RealServer calls the actual Flask AI model
 // and prints the predicted maliciousness score.
 func TestPredictMaliciousness_RealServer(t *testing.T) {
+	ctx := context.Background()
 	// Initialize the logger
 	logger := utils.NewLogger()
 
-	// Use the actual Flask server running on localhost:5000
-	flaskServerURL := "http://127.0.0.1:5000"
+	// Use the actual Flask server from the configuration (MUDS_AI_MODEL_URL)
+	cfg, err := config.Load([]string{"-store", "memory"})
+	if err != nil {
+		t.Fatalf("Failed to load configuration: %v", err)
+	}
+	flaskServerURL := cfg.AI.ModelURL
 
 	// Instantiate the AIIntegrationService with the real Flask server URL
 	service := services.NewAIIntegrationService(flaskServerURL, logger)
 
 	// Define sample input data
-	inputData := map[string]interface{}{
-		"total_access_count":             2,
-		"honeytoken_access_count":        2,
-		"shared_ip_count":                4,
-		"avg_associated_malicious_score": 0.858166666666667,
-	}
+	inputData := models.NewFeatureVector(models.UserFeatures{
+		TotalAccessCount:            2,
+		HoneytokenAccessCount:       2,
+		SharedIPCount:               4,
+		AvgAssociatedMaliciousScore: 0.858166666666667,
+	})
 
 	// Call PredictMaliciousness
-	result, err := service.PredictMaliciousness(inputData)
+	result, err := service.PredictMaliciousness(ctx, inputData)
 	if err != nil {
 		t.Fatalf("Failed to get prediction from Flask server: %v", err)
 	}
@@ -36,10 +44,6 @@ func TestPredictMaliciousness_RealServer(t *testing.T) {
 	// Print the raw response
 	fmt.Println("AI Model Response:", result)
 
-	// Print maliciousness score if available
-	if score, exists := result["maliciousness_score"]; exists {
-		fmt.Println("Predicted Maliciousness Score:", score)
-	} else {
-		fmt.Println("No maliciousness_score key found in response")
-	}
+	// Print maliciousness score
+	fmt.Println("Predicted Maliciousness Score:", *result.Score)
 }
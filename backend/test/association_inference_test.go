@@ -0,0 +1,253 @@
+package test
+
+import (
+	"backend/handlers"
+	"backend/models"
+	"backend/services"
+	"backend/utils"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// interactionAt returns an interaction of a user at base plus offset
+func interactionAt(userID, endpoint, ip string, base time.Time, offset time.Duration) models.Interaction {
+	interaction := models.NewInteraction(userID, endpoint, 200, false, ip)
+	interaction.Timestamp = base.Add(offset)
+	return interaction
+}
+
+func TestInferAssociations(t *testing.T) {
+	now := time.Now()
+	base := now.Add(-time.Hour)
+	options := services.DefaultAssociationOptions()
+
+	t.Run("SharedIP", func(t *testing.T) {
+		interactions := []models.Interaction{
+			interactionAt("alice", "/a", "10.0.0.1", base, 0),
+			interactionAt("bob", "/a", "10.0.0.1", base, 3*time.Minute),
+			interactionAt("alice", "/a", "10.0.0.2", base, 0),
+			interactionAt("bob", "/a", "10.0.0.2", base, 30*time.Second),
+			// Too far apart
+			interactionAt("carol", "/a", "10.0.0.1", base, 40*time.Minute),
+		}
+		// A gateway shared by more users than max_users
+		for i := 0; i <= options.SharedIP.MaxUsers; i++ {
+			interactions = append(interactions, interactionAt(fmt.Sprintf("office_%d", i), "/a", "10.0.0.9", base, 0))
+		}
+		interactions = append(interactions, interactionAt("carol", "/a", "10.0.0.9", base, 0))
+
+		associations := services.InferAssociations(services.NewAssociationEvidence(interactions, options), options, now)
+		if len(associations) != 1 {
+			t.Fatalf("Expected only alice and bob to be associated, got %+v", associations)
+		}
+		association := associations[0]
+		if association.UserID != "alice" || association.AssociateID != "bob" || association.Type != models.AssociationSharedIP {
+			t.Errorf("Unexpected association: %+v", association)
+		}
+		// Two shared IPs at 0.5 each
+		if association.Weight != 2 || math.Abs(association.Confidence-0.75) > 1e-9 || len(association.Evidence) != 2 {
+			t.Errorf("Expected 2 observations with confidence 0.75, got %+v", association)
+		}
+		if association.Evidence[0] != "used 10.0.0.1 3m0s apart" && association.Evidence[1] != "used 10.0.0.1 3m0s apart" {
+			t.Errorf("Expected the gap to be recorded as evidence, got %v", association.Evidence)
+		}
+		if association.InferredAt == nil || !association.InferredAt.Equal(now) {
+			t.Errorf("Expected inferred_at to be set, got %v", association.InferredAt)
+		}
+	})
+
+	t.Run("SharedHoneytoken", func(t *testing.T) {
+		var interactions []models.Interaction
+		for _, userID := range []string{"mallory", "trudy"} {
+			for _, tokenID := range []string{"ht_1", "ht_2"} {
+				interaction := interactionAt(userID, "/admin", "", base, 0)
+				interaction.HoneytokenTriggered = true
+				interaction.HoneytokenID = tokenID
+				interactions = append(interactions, interaction)
+			}
+		}
+		associations := services.InferAssociations(services.NewAssociationEvidence(interactions, options), options, now)
+		if len(associations) != 1 || associations[0].Type != models.AssociationSharedHoneytoken {
+			t.Fatalf("Expected a shared honeytoken association, got %+v", associations)
+		}
+		if math.Abs(associations[0].Confidence-0.99) > 1e-9 {
+			t.Errorf("Expected two shared honeytokens to give confidence 0.99, got %f", associations[0].Confidence)
+		}
+	})
+
+	t.Run("SimilarEndpoints", func(t *testing.T) {
+		var interactions []models.Interaction
+		for i := 0; i < 10; i++ {
+			endpoint := fmt.Sprintf("/api/step_%d", i)
+			interactions = append(interactions,
+				interactionAt("bot_1", endpoint, "", base, time.Duration(i)*time.Second),
+				interactionAt("bot_2", endpoint, "", base, time.Duration(i)*time.Second),
+				interactionAt("human", fmt.Sprintf("/browse/%d", i%3), "", base, time.Duration(i)*time.Second))
+		}
+		// bot_3 deviates in 1 of 10 steps
+		for i := 0; i < 10; i++ {
+			endpoint := fmt.Sprintf("/api/step_%d", i)
+			if i == 5 {
+				endpoint = "/api/detour"
+			}
+			interactions = append(interactions, interactionAt("bot_3", endpoint, "", base, time.Duration(i)*time.Second))
+		}
+
+		associations := services.InferAssociations(services.NewAssociationEvidence(interactions, options), options, now)
+		confidences := make(map[string]float64)
+		for _, association := range associations {
+			if association.Type != models.AssociationSimilarEndpoints {
+				t.Errorf("Unexpected association type: %+v", association)
+			}
+			confidences[association.UserID+"-"+association.AssociateID] = association.Confidence
+		}
+		expected := map[string]float64{"bot_1-bot_2": 0.7, "bot_1-bot_3": 0.63, "bot_2-bot_3": 0.63}
+		if len(confidences) != len(expected) {
+			t.Fatalf("Expected the bots to be associated with each other only, got %+v", associations)
+		}
+		for pair, confidence := range expected {
+			if math.Abs(confidences[pair]-confidence) > 1e-9 {
+				t.Errorf("Expected %s to have confidence %f, got %f", pair, confidence, confidences[pair])
+			}
+		}
+	})
+
+	t.Run("SimilarEndpointsAtScale", func(t *testing.T) {
+		// Many unrelated users are only compared when they share a MinHash
+		// bucket; the two bots still are
+		random := rand.New(rand.NewSource(1))
+		var interactions []models.Interaction
+		for user := 0; user < 500; user++ {
+			for i := 0; i < 20; i++ {
+				endpoint := fmt.Sprintf("/page/%d", random.Intn(1000))
+				interactions = append(interactions, interactionAt(fmt.Sprintf("user_%d", user), endpoint, "", base, time.Duration(i)*time.Second))
+			}
+		}
+		for i := 0; i < 20; i++ {
+			endpoint := fmt.Sprintf("/api/step_%d", i)
+			interactions = append(interactions, interactionAt("bot_1", endpoint, "", base, time.Duration(i)*time.Second))
+			if i == 7 {
+				endpoint = "/api/detour"
+			}
+			interactions = append(interactions, interactionAt("bot_2", endpoint, "", base, time.Duration(i)*time.Second))
+		}
+
+		associations := services.InferAssociations(services.NewAssociationEvidence(interactions, options), options, now)
+		if len(associations) != 1 || associations[0].UserID != "bot_1" || associations[0].AssociateID != "bot_2" {
+			t.Errorf("Expected only the bots to be associated, got %+v", associations)
+		}
+	})
+
+	t.Run("SimilarEndpointsMaxUsers", func(t *testing.T) {
+		// Every client polling the same endpoint shares a bucket that is too large
+		options := options
+		options.SimilarEndpoints.MaxUsers = 3
+		var interactions []models.Interaction
+		for user := 0; user < 4; user++ {
+			for i := 0; i < 10; i++ {
+				interactions = append(interactions, interactionAt(fmt.Sprintf("poller_%d", user), "/status", "", base, time.Duration(i)*time.Second))
+			}
+		}
+		if associations := services.InferAssociations(services.NewAssociationEvidence(interactions, options), options, now); len(associations) != 0 {
+			t.Errorf("Expected buckets of more than max_users users to be ignored, got %+v", associations)
+		}
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		options := options
+		options.SharedIP.Enabled = false
+		interactions := []models.Interaction{
+			interactionAt("alice", "/a", "10.0.0.1", base, 0),
+			interactionAt("bob", "/a", "10.0.0.1", base, 0),
+		}
+		if associations := services.InferAssociations(services.NewAssociationEvidence(interactions, options), options, now); len(associations) != 0 {
+			t.Errorf("Expected a disabled rule to infer nothing, got %+v", associations)
+		}
+	})
+}
+
+func TestAssociationInferenceJob(t *testing.T) {
+	ctx := context.Background()
+	logger := utils.NewLogger()
+	store := services.NewMemoryStore(logger)
+	store.SaveInteraction(ctx, models.NewInteraction("alice", "/a", 200, false, "10.0.0.1"))
+	store.SaveInteraction(ctx, models.NewInteraction("bob", "/a", 200, false, "10.0.0.1"))
+	store.SaveInteraction(ctx, models.NewInteraction("carol", "/a", 200, false, "10.0.0.2"))
+	store.UpdateMaliciousScore(ctx, "bob", 0.8)
+	store.AssociatedWith(ctx, "alice", "carol")
+
+	job := services.NewAssociationInferenceJob(store, services.DefaultAssociationOptions(), logger)
+	for run := 0; run < 2; run++ {
+		result, err := job.Run(ctx)
+		if err != nil {
+			t.Fatalf("Failed to infer associations: %v", err)
+		}
+		if result.Associations != 1 || result.ByType[models.AssociationSharedIP] != 1 {
+			t.Errorf("Unexpected result: %+v", result)
+		}
+	}
+
+	// Re-running replaces the inferred association instead of adding another
+	associations, _ := store.GetAssociations(ctx, "alice")
+	if len(associations) != 2 {
+		t.Fatalf("Expected an explicit and an inferred association, got %+v", associations)
+	}
+	if associations[0].AssociateID != "bob" || associations[0].Type != models.AssociationSharedIP || associations[0].Weight != 1 {
+		t.Errorf("Unexpected inferred association: %+v", associations[0])
+	}
+	if associations[1].AssociateID != "carol" || associations[1].Type != models.AssociationExplicit || associations[1].Confidence != 1 {
+		t.Errorf("Unexpected explicit association: %+v", associations[1])
+	}
+	if reverse, _ := store.GetAssociations(ctx, "bob"); len(reverse) != 1 || reverse[0].AssociateID != "alice" {
+		t.Errorf("Expected the association in both directions, got %+v", reverse)
+	}
+
+	// Inferred associates count like explicit ones, weighted by confidence:
+	// bob's 0.8 at 0.5 and carol's 0 at 1
+	features, _ := store.ExtractFeatures(ctx, "alice")
+	if math.Abs(features.AvgAssociatedMaliciousScore-0.4/1.5) > 1e-9 {
+		t.Errorf("Expected the weighted average over bob and carol, got %f", features.AvgAssociatedMaliciousScore)
+	}
+	graph, _ := store.ExportUserGraph(ctx)
+	if len(graph.Edges) != 2 || graph.Edges[0].Weight != 0.5 || graph.Edges[1].Weight != 1 {
+		t.Errorf("Expected inferred edges weighted by confidence in the exported graph, got %+v", graph.Edges)
+	}
+
+	handler := handlers.NewInteractionHandler(store, nil, logger)
+	rec := httptest.NewRecorder()
+	handler.ListAssociations(rec, httptest.NewRequest(http.MethodGet, "/api/associations?user_id=bob", nil))
+	var response []models.Association
+	if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to decode associations: %v", err)
+	}
+	if rec.Code != http.StatusOK || len(response) != 1 || len(response[0].Evidence) != 1 {
+		t.Errorf("Unexpected response %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ListAssociations(rec, httptest.NewRequest(http.MethodGet, "/api/associations", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 without user_id, got %d", rec.Code)
+	}
+
+	// Disabling the rule removes its edges on the next run, but not explicit ones
+	options := services.DefaultAssociationOptions()
+	options.SharedIP.Enabled = false
+	result, err := services.NewAssociationInferenceJob(store, options, logger).Run(ctx)
+	if err != nil {
+		t.Fatalf("Failed to infer associations: %v", err)
+	}
+	if result.Associations != 0 || result.Pruned != 2 {
+		t.Errorf("Expected both directions of the shared IP edge to be pruned, got %+v", result)
+	}
+	if associations, _ := store.GetAssociations(ctx, "alice"); len(associations) != 1 || associations[0].Type != models.AssociationExplicit {
+		t.Errorf("Expected only the explicit association to remain, got %+v", associations)
+	}
+}
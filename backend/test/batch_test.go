@@ -0,0 +1,191 @@
+package test
+
+import (
+	"backend/handlers"
+	"backend/models"
+	"backend/services"
+	"backend/utils"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// countingStore records the size of every batch written to the MemoryStore
+type countingStore struct {
+	*services.MemoryStore
+	mu      sync.Mutex
+	batches []int
+}
+
+func (s *countingStore) SaveInteractions(ctx context.Context, interactions []models.Interaction) error {
+	s.mu.Lock()
+	s.batches = append(s.batches, len(interactions))
+	s.mu.Unlock()
+	return s.MemoryStore.SaveInteractions(ctx, interactions)
+}
+
+func TestBatchWriterChunksBySize(t *testing.T) {
+	ctx := context.Background()
+	logger := utils.NewLogger()
+	store := &countingStore{MemoryStore: services.NewMemoryStore(logger)}
+	writer := services.NewBatchWriter(store, 2, time.Hour, logger)
+	defer writer.Close()
+
+	interactions := make([]models.Interaction, 5)
+	for i := range interactions {
+		interactions[i] = models.NewInteraction("bulk_user", "/api/test", 200, false, "1.1.1.1")
+	}
+
+	if err := writer.Submit(interactions); err != nil {
+		t.Fatalf("Failed to submit batch: %v", err)
+	}
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if len(store.batches) != 3 || store.batches[0] != 2 || store.batches[2] != 1 {
+		t.Errorf("Expected batches of [2 2 1], got %v", store.batches)
+	}
+	features, _ := store.ExtractFeatures(ctx, "bulk_user")
+	if features.TotalAccessCount != 5 {
+		t.Errorf("Expected 5 stored interactions, got %d", features.TotalAccessCount)
+	}
+}
+
+func TestBatchWriterFlushesOnInterval(t *testing.T) {
+	logger := utils.NewLogger()
+	store := services.NewMemoryStore(logger)
+	writer := services.NewBatchWriter(store, 1000, 10*time.Millisecond, logger)
+	defer writer.Close()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- writer.Submit([]models.Interaction{models.NewInteraction("slow_user", "/", 200, false, "1.1.1.1")})
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Failed to submit batch: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected a partial batch to be flushed by the flush interval")
+	}
+}
+
+func TestBatchWriterRetriesAreIdempotent(t *testing.T) {
+	ctx := context.Background()
+	logger := utils.NewLogger()
+	store := services.NewMemoryStore(logger)
+	writer := services.NewBatchWriter(store, 2, time.Hour, logger)
+	defer writer.Close()
+
+	interactions := make([]models.Interaction, 3)
+	for i := range interactions {
+		interactions[i] = models.NewInteraction("retried_user", "/api/test", 200, false, "1.1.1.1")
+		interactions[i].ID = models.NewInteractionID()
+	}
+
+	// A retry after a partly failed flush resubmits chunks that were written
+	for attempt := 0; attempt < 2; attempt++ {
+		if err := writer.Submit(interactions); err != nil {
+			t.Fatalf("Failed to submit batch: %v", err)
+		}
+	}
+
+	features, _ := store.ExtractFeatures(ctx, "retried_user")
+	if features.TotalAccessCount != 3 {
+		t.Errorf("Expected each interaction to be stored once, got %d", features.TotalAccessCount)
+	}
+}
+
+func TestLogInteractionsBatchHandler(t *testing.T) {
+	ctx := context.Background()
+	logger := utils.NewLogger()
+	store := services.NewMemoryStore(logger)
+	queue, drain := newTestQueue(t, store, services.IngestionQueueOptions{})
+	handler := handlers.NewBatchHandler(queue, logger)
+
+	tests := map[string]string{
+		"JSON array": `[
+			{"user_id": "array_user", "endpoint": "/a", "response_status_code": 200, "ip_address": "1.1.1.1"},
+			{"user_id": "", "endpoint": "/b", "response_status_code": 200, "ip_address": "1.1.1.1"},
+			{"user_id": "array_user", "endpoint": "/c", "response_status_code": 500, "ip_address": "2.2.2.2"}
+		]`,
+		"NDJSON": `{"user_id": "ndjson_user", "endpoint": "/a", "response_status_code": 200, "ip_address": "1.1.1.1"}
+{"user_id": "ndjson_user", "endpoint": "/b", "response_status_code": "oops"}
+
+{"user_id": "ndjson_user", "endpoint": "/c", "response_status_code": 404, "ip_address": "2.2.2.2"}`,
+	}
+
+	for name, body := range tests {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/log-interactions", strings.NewReader(body))
+			rec := httptest.NewRecorder()
+			handler.LogInteractionsBatch(rec, req)
+
+			if rec.Code != http.StatusAccepted {
+				t.Fatalf("Expected status 202, got %d: %s", rec.Code, rec.Body.String())
+			}
+			var response handlers.BatchResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if response.Accepted != 2 || response.Rejected != 1 {
+				t.Errorf("Expected 2 accepted and 1 rejected, got %+v", response)
+			}
+			if result := response.Results[1]; result.Status != "rejected" || result.Error == "" {
+				t.Errorf("Expected record 1 to be rejected with a reason, got %+v", result)
+			}
+		})
+	}
+
+	drain()
+	for _, userID := range []string{"array_user", "ndjson_user"} {
+		features, err := store.ExtractFeatures(ctx, userID)
+		if err != nil || features.TotalAccessCount != 2 {
+			t.Errorf("Expected 2 stored interactions for %s, got %+v (%v)", userID, features, err)
+		}
+	}
+
+	t.Run("Malformed array", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/api/log-interactions", strings.NewReader(`[{"user_id": `))
+		rec := httptest.NewRecorder()
+		handler.LogInteractionsBatch(rec, req)
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("Expected status 400, got %d", rec.Code)
+		}
+	})
+
+	t.Run("No valid record", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/api/log-interactions", strings.NewReader(`[{"user_id": ""}, {"endpoint": "/a"}]`))
+		rec := httptest.NewRecorder()
+		handler.LogInteractionsBatch(rec, req)
+		var response handlers.BatchResponse
+		json.Unmarshal(rec.Body.Bytes(), &response)
+		if rec.Code != http.StatusBadRequest || response.Rejected != 2 {
+			t.Errorf("Expected status 400 reporting 2 rejected records, got %d: %s", rec.Code, rec.Body.String())
+		}
+	})
+
+	t.Run("Too large", func(t *testing.T) {
+		body := "[" + strings.Repeat(" ", handlers.MaxBatchBodySize) + "]"
+		rec := httptest.NewRecorder()
+		handler.LogInteractionsBatch(rec, httptest.NewRequest(http.MethodPost, "/api/log-interactions", strings.NewReader(body)))
+		if rec.Code != http.StatusRequestEntityTooLarge {
+			t.Errorf("Expected status 413, got %d", rec.Code)
+		}
+	})
+
+	t.Run("Wrong method", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		handler.LogInteractionsBatch(rec, httptest.NewRequest(http.MethodGet, "/api/log-interactions", nil))
+		if rec.Code != http.StatusMethodNotAllowed {
+			t.Errorf("Expected status 405, got %d", rec.Code)
+		}
+	})
+}
@@ -0,0 +1,122 @@
+package test
+
+import (
+	"backend/handlers"
+	"backend/models"
+	"backend/services"
+	"backend/utils"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestDetectCommunities(t *testing.T) {
+	// Two triangles joined by a single edge, and a lone user
+	graph := models.UserGraph{
+		Users: []models.GraphUser{
+			{UserID: "a1", MaliciousScore: 0.9, IPAddresses: []string{"1.1.1.1", "2.2.2.2"}},
+			{UserID: "a2", MaliciousScore: 0.6, HoneytokenHits: 2, IPAddresses: []string{"1.1.1.1"}},
+			{UserID: "a3", MaliciousScore: 0.3, IPAddresses: []string{"1.1.1.1", "3.3.3.3"}},
+			{UserID: "b1", MaliciousScore: 0.1, IPAddresses: []string{"4.4.4.4"}},
+			{UserID: "b2", MaliciousScore: 0.1, IPAddresses: []string{"5.5.5.5"}},
+			{UserID: "b3", MaliciousScore: 0.1},
+			{UserID: "loner", MaliciousScore: 1},
+		},
+		Edges: []models.GraphEdge{
+			{From: "a1", To: "a2", Weight: 1}, {From: "a2", To: "a3", Weight: 1}, {From: "a1", To: "a3", Weight: 1},
+			{From: "b1", To: "b2", Weight: 1}, {From: "b2", To: "b3", Weight: 1}, {From: "b1", To: "b3", Weight: 1},
+			{From: "a3", To: "b1", Weight: 1},
+		},
+	}
+	result := services.DetectCommunities(graph, services.DefaultCommunityOptions())
+
+	if !result.Converged || len(result.Clusters) != 3 {
+		t.Fatalf("Expected 3 clusters, got %+v", result.Clusters)
+	}
+	expected := map[string]string{"a1": "a1", "a2": "a1", "a3": "a1", "b1": "b1", "b2": "b1", "b3": "b1", "loner": "loner"}
+	if !reflect.DeepEqual(result.Assignments, expected) {
+		t.Errorf("Expected assignments %v, got %v", expected, result.Assignments)
+	}
+
+	// The lone user has the highest mean score; the ring is next
+	if result.Clusters[0].ClusterID != "loner" {
+		t.Errorf("Expected clusters ordered by mean score, got %+v", result.Clusters)
+	}
+	ring := result.Clusters[1]
+	if ring.ClusterID != "a1" || ring.Size != 3 || ring.HoneytokenHits != 2 || ring.MaxScore != 0.9 ||
+		!reflect.DeepEqual(ring.Members, []string{"a1", "a2", "a3"}) || !reflect.DeepEqual(ring.SharedIPs, []string{"1.1.1.1"}) {
+		t.Errorf("Unexpected ring statistics: %+v", ring)
+	}
+	if ring.MeanScore < 0.6-1e-9 || ring.MeanScore > 0.6+1e-9 {
+		t.Errorf("Expected a mean score of 0.6, got %f", ring.MeanScore)
+	}
+	if clean := result.Clusters[2]; len(clean.SharedIPs) != 0 {
+		t.Errorf("Expected no shared IPs in the clean cluster, got %v", clean.SharedIPs)
+	}
+}
+
+func TestCommunityDetectionJob(t *testing.T) {
+	ctx := context.Background()
+	logger := utils.NewLogger()
+	store := services.NewMemoryStore(logger)
+	for _, userID := range []string{"fraud_1", "fraud_2", "fraud_3"} {
+		store.SaveInteraction(ctx, models.NewInteraction(userID, "/api/a", 200, userID == "fraud_1", "6.6.6.6"))
+	}
+	store.SaveInteraction(ctx, models.NewInteraction("bystander", "/api/a", 200, false, "7.7.7.7"))
+	store.UpdateMaliciousScore(ctx, "fraud_1", 0.9)
+	store.AssociatedWith(ctx, "fraud_1", "fraud_2")
+	store.AssociatedWith(ctx, "fraud_2", "fraud_3")
+
+	job := services.NewCommunityDetectionJob(store, services.DefaultCommunityOptions(), logger)
+	handler := handlers.NewClustersHandler(job, logger)
+
+	rec := httptest.NewRecorder()
+	handler.ListClusters(rec, httptest.NewRequest(http.MethodGet, "/api/clusters", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status 503 before the first run, got %d", rec.Code)
+	}
+
+	if _, err := job.Run(ctx); err != nil {
+		t.Fatalf("Failed to detect communities: %v", err)
+	}
+	graph, _ := store.ExportUserGraph(ctx)
+	for _, user := range graph.Users {
+		expected := "fraud_1"
+		if user.UserID == "bystander" {
+			expected = "bystander"
+		}
+		if user.ClusterID != expected {
+			t.Errorf("Expected %s to be saved in cluster %s, got %q", user.UserID, expected, user.ClusterID)
+		}
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ListClusters(rec, httptest.NewRequest(http.MethodGet, "/api/clusters?limit=10", nil))
+	var response handlers.ClustersResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to decode clusters: %v", err)
+	}
+	// The bystander's cluster of one is below the default min_size
+	if rec.Code != http.StatusOK || response.Users != 4 || len(response.Clusters) != 1 {
+		t.Fatalf("Unexpected response %d: %s", rec.Code, rec.Body.String())
+	}
+	if cluster := response.Clusters[0]; cluster.Size != 3 || cluster.HoneytokenHits != 1 || !reflect.DeepEqual(cluster.SharedIPs, []string{"6.6.6.6"}) {
+		t.Errorf("Unexpected cluster: %+v", cluster)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ListClusters(rec, httptest.NewRequest(http.MethodGet, "/api/clusters?min_size=1", nil))
+	json.Unmarshal(rec.Body.Bytes(), &response)
+	if len(response.Clusters) != 2 {
+		t.Errorf("Expected min_size=1 to include the bystander, got %+v", response.Clusters)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ListClusters(rec, httptest.NewRequest(http.MethodGet, "/api/clusters?limit=0", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for limit=0, got %d", rec.Code)
+	}
+}
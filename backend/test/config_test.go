@@ -0,0 +1,129 @@
+package test
+
+import (
+	"backend/config"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestConfigDefaults(t *testing.T) {
+	// There is no default password, so the Neo4j backend needs one to load
+	t.Setenv("MUDS_NEO4J_PASSWORD", "s3cret")
+	cfg, err := config.Load(nil)
+	if err != nil {
+		t.Fatalf("Failed to load default config: %v", err)
+	}
+	expected := config.Default()
+	expected.Neo4j.Password = "s3cret"
+	if !reflect.DeepEqual(cfg, expected) {
+		t.Errorf("Expected defaults %+v, got %+v", expected, cfg)
+	}
+}
+
+func TestConfigPrecedence(t *testing.T) {
+	dir := t.TempDir()
+	secretPath := filepath.Join(dir, "neo4j-password")
+	if err := os.WriteFile(secretPath, []byte("s3cret\n"), 0o600); err != nil {
+		t.Fatalf("Failed to write secret: %v", err)
+	}
+
+	configPath := filepath.Join(dir, "config.yaml")
+	yaml := `
+server:
+  port: 9000
+neo4j:
+  uri: bolt://neo4j.staging:7687
+  password_file: ` + secretPath + `
+ai:
+  model_url: http://model.staging:5000
+ingestion:
+  flush_interval: 250ms
+`
+	if err := os.WriteFile(configPath, []byte(yaml), 0o600); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	// Environment overrides the file and flags override the environment
+	t.Setenv("MUDS_NEO4J_URI", "bolt://neo4j.env:7687")
+	t.Setenv("MUDS_PORT", "9001")
+
+	cfg, err := config.Load([]string{"-config", configPath, "-port", "9002"})
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	if cfg.Server.Port != 9002 {
+		t.Errorf("Expected flag to set port 9002, got %d", cfg.Server.Port)
+	}
+	if cfg.Neo4j.URI != "bolt://neo4j.env:7687" {
+		t.Errorf("Expected environment to set the Neo4j URI, got %s", cfg.Neo4j.URI)
+	}
+	if cfg.AI.ModelURL != "http://model.staging:5000" {
+		t.Errorf("Expected file to set the model URL, got %s", cfg.AI.ModelURL)
+	}
+	if cfg.Ingestion.FlushInterval != 250*time.Millisecond {
+		t.Errorf("Expected file to set the flush interval, got %s", cfg.Ingestion.FlushInterval)
+	}
+	if cfg.Neo4j.Password != "s3cret" {
+		t.Errorf("Expected password to be read from its file, got %q", cfg.Neo4j.Password)
+	}
+	if cfg.Neo4j.Username != config.Default().Neo4j.Username {
+		t.Errorf("Expected unset values to keep their defaults, got username %q", cfg.Neo4j.Username)
+	}
+}
+
+func TestConfigValidation(t *testing.T) {
+	// Each case must fail on its own setting, not on the missing password
+	t.Setenv("MUDS_NEO4J_PASSWORD", "s3cret")
+	tests := map[string][]string{
+		"Unknown store":  {"-store", "postgres"},
+		"Invalid port":   {"-port", "70000"},
+		"Invalid model":  {"-ai-model-url", "not a url"},
+		"Zero workers":   {"-ingest-workers", "0"},
+		"Bad duration":   {"-flush-interval", "soon"},
+		"Missing secret": {"-neo4j-password-file", "/nonexistent/secret"},
+		"Bad window":     {"-feature-windows", "1h,2x"},
+		"No windows":     {"-feature-windows", ""},
+		"Zero interval":  {"-community-interval", "0s"},
+	}
+	for name, args := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := config.Load(args); err == nil {
+				t.Errorf("Expected an error loading %v", args)
+			}
+		})
+	}
+
+	t.Run("Missing password", func(t *testing.T) {
+		t.Setenv("MUDS_NEO4J_PASSWORD", "")
+		if _, err := config.Load(nil); err == nil {
+			t.Error("Expected an error for the Neo4j backend without a password")
+		}
+		if _, err := config.Load([]string{"-store", "memory"}); err != nil {
+			t.Errorf("Expected the memory backend to need no password, got %v", err)
+		}
+	})
+
+	t.Run("Unknown key in file", func(t *testing.T) {
+		configPath := filepath.Join(t.TempDir(), "config.yaml")
+		os.WriteFile(configPath, []byte("neo4j:\n  passwrd: oops\n"), 0o600)
+		if _, err := config.Load([]string{"-config", configPath}); err == nil {
+			t.Error("Expected an error for an unknown config key")
+		}
+	})
+
+	t.Run("Invalid reputation category", func(t *testing.T) {
+		configPath := filepath.Join(t.TempDir(), "config.yaml")
+		os.WriteFile(configPath, []byte("reputation:\n  lists:\n    - path: tor.txt\n      category: Tor Exits\n"), 0o600)
+		if _, err := config.Load([]string{"-config", configPath}); err == nil {
+			t.Error("Expected an error for a category that cannot name a feature")
+		}
+		os.WriteFile(configPath, []byte("reputation:\n  lists:\n    - path: ranges.csv\n      category: vpn\n      row_categories: [Data-Center]\n"), 0o600)
+		if _, err := config.Load([]string{"-config", configPath}); err == nil {
+			t.Error("Expected an error for a row category that cannot name a feature")
+		}
+	})
+}
@@ -0,0 +1,283 @@
+package test
+
+import (
+	"backend/models"
+	"backend/services"
+	"backend/utils"
+	"context"
+	"errors"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+)
+
+// fakeQueryRunner returns canned records instead of querying Neo4j
+type fakeQueryRunner struct {
+	records []neo4j.Record
+	err     error
+	query   string
+	params  map[string]interface{}
+}
+
+func (r *fakeQueryRunner) RunQuery(ctx context.Context, query string, params map[string]interface{}) ([]neo4j.Record, error) {
+	r.query, r.params = query, params
+	return r.records, r.err
+}
+
+// featureRecord builds a feature query row without windowed counts
+func featureRecord(total, honeytoken, weighted, sharedIPs, avgAssociated interface{}) neo4j.Record {
+	return neo4j.Record{
+		Keys: []string{"total_access_count", "honeytoken_access_count", "weighted_honeytoken_score", "shared_ip_count", "avg_associated_malicious_score", "propagated_risk",
+			"ips_shared_with_others", "users_sharing_ips", "subnets_shared_with_others", "distinct_countries", "hosting_traffic_ratio",
+			"reputation_traffic_ratio", "windows"},
+		Values: []any{total, honeytoken, weighted, sharedIPs, avgAssociated, 0.0, int64(0), int64(0), int64(0), int64(0), 0.0, 0.0, []any{}},
+	}
+}
+
+// lifetimeFeatures keeps only the lifetime totals of features so they can be compared
+func lifetimeFeatures(f models.UserFeatures) models.UserFeatures {
+	return models.UserFeatures{
+		TotalAccessCount:            f.TotalAccessCount,
+		HoneytokenAccessCount:       f.HoneytokenAccessCount,
+		WeightedHoneytokenScore:     f.WeightedHoneytokenScore,
+		SharedIPCount:               f.SharedIPCount,
+		AvgAssociatedMaliciousScore: f.AvgAssociatedMaliciousScore,
+		PropagatedRisk:              f.PropagatedRisk,
+		IPsSharedWithOthers:         f.IPsSharedWithOthers,
+		UsersSharingIPs:             f.UsersSharingIPs,
+		SubnetsSharedWithOthers:     f.SubnetsSharedWithOthers,
+		DistinctCountries:           f.DistinctCountries,
+		HostingTrafficRatio:         f.HostingTrafficRatio,
+		ReputationTrafficRatio:      f.ReputationTrafficRatio,
+	}
+}
+
+func TestNeo4jFeatureExtractor(t *testing.T) {
+	ctx := context.Background()
+	logger := utils.NewLogger()
+
+	t.Run("Query", func(t *testing.T) {
+		runner := &fakeQueryRunner{records: []neo4j.Record{featureRecord(int64(3), int64(2), 6.0, int64(2), 5.0)}}
+		features, err := services.NewNeo4jFeatureExtractor(runner, logger).ExtractFeatures(ctx, "user1")
+		if err != nil {
+			t.Fatalf("Failed to extract features: %v", err)
+		}
+		expected := models.UserFeatures{TotalAccessCount: 3, HoneytokenAccessCount: 2, WeightedHoneytokenScore: 6, SharedIPCount: 2, AvgAssociatedMaliciousScore: 5}
+		if !reflect.DeepEqual(lifetimeFeatures(features), expected) {
+			t.Errorf("Expected %+v, got %+v", expected, features)
+		}
+		if runner.params["user_id"] != "user1" || !strings.Contains(runner.query, "OPTIONAL MATCH (u)-[r:ASSOCIATED_WITH]") {
+			t.Errorf("Unexpected query %q with params %v", runner.query, runner.params)
+		}
+	})
+
+	t.Run("NullDefaults", func(t *testing.T) {
+		// A user without associations: avg() over no rows is null
+		runner := &fakeQueryRunner{records: []neo4j.Record{featureRecord(int64(4), int64(0), int64(0), int64(1), nil)}}
+		features, err := services.NewNeo4jFeatureExtractor(runner, logger).ExtractFeatures(ctx, "loner")
+		if err != nil {
+			t.Fatalf("Expected null features to decode to zero, got %v", err)
+		}
+		if features.TotalAccessCount != 4 || features.AvgAssociatedMaliciousScore != 0 || features.WeightedHoneytokenScore != 0 {
+			t.Errorf("Unexpected features: %+v", features)
+		}
+	})
+
+	t.Run("UnknownUser", func(t *testing.T) {
+		runner := &fakeQueryRunner{}
+		_, err := services.NewNeo4jFeatureExtractor(runner, logger).ExtractFeatures(ctx, "ghost")
+		if !errors.Is(err, services.ErrUserNotFound) {
+			t.Errorf("Expected ErrUserNotFound, got %v", err)
+		}
+	})
+
+	t.Run("QueryError", func(t *testing.T) {
+		runner := &fakeQueryRunner{err: errors.New("connection refused")}
+		if _, err := services.NewNeo4jFeatureExtractor(runner, logger).ExtractFeatures(ctx, "user1"); err == nil {
+			t.Error("Expected the query error to be returned")
+		}
+	})
+
+	t.Run("UnexpectedType", func(t *testing.T) {
+		runner := &fakeQueryRunner{records: []neo4j.Record{featureRecord("3", int64(0), 0.0, int64(1), 0.0)}}
+		if _, err := services.NewNeo4jFeatureExtractor(runner, logger).ExtractFeatures(ctx, "user1"); err == nil {
+			t.Error("Expected a string count to be rejected")
+		}
+	})
+
+	t.Run("MissingColumn", func(t *testing.T) {
+		record := neo4j.Record{Keys: []string{"total_access_count"}, Values: []any{int64(1)}}
+		if _, err := services.DecodeUserFeatures(record, models.DefaultFeatureWindows); err == nil {
+			t.Error("Expected a missing column to be rejected")
+		}
+	})
+}
+
+func TestMemoryStoreFeatureEdgeCases(t *testing.T) {
+	ctx := context.Background()
+	store := services.NewMemoryStore(utils.NewLogger())
+
+	t.Run("ZeroAssociations", func(t *testing.T) {
+		store.SaveInteraction(ctx, models.NewInteraction("solo", "/api/a", 200, true, "1.1.1.1"))
+		store.SaveInteraction(ctx, models.NewInteraction("solo", "/api/b", 200, false, "1.1.1.1"))
+
+		features, err := store.ExtractFeatures(ctx, "solo")
+		if err != nil {
+			t.Fatalf("Failed to extract features: %v", err)
+		}
+		expected := models.UserFeatures{TotalAccessCount: 2, HoneytokenAccessCount: 1, WeightedHoneytokenScore: models.DefaultHoneytokenWeight, SharedIPCount: 1}
+		if !reflect.DeepEqual(lifetimeFeatures(features), expected) {
+			t.Errorf("Expected %+v, got %+v", expected, features)
+		}
+	})
+
+	t.Run("ZeroInteractions", func(t *testing.T) {
+		store.AssociatedWith(ctx, "lurker", "solo")
+		store.UpdateMaliciousScore(ctx, "solo", 0.8)
+
+		features, err := store.ExtractFeatures(ctx, "lurker")
+		if err != nil {
+			t.Fatalf("Failed to extract features: %v", err)
+		}
+		expected := models.UserFeatures{AvgAssociatedMaliciousScore: 0.8}
+		if !reflect.DeepEqual(lifetimeFeatures(features), expected) {
+			t.Errorf("Expected %+v, got %+v", expected, features)
+		}
+	})
+
+	t.Run("ManyAssociations", func(t *testing.T) {
+		for i := 0; i < 3; i++ {
+			store.SaveInteraction(ctx, models.NewInteraction("hub", "/api/a", 200, i == 0, "2.2.2.2"))
+		}
+		scores := []float64{0.2, 0.4, 0.6, 0.8}
+		for i, score := range scores {
+			associate := "spoke_" + string(rune('a'+i))
+			store.AssociatedWith(ctx, "hub", associate)
+			store.UpdateMaliciousScore(ctx, associate, score)
+		}
+		// A repeated association does not count twice
+		store.AssociatedWith(ctx, "hub", "spoke_d")
+
+		features, err := store.ExtractFeatures(ctx, "hub")
+		if err != nil {
+			t.Fatalf("Failed to extract features: %v", err)
+		}
+		if features.TotalAccessCount != 3 || features.HoneytokenAccessCount != 1 {
+			t.Errorf("Expected associations not to inflate interaction counts, got %+v", features)
+		}
+		if diff := features.AvgAssociatedMaliciousScore - 0.5; diff > 1e-9 || diff < -1e-9 {
+			t.Errorf("Expected avg_associated_malicious_score 0.5, got %f", features.AvgAssociatedMaliciousScore)
+		}
+	})
+
+	t.Run("UnknownUser", func(t *testing.T) {
+		if _, err := store.ExtractFeatures(ctx, "ghost"); !errors.Is(err, services.ErrUserNotFound) {
+			t.Errorf("Expected ErrUserNotFound, got %v", err)
+		}
+	})
+}
+
+func TestFeatureWindows(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	t.Run("Parse", func(t *testing.T) {
+		for value, expected := range map[string]string{"1h": "1h", "60m": "1h", "90m": "90m", "24h": "24h", "1d": "24h", "48h": "2d", "7d": "7d"} {
+			window, err := models.ParseFeatureWindow(value)
+			if err != nil || window.String() != expected {
+				t.Errorf("Expected %q to parse as %s, got %s (%v)", value, expected, window, err)
+			}
+		}
+		for _, value := range []string{"", "30s", "-1h", "xd", "1w"} {
+			if _, err := models.ParseFeatureWindow(value); err == nil {
+				t.Errorf("Expected %q to be rejected", value)
+			}
+		}
+	})
+
+	t.Run("MemoryStore", func(t *testing.T) {
+		store := services.NewMemoryStore(utils.NewLogger())
+		store.Now = func() time.Time { return now }
+
+		// 6 interactions in the last hour, 12 in the last day, 14 in the last week
+		save := func(age time.Duration, count int, honeytoken bool, status int, ip string) {
+			for i := 0; i < count; i++ {
+				interaction := models.NewInteraction("burst", "/api/a", status, honeytoken, ip)
+				interaction.Timestamp = now.Add(-age)
+				store.SaveInteraction(ctx, interaction)
+			}
+		}
+		save(10*time.Minute, 6, true, 500, "1.1.1.1")
+		save(5*time.Hour, 6, false, 200, "2.2.2.2")
+		save(3*24*time.Hour, 2, false, 404, "3.3.3.3")
+		save(30*24*time.Hour, 1, false, 200, "4.4.4.4")
+
+		features, err := store.ExtractFeatures(ctx, "burst")
+		if err != nil {
+			t.Fatalf("Failed to extract features: %v", err)
+		}
+		expected := []models.WindowFeatures{
+			{Window: models.DefaultFeatureWindows[0], Name: "1h", Interactions: 6, HoneytokenHits: 6, DistinctIPs: 1, ErrorResponses: 6},
+			{Window: models.DefaultFeatureWindows[1], Name: "24h", Interactions: 12, HoneytokenHits: 6, DistinctIPs: 2, ErrorResponses: 6},
+			{Window: models.DefaultFeatureWindows[2], Name: "7d", Interactions: 14, HoneytokenHits: 6, DistinctIPs: 3, ErrorResponses: 8},
+		}
+		if !reflect.DeepEqual(features.Windows, expected) {
+			t.Errorf("Expected windows %+v, got %+v", expected, features.Windows)
+		}
+		if features.TotalAccessCount != 15 {
+			t.Errorf("Expected lifetime totals to include old interactions, got %d", features.TotalAccessCount)
+		}
+
+		// 6/h against 12/24h is 12 times the daily rate; the daily rate is
+		// 12/24 against 14/168 per hour, 6 times the weekly rate
+		if math.Abs(features.InteractionVelocity-12) > 1e-9 || math.Abs(features.InteractionAcceleration-2) > 1e-9 {
+			t.Errorf("Expected interaction velocity 12 and acceleration 2, got %f and %f", features.InteractionVelocity, features.InteractionAcceleration)
+		}
+		if math.Abs(features.HoneytokenVelocity-24) > 1e-9 || math.Abs(features.HoneytokenAcceleration-24.0/7) > 1e-9 {
+			t.Errorf("Expected honeytoken velocity 24 and acceleration 24/7, got %f and %f", features.HoneytokenVelocity, features.HoneytokenAcceleration)
+		}
+		if features.ToMap()["interactions_24h"] != int64(12) {
+			t.Errorf("Expected named windowed features, got %v", features.ToMap())
+		}
+	})
+
+	t.Run("Neo4j", func(t *testing.T) {
+		record := featureRecord(int64(3), int64(1), 1.0, int64(1), 0.0)
+		record.Values[len(record.Values)-1] = []any{
+			map[string]any{"window": "1h", "interactions": int64(1), "honeytoken_hits": int64(1), "distinct_ips": int64(1), "error_responses": int64(0)},
+			map[string]any{"window": "24h", "interactions": int64(2), "honeytoken_hits": int64(1), "distinct_ips": int64(1), "error_responses": int64(1)},
+		}
+		runner := &fakeQueryRunner{records: []neo4j.Record{record}}
+		extractor := services.NewNeo4jFeatureExtractor(runner, utils.NewLogger())
+		extractor.Windows = []models.FeatureWindow{models.DefaultFeatureWindows[1], models.DefaultFeatureWindows[0]}
+		extractor.Now = func() time.Time { return now }
+
+		features, err := extractor.ExtractFeatures(ctx, "user1")
+		if err != nil {
+			t.Fatalf("Failed to extract features: %v", err)
+		}
+		if len(features.Windows) != 2 || features.Windows[0].Name != "1h" || features.Windows[1].ErrorResponses != 1 {
+			t.Errorf("Unexpected windows: %+v", features.Windows)
+		}
+		if math.Abs(features.InteractionVelocity-12) > 1e-9 {
+			t.Errorf("Expected interaction velocity 12, got %f", features.InteractionVelocity)
+		}
+
+		windows, _ := runner.params["windows"].([]map[string]interface{})
+		if len(windows) != 2 || windows[0]["name"] != "1h" || windows[0]["since"] != "2024-06-01T11:00:00Z" {
+			t.Errorf("Expected windows shortest first ending now, got %v", runner.params["windows"])
+		}
+	})
+
+	t.Run("WrongWindowType", func(t *testing.T) {
+		record := featureRecord(int64(1), int64(0), 0.0, int64(1), 0.0)
+		record.Values[len(record.Values)-1] = []any{map[string]any{"window": "1h", "interactions": "1"}}
+		if _, err := services.DecodeUserFeatures(record, models.DefaultFeatureWindows); err == nil {
+			t.Error("Expected a string window count to be rejected")
+		}
+	})
+}
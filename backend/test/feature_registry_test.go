@@ -0,0 +1,143 @@
+package test
+
+import (
+	"backend/handlers"
+	"backend/models"
+	"backend/services"
+	"backend/utils"
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// sessionCountFeature is a custom feature registered from outside the services package
+type sessionCountFeature struct{}
+
+func (sessionCountFeature) Name() string                   { return "session_count" }
+func (sessionCountFeature) Description() string            { return "Distinct sessions" }
+func (sessionCountFeature) Source() services.FeatureSource { return services.SourceInteractions }
+func (sessionCountFeature) Compute(data services.FeatureData) (interface{}, error) {
+	sessions := make(map[string]struct{})
+	for _, interaction := range data.Interactions {
+		sessions[interaction.SessionID] = struct{}{}
+	}
+	return int64(len(sessions)), nil
+}
+
+func TestFeatureRegistry(t *testing.T) {
+	registry := services.NewDefaultFeatureRegistry(models.DefaultFeatureWindows)
+
+	enabled := make(map[string]bool)
+	for _, info := range registry.List() {
+		enabled[info.Name] = info.Enabled
+	}
+	for _, name := range []string{"total_access_count", "interactions_24h", "honeytoken_velocity"} {
+		if !enabled[name] {
+			t.Errorf("Expected built-in feature %s to be enabled", name)
+		}
+	}
+	for _, name := range []string{"error_rate", "endpoint_diversity"} {
+		if on, ok := enabled[name]; !ok || on {
+			t.Errorf("Expected custom feature %s to be registered but disabled", name)
+		}
+	}
+	if registry.NeedsInteractions() {
+		t.Error("Expected the built-in features not to load interactions")
+	}
+
+	if err := registry.Register(services.ErrorRateFeature{}, true); err == nil {
+		t.Error("Expected a duplicate feature name to be rejected")
+	}
+	if err := registry.Enable([]string{"total_access_count", "favorite_color"}); err == nil {
+		t.Error("Expected enabling an unknown feature to fail")
+	}
+	if err := registry.Require([]string{"total_access_count", "error_rate"}); err == nil {
+		t.Error("Expected a disabled feature to fail Require")
+	}
+	if err := registry.Require([]string{"favorite_color"}); err == nil {
+		t.Error("Expected an unknown feature to fail Require")
+	}
+	if err := registry.Require([]string{"total_access_count", "interactions_1h"}); err != nil {
+		t.Errorf("Expected enabled features to pass Require, got %v", err)
+	}
+	if err := registry.Require(services.RemoteModelFeatures); err != nil {
+		t.Errorf("Expected the default features to cover the AI model's inputs, got %v", err)
+	}
+	registry.Enable([]string{"total_access_count", "honeytoken_access_count", "shared_ip_count"})
+	if err := registry.Require(services.RemoteModelFeatures); err == nil {
+		t.Error("Expected disabling an input of the AI model to fail Require")
+	}
+}
+
+func TestAnalyzeUserAssemblesEnabledFeatures(t *testing.T) {
+	ctx := context.Background()
+	logger := utils.NewLogger()
+	store := services.NewMemoryStore(logger)
+
+	var request map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&request)
+		w.Write([]byte(`{"schema_version": 1, "maliciousness_score": 0.5}`))
+	}))
+	defer server.Close()
+
+	analysis := services.NewUserAnalysisService(store, services.NewAIIntegrationService(server.URL, logger), logger)
+	if err := analysis.Features.Register(sessionCountFeature{}, false); err != nil {
+		t.Fatalf("Failed to register custom feature: %v", err)
+	}
+	if err := analysis.Features.Enable([]string{"total_access_count", "error_rate", "endpoint_diversity", "session_count"}); err != nil {
+		t.Fatalf("Failed to enable features: %v", err)
+	}
+
+	for i, status := range []int{200, 404, 500, 200} {
+		interaction := models.NewInteraction("scanner", []string{"/a", "/b", "/c", "/a"}[i], status, false, "1.1.1.1")
+		interaction.SessionID = []string{"s1", "s1", "s2", "s2"}[i]
+		store.SaveInteraction(ctx, interaction)
+	}
+
+	result, err := analysis.AnalyzeUser(ctx, "scanner")
+	if err != nil {
+		t.Fatalf("Failed to analyze user: %v", err)
+	}
+
+	expected := map[string]float64{"total_access_count": 4, "error_rate": 0.5, "endpoint_diversity": 0.75, "session_count": 2}
+	for name, value := range expected {
+		if got, ok := request[name].(float64); !ok || math.Abs(got-value) > 1e-9 {
+			t.Errorf("Expected %s to be %v, got %v", name, value, request[name])
+		}
+	}
+	if _, ok := request["shared_ip_count"]; ok {
+		t.Errorf("Expected disabled features not to be sent, got %v", request)
+	}
+	if len(result.Features) != len(expected) {
+		t.Errorf("Expected the response to list the enabled features, got %v", result.Features)
+	}
+}
+
+func TestListFeaturesHandler(t *testing.T) {
+	logger := utils.NewLogger()
+	analysis := services.NewUserAnalysisService(services.NewMemoryStore(logger), services.NewHeuristicScorer(services.DefaultHeuristicWeights()), logger)
+	handler := handlers.NewUserAnalysisHandler(analysis, logger)
+
+	rec := httptest.NewRecorder()
+	handler.ListFeatures(rec, httptest.NewRequest(http.MethodGet, "/api/features", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rec.Code)
+	}
+	var features []services.FeatureInfo
+	if err := json.Unmarshal(rec.Body.Bytes(), &features); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(features) == 0 || features[0].Name == "" || features[0].Description == "" || features[0].Source == "" {
+		t.Errorf("Expected described features, got %+v", features)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ListFeatures(rec, httptest.NewRequest(http.MethodPost, "/api/features", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected status 405 for POST, got %d", rec.Code)
+	}
+}
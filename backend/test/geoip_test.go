@@ -0,0 +1,288 @@
+package test
+
+import (
+	"backend/models"
+	"backend/services"
+	"backend/utils"
+	"context"
+	"encoding/binary"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+)
+
+// mmdbNetwork is an IPv4 network and its record in a test MaxMind database
+type mmdbNetwork struct {
+	cidr   string
+	record map[string]any
+}
+
+// writeMMDB writes an IPv4 MaxMind database with 24-bit records to path. It
+// supports just enough of the format for the records used in these tests.
+func writeMMDB(t *testing.T, path string, networks []mmdbNetwork) {
+	t.Helper()
+
+	// Each node has a left and right record: 0 for no data, a positive node
+	// index, or a negative -(data offset + 1)
+	nodes := [][2]int{{0, 0}}
+	var data []byte
+	for _, network := range networks {
+		_, prefix, err := net.ParseCIDR(network.cidr)
+		if err != nil {
+			t.Fatalf("Invalid network %s: %v", network.cidr, err)
+		}
+		ones, _ := prefix.Mask.Size()
+		ip := prefix.IP.To4()
+		node := 0
+		for i := 0; i < ones; i++ {
+			side := int(ip[i/8]>>(7-i%8)) & 1
+			if i == ones-1 {
+				nodes[node][side] = -(len(data) + 1)
+				break
+			}
+			if nodes[node][side] <= 0 {
+				nodes = append(nodes, [2]int{0, 0})
+				nodes[node][side] = len(nodes) - 1
+			}
+			node = nodes[node][side]
+		}
+		data = append(data, mmdbEncode(network.record)...)
+	}
+
+	var out []byte
+	for _, node := range nodes {
+		for _, value := range node {
+			switch {
+			case value == 0:
+				value = len(nodes)
+			case value < 0:
+				value = len(nodes) + 16 + (-value - 1)
+			}
+			out = append(out, byte(value>>16), byte(value>>8), byte(value))
+		}
+	}
+	out = append(out, make([]byte, 16)...)
+	out = append(out, data...)
+	out = append(out, "\xAB\xCD\xEFMaxMind.com"...)
+	out = append(out, mmdbEncode(map[string]any{
+		"binary_format_major_version": uint16(2),
+		"binary_format_minor_version": uint16(0),
+		"build_epoch":                 uint64(time.Now().Unix()),
+		"database_type":               "MUDS-Test",
+		"description":                 map[string]any{"en": "MUDS test database"},
+		"ip_version":                  uint16(4),
+		"languages":                   []any{"en"},
+		"node_count":                  uint32(len(nodes)),
+		"record_size":                 uint16(24),
+	})...)
+
+	// Replace the file atomically, as GeoIP updates should
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, out, 0o644); err != nil {
+		t.Fatalf("Failed to write database: %v", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		t.Fatalf("Failed to replace database: %v", err)
+	}
+}
+
+// mmdbEncode encodes a value in the MaxMind DB data format
+func mmdbEncode(value any) []byte {
+	switch v := value.(type) {
+	case string:
+		return append(mmdbControl(2, len(v)), v...)
+	case bool:
+		if v {
+			return mmdbControl(14, 1)
+		}
+		return mmdbControl(14, 0)
+	case uint16:
+		return mmdbUint(5, uint64(v))
+	case uint32:
+		return mmdbUint(6, uint64(v))
+	case uint64:
+		return mmdbUint(9, v)
+	case []any:
+		out := mmdbControl(11, len(v))
+		for _, item := range v {
+			out = append(out, mmdbEncode(item)...)
+		}
+		return out
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		out := mmdbControl(7, len(v))
+		for _, key := range keys {
+			out = append(out, mmdbEncode(key)...)
+			out = append(out, mmdbEncode(v[key])...)
+		}
+		return out
+	}
+	panic("unsupported MaxMind DB value")
+}
+
+// mmdbUint encodes an unsigned integer without leading zero bytes
+func mmdbUint(typ int, value uint64) []byte {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], value)
+	trimmed := buf[:]
+	for len(trimmed) > 0 && trimmed[0] == 0 {
+		trimmed = trimmed[1:]
+	}
+	return append(mmdbControl(typ, len(trimmed)), trimmed...)
+}
+
+// mmdbControl encodes the control byte of a value of type typ and size
+func mmdbControl(typ, size int) []byte {
+	var control byte
+	var extended []byte
+	if typ > 7 {
+		extended = []byte{byte(typ - 7)}
+	} else {
+		control = byte(typ) << 5
+	}
+	var sizeBytes []byte
+	switch {
+	case size < 29:
+		control |= byte(size)
+	case size < 285:
+		control |= 29
+		sizeBytes = []byte{byte(size - 29)}
+	default:
+		control |= 30
+		sizeBytes = []byte{byte((size - 285) >> 8), byte(size - 285)}
+	}
+	out := append([]byte{control}, extended...)
+	return append(out, sizeBytes...)
+}
+
+// cityRecord returns a City database record
+func cityRecord(country, city string) map[string]any {
+	return map[string]any{
+		"country": map[string]any{"iso_code": country},
+		"city":    map[string]any{"names": map[string]any{"en": city}},
+	}
+}
+
+// asnRecord returns an ASN database record
+func asnRecord(asn uint32, org string) map[string]any {
+	return map[string]any{"autonomous_system_number": asn, "autonomous_system_organization": org}
+}
+
+// newTestGeoIP writes City and ASN databases to a temporary directory and loads them
+func newTestGeoIP(t *testing.T) (*services.GeoIPEnricher, string) {
+	t.Helper()
+	dir := t.TempDir()
+	cityDB := filepath.Join(dir, "city.mmdb")
+	asnDB := filepath.Join(dir, "asn.mmdb")
+	writeMMDB(t, cityDB, []mmdbNetwork{
+		{"203.0.113.0/24", cityRecord("US", "Ashburn")},
+		{"198.51.100.0/24", cityRecord("DE", "Berlin")},
+	})
+	writeMMDB(t, asnDB, []mmdbNetwork{
+		{"203.0.113.0/24", asnRecord(16509, "AMAZON-02")},
+		{"198.51.100.0/24", asnRecord(3320, "Deutsche Telekom AG")},
+	})
+
+	enricher, err := services.NewGeoIPEnricher(services.GeoIPOptions{CityDB: cityDB, ASNDB: asnDB}, utils.NewLogger())
+	if err != nil {
+		t.Fatalf("Failed to load GeoIP databases: %v", err)
+	}
+	return enricher, cityDB
+}
+
+func TestGeoIPEnricher(t *testing.T) {
+	enricher, _ := newTestGeoIP(t)
+
+	interaction := models.NewInteraction("alice", "/a", 200, false, "203.0.113.7:443")
+	interaction.Country = "FR"
+	enricher.Enrich(&interaction)
+	if interaction.Country != "US" || interaction.City != "Ashburn" || interaction.ASN != 16509 || interaction.ASOrg != "AMAZON-02" || !interaction.HostingProvider {
+		t.Errorf("Unexpected enrichment of an AWS address: %+v", interaction)
+	}
+
+	interaction = models.NewInteraction("alice", "/a", 200, false, "198.51.100.1")
+	enricher.Enrich(&interaction)
+	if interaction.Country != "DE" || interaction.ASN != 3320 || interaction.HostingProvider {
+		t.Errorf("Unexpected enrichment of a residential address: %+v", interaction)
+	}
+
+	for _, address := range []string{"192.0.2.1", "2001:db8::1", "not an ip"} {
+		interaction = models.NewInteraction("alice", "/a", 200, false, address)
+		interaction.Country, interaction.HostingProvider = "FR", true
+		enricher.Enrich(&interaction)
+		if interaction.Country != "" || interaction.ASN != 0 || interaction.HostingProvider {
+			t.Errorf("Expected %s to have no GeoIP data, got %+v", address, interaction)
+		}
+	}
+
+	if _, err := services.NewGeoIPEnricher(services.GeoIPOptions{CityDB: "/nonexistent.mmdb"}, utils.NewLogger()); err == nil {
+		t.Error("Expected an error loading a missing database")
+	}
+}
+
+func TestGeoIPEnricherReload(t *testing.T) {
+	enricher, cityDB := newTestGeoIP(t)
+	if reloaded, err := enricher.Reload(); reloaded || err != nil {
+		t.Fatalf("Expected no reload of unchanged databases, got %v, %v", reloaded, err)
+	}
+
+	writeMMDB(t, cityDB, []mmdbNetwork{{"203.0.113.0/24", cityRecord("CA", "Montreal")}})
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(cityDB, later, later)
+	if reloaded, err := enricher.Reload(); !reloaded || err != nil {
+		t.Fatalf("Expected the changed database to be reloaded, got %v, %v", reloaded, err)
+	}
+	interaction := models.NewInteraction("alice", "/a", 200, false, "203.0.113.7")
+	enricher.Enrich(&interaction)
+	if interaction.Country != "CA" || interaction.ASN != 16509 {
+		t.Errorf("Expected the reloaded country and the unchanged ASN, got %+v", interaction)
+	}
+
+	// A broken update keeps the previous database
+	os.WriteFile(cityDB, []byte("truncated"), 0o644)
+	if _, err := enricher.Reload(); err == nil {
+		t.Error("Expected an error reloading a broken database")
+	}
+	enricher.Enrich(&interaction)
+	if interaction.Country != "CA" {
+		t.Errorf("Expected the previous database to stay in use, got %+v", interaction)
+	}
+}
+
+func TestGeoIPFeatures(t *testing.T) {
+	ctx := context.Background()
+	enricher, _ := newTestGeoIP(t)
+	store := services.NewMemoryStore(utils.NewLogger())
+	queue, drain := newTestQueue(t, store, services.IngestionQueueOptions{
+		Enrichers: []services.InteractionEnricher{enricher},
+	})
+
+	if err := queue.Enqueue([]models.Interaction{
+		models.NewInteraction("alice", "/a", 200, false, "203.0.113.7"),
+		models.NewInteraction("alice", "/a", 200, false, "203.0.113.8"),
+		models.NewInteraction("alice", "/a", 200, false, "198.51.100.1"),
+		models.NewInteraction("alice", "/a", 200, false, "192.0.2.1"),
+	}); err != nil {
+		t.Fatalf("Failed to enqueue interactions: %v", err)
+	}
+	drain()
+
+	features, err := store.ExtractFeatures(ctx, "alice")
+	if err != nil {
+		t.Fatalf("Failed to extract features: %v", err)
+	}
+	if features.DistinctCountries != 2 || features.HostingTrafficRatio != 0.5 {
+		t.Errorf("Expected 2 countries and half the traffic from hosting providers, got %+v", features)
+	}
+	interactions, _ := store.GetInteractions(ctx, "alice", time.Time{})
+	if len(interactions) != 4 || interactions[2].City != "Berlin" || interactions[2].ASOrg != "Deutsche Telekom AG" {
+		t.Errorf("Expected stored interactions to keep their GeoIP data, got %+v", interactions)
+	}
+}
@@ -0,0 +1,104 @@
+package test
+
+import (
+	"backend/handlers"
+	"backend/services"
+	"backend/utils"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHealthEndpoints(t *testing.T) {
+	logger := utils.NewLogger()
+
+	var modelHealthy atomic.Bool
+	modelHealthy.Store(true)
+	modelServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/health" || !modelHealthy.Load() {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Write([]byte(`{"status": "ok"}`))
+	}))
+	defer modelServer.Close()
+
+	aiService := services.NewAIIntegrationService(modelServer.URL, logger)
+	healthService := services.NewHealthService("1.2.3", time.Hour, time.Second, logger)
+	healthService.Register("ai_model", aiService.Ping)
+	healthService.Register("store", func(ctx context.Context) error { return nil })
+	handler := handlers.NewHealthHandler(healthService, logger)
+
+	get := func(h http.HandlerFunc) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		h(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		return rec
+	}
+
+	// Liveness does not depend on dependencies; readiness waits for the first check
+	if rec := get(handler.Healthz); rec.Code != http.StatusOK {
+		t.Errorf("Expected /healthz to return 200, got %d", rec.Code)
+	}
+	if rec := get(handler.Readyz); rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected /readyz to return 503 before the first check, got %d", rec.Code)
+	}
+
+	healthService.CheckAll(context.Background())
+	if rec := get(handler.Readyz); rec.Code != http.StatusOK {
+		t.Errorf("Expected /readyz to return 200 with healthy dependencies, got %d", rec.Code)
+	}
+
+	modelHealthy.Store(false)
+	healthService.CheckAll(context.Background())
+	if rec := get(handler.Readyz); rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected /readyz to return 503 with a failing dependency, got %d", rec.Code)
+	}
+
+	rec := get(handler.Status)
+	var status services.HealthStatus
+	if err := json.Unmarshal(rec.Body.Bytes(), &status); err != nil {
+		t.Fatalf("Failed to decode /status response: %v", err)
+	}
+	if status.Version != "1.2.3" || status.Ready || len(status.Dependencies) != 2 {
+		t.Fatalf("Unexpected status: %+v", status)
+	}
+	aiStatus := status.Dependencies[0]
+	if aiStatus.Name != "ai_model" || aiStatus.Healthy || aiStatus.LastError == "" || aiStatus.LastErrorAt == nil {
+		t.Errorf("Expected ai_model to report its last error, got %+v", aiStatus)
+	}
+	if !status.Dependencies[1].Healthy {
+		t.Errorf("Expected store to be healthy, got %+v", status.Dependencies[1])
+	}
+
+	// Recovery keeps the last error but reports healthy again
+	modelHealthy.Store(true)
+	healthService.CheckAll(context.Background())
+	status = healthService.Status()
+	if !status.Ready || status.Dependencies[0].LastError == "" {
+		t.Errorf("Expected recovered dependency with last error retained, got %+v", status)
+	}
+
+	healthService.SetShuttingDown()
+	if rec := get(handler.Readyz); rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected /readyz to return 503 while shutting down, got %d", rec.Code)
+	}
+}
+
+func TestHealthCheckTimeout(t *testing.T) {
+	logger := utils.NewLogger()
+	healthService := services.NewHealthService("dev", time.Hour, 20*time.Millisecond, logger)
+	healthService.Register("slow", func(ctx context.Context) error {
+		<-ctx.Done()
+		return errors.New("timed out")
+	})
+
+	healthService.CheckAll(context.Background())
+	if healthService.Ready() {
+		t.Error("Expected a check exceeding its timeout to fail")
+	}
+}
@@ -0,0 +1,100 @@
+package test
+
+import (
+	"backend/handlers"
+	"backend/models"
+	"backend/services"
+	"backend/utils"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHoneytokenRegistry(t *testing.T) {
+	ctx := context.Background()
+	logger := utils.NewLogger()
+	store := services.NewMemoryStore(logger)
+	queue, drain := newTestQueue(t, store, services.IngestionQueueOptions{})
+	handler := handlers.NewHoneytokenHandler(store, queue, logger)
+
+	// Create a critical fake API key
+	req := httptest.NewRequest(http.MethodPost, "/api/honeytokens",
+		strings.NewReader(`{"type": "api_key", "severity": "critical", "placement": "config/.env.backup"}`))
+	rec := httptest.NewRecorder()
+	handler.Honeytokens(rec, req)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var token models.Honeytoken
+	if err := json.Unmarshal(rec.Body.Bytes(), &token); err != nil {
+		t.Fatalf("Failed to decode created honeytoken: %v", err)
+	}
+	if token.TokenID == "" || !token.Active() {
+		t.Fatalf("Expected an active honeytoken with an ID, got %+v", token)
+	}
+
+	t.Run("Reject invalid honeytoken", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/api/honeytokens",
+			strings.NewReader(`{"type": "api_key", "severity": "apocalyptic", "placement": "x"}`))
+		rec := httptest.NewRecorder()
+		handler.Honeytokens(rec, req)
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("Expected status 400, got %d", rec.Code)
+		}
+	})
+
+	t.Run("Trigger attributes the token", func(t *testing.T) {
+		body := `{"user_id": "attacker", "honeytoken_id": "` + token.TokenID + `", "ip_address": "198.51.100.4"}`
+		req := httptest.NewRequest(http.MethodPost, "/api/detect-honeytoken", strings.NewReader(body))
+		rec := httptest.NewRecorder()
+		handler.DetectHoneytoken(rec, req)
+		if rec.Code != http.StatusAccepted {
+			t.Fatalf("Expected status 202, got %d: %s", rec.Code, rec.Body.String())
+		}
+
+		drain()
+		features, err := store.ExtractFeatures(ctx, "attacker")
+		if err != nil {
+			t.Fatalf("Failed to extract features: %v", err)
+		}
+		if features.HoneytokenAccessCount != 1 {
+			t.Errorf("Expected honeytoken_access_count to be 1, got %d", features.HoneytokenAccessCount)
+		}
+		if features.WeightedHoneytokenScore != models.SeverityCritical.Weight() {
+			t.Errorf("Expected weighted_honeytoken_score to be %f, got %f",
+				models.SeverityCritical.Weight(), features.WeightedHoneytokenScore)
+		}
+	})
+
+	t.Run("Unknown token", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/api/detect-honeytoken",
+			strings.NewReader(`{"user_id": "attacker", "honeytoken_id": "ht_missing"}`))
+		rec := httptest.NewRecorder()
+		handler.DetectHoneytoken(rec, req)
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("Expected status 404, got %d", rec.Code)
+		}
+	})
+
+	t.Run("Retire and list", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/api/honeytokens/retire",
+			strings.NewReader(`{"token_id": "`+token.TokenID+`"}`))
+		rec := httptest.NewRecorder()
+		handler.RetireHoneytoken(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d", rec.Code)
+		}
+
+		active, _ := store.ListHoneytokens(ctx, false)
+		if len(active) != 0 {
+			t.Errorf("Expected no active honeytokens, got %d", len(active))
+		}
+		all, _ := store.ListHoneytokens(ctx, true)
+		if len(all) != 1 || all[0].Active() {
+			t.Errorf("Expected one retired honeytoken, got %+v", all)
+		}
+	})
+}
@@ -0,0 +1,405 @@
+package test
+
+import (
+	"backend/handlers"
+	"backend/models"
+	"backend/services"
+	"backend/utils"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newTestQueue returns an IngestionQueue writing to store through a BatchWriter.
+// Closing the returned function drains the queue so the store can be inspected.
+func newTestQueue(t *testing.T, store services.GraphStore, options services.IngestionQueueOptions) (*services.IngestionQueue, func()) {
+	t.Helper()
+	logger := utils.NewLogger()
+	writer := services.NewBatchWriter(store, 100, 5*time.Millisecond, logger)
+	if options.WALPath == "" {
+		options.WALPath = filepath.Join(t.TempDir(), "ingestion.wal")
+	}
+	queue, err := services.NewIngestionQueue(writer, options, logger)
+	if err != nil {
+		t.Fatalf("Failed to create ingestion queue: %v", err)
+	}
+
+	var once sync.Once
+	drain := func() {
+		once.Do(func() {
+			queue.Close()
+			writer.Close()
+		})
+	}
+	t.Cleanup(drain)
+	return queue, drain
+}
+
+// flakyWriter fails every Submit while down is set
+type flakyWriter struct {
+	mu      sync.Mutex
+	down    bool
+	written []models.Interaction
+}
+
+func (w *flakyWriter) Submit(interactions []models.Interaction) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.down {
+		return errors.New("store unavailable")
+	}
+	w.written = append(w.written, interactions...)
+	return nil
+}
+
+func (w *flakyWriter) setDown(down bool) {
+	w.mu.Lock()
+	w.down = down
+	w.mu.Unlock()
+}
+
+func (w *flakyWriter) count() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return len(w.written)
+}
+
+func TestIngestionQueueSpillsAndReplays(t *testing.T) {
+	logger := utils.NewLogger()
+	writer := &flakyWriter{down: true}
+	options := services.IngestionQueueOptions{
+		Workers:        1,
+		MaxRetries:     1,
+		BaseBackoff:    time.Millisecond,
+		ReplayInterval: 10 * time.Millisecond,
+		WALPath:        filepath.Join(t.TempDir(), "ingestion.wal"),
+	}
+	queue, err := services.NewIngestionQueue(writer, options, logger)
+	if err != nil {
+		t.Fatalf("Failed to create ingestion queue: %v", err)
+	}
+	defer queue.Close()
+
+	interaction := models.NewInteraction("wal_user", "/api/test", 200, false, "1.1.1.1")
+	if err := queue.Enqueue([]models.Interaction{interaction, interaction}); err != nil {
+		t.Fatalf("Failed to enqueue: %v", err)
+	}
+
+	waitFor(t, "interactions to spill to the WAL", func() bool { return queue.WAL.Size() > 0 })
+	if queue.Available() {
+		t.Error("Expected the store to be marked unavailable")
+	}
+
+	writer.setDown(false)
+	waitFor(t, "the WAL to be replayed", func() bool { return writer.count() == 2 })
+	waitFor(t, "the store to be marked available", queue.Available)
+	if size := queue.WAL.Size(); size != 0 {
+		t.Errorf("Expected the WAL to be truncated after replay, got %d bytes", size)
+	}
+}
+
+func TestIngestionQueueReplaysOnStartup(t *testing.T) {
+	walPath := filepath.Join(t.TempDir(), "ingestion.wal")
+	wal, err := services.NewWriteAheadLog(walPath)
+	if err != nil {
+		t.Fatalf("Failed to create WAL: %v", err)
+	}
+	interaction := models.NewInteraction("crashed_user", "/api/test", 200, false, "1.1.1.1")
+	if err := wal.Append([]models.Interaction{interaction}); err != nil {
+		t.Fatalf("Failed to append to WAL: %v", err)
+	}
+
+	writer := &flakyWriter{}
+	queue, err := services.NewIngestionQueue(writer, services.IngestionQueueOptions{WALPath: walPath}, utils.NewLogger())
+	if err != nil {
+		t.Fatalf("Failed to create ingestion queue: %v", err)
+	}
+	defer queue.Close()
+
+	if writer.count() != 1 {
+		t.Errorf("Expected the leftover WAL entry to be replayed on startup, got %d writes", writer.count())
+	}
+}
+
+func TestIngestionQueueDrainsBacklogPerWrite(t *testing.T) {
+	logger := utils.NewLogger()
+	store := services.NewMemoryStore(logger)
+	// Writes wait for the flush interval, as batches of 500 never fill up here
+	writer := services.NewBatchWriter(store, 500, 100*time.Millisecond, logger)
+	defer writer.Close()
+	queue, err := services.NewIngestionQueue(writer, services.IngestionQueueOptions{
+		Workers: 1,
+		WALPath: filepath.Join(t.TempDir(), "ingestion.wal"),
+	}, logger)
+	if err != nil {
+		t.Fatalf("Failed to create ingestion queue: %v", err)
+	}
+	defer queue.Close()
+
+	// One write per interaction would take 4s
+	for i := 0; i < 40; i++ {
+		if err := queue.Enqueue([]models.Interaction{models.NewInteraction("busy_user", "/api/test", 200, false, "1.1.1.1")}); err != nil {
+			t.Fatalf("Failed to enqueue: %v", err)
+		}
+	}
+	waitFor(t, "the backlog to be written", func() bool {
+		interactions, _ := store.GetInteractions(context.Background(), "busy_user", time.Time{})
+		return len(interactions) == 40
+	})
+}
+
+func TestIngestionQueueAssignsIDs(t *testing.T) {
+	writer := &flakyWriter{}
+	queue, err := services.NewIngestionQueue(writer, services.IngestionQueueOptions{
+		WALPath: filepath.Join(t.TempDir(), "ingestion.wal"),
+	}, utils.NewLogger())
+	if err != nil {
+		t.Fatalf("Failed to create ingestion queue: %v", err)
+	}
+
+	interaction := models.NewInteraction("id_user", "/api/test", 200, false, "1.1.1.1")
+	interaction.ID = "client-chosen"
+	if err := queue.Enqueue([]models.Interaction{interaction, interaction}); err != nil {
+		t.Fatalf("Failed to enqueue: %v", err)
+	}
+	queue.Close()
+
+	written := writer.written
+	if len(written) != 2 || written[0].ID == "" || written[0].ID == "client-chosen" || written[0].ID == written[1].ID {
+		t.Errorf("Expected every interaction to get a new ID, got %+v", written)
+	}
+}
+
+func TestIngestionQueueClearsClientEnrichment(t *testing.T) {
+	writer := &flakyWriter{}
+	queue, err := services.NewIngestionQueue(writer, services.IngestionQueueOptions{
+		WALPath: filepath.Join(t.TempDir(), "ingestion.wal"),
+	}, utils.NewLogger())
+	if err != nil {
+		t.Fatalf("Failed to create ingestion queue: %v", err)
+	}
+
+	interaction := models.NewInteraction("forged_user", "/api/test", 200, false, "1.1.1.1")
+	interaction.Country = "FR"
+	interaction.City = "Paris"
+	interaction.ASN = 16276
+	interaction.ASOrg = "OVH SAS"
+	interaction.HostingProvider = true
+	interaction.Reputation = []string{"internal"}
+	if err := queue.Enqueue([]models.Interaction{interaction}); err != nil {
+		t.Fatalf("Failed to enqueue: %v", err)
+	}
+	queue.Close()
+
+	written := writer.written
+	if len(written) != 1 {
+		t.Fatalf("Expected 1 written interaction, got %d", len(written))
+	}
+	got := written[0]
+	if got.Country != "" || got.City != "" || got.ASN != 0 || got.ASOrg != "" || got.HostingProvider {
+		t.Errorf("Expected client GeoIP fields to be cleared, got %+v", got)
+	}
+	if len(got.Reputation) != 0 {
+		t.Errorf("Expected client reputation tags to be cleared, got %v", got.Reputation)
+	}
+}
+
+func TestWriteAheadLogReplay(t *testing.T) {
+	walPath := filepath.Join(t.TempDir(), "ingestion.wal")
+	interaction := models.NewInteraction("wal_user", "/api/test", 200, false, "1.1.1.1")
+	entries := make([]models.Interaction, 5)
+	for i := range entries {
+		entries[i] = interaction
+	}
+	wal, err := services.NewWriteAheadLog(walPath)
+	if err != nil {
+		t.Fatalf("Failed to create WAL: %v", err)
+	}
+	if err := wal.Append(entries); err != nil {
+		t.Fatalf("Failed to append to WAL: %v", err)
+	}
+	// A crash in the middle of an append leaves a torn final line
+	file, _ := os.OpenFile(walPath, os.O_APPEND|os.O_WRONLY, 0o644)
+	file.WriteString(`{"user_id":"wal_us`)
+	file.Close()
+
+	var batches []int
+	count, err := wal.Replay(2, func(interactions []models.Interaction) error {
+		batches = append(batches, len(interactions))
+		// Appends are not blocked while batches are written
+		return wal.Append([]models.Interaction{interaction})
+	})
+	if err != nil {
+		t.Fatalf("Failed to replay WAL: %v", err)
+	}
+	if count != 5 || !reflect.DeepEqual(batches, []int{2, 2, 1}) {
+		t.Errorf("Expected 5 interactions in batches of [2 2 1], got %d in %v", count, batches)
+	}
+
+	count, err = wal.Replay(2, func(interactions []models.Interaction) error { return nil })
+	if err != nil || count != 3 {
+		t.Errorf("Expected the 3 interactions appended during the replay to be replayed next, got %d, %v", count, err)
+	}
+	if size := wal.Size(); size != 0 {
+		t.Errorf("Expected an empty WAL after replay, got %d bytes", size)
+	}
+}
+
+func TestWriteAheadLogReplayFailures(t *testing.T) {
+	walPath := filepath.Join(t.TempDir(), "ingestion.wal")
+	// A torn line left before the process restarted is cut off on open
+	os.WriteFile(walPath, []byte(`{"user_id":"a","endpoint":"/"}`+"\n"+`{"user_id":"b","endpoint":"/"}`+"\n"+`{"user_id":"c`), 0o644)
+	wal, err := services.NewWriteAheadLog(walPath)
+	if err != nil {
+		t.Fatalf("Failed to create WAL: %v", err)
+	}
+	if err := wal.Append([]models.Interaction{models.NewInteraction("d", "/", 200, false, "1.1.1.1")}); err != nil {
+		t.Fatalf("Failed to append to WAL: %v", err)
+	}
+
+	// A failed write keeps the log for the next replay
+	if _, err := wal.Replay(10, func([]models.Interaction) error { return errors.New("store unavailable") }); err == nil {
+		t.Fatal("Expected the failed write to be reported")
+	}
+	var users []string
+	count, err := wal.Replay(10, func(interactions []models.Interaction) error {
+		for _, interaction := range interactions {
+			users = append(users, interaction.UserID)
+		}
+		return nil
+	})
+	if err != nil || count != 3 || !reflect.DeepEqual(users, []string{"a", "b", "d"}) {
+		t.Errorf("Expected a, b and d to be replayed, got %v, %d, %v", users, count, err)
+	}
+
+	// Corruption anywhere but the final line is an error
+	os.WriteFile(walPath, []byte("garbage\n"+`{"user_id":"e","endpoint":"/"}`+"\n"), 0o644)
+	if _, err := wal.Replay(10, func([]models.Interaction) error { return nil }); err == nil {
+		t.Error("Expected an error replaying a corrupt WAL")
+	}
+	if wal.Size() == 0 {
+		t.Error("Expected the corrupt WAL to be kept")
+	}
+}
+
+func TestIngestionQueueShedsLoad(t *testing.T) {
+	logger := utils.NewLogger()
+	// A writer that blocks keeps everything in the queue
+	block := make(chan struct{})
+	writer := services.InteractionWriter(blockingWriter(block))
+	queue, err := services.NewIngestionQueue(writer, services.IngestionQueueOptions{
+		MaxPending: 2,
+		Workers:    1,
+		RetryAfter: 3 * time.Second,
+		WALPath:    filepath.Join(t.TempDir(), "ingestion.wal"),
+	}, logger)
+	if err != nil {
+		t.Fatalf("Failed to create ingestion queue: %v", err)
+	}
+	defer queue.Close()
+	defer close(block)
+
+	interaction := models.NewInteraction("busy_user", "/api/test", 200, false, "1.1.1.1")
+	if err := queue.Enqueue([]models.Interaction{interaction, interaction}); err != nil {
+		t.Fatalf("Failed to enqueue: %v", err)
+	}
+
+	handler := handlers.NewInteractionHandler(services.NewMemoryStore(logger), queue, logger)
+	req := httptest.NewRequest(http.MethodPost, "/api/log-interaction",
+		strings.NewReader(`{"user_id": "busy_user", "endpoint": "/", "response_status_code": 200, "ip_address": "1.1.1.1"}`))
+	rec := httptest.NewRecorder()
+	handler.LogInteraction(rec, req)
+
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected status 429, got %d", rec.Code)
+	}
+	if retryAfter := rec.Header().Get("Retry-After"); retryAfter != "3" {
+		t.Errorf("Expected Retry-After to be 3, got %q", retryAfter)
+	}
+}
+
+// closingWriter holds every Submit until the store is closed, then fails it
+type closingWriter struct {
+	started chan struct{}
+	closed  chan struct{}
+	calls   *atomic.Int32
+}
+
+func (w closingWriter) Submit(interactions []models.Interaction) error {
+	w.calls.Add(1)
+	select {
+	case w.started <- struct{}{}:
+	default:
+	}
+	<-w.closed
+	return errors.New("driver closed")
+}
+
+func TestIngestionQueueAbandonSpillsToWAL(t *testing.T) {
+	writer := closingWriter{started: make(chan struct{}, 1), closed: make(chan struct{}), calls: new(atomic.Int32)}
+	queue, err := services.NewIngestionQueue(writer, services.IngestionQueueOptions{
+		Workers:    1,
+		WriteBatch: 1,
+		WALPath:    filepath.Join(t.TempDir(), "ingestion.wal"),
+	}, utils.NewLogger())
+	if err != nil {
+		t.Fatalf("Failed to create ingestion queue: %v", err)
+	}
+
+	interaction := models.NewInteraction("late_user", "/api/test", 200, false, "1.1.1.1")
+	queue.Enqueue([]models.Interaction{interaction})
+	<-writer.started
+	queue.Enqueue([]models.Interaction{interaction})
+	queue.Enqueue([]models.Interaction{interaction})
+
+	// A shutdown that timed out: queued interactions skip the store, and the
+	// write in progress spills once the store is closed
+	closed := make(chan struct{})
+	go func() {
+		queue.Close()
+		close(closed)
+	}()
+	queue.Abandon()
+	close(writer.closed)
+	<-closed
+
+	var spilled []models.Interaction
+	if _, err := queue.WAL.Replay(10, func(batch []models.Interaction) error {
+		spilled = append(spilled, batch...)
+		return nil
+	}); err != nil || len(spilled) != 3 {
+		t.Errorf("Expected all 3 interactions in the WAL, got %d (%v)", len(spilled), err)
+	}
+	if calls := writer.calls.Load(); calls != 1 {
+		t.Errorf("Expected only the write in progress to reach the store, got %d writes", calls)
+	}
+}
+
+// blockingWriter blocks every Submit until release is closed
+type blockingWriter chan struct{}
+
+func (w blockingWriter) Submit(interactions []models.Interaction) error {
+	<-w
+	return nil
+}
+
+// waitFor polls condition until it holds or a second has passed
+func waitFor(t *testing.T, what string, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
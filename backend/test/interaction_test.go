@@ -1,7 +1,14 @@
 package test
 
 import (
+	"backend/handlers"
 	"backend/models"
+	"backend/services"
+	"backend/utils"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 )
@@ -78,3 +85,112 @@ func TestToMap(t *testing.T) {
 		}
 	})
 }
+
+func TestValidateInteraction(t *testing.T) {
+	now := time.Date(2025, 1, 20, 23, 0, 0, 0, time.UTC)
+	valid := models.Interaction{
+		UserID:             "user123",
+		Endpoint:           "/api/test",
+		Timestamp:          now,
+		ResponseStatusCode: 200,
+		IPAddress:          "192.168.1.1",
+		Method:             "GET",
+		RequestSize:        512,
+		LatencyMs:          12.5,
+	}
+	if err := valid.Validate(now); err != nil {
+		t.Fatalf("Expected interaction to be valid, got %v", err)
+	}
+
+	tests := map[string]func(i *models.Interaction){
+		"Missing user_id":      func(i *models.Interaction) { i.UserID = "" },
+		"Relative endpoint":    func(i *models.Interaction) { i.Endpoint = "api/test" },
+		"Invalid status code":  func(i *models.Interaction) { i.ResponseStatusCode = 42 },
+		"Invalid IP address":   func(i *models.Interaction) { i.IPAddress = "not-an-ip" },
+		"IP address with port": func(i *models.Interaction) { i.IPAddress = "192.168.1.1:8080" },
+		"Invalid method":       func(i *models.Interaction) { i.Method = "FETCH" },
+		"Negative size":        func(i *models.Interaction) { i.RequestSize = -1 },
+		"Negative latency":     func(i *models.Interaction) { i.LatencyMs = -1 },
+		"Future timestamp":     func(i *models.Interaction) { i.Timestamp = now.Add(models.MaxTimestampSkew + time.Second) },
+		"Stale timestamp":      func(i *models.Interaction) { i.Timestamp = now.Add(-models.MaxTimestampAge - time.Second) },
+	}
+	for name, mutate := range tests {
+		t.Run(name, func(t *testing.T) {
+			interaction := valid
+			mutate(&interaction)
+			if err := interaction.Validate(now); err == nil {
+				t.Errorf("Expected validation error for %+v", interaction)
+			}
+		})
+	}
+}
+
+func TestLogInteractionHandler(t *testing.T) {
+	ctx := context.Background()
+	logger := utils.NewLogger()
+
+	t.Run("Full payload", func(t *testing.T) {
+		store := services.NewMemoryStore(logger)
+		queue, drain := newTestQueue(t, store, services.IngestionQueueOptions{})
+		handler := handlers.NewInteractionHandler(store, queue, logger)
+
+		body := `{
+			"user_id": "user123",
+			"endpoint": "/api/admin",
+			"response_status_code": 403,
+			"honeytoken_triggered": true,
+			"ip_address": "10.0.0.7:51234",
+			"method": "post",
+			"user_agent": "curl/8.0",
+			"session_id": "sess-1",
+			"request_size": 128,
+			"latency_ms": 3.2
+		}`
+		req := httptest.NewRequest(http.MethodPost, "/api/log-interaction", strings.NewReader(body))
+		rec := httptest.NewRecorder()
+		handler.LogInteraction(rec, req)
+
+		if rec.Code != http.StatusAccepted {
+			t.Fatalf("Expected status 202, got %d: %s", rec.Code, rec.Body.String())
+		}
+		drain()
+		features, err := store.ExtractFeatures(ctx, "user123")
+		if err != nil {
+			t.Fatalf("Failed to extract features: %v", err)
+		}
+		if features.TotalAccessCount != 1 || features.HoneytokenAccessCount != 1 {
+			t.Errorf("Expected one honeytoken interaction to be stored, got %+v", features)
+		}
+	})
+
+	t.Run("Caller address without port", func(t *testing.T) {
+		store := services.NewMemoryStore(logger)
+		queue, _ := newTestQueue(t, store, services.IngestionQueueOptions{})
+		handler := handlers.NewInteractionHandler(store, queue, logger)
+
+		req := httptest.NewRequest(http.MethodPost, "/api/log-interaction",
+			strings.NewReader(`{"user_id": "user456", "endpoint": "/", "response_status_code": 200}`))
+		req.RemoteAddr = "203.0.113.9:4000"
+		rec := httptest.NewRecorder()
+		handler.LogInteraction(rec, req)
+
+		if rec.Code != http.StatusAccepted {
+			t.Fatalf("Expected status 202, got %d: %s", rec.Code, rec.Body.String())
+		}
+	})
+
+	t.Run("Invalid payload", func(t *testing.T) {
+		store := services.NewMemoryStore(logger)
+		queue, _ := newTestQueue(t, store, services.IngestionQueueOptions{})
+		handler := handlers.NewInteractionHandler(store, queue, logger)
+
+		req := httptest.NewRequest(http.MethodPost, "/api/log-interaction",
+			strings.NewReader(`{"user_id": "user123", "endpoint": "/api/test", "response_status_code": 999}`))
+		rec := httptest.NewRecorder()
+		handler.LogInteraction(rec, req)
+
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("Expected status 400, got %d", rec.Code)
+		}
+	})
+}
@@ -0,0 +1,103 @@
+package test
+
+import (
+	"backend/utils"
+	"fmt"
+	"math/rand"
+	"net"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestIPSubnet(t *testing.T) {
+	tests := map[string]string{
+		"203.0.113.7":             "203.0.113.0/24",
+		"203.0.113.7:443":         "203.0.113.0/24",
+		"::ffff:203.0.113.7":      "203.0.113.0/24",
+		"2001:db8:1:2:3:4:5:6":    "2001:db8:1:2::/64",
+		"[2001:db8::1%eth0]:8080": "2001:db8::/64",
+	}
+	for address, expected := range tests {
+		subnet, err := utils.IPSubnet(address)
+		if err != nil || subnet != expected {
+			t.Errorf("Expected subnet of %q to be %s, got %s (%v)", address, expected, subnet, err)
+		}
+	}
+	if _, err := utils.IPSubnet("not an ip"); err == nil {
+		t.Error("Expected an error for an invalid address")
+	}
+}
+
+func TestIPTree(t *testing.T) {
+	tree := utils.NewIPTree()
+	for cidr, value := range map[string]string{
+		"10.0.0.0/8":                "private",
+		"10.1.0.0/16":               "office",
+		"10.1.2.3/32":               "banned",
+		"10.1.128.0/17":             "vpn",
+		"::ffff:192.0.2.0/120":      "test_net",
+		"2001:db8::/32":             "documentation",
+		"2001:db8:1::/48":           "vpn",
+		"2001:db8:1::/64":           "banned",
+		"192.0.2.0/24":              "tor",
+		"198.51.100.128/25":         "datacenter",
+		"2001:db8:ffff::/48":        "datacenter",
+		"2001:db8:ffff:1::dead/128": "banned",
+	} {
+		_, network, _ := net.ParseCIDR(cidr)
+		tree.Insert(network, value)
+	}
+	if tree.Len() != 12 {
+		t.Errorf("Expected 12 networks, got %d", tree.Len())
+	}
+
+	tests := map[string][]string{
+		"10.1.2.3":              {"banned", "office", "private"},
+		"10.1.2.4":              {"office", "private"},
+		"10.1.200.1":            {"office", "private", "vpn"},
+		"10.2.0.1":              {"private"},
+		"192.0.2.9":             {"test_net", "tor"},
+		"::ffff:192.0.2.9":      {"test_net", "tor"},
+		"198.51.100.127":        nil,
+		"198.51.100.200":        {"datacenter"},
+		"2001:db8:1::1":         {"banned", "documentation", "vpn"},
+		"2001:db8:1:1::1":       {"documentation", "vpn"},
+		"2001:db8:ffff:1::dead": {"banned", "datacenter", "documentation"},
+		"2001:db9::1":           nil,
+		"11.0.0.1":              nil,
+	}
+	for address, expected := range tests {
+		if values := tree.Lookup(net.ParseIP(address)); !reflect.DeepEqual(values, expected) {
+			t.Errorf("Expected %s to match %v, got %v", address, expected, values)
+		}
+	}
+}
+
+// TestIPTreeRandom compares lookups with a linear scan over random networks,
+// many of them nested, to exercise node splits
+func TestIPTreeRandom(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	tree := utils.NewIPTree()
+	var networks []*net.IPNet
+	for i := 0; i < 500; i++ {
+		ip := net.IPv4(10, byte(random.Intn(4)), byte(random.Intn(256)), byte(random.Intn(256)))
+		_, network, _ := net.ParseCIDR(fmt.Sprintf("%s/%d", ip, 8+random.Intn(25)))
+		networks = append(networks, network)
+		tree.Insert(network, fmt.Sprint(i))
+	}
+
+	for i := 0; i < 500; i++ {
+		ip := net.IPv4(10, byte(random.Intn(4)), byte(random.Intn(256)), byte(random.Intn(256)))
+		var expected []string
+		for j, network := range networks {
+			if network.Contains(ip) {
+				expected = append(expected, fmt.Sprint(j))
+			}
+		}
+		sort.Strings(expected)
+		if values := tree.Lookup(ip); !reflect.DeepEqual(values, expected) {
+			t.Fatalf("Expected %s to match %v, got %v", ip, expected, values)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package test
+
+import (
+	"backend/handlers"
+	"backend/utils"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestLoggerLevels(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := utils.NewLoggerWithOptions(&buf, "json", "info")
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+
+	logger.Debug("hidden")
+	if buf.Len() != 0 {
+		t.Errorf("Expected debug messages to be dropped at info level, got %q", buf.String())
+	}
+
+	if err := logger.SetLevel("debug"); err != nil {
+		t.Fatalf("Failed to set level: %v", err)
+	}
+	logger.With("component", "test").Debug("shown", "user_id", "user123")
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("Expected a JSON log line, got %q: %v", buf.String(), err)
+	}
+	if entry["msg"] != "shown" || entry["user_id"] != "user123" || entry["component"] != "test" {
+		t.Errorf("Unexpected log entry: %v", entry)
+	}
+
+	if err := logger.SetLevel("verbose"); err == nil {
+		t.Error("Expected an error for an unknown level")
+	}
+	if _, err := utils.NewLoggerWithOptions(&buf, "xml", "info"); err == nil {
+		t.Error("Expected an error for an unknown format")
+	}
+}
+
+func TestRequestIDMiddleware(t *testing.T) {
+	var buf bytes.Buffer
+	logger, _ := utils.NewLoggerWithOptions(&buf, "json", "info")
+
+	handler := handlers.RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		logger.WithContext(r.Context()).Info("handled")
+	}))
+
+	t.Run("Generated", func(t *testing.T) {
+		buf.Reset()
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+		requestID := rec.Header().Get(utils.RequestIDHeader)
+		if requestID == "" {
+			t.Fatal("Expected a generated request ID in the response")
+		}
+		if !strings.Contains(buf.String(), `"request_id":"`+requestID+`"`) {
+			t.Errorf("Expected the log line to carry request ID %s, got %q", requestID, buf.String())
+		}
+	})
+
+	t.Run("Propagated", func(t *testing.T) {
+		buf.Reset()
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(utils.RequestIDHeader, "upstream-42")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		if got := rec.Header().Get(utils.RequestIDHeader); got != "upstream-42" {
+			t.Errorf("Expected the caller's request ID to be kept, got %q", got)
+		}
+	})
+
+	t.Run("Unsafe ID replaced", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(utils.RequestIDHeader, "bad id\nwith newline")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		if got := rec.Header().Get(utils.RequestIDHeader); got == "bad id\nwith newline" || got == "" {
+			t.Errorf("Expected an unsafe request ID to be replaced, got %q", got)
+		}
+	})
+}
@@ -0,0 +1,125 @@
+package test
+
+import (
+	"backend/models"
+	"backend/services"
+	"backend/utils"
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestMemoryStore(t *testing.T) {
+	ctx := context.Background()
+	logger := utils.NewLogger()
+	store := services.NewMemoryStore(logger)
+
+	userID := "test_user_123"
+	interactions := []models.Interaction{
+		models.NewInteraction(userID, "/api/endpoint1", 200, false, "1.1.1.1"),
+		models.NewInteraction(userID, "/api/endpoint2", 404, true, "2.2.2.2"),
+		models.NewInteraction(userID, "/api/endpoint3", 500, true, "1.1.1.1"),
+	}
+
+	for _, interaction := range interactions {
+		if err := store.SaveInteraction(ctx, interaction); err != nil {
+			t.Fatalf("Failed to save interaction for user %s: %v", userID, err)
+		}
+	}
+
+	// Malicious score starts at 0.0 and can be updated
+	initialScore, err := store.GetMaliciousScore(ctx, userID)
+	if err != nil {
+		t.Fatalf("Failed to get malicious score for user %s: %v", userID, err)
+	}
+	if initialScore != 0.0 {
+		t.Errorf("Expected malicious score to be 0.0 initially, got %f", initialScore)
+	}
+	if err := store.UpdateMaliciousScore(ctx, userID, 3.5); err != nil {
+		t.Fatalf("Failed to update malicious score for user %s: %v", userID, err)
+	}
+	if score, _ := store.GetMaliciousScore(ctx, userID); score != 3.5 {
+		t.Errorf("Expected malicious score to be 3.5, got %f", score)
+	}
+
+	if _, err := store.GetMaliciousScore(ctx, "unknown_user"); !errors.Is(err, services.ErrUserNotFound) {
+		t.Errorf("Expected ErrUserNotFound for an unknown user, got %v", err)
+	}
+
+	// Associate users and give them scores
+	if err := store.AssociatedWith(ctx, userID, "test_user_associated_1"); err != nil {
+		t.Fatalf("Failed to associate users: %v", err)
+	}
+	if err := store.AssociatedWith(ctx, userID, "test_user_associated_2"); err != nil {
+		t.Fatalf("Failed to associate users: %v", err)
+	}
+	store.UpdateMaliciousScore(ctx, "test_user_associated_1", 6.0)
+	store.UpdateMaliciousScore(ctx, "test_user_associated_2", 4.0)
+
+	features, err := store.ExtractFeatures(ctx, userID)
+	if err != nil {
+		t.Fatalf("Failed to extract features: %v", err)
+	}
+
+	expected := models.UserFeatures{
+		TotalAccessCount:            3,
+		HoneytokenAccessCount:       2,
+		WeightedHoneytokenScore:     2 * models.DefaultHoneytokenWeight,
+		SharedIPCount:               2,
+		AvgAssociatedMaliciousScore: 5.0,
+	}
+	if !reflect.DeepEqual(lifetimeFeatures(features), expected) {
+		t.Errorf("Expected features %+v, got %+v", expected, features)
+	}
+
+	// A user without interactions gets zero interaction features
+	associateFeatures, err := store.ExtractFeatures(ctx, "test_user_associated_1")
+	if err != nil {
+		t.Fatalf("Failed to extract features for a user without interactions: %v", err)
+	}
+	if associateFeatures.TotalAccessCount != 0 || associateFeatures.AvgAssociatedMaliciousScore != 3.5 {
+		t.Errorf("Unexpected features for a user without interactions: %+v", associateFeatures)
+	}
+}
+
+func TestMemoryStoreSharedIPFeatures(t *testing.T) {
+	ctx := context.Background()
+	store := services.NewMemoryStore(utils.NewLogger())
+
+	// alice shares 203.0.113.7 with bob and carol, and 198.51.100.0/24 with dave
+	store.SaveInteraction(ctx, models.NewInteraction("alice", "/a", 200, false, "203.0.113.7"))
+	store.SaveInteraction(ctx, models.NewInteraction("alice", "/a", 200, false, "198.51.100.1:5000"))
+	store.SaveInteraction(ctx, models.NewInteraction("alice", "/a", 200, false, "2001:db8::1"))
+	store.SaveInteractions(ctx, []models.Interaction{
+		models.NewInteraction("bob", "/a", 200, false, "203.0.113.7:443"),
+		models.NewInteraction("carol", "/a", 200, false, "203.0.113.7"),
+		models.NewInteraction("dave", "/a", 200, false, "198.51.100.200"),
+	})
+
+	features, err := store.ExtractFeatures(ctx, "alice")
+	if err != nil {
+		t.Fatalf("Failed to extract features: %v", err)
+	}
+	if features.SharedIPCount != 3 || features.IPsSharedWithOthers != 1 || features.UsersSharingIPs != 2 || features.SubnetsSharedWithOthers != 2 {
+		t.Errorf("Unexpected shared-IP features: %+v", features)
+	}
+
+	features, _ = store.ExtractFeatures(ctx, "dave")
+	if features.IPsSharedWithOthers != 0 || features.UsersSharingIPs != 0 || features.SubnetsSharedWithOthers != 1 {
+		t.Errorf("Expected dave to share only a subnet, got %+v", features)
+	}
+}
+
+func TestMemoryStoreRejectsDuplicateHoneytoken(t *testing.T) {
+	ctx := context.Background()
+	store := services.NewMemoryStore(utils.NewLogger())
+
+	token := models.NewHoneytoken(models.HoneytokenAPIKey, models.SeverityHigh, "config.yaml", "Fake API key")
+	if err := store.CreateHoneytoken(ctx, token); err != nil {
+		t.Fatalf("Failed to create honeytoken: %v", err)
+	}
+	if err := store.CreateHoneytoken(ctx, token); !errors.Is(err, services.ErrHoneytokenExists) {
+		t.Errorf("Expected ErrHoneytokenExists for a duplicate token_id, got %v", err)
+	}
+}
@@ -0,0 +1,74 @@
+package test
+
+import (
+	"backend/metrics"
+	"backend/models"
+	"backend/services"
+	"backend/utils"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMetricsInstrumentation(t *testing.T) {
+	ctx := context.Background()
+	logger := utils.NewLogger()
+	appMetrics := metrics.New()
+
+	store := appMetrics.InstrumentStore(services.NewMemoryStore(logger))
+	server := newFakeModelServer(t, 0.75)
+	scorer := appMetrics.InstrumentScorer(services.NewAIIntegrationService(server.URL, logger))
+	analysis := services.NewUserAnalysisService(store, scorer, logger)
+
+	userID := "metrics_user"
+	store.SaveInteraction(ctx, models.NewInteraction(userID, "/api/endpoint1", 200, false, "1.1.1.1"))
+	store.SaveInteractions(ctx, []models.Interaction{
+		models.NewInteraction(userID, "/api/endpoint2", 200, true, "2.2.2.2"),
+		models.NewInteraction(userID, "/api/endpoint3", 200, true, "2.2.2.2"),
+	})
+	if _, err := store.GetMaliciousScore(ctx, "unknown_user"); err == nil {
+		t.Fatal("Expected an error for an unknown user")
+	}
+	if _, err := analysis.AnalyzeUser(ctx, userID); err != nil {
+		t.Fatalf("Failed to analyze user: %v", err)
+	}
+
+	failing := appMetrics.InstrumentScorer(services.NewAIIntegrationService("http://127.0.0.1:1", logger))
+	if _, err := failing.Score(ctx, models.NewFeatureVector(models.UserFeatures{})); err == nil {
+		t.Fatal("Expected an error from an unreachable model server")
+	}
+
+	route := appMetrics.InstrumentHandler("/api/teapot", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+	route(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/api/teapot", nil))
+
+	appMetrics.RegisterGauge("ingestion_queue_pending", "Interactions waiting in the ingestion queue.", func() float64 { return 7 })
+
+	rec := httptest.NewRecorder()
+	appMetrics.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body, _ := io.ReadAll(rec.Body)
+	exposition := string(body)
+
+	expected := []string{
+		`muds_http_requests_total{code="418",method="POST",route="/api/teapot"} 1`,
+		`muds_http_request_duration_seconds_count{method="POST",route="/api/teapot"} 1`,
+		`muds_store_operation_duration_seconds_count{operation="SaveInteraction"} 1`,
+		`muds_store_operation_duration_seconds_count{operation="SaveInteractions"} 1`,
+		`muds_store_operation_errors_total{operation="GetMaliciousScore"} 1`,
+		`muds_honeytoken_triggers_total 2`,
+		`muds_prediction_duration_seconds_count{scorer="remote_model"} 2`,
+		`muds_prediction_failures_total{scorer="remote_model"} 1`,
+		`muds_maliciousness_score_bucket{scorer="remote_model",le="0.7"} 0`,
+		`muds_maliciousness_score_bucket{scorer="remote_model",le="0.8"} 1`,
+		`muds_ingestion_queue_pending 7`,
+	}
+	for _, line := range expected {
+		if !strings.Contains(exposition, line) {
+			t.Errorf("Expected metrics to contain %q", line)
+		}
+	}
+}
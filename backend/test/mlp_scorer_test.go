@@ -0,0 +1,134 @@
+package test
+
+import (
+	"backend/models"
+	"backend/services"
+	"context"
+	"encoding/json"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// mlpFixture is a small MLPRegressor exported with scikit-learn's predictions
+// of it in mlpPredictions. Regenerate both from the ai directory with
+//
+//	python -m models.export_model --hidden-layers 5,3 --version mlp-test-fixture \
+//	    --output ../backend/test/testdata/mlp_model.json --predictions ../backend/test/testdata/mlp_predictions.json
+const (
+	mlpFixture     = "testdata/mlp_model.json"
+	mlpPredictions = "testdata/mlp_predictions.json"
+)
+
+func TestMLPScorerParity(t *testing.T) {
+	model, err := services.LoadMLPModel(mlpFixture)
+	if err != nil {
+		t.Fatalf("Failed to load model: %v", err)
+	}
+	if len(model.Reference) == 0 {
+		t.Fatal("Expected the fixture to contain reference predictions")
+	}
+
+	for i, reference := range model.Reference {
+		prediction, err := model.Predict(reference.Features)
+		if err != nil {
+			t.Fatalf("Failed to predict reference %d: %v", i, err)
+		}
+		if math.Abs(prediction-reference.Prediction) > 1e-9 {
+			t.Errorf("Reference %d: expected %.12f, got %.12f", i, reference.Prediction, prediction)
+		}
+	}
+}
+
+func TestMLPScorerMatchesSklearn(t *testing.T) {
+	data, err := os.ReadFile(mlpPredictions)
+	if os.IsNotExist(err) {
+		t.Skipf("%s has not been generated yet", mlpPredictions)
+	}
+	if err != nil {
+		t.Fatalf("Failed to read predictions: %v", err)
+	}
+	var predictions []services.MLPReference
+	if err := json.Unmarshal(data, &predictions); err != nil {
+		t.Fatalf("Failed to decode predictions: %v", err)
+	}
+	model, err := services.LoadMLPModel(mlpFixture)
+	if err != nil {
+		t.Fatalf("Failed to load model: %v", err)
+	}
+
+	for i, expected := range predictions {
+		prediction, err := model.Predict(expected.Features)
+		if err != nil {
+			t.Fatalf("Failed to predict row %d: %v", i, err)
+		}
+		if math.Abs(prediction-expected.Prediction) > 1e-6 {
+			t.Errorf("Row %d %v: scikit-learn predicted %.9f, got %.9f", i, expected.Features, expected.Prediction, prediction)
+		}
+	}
+}
+
+func TestMLPScorerScore(t *testing.T) {
+	scorer, err := services.NewMLPScorer(mlpFixture)
+	if err != nil {
+		t.Fatalf("Failed to load model: %v", err)
+	}
+
+	reference := scorer.Model.Reference[0]
+	features := models.UserFeatures{
+		TotalAccessCount:            int64(reference.Features[0]),
+		HoneytokenAccessCount:       int64(reference.Features[1]),
+		SharedIPCount:               int64(reference.Features[2]),
+		AvgAssociatedMaliciousScore: reference.Features[3],
+	}
+	result, err := scorer.Score(context.Background(), models.NewFeatureVector(features))
+	if err != nil {
+		t.Fatalf("Failed to score features: %v", err)
+	}
+	if math.Abs(result.Score()-reference.Prediction) > 1e-9 || result.Scorer != "mlp" || result.Prediction.ModelVersion != scorer.Model.ModelVersion {
+		t.Errorf("Unexpected result: %+v", result)
+	}
+}
+
+func TestLoadMLPModelValidation(t *testing.T) {
+	data, err := os.ReadFile(mlpFixture)
+	if err != nil {
+		t.Fatalf("Failed to read fixture: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		mutate func(m map[string]interface{})
+	}{
+		{"UnsupportedFormat", func(m map[string]interface{}) { m["format_version"] = 99 }},
+		{"DuplicateFeature", func(m map[string]interface{}) {
+			m["feature_names"] = []string{"total_access_count", "honeytoken_access_count", "shared_ip_count", "shared_ip_count"}
+		}},
+		{"UnknownActivation", func(m map[string]interface{}) { m["activation"] = "softsign" }},
+		{"MissingClip", func(m map[string]interface{}) { delete(m, "clip") }},
+		{"ShapeMismatch", func(m map[string]interface{}) {
+			layers := m["layers"].([]interface{})
+			m["layers"] = layers[1:]
+		}},
+		{"ScalerMismatch", func(m map[string]interface{}) {
+			m["input_scaler"] = map[string]interface{}{"scale": []float64{1}, "min": []float64{0}}
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var artifact map[string]interface{}
+			json.Unmarshal(data, &artifact)
+			tt.mutate(artifact)
+
+			path := filepath.Join(t.TempDir(), "model.json")
+			encoded, _ := json.Marshal(artifact)
+			os.WriteFile(path, encoded, 0o644)
+
+			if _, err := services.LoadMLPModel(path); err == nil {
+				t.Error("Expected an invalid artifact to be rejected")
+			}
+		})
+	}
+}
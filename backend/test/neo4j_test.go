@@ -1,6 +1,7 @@
 package test
 
 import (
+	"backend/config"
 	"backend/models"
 	"backend/services"
 	"backend/utils"
@@ -12,18 +13,25 @@ import (
 func TestNeo4jService(t *testing.T) {
 	// 1. Setup: create a test logger (you can use your own logger implementation)
 	logger := utils.NewLogger()
+	ctx := context.Background()
 
-	// 2. Provide your test Neo4j connection details (could be from environment variables).
-	uri := "bolt://localhost:7687"
-	username := "neo4j"
-	password := "Password"
+	// 2. Load the test Neo4j connection details (MUDS_NEO4J_* environment variables).
+	cfg, err := config.Load(nil)
+	if err != nil {
+		t.Fatalf("Failed to load configuration: %v", err)
+	}
+	uri := cfg.Neo4j.URI
+	username := cfg.Neo4j.Username
+	password := cfg.Neo4j.Password
 
 	// 3. Create the Neo4jService
-	svc := services.NewNeo4jService(uri, username, password, logger)
+	svc, err := services.NewNeo4jService(uri, username, password, logger)
+	if err != nil {
+		t.Fatalf("Failed to create Neo4jService: %v", err)
+	}
 
 	// 4. Defer closing the driver until after tests run
 	defer func() {
-		ctx := context.Background()
 		if err := svc.Driver.Close(ctx); err != nil {
 			t.Fatalf("Failed to close Neo4j driver: %v", err)
 		}
@@ -39,7 +47,7 @@ func TestNeo4jService(t *testing.T) {
 
 	// 6. Save multiple interactions
 	for _, interaction := range interactions {
-		err := svc.SaveInteraction(interaction)
+		err := svc.SaveInteraction(ctx, interaction)
 		if err != nil {
 			t.Fatalf("Failed to save interaction for user %s: %v", userID, err)
 		}
@@ -55,7 +63,7 @@ func TestNeo4jService(t *testing.T) {
 	`
 	params := map[string]interface{}{"user_id": userID}
 
-	records, err := svc.RunQuery(query, params)
+	records, err := svc.RunQuery(ctx, query, params)
 	if err != nil {
 		t.Fatalf("Failed to run query to validate data: %v", err)
 	}
@@ -95,7 +103,7 @@ func TestNeo4jService(t *testing.T) {
 	}
 
 	// 9. Test GetMaliciousScore (should be 0.0 by default)
-	initialScore, err := svc.GetMaliciousScore(userID)
+	initialScore, err := svc.GetMaliciousScore(ctx, userID)
 	if err != nil {
 		t.Fatalf("Failed to get malicious score for user %s: %v", userID, err)
 	}
@@ -105,12 +113,12 @@ func TestNeo4jService(t *testing.T) {
 
 	// 10. Test UpdateMaliciousScore
 	newScore := 3.5
-	err = svc.UpdateMaliciousScore(userID, newScore)
+	err = svc.UpdateMaliciousScore(ctx, userID, newScore)
 	if err != nil {
 		t.Fatalf("Failed to update malicious score for user %s: %v", userID, err)
 	}
 
-	updatedScore, err := svc.GetMaliciousScore(userID)
+	updatedScore, err := svc.GetMaliciousScore(ctx, userID)
 	if err != nil {
 		t.Fatalf("Failed to re-fetch malicious score for user %s: %v", userID, err)
 	}
@@ -123,18 +131,18 @@ func TestNeo4jService(t *testing.T) {
 	associatedUserID2 := "test_user_associated_2"
 
 	// Associate them
-	if err := svc.AssociatedWith(userID, associatedUserID1); err != nil {
+	if err := svc.AssociatedWith(ctx, userID, associatedUserID1); err != nil {
 		t.Fatalf("Failed to associate user %s with %s: %v", userID, associatedUserID1, err)
 	}
-	if err := svc.AssociatedWith(userID, associatedUserID2); err != nil {
+	if err := svc.AssociatedWith(ctx, userID, associatedUserID2); err != nil {
 		t.Fatalf("Failed to associate user %s with %s: %v", userID, associatedUserID2, err)
 	}
 
 	// Update malicious scores for associated users
-	if err := svc.UpdateMaliciousScore(associatedUserID1, 6.0); err != nil {
+	if err := svc.UpdateMaliciousScore(ctx, associatedUserID1, 6.0); err != nil {
 		t.Fatalf("Failed to update malicious score for %s: %v", associatedUserID1, err)
 	}
-	if err := svc.UpdateMaliciousScore(associatedUserID2, 4.0); err != nil {
+	if err := svc.UpdateMaliciousScore(ctx, associatedUserID2, 4.0); err != nil {
 		t.Fatalf("Failed to update malicious score for %s: %v", associatedUserID2, err)
 	}
 
@@ -143,7 +151,7 @@ func TestNeo4jService(t *testing.T) {
 		MATCH (u:User {user_id: $user_id})-[:ASSOCIATED_WITH]->(p:User)
 		RETURN AVG(p.malicious_score) AS avg_associated_malicious_score
 	`
-	avgRecords, err := svc.RunQuery(avgQuery, map[string]interface{}{"user_id": userID})
+	avgRecords, err := svc.RunQuery(ctx, avgQuery, map[string]interface{}{"user_id": userID})
 	if err != nil {
 		t.Fatalf("Failed to run avg malicious score query: %v", err)
 	}
@@ -165,12 +173,14 @@ func TestNeo4jService(t *testing.T) {
 
 	// 13. Clean up the database (delete all nodes and relationships)
 	cleanupQuery := `MATCH (n) DETACH DELETE n`
-	_, err = svc.RunQuery(cleanupQuery, nil)
+	_, err = svc.RunQuery(ctx, cleanupQuery, nil)
 	if err != nil {
 		t.Fatalf("Failed to clean up database: %v", err)
 	}
 
 	// 14. Close the driver (if not already done by defer)
-	svc.CloseDriver()
+	if err := svc.CloseDriver(ctx); err != nil {
+		t.Fatalf("Failed to close Neo4j driver: %v", err)
+	}
 	fmt.Println("TestNeo4jService completed successfully.")
 }
@@ -0,0 +1,148 @@
+package test
+
+import (
+	"backend/models"
+	"backend/services"
+	"backend/utils"
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// newTestReputation writes a Tor exit list and a CSV range list to a
+// temporary directory and loads them
+func newTestReputation(t *testing.T) (*services.IPReputation, string, string) {
+	t.Helper()
+	dir := t.TempDir()
+	torList := filepath.Join(dir, "tor-exits.txt")
+	rangeList := filepath.Join(dir, "ranges.csv")
+	os.WriteFile(torList, []byte("# Tor exit nodes\n192.0.2.10\n192.0.2.11  # relay\n\nnot-an-address\n2001:db8::10\n"), 0o644)
+	os.WriteFile(rangeList, []byte("network,category\n198.51.100.0/24,datacenter\n203.0.113.0/25,\n10.0.0.0/8,banned\n"), 0o644)
+
+	reputation, err := services.NewIPReputation(services.ReputationOptions{Lists: []services.ReputationList{
+		{Path: torList, Category: "tor"},
+		{Path: rangeList, Category: "vpn", RowCategories: []string{"datacenter", "banned"}},
+	}}, utils.NewLogger())
+	if err != nil {
+		t.Fatalf("Failed to load reputation lists: %v", err)
+	}
+	return reputation, torList, rangeList
+}
+
+func TestIPReputation(t *testing.T) {
+	reputation, _, _ := newTestReputation(t)
+
+	tests := map[string][]string{
+		"192.0.2.10":       {"tor"},
+		"192.0.2.11:443":   {"tor"},
+		"192.0.2.12":       nil,
+		"[2001:db8::10]:8": {"tor"},
+		"198.51.100.7":     {"datacenter"},
+		"203.0.113.7":      {"vpn"}, // No category column falls back to the list's
+		"203.0.113.200":    nil,
+		"10.20.30.40":      {"banned"},
+		"not an ip":        nil,
+	}
+	for address, expected := range tests {
+		if categories := reputation.Lookup(address); !reflect.DeepEqual(categories, expected) {
+			t.Errorf("Expected %s to be tagged %v, got %v", address, expected, categories)
+		}
+	}
+	if categories := reputation.Categories(); !reflect.DeepEqual(categories, []string{"banned", "datacenter", "tor", "vpn"}) {
+		t.Errorf("Unexpected categories: %v", categories)
+	}
+
+	interaction := models.NewInteraction("alice", "/a", 200, false, "192.0.2.10")
+	interaction.Reputation = []string{"spoofed"}
+	reputation.Enrich(&interaction)
+	if !reflect.DeepEqual(interaction.Reputation, []string{"tor"}) {
+		t.Errorf("Expected the interaction to be tagged tor, got %v", interaction.Reputation)
+	}
+
+	if _, err := services.NewIPReputation(services.ReputationOptions{Lists: []services.ReputationList{
+		{Path: "/nonexistent.txt", Category: "tor"},
+	}}, utils.NewLogger()); err == nil {
+		t.Error("Expected an error loading a missing list")
+	}
+
+	// Row categories must be declared, since only declared ones get a feature
+	rangeList := filepath.Join(t.TempDir(), "ranges.csv")
+	os.WriteFile(rangeList, []byte("198.51.100.0/24,datacenter\n10.0.0.0/8,banned\n"), 0o644)
+	for _, list := range []services.ReputationList{
+		{Path: rangeList, Category: "vpn", RowCategories: []string{"datacenter"}},
+		{Path: rangeList, Category: "vpn", RowCategories: []string{"datacenter", "Banned Ranges"}},
+	} {
+		if _, err := services.NewIPReputation(services.ReputationOptions{Lists: []services.ReputationList{list}}, utils.NewLogger()); err == nil {
+			t.Errorf("Expected an error loading a list with row categories %v", list.RowCategories)
+		}
+	}
+}
+
+func TestIPReputationReload(t *testing.T) {
+	reputation, torList, rangeList := newTestReputation(t)
+	if reloaded, err := reputation.Reload(); reloaded || err != nil {
+		t.Fatalf("Expected no reload of unchanged lists, got %v, %v", reloaded, err)
+	}
+
+	os.WriteFile(torList, []byte("192.0.2.99\n"), 0o644)
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(torList, later, later)
+	if reloaded, err := reputation.Reload(); !reloaded || err != nil {
+		t.Fatalf("Expected the changed list to be reloaded, got %v, %v", reloaded, err)
+	}
+	if reputation.Lookup("192.0.2.10") != nil || reputation.Lookup("192.0.2.99") == nil {
+		t.Error("Expected the reloaded Tor list to replace the old one")
+	}
+	if reputation.Lookup("198.51.100.7") == nil {
+		t.Error("Expected unchanged lists to stay loaded")
+	}
+
+	// A broken update keeps the previous lists
+	os.WriteFile(rangeList, []byte("\"198.51.100.0/24,datacenter\n"), 0o644)
+	os.Chtimes(rangeList, later, later)
+	if _, err := reputation.Reload(); err == nil {
+		t.Error("Expected an error reloading a malformed list")
+	}
+	if reputation.Lookup("198.51.100.7") == nil || reputation.Lookup("192.0.2.99") == nil {
+		t.Error("Expected the previous lists to stay in use")
+	}
+}
+
+func TestReputationFeatures(t *testing.T) {
+	ctx := context.Background()
+	reputation, _, _ := newTestReputation(t)
+	store := services.NewMemoryStore(utils.NewLogger())
+	queue, drain := newTestQueue(t, store, services.IngestionQueueOptions{
+		Enrichers: []services.InteractionEnricher{reputation},
+	})
+
+	if err := queue.Enqueue([]models.Interaction{
+		models.NewInteraction("mallory", "/a", 200, false, "192.0.2.10"),
+		models.NewInteraction("mallory", "/a", 200, false, "192.0.2.11"),
+		models.NewInteraction("mallory", "/a", 200, false, "198.51.100.7"),
+		models.NewInteraction("mallory", "/a", 200, false, "192.0.2.1"),
+	}); err != nil {
+		t.Fatalf("Failed to enqueue interactions: %v", err)
+	}
+	drain()
+
+	features, err := store.ExtractFeatures(ctx, "mallory")
+	if err != nil {
+		t.Fatalf("Failed to extract features: %v", err)
+	}
+	if features.ReputationTrafficRatio != 0.75 {
+		t.Errorf("Expected 3 of 4 interactions from listed IPs, got %f", features.ReputationTrafficRatio)
+	}
+
+	interactions, _ := store.GetInteractions(ctx, "mallory", time.Time{})
+	data := services.FeatureData{UserID: "mallory", Interactions: interactions}
+	for category, expected := range map[string]float64{"tor": 0.5, "datacenter": 0.25, "vpn": 0} {
+		feature := services.ReputationCategoryFeature{Category: category}
+		if value, _ := feature.Compute(data); value != expected {
+			t.Errorf("Expected %s to be %f, got %v", feature.Name(), expected, value)
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package test
+
+import (
+	"backend/handlers"
+	"backend/models"
+	"backend/services"
+	"backend/utils"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// blockingScorer scores 0.5 once release is closed
+type blockingScorer struct {
+	release chan struct{}
+}
+
+func (s *blockingScorer) Name() string { return "blocking" }
+
+func (s *blockingScorer) Score(ctx context.Context, vector models.FeatureVector) (services.ScoreResult, error) {
+	select {
+	case <-s.release:
+		return services.ScoreResult{Prediction: models.NewPrediction(0.5, "blocking", "v1"), Scorer: s.Name()}, nil
+	case <-ctx.Done():
+		return services.ScoreResult{}, ctx.Err()
+	}
+}
+
+// newRescoringFixture returns a job over a memory store holding user_1 to user_n
+func newRescoringFixture(t *testing.T, users int, scorer services.Scorer) (*services.RescoringJob, *services.MemoryStore) {
+	t.Helper()
+	logger := utils.NewLogger()
+	store := services.NewMemoryStore(logger)
+	for i := 1; i <= users; i++ {
+		store.SaveInteraction(context.Background(), models.NewInteraction(fmt.Sprintf("user_%d", i), "/api/a", 200, i%2 == 0, "1.1.1.1"))
+	}
+
+	options := services.DefaultRescoringOptions()
+	options.Interval = 0
+	options.Workers = 2
+	options.BatchSize = 2
+	options.CheckpointPath = filepath.Join(t.TempDir(), "rescoring.checkpoint")
+	job := services.NewRescoringJob(services.NewUserAnalysisService(store, scorer, logger), options, logger)
+	t.Cleanup(job.Stop)
+	return job, store
+}
+
+// waitForRun waits until the current run of job has finished
+func waitForRun(t *testing.T, job *services.RescoringJob) services.RescoringStatus {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if status := job.Status(); !status.Running {
+			return status
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatal("Timed out waiting for the re-scoring run")
+	return services.RescoringStatus{}
+}
+
+func TestRescoringJob(t *testing.T) {
+	ctx := context.Background()
+	job, store := newRescoringFixture(t, 5, services.NewHeuristicScorer(services.DefaultHeuristicWeights()))
+
+	if _, err := job.Trigger(false); err != nil {
+		t.Fatalf("Failed to trigger run: %v", err)
+	}
+	status := waitForRun(t, job)
+	if status.Scored != 5 || status.Failed != 0 || status.LastUserID != "user_5" || status.LastError != "" || status.Trigger != services.RescoringTriggerManual {
+		t.Errorf("Unexpected status after a full run: %+v", status)
+	}
+	if score, _ := store.GetMaliciousScore(ctx, "user_2"); score == 0 {
+		t.Error("Expected the run to persist malicious_score")
+	}
+	if _, err := os.Stat(job.Options.CheckpointPath); !os.IsNotExist(err) {
+		t.Errorf("Expected the checkpoint to be removed after a finished run, got %v", err)
+	}
+
+	// Only the user with a new interaction is stale, even when the interaction
+	// arrives late with a timestamp from before the last score
+	time.Sleep(2 * time.Millisecond)
+	late := models.NewInteraction("user_3", "/api/b", 200, false, "1.1.1.1")
+	late.Timestamp = time.Now().Add(-time.Hour)
+	store.SaveInteraction(ctx, late)
+	job.Trigger(true)
+	status = waitForRun(t, job)
+	if status.Scored != 1 || !status.StaleOnly {
+		t.Errorf("Expected a stale-only run to re-score 1 user, got %+v", status)
+	}
+	if history, _ := store.GetScoreHistory(ctx, "user_3"); len(history) != 2 {
+		t.Errorf("Expected user_3 to be scored twice, got %d snapshots", len(history))
+	}
+}
+
+func TestRescoringJobResumesFromCheckpoint(t *testing.T) {
+	ctx := context.Background()
+	job, store := newRescoringFixture(t, 5, services.NewHeuristicScorer(services.DefaultHeuristicWeights()))
+
+	checkpoint := `{"run_id": "crashed", "trigger": "manual", "last_user_id": "user_2", "scored": 2}`
+	os.WriteFile(job.Options.CheckpointPath, []byte(checkpoint), 0o644)
+
+	job.Start()
+	status := waitForRun(t, job)
+	if status.RunID != "crashed" || status.Trigger != services.RescoringTriggerResume || status.Scored != 5 {
+		t.Errorf("Expected the crashed run to resume and finish, got %+v", status)
+	}
+	for _, userID := range []string{"user_1", "user_2"} {
+		if history, _ := store.GetScoreHistory(ctx, userID); len(history) != 0 {
+			t.Errorf("Expected %s before the checkpoint not to be re-scored", userID)
+		}
+	}
+	if history, _ := store.GetScoreHistory(ctx, "user_3"); len(history) != 1 {
+		t.Error("Expected user_3 after the checkpoint to be scored")
+	}
+}
+
+func TestRescoringJobStopKeepsCheckpoint(t *testing.T) {
+	scorer := &blockingScorer{release: make(chan struct{})}
+	job, _ := newRescoringFixture(t, 3, scorer)
+
+	if _, err := job.Trigger(false); err != nil {
+		t.Fatalf("Failed to trigger run: %v", err)
+	}
+	if _, err := job.Trigger(false); !errors.Is(err, services.ErrRescoringRunning) {
+		t.Errorf("Expected ErrRescoringRunning while a run is in progress, got %v", err)
+	}
+
+	job.Stop()
+	status := job.Status()
+	if status.Running || status.Scored != 0 || status.LastError == "" {
+		t.Errorf("Expected the run to be interrupted without progress, got %+v", status)
+	}
+	data, err := os.ReadFile(job.Options.CheckpointPath)
+	if err != nil || !strings.Contains(string(data), status.RunID) {
+		t.Errorf("Expected the checkpoint to remain for the next start, got %q (%v)", data, err)
+	}
+}
+
+func TestRescoringHandler(t *testing.T) {
+	job, _ := newRescoringFixture(t, 2, services.NewHeuristicScorer(services.DefaultHeuristicWeights()))
+	handler := handlers.NewRescoringHandler(job, utils.NewLogger())
+
+	rec := httptest.NewRecorder()
+	handler.Rescoring(rec, httptest.NewRequest(http.MethodPost, "/api/rescoring", strings.NewReader(`{"stale_only": true}`)))
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("Expected status 202, got %d: %s", rec.Code, rec.Body.String())
+	}
+	waitForRun(t, job)
+
+	rec = httptest.NewRecorder()
+	handler.Rescoring(rec, httptest.NewRequest(http.MethodGet, "/api/rescoring", nil))
+	var status services.RescoringStatus
+	if err := json.Unmarshal(rec.Body.Bytes(), &status); err != nil {
+		t.Fatalf("Failed to decode status: %v", err)
+	}
+	if rec.Code != http.StatusOK || status.Running || status.Scored != 2 || !status.StaleOnly || status.FinishedAt == nil {
+		t.Errorf("Unexpected status %d: %+v", rec.Code, status)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.Rescoring(rec, httptest.NewRequest(http.MethodDelete, "/api/rescoring", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected status 405, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,120 @@
+package test
+
+import (
+	"backend/models"
+	"backend/services"
+	"backend/utils"
+	"context"
+	"math"
+	"testing"
+)
+
+func TestPropagateRisk(t *testing.T) {
+	options := services.DefaultRiskPropagationOptions()
+
+	t.Run("TwoUsers", func(t *testing.T) {
+		options := options
+		options.Damping = 0.5
+		graph := models.UserGraph{
+			Users: []models.GraphUser{{UserID: "seed", MaliciousScore: 0.9}, {UserID: "accomplice"}},
+			Edges: []models.GraphEdge{{From: "seed", To: "accomplice", Weight: 1}},
+		}
+		result := services.PropagateRisk(graph, options)
+		// risk(seed) = 0.5 + 0.5 * risk(accomplice) and risk(accomplice) = 0.5 * risk(seed)
+		if math.Abs(result.Risks["seed"]-2.0/3) > 1e-5 || math.Abs(result.Risks["accomplice"]-1.0/3) > 1e-5 {
+			t.Errorf("Expected risks 2/3 and 1/3, got %v", result.Risks)
+		}
+		if !result.Converged || result.Seeds != 1 || result.Users != 2 {
+			t.Errorf("Unexpected result: %+v", result)
+		}
+	})
+
+	t.Run("Ring", func(t *testing.T) {
+		// A ring of clean users around a honeytoken triggerer, and an unrelated clean clique
+		graph := models.UserGraph{
+			Users: []models.GraphUser{
+				{UserID: "trigger", HoneytokenHits: 1},
+				{UserID: "ring_1", MaliciousScore: 0.1}, {UserID: "ring_2", MaliciousScore: 0.1}, {UserID: "ring_3", MaliciousScore: 0.1},
+				{UserID: "clean_1"}, {UserID: "clean_2"}, {UserID: "loner", MaliciousScore: 0.5},
+			},
+			Edges: []models.GraphEdge{
+				{From: "trigger", To: "ring_1", Weight: 1}, {From: "ring_1", To: "ring_2", Weight: 1}, {From: "ring_2", To: "ring_3", Weight: 1}, {From: "ring_3", To: "trigger", Weight: 1},
+				{From: "clean_1", To: "clean_2", Weight: 1},
+			},
+		}
+		result := services.PropagateRisk(graph, options)
+		for _, userID := range []string{"ring_1", "ring_2", "ring_3"} {
+			// Each member's own score is 0.1
+			if result.Risks[userID] <= 0.1 {
+				t.Errorf("Expected ring member %s to be riskier than it looks on its own, got %f", userID, result.Risks[userID])
+			}
+		}
+		if result.Risks["ring_1"] <= result.Risks["ring_2"] {
+			t.Errorf("Expected risk to decay with distance from the seed, got %v", result.Risks)
+		}
+		for _, userID := range []string{"clean_1", "clean_2", "loner"} {
+			if result.Risks[userID] != 0 {
+				t.Errorf("Expected %s without a path to a seed to have no risk, got %f", userID, result.Risks[userID])
+			}
+		}
+		for userID, risk := range result.Risks {
+			if risk < 0 || risk > 1 {
+				t.Errorf("Expected risk of %s in [0, 1], got %f", userID, risk)
+			}
+		}
+	})
+
+	t.Run("MaxIterations", func(t *testing.T) {
+		options := options
+		options.MaxIterations = 1
+		graph := models.UserGraph{
+			Users: []models.GraphUser{{UserID: "a", MaliciousScore: 1}, {UserID: "b"}, {UserID: "c"}},
+			Edges: []models.GraphEdge{{From: "a", To: "b", Weight: 1}, {From: "b", To: "c", Weight: 1}},
+		}
+		if result := services.PropagateRisk(graph, options); result.Converged || result.Iterations != 1 {
+			t.Errorf("Expected propagation to stop unconverged after 1 iteration, got %+v", result)
+		}
+	})
+}
+
+func TestRiskPropagationJob(t *testing.T) {
+	ctx := context.Background()
+	logger := utils.NewLogger()
+	store := services.NewMemoryStore(logger)
+
+	store.SaveInteraction(ctx, models.NewInteraction("fraudster", "/api/a", 200, false, "1.1.1.1"))
+	store.SaveInteraction(ctx, models.NewInteraction("accomplice", "/api/a", 200, false, "2.2.2.2"))
+	store.SaveInteraction(ctx, models.NewInteraction("bystander", "/api/a", 200, false, "3.3.3.3"))
+	store.UpdateMaliciousScore(ctx, "fraudster", 0.95)
+	store.AssociatedWith(ctx, "fraudster", "accomplice")
+	store.AssociatedWith(ctx, "fraudster", "accomplice")
+
+	graph, err := store.ExportUserGraph(ctx)
+	if err != nil {
+		t.Fatalf("Failed to export graph: %v", err)
+	}
+	if len(graph.Users) != 3 || len(graph.Edges) != 1 {
+		t.Errorf("Expected 3 users and 1 deduplicated edge, got %+v", graph)
+	}
+
+	job := services.NewRiskPropagationJob(store, services.DefaultRiskPropagationOptions(), logger)
+	result, err := job.Run(ctx)
+	if err != nil {
+		t.Fatalf("Failed to propagate risk: %v", err)
+	}
+	if result.Seeds != 1 || job.LastResult() == nil {
+		t.Errorf("Unexpected result: %+v", result)
+	}
+
+	features, _ := store.ExtractFeatures(ctx, "accomplice")
+	if features.PropagatedRisk <= 0 || features.PropagatedRisk != result.Risks["accomplice"] {
+		t.Errorf("Expected the accomplice's propagated_risk to be saved, got %f", features.PropagatedRisk)
+	}
+	if features.ToMap()["propagated_risk"] != features.PropagatedRisk {
+		t.Error("Expected propagated_risk to be a named feature")
+	}
+	features, _ = store.ExtractFeatures(ctx, "bystander")
+	if features.PropagatedRisk != 0 {
+		t.Errorf("Expected the bystander to have no propagated risk, got %f", features.PropagatedRisk)
+	}
+}
@@ -0,0 +1,197 @@
+package test
+
+import (
+	"backend/handlers"
+	"backend/models"
+	"backend/services"
+	"backend/utils"
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// newFakeModelServer returns a Flask stand-in that always predicts the given score
+func newFakeModelServer(t *testing.T, score float64) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var features map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&features); err != nil {
+			t.Errorf("Fake model server received invalid JSON: %v", err)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"schema_version": models.PredictionSchemaVersion, "maliciousness_score": score})
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestAnalyzeUserPersistsScore(t *testing.T) {
+	ctx := context.Background()
+	logger := utils.NewLogger()
+	store := services.NewMemoryStore(logger)
+	server := newFakeModelServer(t, 0.75)
+	aiService := services.NewAIIntegrationService(server.URL, logger)
+	analysis := services.NewUserAnalysisService(store, aiService, logger)
+
+	userID := "scored_user"
+	store.SaveInteraction(ctx, models.NewInteraction(userID, "/api/endpoint1", 200, false, "1.1.1.1"))
+	store.SaveInteraction(ctx, models.NewInteraction(userID, "/api/endpoint2", 200, true, "2.2.2.2"))
+
+	for i := 0; i < 2; i++ {
+		if _, err := analysis.AnalyzeUser(ctx, userID); err != nil {
+			t.Fatalf("Failed to analyze user: %v", err)
+		}
+	}
+
+	score, err := store.GetMaliciousScore(ctx, userID)
+	if err != nil {
+		t.Fatalf("Failed to get malicious score: %v", err)
+	}
+	if score != 0.75 {
+		t.Errorf("Expected malicious score to be 0.75, got %f", score)
+	}
+
+	history, err := analysis.ScoreHistory(ctx, userID)
+	if err != nil {
+		t.Fatalf("Failed to get score history: %v", err)
+	}
+	if len(history) != 2 {
+		t.Fatalf("Expected 2 score snapshots, got %d", len(history))
+	}
+	snapshot := history[0]
+	if snapshot.Score != 0.75 || snapshot.ModelVersion != services.DefaultModelVersion {
+		t.Errorf("Unexpected snapshot: %+v", snapshot)
+	}
+	if snapshot.Features.TotalAccessCount != 2 || snapshot.Features.HoneytokenAccessCount != 1 {
+		t.Errorf("Expected snapshot to record the input features, got %+v", snapshot.Features)
+	}
+}
+
+// interleavingScorer runs during before delegating to Scorer
+type interleavingScorer struct {
+	services.Scorer
+	during func()
+}
+
+func (s interleavingScorer) Score(ctx context.Context, vector models.FeatureVector) (services.ScoreResult, error) {
+	s.during()
+	return s.Scorer.Score(ctx, vector)
+}
+
+func TestAnalyzeUserLeavesUserStaleForConcurrentInteractions(t *testing.T) {
+	ctx := context.Background()
+	logger := utils.NewLogger()
+	store := services.NewMemoryStore(logger)
+	store.SaveInteraction(ctx, models.NewInteraction("busy_user", "/a", 200, false, "1.1.1.1"))
+
+	// The interaction arrives after the features were read
+	scorer := interleavingScorer{services.NewHeuristicScorer(services.DefaultHeuristicWeights()), func() {
+		store.SaveInteraction(ctx, models.NewInteraction("busy_user", "/b", 200, false, "1.1.1.1"))
+	}}
+	if _, err := services.NewUserAnalysisService(store, scorer, logger).AnalyzeUser(ctx, "busy_user"); err != nil {
+		t.Fatalf("Failed to analyze user: %v", err)
+	}
+	if stale, _ := store.ListUserIDs(ctx, "", 10, true); len(stale) != 1 || stale[0] != "busy_user" {
+		t.Errorf("Expected the user to need another score, got stale users %v", stale)
+	}
+}
+
+func TestHeuristicScorer(t *testing.T) {
+	scorer := services.NewHeuristicScorer(services.DefaultHeuristicWeights())
+	ctx := context.Background()
+
+	result, err := scorer.Score(ctx, models.NewFeatureVector(models.UserFeatures{
+		TotalAccessCount:            50,
+		HoneytokenAccessCount:       25,
+		SharedIPCount:               5,
+		AvgAssociatedMaliciousScore: 0.5,
+	}))
+	if err != nil {
+		t.Fatalf("Failed to score features: %v", err)
+	}
+	// 0.4*0.5 + 0.3*0.5 + 0.2*0.5 + 0.1*0.5
+	if math.Abs(result.Score()-0.5) > 1e-9 || result.Scorer != "heuristic" || result.Prediction.ModelVersion != services.HeuristicModelVersion {
+		t.Errorf("Unexpected heuristic result: %+v", result)
+	}
+
+	// Counts beyond their caps are clamped, keeping the score within [0, 1]
+	result, _ = scorer.Score(ctx, models.NewFeatureVector(models.UserFeatures{
+		TotalAccessCount:            5000,
+		HoneytokenAccessCount:       5000,
+		SharedIPCount:               500,
+		AvgAssociatedMaliciousScore: 1,
+	}))
+	if math.Abs(result.Score()-1) > 1e-9 {
+		t.Errorf("Expected a saturated score of 1, got %f", result.Score())
+	}
+
+	result, _ = scorer.Score(ctx, models.NewFeatureVector(models.UserFeatures{}))
+	if result.Score() != 0 {
+		t.Errorf("Expected a user without activity to score 0, got %f", result.Score())
+	}
+}
+
+func TestAnalyzeUserFallsBackToHeuristic(t *testing.T) {
+	ctx := context.Background()
+	logger := utils.NewLogger()
+	store := services.NewMemoryStore(logger)
+
+	options := services.DefaultAIClientOptions()
+	options.MaxRetries = 0
+	remote := services.NewAIIntegrationServiceWithOptions("http://127.0.0.1:1", options, logger)
+	scorer := services.NewFallbackScorer(remote, services.NewHeuristicScorer(services.DefaultHeuristicWeights()), logger)
+	analysis := services.NewUserAnalysisService(store, scorer, logger)
+
+	userID := "fallback_user"
+	store.SaveInteraction(ctx, models.NewInteraction(userID, "/api/endpoint1", 200, true, "1.1.1.1"))
+
+	result, err := analysis.AnalyzeUser(ctx, userID)
+	if err != nil {
+		t.Fatalf("Expected the heuristic to score the user, got %v", err)
+	}
+	if result.Scorer != "heuristic" || result.ModelName != "heuristic" || result.FallbackReason == "" {
+		t.Errorf("Expected the response to name the fallback scorer and reason, got %+v", result)
+	}
+
+	history, _ := analysis.ScoreHistory(ctx, userID)
+	if len(history) != 1 || history[0].ModelVersion != services.HeuristicModelVersion {
+		t.Errorf("Expected the heuristic score to be recorded, got %+v", history)
+	}
+}
+
+func TestAnalyzeUserHandlerResponseShape(t *testing.T) {
+	ctx := context.Background()
+	logger := utils.NewLogger()
+	store := services.NewMemoryStore(logger)
+	server := newFakeModelServer(t, 0.3)
+	analysis := services.NewUserAnalysisService(store, services.NewAIIntegrationService(server.URL, logger), logger)
+	handler := handlers.NewUserAnalysisHandler(analysis, logger)
+
+	store.SaveInteraction(ctx, models.NewInteraction("shape_user", "/api/endpoint1", 200, false, "1.1.1.1"))
+
+	rec := httptest.NewRecorder()
+	handler.AnalyzeUser(rec, httptest.NewRequest(http.MethodPost, "/api/analyze-user", strings.NewReader(`{"user_id": "shape_user"}`)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var response map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	for _, key := range []string{"schema_version", "user_id", "maliciousness_score", "score_min", "score_max", "model_name", "model_version", "scorer", "features", "analyzed_at"} {
+		if _, ok := response[key]; !ok {
+			t.Errorf("Expected response to contain %q, got %v", key, response)
+		}
+	}
+	if response["maliciousness_score"] != 0.3 || response["scorer"] != "remote_model" || response["model_version"] != services.DefaultModelVersion {
+		t.Errorf("Unexpected response: %v", response)
+	}
+	if _, ok := response["fallback_reason"]; ok {
+		t.Errorf("Expected no fallback_reason without a fallback, got %v", response)
+	}
+}
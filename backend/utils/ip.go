@@ -0,0 +1,44 @@
+package utils
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// NormalizeIP strips any port and zone from an address and returns the IP in
+// canonical form, e.g. "[::1]:8080" becomes "::1" and "1.2.3.4:80" becomes "1.2.3.4"
+func NormalizeIP(address string) (string, error) {
+	address = strings.TrimSpace(address)
+	if host, _, err := net.SplitHostPort(address); err == nil {
+		address = host
+	}
+	address = strings.Trim(address, "[]")
+	if zone := strings.IndexByte(address, '%'); zone >= 0 {
+		address = address[:zone]
+	}
+
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return "", fmt.Errorf("invalid IP address: %q", address)
+	}
+	if v4 := ip.To4(); v4 != nil {
+		return v4.String(), nil
+	}
+	return ip.String(), nil
+}
+
+// IPSubnet returns the /24 network of an IPv4 address or the /64 network of
+// an IPv6 address in CIDR notation, e.g. "203.0.113.7:443" becomes
+// "203.0.113.0/24" and "2001:db8::1" becomes "2001:db8::/64"
+func IPSubnet(address string) (string, error) {
+	normalized, err := NormalizeIP(address)
+	if err != nil {
+		return "", err
+	}
+	ip := net.ParseIP(normalized)
+	if v4 := ip.To4(); v4 != nil {
+		return (&net.IPNet{IP: v4.Mask(net.CIDRMask(24, 32)), Mask: net.CIDRMask(24, 32)}).String(), nil
+	}
+	return (&net.IPNet{IP: ip.Mask(net.CIDRMask(64, 128)), Mask: net.CIDRMask(64, 128)}).String(), nil
+}
@@ -0,0 +1,140 @@
+package utils
+
+import (
+	"net"
+	"sort"
+)
+
+// IPTree maps IP networks to values for longest- and all-prefix lookups. It
+// is a path-compressed binary radix tree per address family: a node holds
+// the prefix shared by everything below it, so a lookup visits at most one
+// node per distinct prefix length on the path rather than one per bit.
+// An IPTree is not safe for concurrent writes; build it, then share it.
+type IPTree struct {
+	v4   *ipTreeNode
+	v6   *ipTreeNode
+	size int
+}
+
+type ipTreeNode struct {
+	prefix   []byte // Masked to bits
+	bits     int
+	children [2]*ipTreeNode
+	values   []string
+}
+
+// NewIPTree creates an empty IPTree
+func NewIPTree() *IPTree {
+	return &IPTree{
+		v4: &ipTreeNode{prefix: make([]byte, net.IPv4len)},
+		v6: &ipTreeNode{prefix: make([]byte, net.IPv6len)},
+	}
+}
+
+// Len returns the number of networks inserted
+func (t *IPTree) Len() int {
+	return t.size
+}
+
+// root returns the tree of the address family of ip and ip in its length
+func (t *IPTree) root(ip net.IP) (*ipTreeNode, net.IP) {
+	if ip4 := ip.To4(); ip4 != nil {
+		return t.v4, ip4
+	}
+	return t.v6, ip.To16()
+}
+
+// Insert adds value to network. IPv4 networks written as IPv4-mapped IPv6
+// are stored as IPv4.
+func (t *IPTree) Insert(network *net.IPNet, value string) {
+	ones, total := network.Mask.Size()
+	ip := network.IP.Mask(network.Mask)
+	if total == 8*net.IPv6len && ones >= 96 && ip.To4() != nil {
+		ones -= 96
+	}
+	node, key := t.root(ip)
+	t.size++
+
+	slot := &node
+	for {
+		n := *slot
+		common := commonPrefixBits(key, n.prefix, min(ones, n.bits))
+		if common < n.bits {
+			// The network branches off inside n's prefix: split n
+			split := &ipTreeNode{prefix: maskBits(key, common), bits: common}
+			split.children[bitAt(n.prefix, common)] = n
+			*slot = split
+			if common == ones {
+				split.values = append(split.values, value)
+			} else {
+				split.children[bitAt(key, common)] = &ipTreeNode{prefix: maskBits(key, ones), bits: ones, values: []string{value}}
+			}
+			return
+		}
+		if n.bits == ones {
+			n.values = append(n.values, value)
+			return
+		}
+		slot = &n.children[bitAt(key, n.bits)]
+		if *slot == nil {
+			*slot = &ipTreeNode{prefix: maskBits(key, ones), bits: ones, values: []string{value}}
+			return
+		}
+	}
+}
+
+// Lookup returns the distinct values of every network containing ip, sorted
+func (t *IPTree) Lookup(ip net.IP) []string {
+	if ip == nil {
+		return nil
+	}
+	node, key := t.root(ip)
+
+	seen := make(map[string]struct{})
+	for n := node; n != nil; {
+		if commonPrefixBits(key, n.prefix, n.bits) < n.bits {
+			break
+		}
+		for _, value := range n.values {
+			seen[value] = struct{}{}
+		}
+		if n.bits == 8*len(key) {
+			break
+		}
+		n = n.children[bitAt(key, n.bits)]
+	}
+	if len(seen) == 0 {
+		return nil
+	}
+	values := make([]string, 0, len(seen))
+	for value := range seen {
+		values = append(values, value)
+	}
+	sort.Strings(values)
+	return values
+}
+
+// bitAt returns bit i of key, counting from the most significant bit
+func bitAt(key []byte, i int) int {
+	return int(key[i/8]>>(7-i%8)) & 1
+}
+
+// commonPrefixBits returns how many leading bits, up to limit, a and b share
+func commonPrefixBits(a, b []byte, limit int) int {
+	for i := 0; i < limit; i++ {
+		if bitAt(a, i) != bitAt(b, i) {
+			return i
+		}
+	}
+	return limit
+}
+
+// maskBits returns a copy of key with all but its first bits cleared
+func maskBits(key []byte, bits int) []byte {
+	masked := make([]byte, len(key))
+	copy(masked, key)
+	for i := bits; i < 8*len(key); i++ {
+		masked[i/8] &^= 1 << (7 - i%8)
+	}
+	return masked
+}
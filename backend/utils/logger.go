@@ -1,39 +1,98 @@
 package utils
 
 import (
-	"log"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
 	"os"
+	"strings"
 )
 
-// Logger struct to hold loggers for different log levels
+// Logger is a leveled, structured logger built on log/slog. Messages take
+// key-value pairs, e.g. logger.Info("Saved interaction", "user_id", id).
 type Logger struct {
-	InfoLogger  *log.Logger
-	ErrorLogger *log.Logger
-	DebugLogger *log.Logger
+	logger *slog.Logger
+	level  *slog.LevelVar
 }
 
-// NewLogger initializes and returns a new Logger instance
+// NewLogger initializes and returns a new Logger writing text at info level to stdout
 func NewLogger() *Logger {
-	return &Logger{
-		InfoLogger:  log.New(os.Stdout, "INFO: ", log.Ldate|log.Ltime|log.Lshortfile),
-		ErrorLogger: log.New(os.Stderr, "ERROR: ", log.Ldate|log.Ltime|log.Lshortfile),
-		DebugLogger: log.New(os.Stdout, "DEBUG: ", log.Ldate|log.Ltime|log.Lshortfile),
+	logger, _ := NewLoggerWithOptions(os.Stdout, "text", "info")
+	return logger
+}
+
+// NewLoggerWithOptions returns a Logger writing to w in the given format
+// ("text" or "json") at the given level ("debug", "info", "warn" or "error")
+func NewLoggerWithOptions(w io.Writer, format, level string) (*Logger, error) {
+	levelVar := new(slog.LevelVar)
+	if err := setLevel(levelVar, level); err != nil {
+		return nil, err
 	}
+
+	options := &slog.HandlerOptions{Level: levelVar}
+	var handler slog.Handler
+	switch strings.ToLower(format) {
+	case "json":
+		handler = slog.NewJSONHandler(w, options)
+	case "text", "":
+		handler = slog.NewTextHandler(w, options)
+	default:
+		return nil, fmt.Errorf("unknown log format %q", format)
+	}
+
+	return &Logger{logger: slog.New(handler), level: levelVar}, nil
 }
 
 // Info logs informational messages
-func (l *Logger) Info(message string) {
-	l.InfoLogger.Println(message)
+func (l *Logger) Info(message string, args ...any) {
+	l.logger.Info(message, args...)
+}
+
+// Warn logs warning messages
+func (l *Logger) Warn(message string, args ...any) {
+	l.logger.Warn(message, args...)
 }
 
 // Error logs error messages
-func (l *Logger) Error(message string) {
-	l.ErrorLogger.Println(message)
+func (l *Logger) Error(message string, args ...any) {
+	l.logger.Error(message, args...)
+}
+
+// Debug logs debug messages, which are dropped unless the level is debug
+func (l *Logger) Debug(message string, args ...any) {
+	l.logger.Debug(message, args...)
+}
+
+// With returns a Logger that adds the given key-value pairs to every message
+func (l *Logger) With(args ...any) *Logger {
+	return &Logger{logger: l.logger.With(args...), level: l.level}
+}
+
+// WithContext returns a Logger that adds the request ID of ctx, if any
+func (l *Logger) WithContext(ctx context.Context) *Logger {
+	if requestID := RequestIDFromContext(ctx); requestID != "" {
+		return l.With("request_id", requestID)
+	}
+	return l
+}
+
+// Level returns the current minimum level
+func (l *Logger) Level() string {
+	return strings.ToLower(l.level.Level().String())
+}
+
+// SetLevel changes the minimum level at runtime. It affects every Logger
+// derived from this one with With or WithContext.
+func (l *Logger) SetLevel(level string) error {
+	return setLevel(l.level, level)
 }
 
-// Debug logs debug messages (only if debugging is enabled)
-func (l *Logger) Debug(message string, debugEnabled bool) {
-	if debugEnabled {
-		l.DebugLogger.Println(message)
+func setLevel(levelVar *slog.LevelVar, level string) error {
+	var parsed slog.Level
+	if err := parsed.UnmarshalText([]byte(level)); err != nil {
+		return fmt.Errorf("unknown log level %q", level)
 	}
+	levelVar.Set(parsed)
+	return nil
 }